@@ -0,0 +1,217 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// maxUserMetadataSize is the limit s3 places on the total size of the user metadata keys and values.
+const maxUserMetadataSize = 2 * 1024
+
+var (
+	// ErrInvalidAttr is returned when an attribute name or value can't be stored as s3 user metadata.
+	ErrInvalidAttr = errors.New("invalid attribute")
+	// ErrAttrsTooLarge is returned when the attributes of an object would exceed the 2KB s3 limit.
+	ErrAttrsTooLarge = errors.New("attributes exceed 2KB")
+)
+
+// WithAttrs sets the attributes stored as user metadata with a new object, so they are written
+// atomically with the data.
+//
+// Note:
+//   - s3 lowercases metadata keys, so names are lowercased and those which only differ by case are rejected.
+//   - Names and values are limited to printable US-ASCII, and their total size to 2KB.
+//   - This is the same as WithMetadata.
+func WithAttrs(attrs map[string]string) WriteOption {
+	return WithMetadata(attrs)
+}
+
+// GetAttrs returns the attributes of the named file, these are read from the user metadata of the
+// object with a single HeadObject.
+func (s3fs *S3FS) GetAttrs(name string) (map[string]string, error) {
+	res, err := s3fs.headAttrs(s3fs.context(), "getattr", name)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string]string, len(res.Metadata))
+	for k, v := range res.Metadata {
+		attrs[strings.ToLower(k)] = v
+	}
+
+	return attrs, nil
+}
+
+// SetAttr sets an attribute of the named file, replacing any existing value.
+//
+// Note:
+//   - s3 metadata can't be modified in place, so the object is copied over itself with the new
+//     metadata, which creates a new version in a versioned bucket.
+//   - The content type, other attributes, and headers such as Cache-Control are preserved.
+//   - The copy is conditional on the ETag read before it, so a concurrent write returns an error
+//     rather than being lost.
+//   - The object is copied with a single CopyObject so is limited to 5GiB.
+func (s3fs *S3FS) SetAttr(name, key, value string) error {
+	ctx := s3fs.context()
+
+	res, err := s3fs.headAttrs(ctx, "setattr", name)
+	if err != nil {
+		return err
+	}
+
+	key = strings.ToLower(key)
+
+	if existing, ok := res.Metadata[key]; ok && existing == value {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(res.Metadata)+1)
+	for k, v := range res.Metadata {
+		metadata[strings.ToLower(k)] = v
+	}
+	metadata[key] = value
+
+	return s3fs.replaceAttrs(ctx, "setattr", name, res, metadata)
+}
+
+// DelAttr removes an attribute from the named file, this is a no-op if the attribute isn't set.
+//
+// Note:
+//   - This has the same behaviour as SetAttr, the object is copied over itself with the new metadata.
+func (s3fs *S3FS) DelAttr(name, key string) error {
+	ctx := s3fs.context()
+
+	res, err := s3fs.headAttrs(ctx, "delattr", name)
+	if err != nil {
+		return err
+	}
+
+	key = strings.ToLower(key)
+
+	if _, ok := res.Metadata[key]; !ok {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(res.Metadata))
+	for k, v := range res.Metadata {
+		if k = strings.ToLower(k); k != key {
+			metadata[k] = v
+		}
+	}
+
+	return s3fs.replaceAttrs(ctx, "delattr", name, res, metadata)
+}
+
+func (s3fs *S3FS) headAttrs(ctx context.Context, op, name string) (*s3.HeadObjectOutput, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return headObject(ctx, s3fs.s3client, s3fs.bucket, op, name)
+}
+
+// replaceAttrs copies the object over itself replacing the user metadata, the headers which are
+// also replaced by the copy are carried over from res.
+func (s3fs *S3FS) replaceAttrs(ctx context.Context, op, name string, res *s3.HeadObjectOutput, metadata map[string]string) error {
+	metadata, err := normaliseAttrs(metadata)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	req := &s3.CopyObjectInput{
+		Bucket:             aws.String(s3fs.bucket),
+		Key:                aws.String(name),
+		CopySource:         copySource(s3fs.bucket, name, ""),
+		CopySourceIfMatch:  res.ETag,
+		MetadataDirective:  types.MetadataDirectiveReplace,
+		Metadata:           metadata,
+		ContentType:        res.ContentType,
+		CacheControl:       res.CacheControl,
+		ContentDisposition: res.ContentDisposition,
+		ContentEncoding:    res.ContentEncoding,
+		ContentLanguage:    res.ContentLanguage,
+		Expires:            res.Expires,
+		StorageClass:       res.StorageClass,
+	}
+
+	if res.ServerSideEncryption == types.ServerSideEncryptionAwsKms {
+		req.ServerSideEncryption = res.ServerSideEncryption
+		req.SSEKMSKeyId = res.SSEKMSKeyId
+		req.BucketKeyEnabled = res.BucketKeyEnabled
+	}
+
+	if _, err := s3fs.s3client.CopyObject(ctx, req); err != nil {
+		return pathError(op, name, err)
+	}
+
+	return nil
+}
+
+// normaliseAttrs returns the attributes with lowercase names, as they are stored by s3, checking
+// they are valid http headers and within the size limit for user metadata.
+func normaliseAttrs(attrs map[string]string) (map[string]string, error) {
+	if len(attrs) == 0 {
+		return attrs, nil
+	}
+
+	normalised := make(map[string]string, len(attrs))
+	size := 0
+
+	for k, v := range attrs {
+		lower := strings.ToLower(k)
+
+		if !validAttrName(lower) {
+			return nil, fmt.Errorf("%w: name %q", ErrInvalidAttr, k)
+		}
+		if !validAttrValue(v) {
+			return nil, fmt.Errorf("%w: value of %q must be printable US-ASCII", ErrInvalidAttr, k)
+		}
+		if _, ok := normalised[lower]; ok {
+			return nil, fmt.Errorf("%w: name %q differs from another only by case", ErrInvalidAttr, k)
+		}
+
+		normalised[lower] = v
+		size += len(lower) + len(v)
+	}
+
+	if size > maxUserMetadataSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrAttrsTooLarge, size)
+	}
+
+	return normalised, nil
+}
+
+// validAttrName reports whether the name is a valid http header token.
+func validAttrName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func validAttrValue(value string) bool {
+	for _, c := range value {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,167 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_Attrs(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+
+	srv, client := fakes3.NewServer(backend)
+	defer srv.Close()
+
+	s3fs := NewWithClient("fooBucket", client)
+
+	t.Run("written with the object", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.WriteFileResult("file.txt", []byte("data"), 0o644,
+			WithContentType("text/plain"),
+			WithAttrs(map[string]string{"Status": "pending", "source-sha256": "abc"}),
+		)
+		assert.NoError(err)
+
+		attrs, err := s3fs.GetAttrs("file.txt")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"status": "pending", "source-sha256": "abc"}, attrs)
+	})
+
+	t.Run("set and delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := s3fs.SetAttr("file.txt", "STATUS", "done")
+		assert.NoError(err)
+
+		attrs, err := s3fs.GetAttrs("file.txt")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"status": "done", "source-sha256": "abc"}, attrs)
+
+		err = s3fs.DelAttr("file.txt", "source-sha256")
+		assert.NoError(err)
+
+		attrs, err = s3fs.GetAttrs("file.txt")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"status": "done"}, attrs)
+
+		// the data and content type are preserved
+		obj := backend.Get("fooBucket", "file.txt")
+		assert.Equal("data", string(obj.Data))
+		assert.Equal("text/plain", obj.ContentType)
+	})
+
+	t.Run("headers are preserved", func(t *testing.T) {
+		assert := require.New(t)
+
+		expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		// the test server doesn't carry the headers, so the backend is used directly
+		direct := NewWithClient("fooBucket", backend)
+
+		_, err := direct.WriteFileResult("page.html", []byte("<html></html>"), 0o644,
+			WithCacheControl("max-age=60"),
+			WithExpires(expires),
+		)
+		assert.NoError(err)
+
+		assert.NoError(direct.SetAttr("page.html", "status", "done"))
+
+		obj := backend.Get("fooBucket", "page.html")
+		assert.Equal("max-age=60", obj.CacheControl)
+		assert.NotNil(obj.Expires)
+		assert.True(expires.Equal(*obj.Expires))
+	})
+
+	t.Run("unchanged attributes aren't copied", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		assert.NoError(s3fs.SetAttr("file.txt", "status", "done"))
+		assert.NoError(s3fs.DelAttr("file.txt", "missing"))
+		assert.Equal(0, backend.Calls("CopyObject"))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.GetAttrs("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		err = s3fs.SetAttr("missing.txt", "status", "done")
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("invalid attributes", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		err := s3fs.SetAttr("file.txt", "bad name", "value")
+		assert.ErrorIs(err, ErrInvalidAttr)
+
+		err = s3fs.SetAttr("file.txt", "status", "café")
+		assert.ErrorIs(err, ErrInvalidAttr)
+
+		err = s3fs.SetAttr("file.txt", "large", strings.Repeat("a", 2048))
+		assert.ErrorIs(err, ErrAttrsTooLarge)
+
+		_, err = s3fs.WriteFileResult("other.txt", []byte("data"), 0o644, WithAttrs(map[string]string{"Status": "a", "status": "b"}))
+		assert.ErrorIs(err, ErrInvalidAttr)
+
+		_, err = s3fs.WriteFrom("other.txt", strings.NewReader("data"), WithAttrs(map[string]string{"large": strings.Repeat("a", 2048)}))
+		assert.ErrorIs(err, ErrAttrsTooLarge)
+
+		assert.Equal(0, backend.Calls("CopyObject"))
+		assert.Equal(0, backend.Calls("PutObject"))
+	})
+
+	t.Run("concurrent write", func(t *testing.T) {
+		assert := require.New(t)
+
+		var written bool
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "CopyObject" && !written {
+				written = true
+				backend.Put("fooBucket", "file.txt", []byte("replaced"))
+			}
+			return nil
+		}
+		defer func() { backend.OnCall = nil }()
+
+		err := s3fs.SetAttr("file.txt", "status", "failed")
+
+		var apiErr smithy.APIError
+		assert.True(errors.As(err, &apiErr))
+		assert.Equal("PreconditionFailed", apiErr.ErrorCode())
+		assert.Equal("replaced", string(backend.Get("fooBucket", "file.txt").Data))
+	})
+}
+
+func Test_normaliseAttrs(t *testing.T) {
+	assert := require.New(t)
+
+	attrs, err := normaliseAttrs(map[string]string{"Content-Hash": "abc", "x_count": "1"})
+	assert.NoError(err)
+	assert.Equal(map[string]string{"content-hash": "abc", "x_count": "1"}, attrs)
+
+	// the limit includes the names
+	_, err = normaliseAttrs(map[string]string{"key": strings.Repeat("a", 2045)})
+	assert.NoError(err)
+	_, err = normaliseAttrs(map[string]string{"key": strings.Repeat("a", 2046)})
+	assert.ErrorIs(err, ErrAttrsTooLarge)
+
+	_, err = normaliseAttrs(map[string]string{"": "value"})
+	assert.ErrorIs(err, ErrInvalidAttr)
+
+	_, err = normaliseAttrs(map[string]string{"key": "line\nbreak"})
+	assert.ErrorIs(err, ErrInvalidAttr)
+}
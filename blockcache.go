@@ -0,0 +1,206 @@
+package s3iofs
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// WithBlockCache caches the data read by ReadAt in blocks of blockSize, shared by every file opened
+// from the filesystem, so readers which return to the same regions of a file, such as the footer of
+// a parquet file or the directory of a zip file, don't request them again. At most maxBytes of
+// blocks are kept with the least recently used removed first. This is disabled by default, and a
+// maxBytes smaller than the block size leaves it disabled.
+//
+// Note:
+//   - Reads are rounded out to whole blocks, the blocks missing from a read are fetched with a
+//     single ranged GetObject.
+//   - Blocks are keyed by the bucket, key and ETag of the file, so a file opened after the object
+//     is replaced doesn't see the old data. An object without an ETag is only keyed by its name.
+//   - Reads larger than maxBytes, and reads of files of unknown size, aren't cached.
+//   - Read and WriteTo don't use the cache, see WithReadAhead for sequential reads.
+func WithBlockCache(blockSize, maxBytes int64) Option {
+	return func(fo *fsOptions) {
+		if blockSize <= 0 || maxBytes < blockSize {
+			return
+		}
+		fo.blockSize = blockSize
+		fo.blockCacheBytes = maxBytes
+	}
+}
+
+// blockCache is a least recently used cache of the blocks of objects, which is safe for concurrent use.
+type blockCache struct {
+	blockSize int64
+	maxBytes  int64
+
+	mu      sync.Mutex
+	order   *list.List // most recently used at the front
+	entries map[blockKey]*list.Element
+	size    int64 // bytes held by the cached blocks
+}
+
+// blockKey identifies a block of a version of an object.
+type blockKey struct {
+	bucket string
+	key    string
+	etag   string
+	index  int64
+}
+
+type blockEntry struct {
+	key  blockKey
+	data []byte
+}
+
+func newBlockCache(blockSize, maxBytes int64) *blockCache {
+	return &blockCache{
+		blockSize: blockSize,
+		maxBytes:  maxBytes,
+		order:     list.New(),
+		entries:   map[blockKey]*list.Element{},
+	}
+}
+
+// get returns the cached block.
+func (c *blockCache) get(key blockKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*blockEntry).data, true
+}
+
+// put caches the block, removing the least recently used blocks until the cache is within maxBytes.
+func (c *blockCache) put(key blockKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another read fetched the same block at the same time
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&blockEntry{key: key, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*blockEntry)
+
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
+
+// readBlocks reads len(p) bytes from the offset of an object of the given size using the blocks of
+// the cache, the blocks which aren't cached are fetched with one ranged GetObject.
+func (s3f *s3File) readBlocks(p []byte, offset, size int64) (int, error) {
+	c := s3f.blocks
+
+	end := min(offset+int64(len(p)), size)
+	first, last := offset/c.blockSize, (end-1)/c.blockSize
+
+	key := blockKey{bucket: s3f.bucket, key: s3f.name, etag: s3f.openETag}
+
+	blocks := make([][]byte, last-first+1)
+	missing := -1 // index in blocks of the first block which isn't cached
+
+	for i := range blocks {
+		key.index = first + int64(i)
+
+		data, ok := c.get(key)
+		if ok {
+			blocks[i] = data
+			continue
+		}
+
+		if missing < 0 {
+			missing = i
+		}
+	}
+
+	if missing >= 0 {
+		// the blocks between the first and last missing block are fetched along with them, a run of
+		// cached blocks in the middle of a read is cheaper to read again than a second request
+		stop := len(blocks) - 1
+		for blocks[stop] != nil {
+			stop--
+		}
+
+		fetched, err := s3f.fetchBlocks(key, first+int64(missing), first+int64(stop), size)
+		if err != nil {
+			// the offset is past the end of the object, its size has changed
+			if isInvalidRange(err) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+
+		copy(blocks[missing:], fetched)
+	}
+
+	n := 0
+	for i, data := range blocks {
+		start := int64(0)
+		if i == 0 {
+			start = offset - first*c.blockSize
+		}
+		n += copy(p[n:], data[start:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// fetchBlocks fetches the blocks from first to last inclusive with a ranged GetObject pinned to the
+// file, and adds them to the cache.
+func (s3f *s3File) fetchBlocks(key blockKey, first, last, size int64) ([][]byte, error) {
+	c := s3f.blocks
+
+	start := first * c.blockSize
+	end := min((last+1)*c.blockSize, size)
+
+	res, err := s3f.s3client.GetObject(s3f.context(), s3f.rangeRequest(start, end-start))
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return nil, &fs.PathError{Op: opRead, Path: s3f.name, Err: ErrObjectChanged}
+		}
+		return nil, pathError(opRead, s3f.name, err)
+	}
+	defer res.Body.Close()
+
+	blocks := make([][]byte, 0, last-first+1)
+
+	for index := first; index <= last; index++ {
+		data := make([]byte, min(c.blockSize, size-index*c.blockSize))
+
+		if _, err := io.ReadFull(res.Body, data); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				err = fmt.Errorf("block %d is shorter than the size of the object: %w", index, io.ErrUnexpectedEOF)
+			}
+			return nil, pathError(opRead, s3f.name, err)
+		}
+
+		key.index = index
+		c.put(key, data)
+
+		blocks = append(blocks, data)
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,186 @@
+package s3iofs
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_BlockCache(t *testing.T) {
+	const blockSize = 4096
+
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	newFS := func(maxBytes int64) (*fakes3.Backend, *S3FS) {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "file.bin", data)
+		return backend, NewWithClient("fooBucket", backend, WithBlockCache(blockSize, maxBytes))
+	}
+
+	readAt := func(assert *require.Assertions, f io.ReaderAt, offset int64, length int) {
+		buf := make([]byte, length)
+		n, err := f.ReadAt(buf, offset)
+		assert.NoError(err)
+		assert.Equal(length, n)
+		assert.Equal(data[offset:offset+int64(length)], buf)
+	}
+
+	t.Run("partial block at the end of the object", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(1024 * 1024)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.ResetCalls()
+
+		buf := make([]byte, 100)
+		n, err := f.ReadAt(buf, 9950)
+		assert.ErrorIs(err, io.EOF)
+		assert.Equal(50, n)
+		assert.Equal(data[9950:], buf[:n])
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		// the last block is cached, including the bytes before the first read
+		readAt(assert, f, 8192, 1808)
+		readAt(assert, f, 9000, 500)
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		n, err = f.ReadAt(buf, 10000)
+		assert.ErrorIs(err, io.EOF)
+		assert.Zero(n)
+	})
+
+	t.Run("blocks are shared by open files", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(1024 * 1024)
+
+		f1, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f1.Close()
+
+		f2, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f2.Close()
+
+		backend.ResetCalls()
+
+		// a read across blocks fetches them with one request
+		readAt(assert, f1, 4000, 200)
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		readAt(assert, f2, 4000, 200)
+		readAt(assert, f2, 0, 10)
+		readAt(assert, f2, 8000, 100)
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		// only the missing last block is fetched
+		readAt(assert, f1, 0, len(data))
+		assert.Equal(2, backend.Calls("GetObject"))
+	})
+
+	t.Run("least recently used blocks are evicted", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(2 * blockSize)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.ResetCalls()
+
+		readAt(assert, f, 0, 10)
+		readAt(assert, f, blockSize, 10)
+		readAt(assert, f, 0, 10)
+		assert.Equal(2, backend.Calls("GetObject"))
+
+		// the second block is the least recently used
+		readAt(assert, f, 2*blockSize, 10)
+		assert.Equal(3, backend.Calls("GetObject"))
+
+		readAt(assert, f, 0, 10)
+		assert.Equal(3, backend.Calls("GetObject"))
+
+		readAt(assert, f, blockSize, 10)
+		assert.Equal(4, backend.Calls("GetObject"))
+
+		// reads larger than the cache aren't cached
+		readAt(assert, f, 0, len(data))
+		readAt(assert, f, 0, len(data))
+		assert.Equal(6, backend.Calls("GetObject"))
+	})
+
+	t.Run("replaced objects aren't served from the cache", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(1024 * 1024)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		readAt(assert, f, 0, 10)
+
+		backend.Put("fooBucket", "file.bin", bytes.Repeat([]byte("x"), len(data)))
+
+		f2, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f2.Close()
+
+		buf := make([]byte, 10)
+		_, err = f2.ReadAt(buf, 0)
+		assert.NoError(err)
+		assert.Equal(bytes.Repeat([]byte("x"), 10), buf)
+
+		// the file opened before the change can't read the new object
+		_, err = f.ReadAt(buf, blockSize)
+		assert.ErrorIs(err, ErrObjectChanged)
+	})
+
+	t.Run("concurrent reads", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, s3fs := newFS(2 * blockSize)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		var (
+			wg   sync.WaitGroup
+			errs = make(chan error, 8)
+		)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for offset := int64(i * 100); offset < 9000; offset += 997 {
+					buf := make([]byte, 1000)
+					n, err := f.ReadAt(buf, offset)
+					if err != nil {
+						errs <- err
+						return
+					}
+					assert.Equal(data[offset:offset+int64(n)], buf[:n])
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			assert.NoError(err)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var _ S3API = (*bucketErrorClient)(nil)
+
+// ErrBucketNotFound is matched by the error returned when the bucket of the filesystem doesn't exist,
+// or is in another region and s3 answers with a PermanentRedirect, the message includes the bucket name.
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// isBucketNotFound reports whether the error indicates the bucket doesn't exist or can't be reached
+// at the endpoint of the client, a HeadObject has no body so the redirect is only the status text.
+func isBucketNotFound(err error) bool {
+	var nsb *types.NoSuchBucket
+	if errors.As(err, &nsb) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchBucket", "PermanentRedirect", "MovedPermanently":
+			return true
+		}
+	}
+
+	return false
+}
+
+// bucketNotFoundError names the bucket which wasn't found, it matches ErrBucketNotFound and unwraps
+// to the error returned by the s3 client.
+type bucketNotFoundError struct {
+	bucket string
+	err    error
+}
+
+func (e *bucketNotFoundError) Error() string {
+	return fmt.Sprintf("bucket %q not found: %v", e.bucket, e.err)
+}
+
+func (e *bucketNotFoundError) Unwrap() error {
+	return e.err
+}
+
+func (e *bucketNotFoundError) Is(target error) bool {
+	return target == ErrBucketNotFound
+}
+
+// ErrWrongRegion is matched by the error returned by CheckAccess when the bucket is in another region
+// than the one the client is configured with.
+var ErrWrongRegion = errors.New("bucket in another region")
+
+// WrongRegionError is returned by CheckAccess when s3 redirects the request for the bucket to another
+// region, it matches ErrWrongRegion and unwraps to the error returned by the s3 client.
+type WrongRegionError struct {
+	Bucket string
+	// Region is the region of the bucket, from the x-amz-bucket-region header, it is empty if the
+	// response didn't include it.
+	Region string
+	err    error
+}
+
+func (e *WrongRegionError) Error() string {
+	if e.Region == "" {
+		return fmt.Sprintf("bucket %q is in another region: %v", e.Bucket, e.err)
+	}
+	return fmt.Sprintf("bucket %q is in region %s: %v", e.Bucket, e.Region, e.err)
+}
+
+func (e *WrongRegionError) Unwrap() error {
+	return e.err
+}
+
+func (e *WrongRegionError) Is(target error) bool {
+	return target == ErrWrongRegion
+}
+
+// CheckAccess checks the bucket exists and the credentials of the client can access it with a single
+// HeadBucket, so an application can fail at startup, or from a health check, rather than on its
+// first read.
+//
+// Note:
+//   - A missing bucket returns an error matching ErrBucketNotFound.
+//   - Credentials without access to the bucket return an error matching fs.ErrPermission.
+//   - A bucket in another region returns a *WrongRegionError, which matches ErrWrongRegion and
+//     includes the region of the bucket when s3 returns it.
+func (s3fs *S3FS) CheckAccess(ctx context.Context) error {
+	_, err := s3fs.s3client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s3fs.bucket),
+	})
+	if err == nil {
+		return nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	// a HeadBucket has no body so the errors are only the status code and text
+	var respErr *awshttp.ResponseError
+	errors.As(err, &respErr)
+
+	switch {
+	case isWrongRegion(err, respErr):
+		wre := &WrongRegionError{Bucket: s3fs.bucket, err: withResponseInfo(err)}
+		if respErr != nil && respErr.Response != nil {
+			wre.Region = respErr.Response.Header.Get("x-amz-bucket-region")
+		}
+		return wre
+	case isBucketNotFound(err), isNotFound(err), respErr != nil && respErr.HTTPStatusCode() == http.StatusNotFound:
+		return &bucketNotFoundError{bucket: s3fs.bucket, err: withResponseInfo(err)}
+	}
+
+	// an access denied error, or a 403 without a body, matches fs.ErrPermission
+	return withResponseInfo(err)
+}
+
+// isWrongRegion reports whether the error is a redirect to the region of the bucket.
+func isWrongRegion(err error, respErr *awshttp.ResponseError) bool {
+	if respErr != nil && respErr.HTTPStatusCode() == http.StatusMovedPermanently {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PermanentRedirect", "MovedPermanently":
+			return true
+		}
+	}
+
+	return false
+}
+
+// bucketErrorClient replaces the errors of calls made to a missing bucket with a bucketNotFoundError,
+// so every operation of the filesystem reports the bucket rather than a missing key.
+type bucketErrorClient struct {
+	inner S3API
+}
+
+// bucketError returns the error of a call to the bucket, the response details are kept in the message.
+func bucketError(bucket *string, err error) error {
+	if err == nil || !isBucketNotFound(err) {
+		return err
+	}
+	return &bucketNotFoundError{bucket: aws.ToString(bucket), err: withResponseInfo(err)}
+}
+
+func (c *bucketErrorClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	res, err := c.inner.GetObject(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	res, err := c.inner.ListObjectsV2(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	res, err := c.inner.HeadObject(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	res, err := c.inner.DeleteObject(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	res, err := c.inner.PutObject(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	res, err := c.inner.CopyObject(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	res, err := c.inner.DeleteObjects(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	res, err := c.inner.CreateMultipartUpload(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	res, err := c.inner.UploadPart(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	res, err := c.inner.UploadPartCopy(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	res, err := c.inner.CompleteMultipartUpload(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	res, err := c.inner.AbortMultipartUpload(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	res, err := c.inner.ListObjectVersions(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	res, err := c.inner.GetObjectTagging(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+func (c *bucketErrorClient) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	res, err := c.inner.PutObjectTagging(ctx, params, optFns...)
+	return res, bucketError(params.Bucket, err)
+}
+
+// HeadBucket is passed through as CheckAccess maps its errors itself.
+func (c *bucketErrorClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return c.inner.HeadBucket(ctx, params, optFns...)
+}
@@ -0,0 +1,175 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3FS_BucketNotFound(t *testing.T) {
+	missing := map[string]error{
+		"no such bucket":     &types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")},
+		"response error":     operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NoSuchBucket", Message: "The specified bucket does not exist"}),
+		"permanent redirect": operationError(301, "ABC123", &smithy.GenericAPIError{Code: "PermanentRedirect"}),
+	}
+
+	for name, bucketErr := range missing {
+		t.Run(name, func(t *testing.T) {
+			assert := require.New(t)
+
+			// a HeadObject of a missing bucket has no body, so it is indistinguishable from a missing key
+			mockClient := new(mockS3Client)
+			mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadObjectOutput)(nil), &types.NotFound{})
+			mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), bucketErr)
+			mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).Return((*s3.ListObjectsV2Output)(nil), bucketErr)
+			mockClient.On("PutObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.PutObjectOutput)(nil), bucketErr)
+
+			s3fs := NewWithClient("fooBucket", mockClient)
+
+			_, openErr := s3fs.Open("file.txt")
+			_, statErr := s3fs.Stat("file.txt")
+			_, readDirErr := s3fs.ReadDir("dir")
+
+			errs := map[string]error{
+				"open":     openErr,
+				"stat":     statErr,
+				"read dir": readDirErr,
+				"write":    s3fs.WriteFile("file.txt", []byte("data"), 0o644),
+			}
+
+			for op, err := range errs {
+				assert.ErrorIs(err, ErrBucketNotFound, op)
+				assert.NotErrorIs(err, fs.ErrNotExist, op)
+				assert.ErrorIs(err, bucketErr, op)
+				assert.ErrorContains(err, `bucket "fooBucket" not found`, op)
+
+				var pathErr *fs.PathError
+				assert.ErrorAs(err, &pathErr, op)
+			}
+		})
+	}
+}
+
+func TestS3FS_CheckAccess(t *testing.T) {
+	redirect := func(region string) error {
+		resp := &http.Response{StatusCode: 301, Header: http.Header{}}
+		if region != "" {
+			resp.Header.Set("x-amz-bucket-region", region)
+		}
+		return &smithy.OperationError{
+			ServiceID:     "S3",
+			OperationName: "HeadBucket",
+			Err: &awshttp.ResponseError{
+				ResponseError: &smithyhttp.ResponseError{
+					Response: &smithyhttp.Response{Response: resp},
+					Err:      &smithy.GenericAPIError{Code: "MovedPermanently", Message: "Moved Permanently"},
+				},
+				RequestID: "ABC123",
+			},
+		}
+	}
+
+	t.Run("bucket is accessible", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything, &s3.HeadBucketInput{Bucket: aws.String("fooBucket")}, mock.Anything).Return(&s3.HeadBucketOutput{}, nil)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		assert.NoError(s3fs.CheckAccess(context.Background()))
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("bucket not found", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NotFound", Message: "Not Found"}))
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.CheckAccess(context.Background())
+		assert.ErrorIs(err, ErrBucketNotFound)
+		assert.ErrorContains(err, `bucket "fooBucket" not found`)
+		assert.ErrorContains(err, "request id ABC123")
+		assert.NotErrorIs(err, fs.ErrPermission)
+	})
+
+	t.Run("access denied", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), operationError(403, "ABC123", &smithy.GenericAPIError{Code: "Forbidden", Message: "Forbidden"}))
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.CheckAccess(context.Background())
+		assert.ErrorIs(err, fs.ErrPermission)
+		assert.NotErrorIs(err, ErrBucketNotFound)
+
+		var re *ResponseError
+		assert.ErrorAs(err, &re)
+		assert.Equal(403, re.StatusCode)
+	})
+
+	t.Run("bucket in another region", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), redirect("eu-west-1"))
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.CheckAccess(context.Background())
+		assert.ErrorIs(err, ErrWrongRegion)
+		assert.NotErrorIs(err, ErrBucketNotFound)
+
+		var wre *WrongRegionError
+		assert.ErrorAs(err, &wre)
+		assert.Equal("fooBucket", wre.Bucket)
+		assert.Equal("eu-west-1", wre.Region)
+		assert.ErrorContains(err, `bucket "fooBucket" is in region eu-west-1`)
+	})
+
+	t.Run("redirect without a region", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), redirect(""))
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.CheckAccess(context.Background())
+
+		var wre *WrongRegionError
+		assert.ErrorAs(err, &wre)
+		assert.Empty(wre.Region)
+		assert.ErrorContains(err, `bucket "fooBucket" is in another region`)
+	})
+
+	t.Run("other errors are returned", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadBucket", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadBucketOutput)(nil), errors.New("connection refused"))
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.CheckAccess(context.Background())
+		assert.ErrorContains(err, "connection refused")
+		assert.NotErrorIs(err, ErrBucketNotFound)
+		assert.NotErrorIs(err, fs.ErrPermission)
+	})
+}
@@ -0,0 +1,343 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// maxDeleteBatch is the maximum number of keys accepted by a single DeleteObjects call.
+	maxDeleteBatch = 1000
+
+	defaultBulkConcurrency = 8
+)
+
+// ErrCancelled is matched by the error returned when a bulk operation stops because its context was cancelled.
+var ErrCancelled = errors.New("bulk operation cancelled")
+
+// CancelledError is returned when a bulk operation is stopped by its context, in flight
+// batches are finished before returning so Done and Failed describe the final state.
+type CancelledError struct {
+	// Done is the number of keys which were processed.
+	Done int64
+	// Failed is the number of keys which failed to process.
+	Failed int64
+	// Remaining are the keys which were found but not processed, this is only set by operations
+	// which list as they go, such as RemoveAll, so it doesn't include the keys which weren't listed.
+	Remaining []string
+	// Err is the error from the context.
+	Err error
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("%s after %d keys done, %d failed: %v", ErrCancelled, e.Done, e.Failed, e.Err)
+}
+
+func (e *CancelledError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrCancelled.
+func (e *CancelledError) Is(target error) bool {
+	return target == ErrCancelled
+}
+
+// KeyError describes the failure of a single key within a batch operation.
+type KeyError struct {
+	Key     string
+	Code    string
+	Message string
+	// Err is the request error when the whole batch failed, it is nil for per key failures reported by s3.
+	Err error
+}
+
+func (e KeyError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Key, e.Code, e.Message)
+}
+
+func (e KeyError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned when some keys in a batch operation such as a DeleteObjects call fail,
+// the keys which are not listed succeeded.
+type BatchError struct {
+	op     string
+	failed []KeyError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.failed) == 1 {
+		return fmt.Sprintf("batch failed for 1 key: %v", e.failed[0])
+	}
+	return fmt.Sprintf("batch failed for %d keys, first error: %v", len(e.failed), e.failed[0])
+}
+
+// Unwrap returns an *fs.PathError for each failed key, which wraps its KeyError, so each failure
+// can be matched with errors.As as it would be for a single file.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.failed))
+	for i, keyErr := range e.failed {
+		errs[i] = &fs.PathError{Op: e.op, Path: keyErr.Key, Err: keyErr}
+	}
+	return errs
+}
+
+// Failed returns the keys which failed along with the error code and message.
+func (e *BatchError) Failed() []KeyError {
+	return e.failed
+}
+
+// Keys returns the keys which failed.
+func (e *BatchError) Keys() []string {
+	keys := make([]string, len(e.failed))
+	for i, keyErr := range e.failed {
+		keys[i] = keyErr.Key
+	}
+	return keys
+}
+
+// BulkProgressFunc is called as each batch of a bulk operation completes, with the running
+// totals of keys done and failed, and the last key in the batch.
+type BulkProgressFunc func(done, failed int64, currentKey string)
+
+// BulkOption configures operations which act on many keys, such as RenameAll.
+type BulkOption func(*bulkOptions)
+
+type bulkOptions struct {
+	concurrency int
+	overwrite   bool
+	progress    BulkProgressFunc
+
+	// options used by CopyFS
+	deleteMissing  bool
+	irregularError bool
+	metadata       MetadataFunc
+
+	// options used by CopyToDir
+	include       []string
+	exclude       []string
+	skipUnchanged bool
+
+	mu     sync.Mutex
+	done   int64
+	failed int64
+}
+
+func newBulkOptions(opts []BulkOption) *bulkOptions {
+	bo := &bulkOptions{
+		concurrency: defaultBulkConcurrency,
+	}
+	for _, opt := range opts {
+		opt(bo)
+	}
+	return bo
+}
+
+// WithBulkConcurrency sets the number of requests a bulk operation has in flight at once, this defaults to 8.
+func WithBulkConcurrency(n int) BulkOption {
+	return func(bo *bulkOptions) {
+		if n > 0 {
+			bo.concurrency = n
+		}
+	}
+}
+
+// WithOverwrite allows a bulk operation to write into a destination prefix which already contains keys.
+func WithOverwrite() BulkOption {
+	return func(bo *bulkOptions) {
+		bo.overwrite = true
+	}
+}
+
+// WithBulkProgress registers a function which is called as each batch of a bulk operation completes.
+func WithBulkProgress(fn BulkProgressFunc) BulkOption {
+	return func(bo *bulkOptions) {
+		bo.progress = fn
+	}
+}
+
+// completed records the outcome of a batch and reports the running totals.
+func (bo *bulkOptions) completed(done, failed int, currentKey string) {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	bo.done += int64(done)
+	bo.failed += int64(failed)
+
+	if bo.progress != nil {
+		bo.progress(bo.done, bo.failed, currentKey)
+	}
+}
+
+// cancelled builds the error returned when the context of a bulk operation is done.
+func (bo *bulkOptions) cancelled(err error) *CancelledError {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	return &CancelledError{Done: bo.done, Failed: bo.failed, Err: err}
+}
+
+// cancelledWithFailures joins the error of a cancelled bulk operation with a *BatchError listing the
+// keys which failed the op before it stopped, if there were any.
+func cancelledWithFailures(op string, cancelErr *CancelledError, failed []KeyError) error {
+	if len(failed) == 0 {
+		return cancelErr
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Key < failed[j].Key })
+
+	return errors.Join(cancelErr, &BatchError{op: op, failed: failed})
+}
+
+// batches splits the slice into chunks of at most size elements.
+func batches[T any](items []T, size int) [][]T {
+	var res [][]T
+	for len(items) > 0 {
+		n := min(len(items), size)
+		res = append(res, items[:n])
+		items = items[n:]
+	}
+	return res
+}
+
+// dirPrefix returns the key prefix used to list the contents of the named directory.
+func dirPrefix(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+// listObjects returns every object under the prefix, without a delimiter, following continuation tokens.
+func (s3fs *S3FS) listObjects(ctx context.Context, prefix string) ([]types.Object, error) {
+	var (
+		objects []types.Object
+		token   *string
+	)
+
+	for {
+		listRes, err := s3fs.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s3fs.bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: token,
+			MaxKeys:           s3fs.opts.dir.maxKeys(0),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, listRes.Contents...)
+
+		if !aws.ToBool(listRes.IsTruncated) {
+			return objects, nil
+		}
+
+		token = listRes.NextContinuationToken
+	}
+}
+
+// hasKeys reports whether any object exists under the prefix.
+func (s3fs *S3FS) hasKeys(ctx context.Context, prefix string) (bool, error) {
+	listRes, err := s3fs.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s3fs.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return len(listRes.Contents) > 0, nil
+}
+
+// deleteKeys removes the keys using DeleteObjects batches, keys which could not be deleted are
+// reported with a *BatchError.
+func (s3fs *S3FS) deleteKeys(ctx context.Context, keys []string, bo *bulkOptions) error {
+	chunks := batches(keys, maxDeleteBatch)
+
+	var (
+		mu     sync.Mutex
+		failed []KeyError
+	)
+
+	runConcurrently(bo.concurrency, len(chunks), func(i int) {
+		batch := chunks[i]
+
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for j, key := range batch {
+			objects[j] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		res, err := s3fs.s3client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s3fs.bucket),
+			Delete: &types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			code := ""
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) {
+				code = apiErr.ErrorCode()
+			}
+
+			for _, key := range batch {
+				failed = append(failed, KeyError{Key: key, Code: code, Message: err.Error(), Err: err})
+			}
+			return
+		}
+
+		for _, keyErr := range res.Errors {
+			failed = append(failed, KeyError{
+				Key:     aws.ToString(keyErr.Key),
+				Code:    aws.ToString(keyErr.Code),
+				Message: aws.ToString(keyErr.Message),
+			})
+		}
+	})
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Key < failed[j].Key })
+
+	return &BatchError{op: "remove", failed: failed}
+}
+
+// runConcurrently calls fn for each index in [0, n) with at most concurrency calls in flight.
+func runConcurrently(concurrency, n int, fn func(i int)) {
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, concurrency)
+
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,109 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_deleteKeys(t *testing.T) {
+	t.Run("mixed success reports the failed keys", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("DeleteObjects", mock.Anything, mock.Anything, mock.Anything).Return(&s3.DeleteObjectsOutput{
+			Deleted: []types.DeletedObject{{Key: aws.String("a.txt")}},
+			Errors: []types.Error{
+				{Key: aws.String("c.txt"), Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")},
+				{Key: aws.String("b.txt"), Code: aws.String("InternalError"), Message: aws.String("We encountered an internal error.")},
+			},
+		}, nil).Once()
+
+		sysfs := NewWithClient("fooBucket", mockClient)
+
+		err := sysfs.deleteKeys(context.Background(), []string{"a.txt", "b.txt", "c.txt"}, newBulkOptions(nil))
+
+		var batchErr *BatchError
+		assert.ErrorAs(err, &batchErr)
+		assert.Equal([]KeyError{
+			{Key: "b.txt", Code: "InternalError", Message: "We encountered an internal error."},
+			{Key: "c.txt", Code: "AccessDenied", Message: "Access Denied"},
+		}, batchErr.Failed())
+		assert.Equal([]string{"b.txt", "c.txt"}, batchErr.Keys())
+		assert.Len(batchErr.Unwrap(), 2)
+
+		var keyErr KeyError
+		assert.ErrorAs(err, &keyErr)
+		assert.Equal("b.txt", keyErr.Key)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("failed request reports every key in the batch", func(t *testing.T) {
+		assert := require.New(t)
+
+		apiErr := &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}
+
+		mockClient := new(mockS3Client)
+		mockClient.On("DeleteObjects", mock.Anything, mock.Anything, mock.Anything).Return((*s3.DeleteObjectsOutput)(nil), apiErr).Once()
+
+		sysfs := NewWithClient("fooBucket", mockClient)
+
+		err := sysfs.deleteKeys(context.Background(), []string{"a.txt", "b.txt"}, newBulkOptions(nil))
+
+		var batchErr *BatchError
+		assert.ErrorAs(err, &batchErr)
+		assert.Equal([]string{"a.txt", "b.txt"}, batchErr.Keys())
+		assert.Equal("SlowDown", batchErr.Failed()[0].Code)
+		assert.True(errors.Is(err, apiErr))
+	})
+
+	t.Run("keys are split into batches of 1000", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		keys := make([]string, 2001)
+		for i := range keys {
+			keys[i] = string(rune('a'+i%26)) + "/" + string(rune('a'+i/26%26)) + "/" + string(rune('a'+i/676))
+			backend.Put("fooBucket", keys[i], nil)
+		}
+
+		sysfs := NewWithClient("fooBucket", backend)
+
+		err := sysfs.deleteKeys(context.Background(), keys, newBulkOptions(nil))
+		assert.NoError(err)
+		assert.Equal(3, backend.Calls("DeleteObjects"))
+		assert.Empty(backend.Keys("fooBucket"))
+	})
+}
+
+func TestS3FS_RenameAllProtectedKeys(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "src/a.txt", []byte("a"))
+	backend.Put("fooBucket", "src/locked.txt", []byte("locked"))
+	backend.Protect("fooBucket", "src/locked.txt")
+
+	sysfs := NewWithClient("fooBucket", backend)
+
+	err := sysfs.RenameAll(context.Background(), "src", "dst")
+
+	var renameErr *RenameError
+	assert.ErrorAs(err, &renameErr)
+	assert.Equal([]string{"src/locked.txt"}, renameErr.CopiedNotDeleted)
+
+	var batchErr *BatchError
+	assert.ErrorAs(err, &batchErr)
+	assert.Equal([]KeyError{{Key: "src/locked.txt", Code: "AccessDenied", Message: "Access Denied because object protected by object lock."}}, batchErr.Failed())
+}
@@ -0,0 +1,68 @@
+package s3iofs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var (
+	// ErrChecksumMismatch is matched by the error returned when s3 rejects an upload because the
+	// data it received doesn't match the checksum sent with it, see WithChecksumAlgorithm.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrInvalidChecksumAlgorithm is returned when a write is given a checksum algorithm which isn't
+	// known to s3.
+	ErrInvalidChecksumAlgorithm = errors.New("invalid checksum algorithm")
+)
+
+// WithChecksumAlgorithm sets the algorithm, such as CRC32C or SHA256, of the checksum sent with the
+// data so s3 verifies it was received intact and stores the checksum with the object.
+//
+// Note:
+//   - The checksum is computed by the sdk, for multipart uploads each part carries its own checksum
+//     and s3 stores a checksum of the part checksums.
+//   - If s3 computes a different checksum the write fails with an error matching ErrChecksumMismatch.
+func WithChecksumAlgorithm(algorithm types.ChecksumAlgorithm) WriteOption {
+	return func(wo *writeOptions) {
+		wo.checksumAlgorithm = algorithm
+	}
+}
+
+// validateChecksumAlgorithm checks the algorithm is known to the sdk, an empty algorithm is left to the sdk.
+func validateChecksumAlgorithm(algorithm types.ChecksumAlgorithm) error {
+	if algorithm == "" {
+		return nil
+	}
+
+	valid := algorithm.Values()
+	if !slices.Contains(valid, algorithm) {
+		return fmt.Errorf("%w: %q must be one of %v", ErrInvalidChecksumAlgorithm, algorithm, valid)
+	}
+
+	return nil
+}
+
+// completedPart returns the part to list in CompleteMultipartUpload, s3 requires the checksums of
+// the parts when the upload has a checksum algorithm.
+func completedPart(partNumber int32, res *s3.UploadPartOutput) types.CompletedPart {
+	return types.CompletedPart{
+		ETag:           res.ETag,
+		PartNumber:     &partNumber,
+		ChecksumCRC32:  res.ChecksumCRC32,
+		ChecksumCRC32C: res.ChecksumCRC32C,
+		ChecksumSHA1:   res.ChecksumSHA1,
+		ChecksumSHA256: res.ChecksumSHA256,
+	}
+}
+
+// isChecksumMismatch reports whether the s3 error code indicates the data didn't match its checksum.
+func isChecksumMismatch(code string) bool {
+	switch code {
+	case "BadDigest", "InvalidDigest", "XAmzContentChecksumMismatch", "XAmzContentSHA256Mismatch":
+		return true
+	}
+	return false
+}
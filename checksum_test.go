@@ -0,0 +1,101 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_WriteChecksum(t *testing.T) {
+	t.Run("put object", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+			return params.ChecksumAlgorithm == types.ChecksumAlgorithmCrc32c
+		}), mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		_, err := s3fs.WriteFileResult("file.txt", []byte("data"), 0o644, WithChecksumAlgorithm(types.ChecksumAlgorithmCrc32c))
+		assert.NoError(err)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		var algorithms []types.ChecksumAlgorithm
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if in, ok := input.(*s3.UploadPartInput); ok {
+				algorithms = append(algorithms, in.ChecksumAlgorithm)
+			}
+			return nil
+		}
+
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(DefaultPartSize), WithUploadConcurrency(1))
+
+		// the backend rejects the upload unless the part checksums are sent with the completion
+		err := s3fs.WriteReader("large.bin", bytes.NewReader(make([]byte, DefaultPartSize+1)), -1,
+			WithChecksumAlgorithm(types.ChecksumAlgorithmSha256))
+		assert.NoError(err)
+
+		assert.Equal([]types.ChecksumAlgorithm{types.ChecksumAlgorithmSha256, types.ChecksumAlgorithmSha256}, algorithms)
+		assert.Len(backend.Get("fooBucket", "large.bin").Data, DefaultPartSize+1)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.PutObjectOutput)(nil),
+			operationError(400, "ABC123", &smithy.GenericAPIError{
+				Code:    "BadDigest",
+				Message: "The CRC32C you specified did not match the calculated checksum.",
+			})).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		_, err := s3fs.WriteFileResult("file.txt", []byte("data"), 0o644, WithChecksumAlgorithm(types.ChecksumAlgorithmCrc32c))
+		assert.ErrorIs(err, ErrChecksumMismatch)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("file.txt", pathErr.Path)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("invalid algorithm", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs := NewWithClient("fooBucket", new(mockS3Client))
+
+		_, err := s3fs.WriteFileResult("file.txt", []byte("data"), 0o644, WithChecksumAlgorithm("MD5"))
+		assert.ErrorIs(err, ErrInvalidChecksumAlgorithm)
+	})
+}
+
+func TestResponseError_Is(t *testing.T) {
+	assert := require.New(t)
+
+	err := pathError("write", "file.txt", operationError(400, "ABC123", &smithy.GenericAPIError{Code: "AccessDenied"}))
+	assert.NotErrorIs(err, ErrChecksumMismatch)
+
+	err = pathError("write", "file.txt", operationError(400, "ABC123", &smithy.GenericAPIError{Code: "XAmzContentChecksumMismatch"}))
+	assert.ErrorIs(err, ErrChecksumMismatch)
+	assert.Equal("file.txt", err.Path)
+}
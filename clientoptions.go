@@ -0,0 +1,120 @@
+package s3iofs
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var _ S3API = (*optionsClient)(nil)
+
+type clientOptionsKey struct{}
+
+// WithClientOptions adds functions which modify the s3.Options of every call made by the filesystem,
+// such as s3.WithAPIOptions to add middleware.
+func WithClientOptions(fns ...func(*s3.Options)) Option {
+	return func(fo *fsOptions) {
+		fo.clientOptions = append(fo.clientOptions, fns...)
+	}
+}
+
+// ContextWithClientOptions returns a context which adds the functions to the s3.Options of the calls
+// made using it, these are applied after those passed to WithClientOptions.
+//
+// This is used with methods which accept a context, for example to use different credentials for a
+// single RenameAll.
+func ContextWithClientOptions(ctx context.Context, fns ...func(*s3.Options)) context.Context {
+	existing, _ := ctx.Value(clientOptionsKey{}).([]func(*s3.Options))
+
+	merged := make([]func(*s3.Options), 0, len(existing)+len(fns))
+	merged = append(merged, existing...)
+	merged = append(merged, fns...)
+
+	return context.WithValue(ctx, clientOptionsKey{}, merged)
+}
+
+// optionsClient forwards the client options of the filesystem and the context to each call.
+type optionsClient struct {
+	inner         S3API
+	clientOptions []func(*s3.Options)
+}
+
+// optFns returns the options for a call, in the order filesystem, context then those passed by the caller.
+func (c *optionsClient) optFns(ctx context.Context, optFns []func(*s3.Options)) []func(*s3.Options) {
+	ctxOptions, _ := ctx.Value(clientOptionsKey{}).([]func(*s3.Options))
+
+	if len(c.clientOptions) == 0 && len(ctxOptions) == 0 {
+		return optFns
+	}
+
+	fns := make([]func(*s3.Options), 0, len(c.clientOptions)+len(ctxOptions)+len(optFns))
+	fns = append(fns, c.clientOptions...)
+	fns = append(fns, ctxOptions...)
+	fns = append(fns, optFns...)
+
+	return fns
+}
+
+func (c *optionsClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return c.inner.GetObject(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return c.inner.ListObjectsV2(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return c.inner.HeadObject(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return c.inner.DeleteObject(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return c.inner.PutObject(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return c.inner.CopyObject(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return c.inner.DeleteObjects(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return c.inner.CreateMultipartUpload(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return c.inner.UploadPart(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	return c.inner.UploadPartCopy(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return c.inner.CompleteMultipartUpload(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return c.inner.AbortMultipartUpload(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	return c.inner.ListObjectVersions(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return c.inner.GetObjectTagging(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	return c.inner.PutObjectTagging(ctx, params, c.optFns(ctx, optFns)...)
+}
+
+func (c *optionsClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return c.inner.HeadBucket(ctx, params, c.optFns(ctx, optFns)...)
+}
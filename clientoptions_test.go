@@ -0,0 +1,105 @@
+package s3iofs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// withRegion returns a client option which sets the region.
+func withRegion(region string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.Region = region
+	}
+}
+
+// regionOf applies the client options and returns the resulting region.
+func regionOf(optFns []func(*s3.Options)) string {
+	var o s3.Options
+	for _, fn := range optFns {
+		fn(&o)
+	}
+	return o.Region
+}
+
+func hasRegion(region string) any {
+	return mock.MatchedBy(func(optFns []func(*s3.Options)) bool {
+		return regionOf(optFns) == region
+	})
+}
+
+func TestS3FS_WithClientOptions(t *testing.T) {
+	t.Run("forwarded to every call", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.Anything, hasRegion("ap-southeast-2")).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(strings.NewReader("data")),
+			ContentLength: aws.Int64(4),
+		}, nil)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "file.txt/"
+		}), hasRegion("ap-southeast-2")).Return(&s3.ListObjectsV2Output{}, nil)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, hasRegion("ap-southeast-2")).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+		}, nil)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, hasRegion("ap-southeast-2")).Return(&s3.HeadObjectOutput{}, nil)
+		mockClient.On("PutObject", mock.Anything, mock.Anything, hasRegion("ap-southeast-2")).Return(&s3.PutObjectOutput{}, nil)
+		mockClient.On("DeleteObject", mock.Anything, mock.Anything, hasRegion("ap-southeast-2")).Return(&s3.DeleteObjectOutput{}, nil)
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithClientOptions(withRegion("ap-southeast-2")))
+
+		_, err := fs.ReadFile(s3fs, "file.txt")
+		assert.NoError(err)
+
+		_, err = s3fs.ReadDir(".")
+		assert.NoError(err)
+
+		_, err = s3fs.StatObject("file.txt")
+		assert.NoError(err)
+
+		err = s3fs.WriteFile("file.txt", []byte("data"), 0644)
+		assert.NoError(err)
+
+		err = s3fs.Remove("file.txt")
+		assert.NoError(err)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("context options are applied last", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, hasRegion("eu-west-1")).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("file.txt")}},
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, hasRegion("ap-southeast-2")).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("file.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithClientOptions(withRegion("ap-southeast-2")))
+
+		ctx := ContextWithClientOptions(context.Background(), withRegion("eu-west-1"))
+
+		noop := func(entries []fs.DirEntry, lastPage bool) error { return nil }
+
+		// per call options override the filesystem options
+		err := s3fs.ReadDirPages(ctx, ".", 0, noop)
+		assert.NoError(err)
+
+		// only calls using the context are affected
+		err = s3fs.ReadDirPages(context.Background(), ".", 0, noop)
+		assert.NoError(err)
+
+		mockClient.AssertExpectations(t)
+	})
+}
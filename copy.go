@@ -0,0 +1,353 @@
+package s3iofs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// maxCopyObjectSize is the largest object which can be copied with a single CopyObject call.
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+	defaultCopyPartSize = 512 * 1024 * 1024
+)
+
+// WithCopyThreshold sets the size in bytes above which objects are copied with a multipart copy
+// rather than a single CopyObject, this defaults to 5GiB which is the largest object CopyObject
+// accepts, so larger thresholds are reduced to this.
+func WithCopyThreshold(n int64) Option {
+	return func(fo *fsOptions) {
+		if n > 0 {
+			fo.copyThreshold = min(n, maxCopyObjectSize)
+		}
+	}
+}
+
+// WithCopyPartSize sets the size in bytes of the parts of a multipart copy, this defaults to 512MiB
+// and must be at least 5MiB. Objects which would need more than 10000 parts use larger parts.
+func WithCopyPartSize(n int64) Option {
+	return func(fo *fsOptions) {
+		if n >= DefaultPartSize {
+			fo.copyPartSize = n
+		}
+	}
+}
+
+// copySource builds the url encoded CopySource value for an object in the bucket.
+func copySource(bucket, key, versionID string) *string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	source := bucket + "/" + strings.Join(segments, "/")
+	if versionID != "" {
+		source += "?versionId=" + url.QueryEscape(versionID)
+	}
+
+	return aws.String(source)
+}
+
+// inherit fills in the Content-Type, metadata and headers which the options don't set from the
+// HeadObject of the source, as a copy with options replaces all of them.
+func (wo *writeOptions) inherit(headRes *s3.HeadObjectOutput) {
+	if wo.contentType == "" {
+		wo.contentType = aws.ToString(headRes.ContentType)
+	}
+	if len(wo.metadata) == 0 {
+		wo.metadata = headRes.Metadata
+	}
+	if wo.cacheControl == "" {
+		wo.cacheControl = aws.ToString(headRes.CacheControl)
+	}
+	if wo.contentDisposition == "" {
+		wo.contentDisposition = aws.ToString(headRes.ContentDisposition)
+	}
+	if wo.contentEncoding == "" {
+		wo.contentEncoding = aws.ToString(headRes.ContentEncoding)
+	}
+	if wo.expires.IsZero() {
+		wo.expires = aws.ToTime(headRes.Expires)
+	}
+}
+
+// Copy copies the named file to dst with a server side copy, the data isn't transferred through
+// this process.
+//
+// Note:
+//   - Without options the metadata, Content-Type and tags of src are copied to dst.
+//   - With options the metadata, headers and tags of src are kept unless the options replace them,
+//     so WithStorageClass or WithSSEKMS only change the storage of dst, while
+//     WithMetadata replaces all the metadata and WithCacheControl only the Cache-Control header.
+//   - src and dst may be the same, with options this updates the metadata of the file in place.
+//   - An existing dst is replaced.
+//   - Errors are returned as a *fs.PathError for dst, the message names src.
+func (s3fs *S3FS) Copy(src, dst string, opts ...WriteOption) error {
+	return s3fs.CopyContext(s3fs.context(), src, dst, opts...)
+}
+
+// CopyContext copies the named file to dst with a server side copy, using the context for the
+// requests. Cancelling the context stops a multipart copy between parts and aborts the upload.
+func (s3fs *S3FS) CopyContext(ctx context.Context, src, dst string, opts ...WriteOption) error {
+	if !fs.ValidPath(src) || src == "." {
+		return &fs.PathError{Op: "copy", Path: dst, Err: fmt.Errorf("source %s: %w", src, fs.ErrInvalid)}
+	}
+	if !fs.ValidPath(dst) || dst == "." {
+		return &fs.PathError{Op: "copy", Path: dst, Err: fs.ErrInvalid}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &fs.PathError{Op: "copy", Path: dst, Err: err}
+	}
+
+	headRes, err := s3fs.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(src),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			err = fs.ErrNotExist
+		}
+		return &fs.PathError{Op: "copy", Path: dst, Err: fmt.Errorf("source %s: %w", src, withResponseInfo(err))}
+	}
+
+	if len(opts) == 0 {
+		// s3 rejects copying an object onto itself without changing it
+		if src == dst {
+			return nil
+		}
+
+		obj := types.Object{Key: aws.String(src), Size: headRes.ContentLength, ETag: headRes.ETag}
+		if err := s3fs.copyObject(ctx, obj, dst); err != nil {
+			return &fs.PathError{Op: "copy", Path: dst, Err: fmt.Errorf("source %s: %w", src, withResponseInfo(err))}
+		}
+
+		return nil
+	}
+
+	wo, err := s3fs.newWriteOptions(opts)
+	if err != nil {
+		return &fs.PathError{Op: "copy", Path: dst, Err: err}
+	}
+
+	wo.inherit(headRes)
+
+	if size := aws.ToInt64(headRes.ContentLength); size > s3fs.opts.copyThreshold {
+		if _, err := s3fs.multipartCopy(ctx, src, dst, aws.ToString(headRes.ETag), size, s3fs.copyPartSize(size), wo); err != nil {
+			return &fs.PathError{Op: "copy", Path: dst, Err: fmt.Errorf("source %s: %w", src, withResponseInfo(err))}
+		}
+
+		return nil
+	}
+
+	req := &s3.CopyObjectInput{
+		Bucket:     aws.String(s3fs.bucket),
+		Key:        aws.String(dst),
+		CopySource: copySource(s3fs.bucket, src, ""),
+	}
+
+	wo.applyCopyObject(req)
+
+	if _, err := s3fs.s3client.CopyObject(ctx, req); err != nil {
+		return &fs.PathError{Op: "copy", Path: dst, Err: fmt.Errorf("source %s: %w", src, withResponseInfo(err))}
+	}
+
+	return nil
+}
+
+// copyObject copies the object to the destination key server side, using a multipart copy for
+// objects which are too large for CopyObject, then verifies the destination matches the source.
+func (s3fs *S3FS) copyObject(ctx context.Context, src types.Object, dstKey string) error {
+	srcKey := aws.ToString(src.Key)
+	size := aws.ToInt64(src.Size)
+
+	var (
+		etag string
+		err  error
+	)
+
+	if size > s3fs.opts.copyThreshold {
+		etag, err = s3fs.multipartCopy(ctx, srcKey, dstKey, aws.ToString(src.ETag), size, s3fs.copyPartSize(size), nil)
+	} else {
+		etag, err = s3fs.singleCopy(ctx, srcKey, dstKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	// a single part copy of a single part object retains the ETag
+	if etag != "" && etag == aws.ToString(src.ETag) {
+		return nil
+	}
+
+	headRes, err := s3fs.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(dstKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	if aws.ToInt64(headRes.ContentLength) != size {
+		return fmt.Errorf("copy of %s to %s has size %d, expected %d", srcKey, dstKey, aws.ToInt64(headRes.ContentLength), size)
+	}
+
+	return nil
+}
+
+func (s3fs *S3FS) singleCopy(ctx context.Context, srcKey, dstKey string) (string, error) {
+	res, err := s3fs.s3client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s3fs.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: copySource(s3fs.bucket, srcKey, ""),
+		// the metadata, content type and tags of the source are kept
+		MetadataDirective: types.MetadataDirectiveCopy,
+		TaggingDirective:  types.TaggingDirectiveCopy,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if res.CopyObjectResult == nil {
+		return "", nil
+	}
+
+	return aws.ToString(res.CopyObjectResult.ETag), nil
+}
+
+// copyPartSize returns the part size used to copy an object of the given size.
+func (s3fs *S3FS) copyPartSize(size int64) int64 {
+	return fitPartSize(size, s3fs.opts.copyPartSize)
+}
+
+// multipartCopy copies the object in ranges of partSize using UploadPartCopy, aborting the upload on
+// failure. Without write options the destination is given the metadata and headers of the source,
+// the tags of the source are copied unless the options replace them. Each part is copied with the
+// ETag of the source as CopySourceIfMatch, so replacing the source part way through fails the copy
+// with ErrObjectChanged rather than mixing the parts of two objects, an empty ETag is taken from
+// the HeadObject of the source.
+func (s3fs *S3FS) multipartCopy(ctx context.Context, srcKey, dstKey, srcETag string, size, partSize int64, wo *writeOptions) (string, error) {
+	if wo == nil || srcETag == "" {
+		headRes, err := s3fs.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(s3fs.bucket),
+			Key:    aws.String(srcKey),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if srcETag == "" {
+			srcETag = aws.ToString(headRes.ETag)
+		}
+		if wo == nil {
+			wo = &writeOptions{}
+			wo.inherit(headRes)
+		}
+	}
+
+	// unlike CopyObject, a multipart copy doesn't copy the tags of the source
+	if len(wo.tags) == 0 {
+		tagRes, err := s3fs.s3client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+			Bucket: aws.String(s3fs.bucket),
+			Key:    aws.String(srcKey),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, tag := range tagRes.TagSet {
+			if wo.tags == nil {
+				wo.tags = make(map[string]string, len(tagRes.TagSet))
+			}
+			wo.tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+
+	req := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(dstKey),
+	}
+
+	wo.applyCreateMultipartUpload(req)
+
+	createRes, err := s3fs.s3client.CreateMultipartUpload(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []types.CompletedPart
+
+	for offset, partNumber := int64(0), int32(1); offset < size; offset, partNumber = offset+partSize, partNumber+1 {
+		if err := ctx.Err(); err != nil {
+			s3fs.abortUpload(dstKey, createRes.UploadId)
+			return "", err
+		}
+
+		end := min(offset+partSize, size) - 1
+
+		partReq := &s3.UploadPartCopyInput{
+			Bucket:          aws.String(s3fs.bucket),
+			Key:             aws.String(dstKey),
+			UploadId:        createRes.UploadId,
+			PartNumber:      aws.Int32(partNumber),
+			CopySource:      copySource(s3fs.bucket, srcKey, ""),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		}
+		if srcETag != "" {
+			partReq.CopySourceIfMatch = aws.String(srcETag)
+		}
+
+		partRes, err := s3fs.s3client.UploadPartCopy(ctx, partReq)
+		if err != nil {
+			s3fs.abortUpload(dstKey, createRes.UploadId)
+			if isPreconditionFailed(err) {
+				err = ErrObjectChanged
+			}
+			return "", fmt.Errorf("copy part %d: %w", partNumber, err)
+		}
+
+		if partRes.CopyPartResult == nil {
+			s3fs.abortUpload(dstKey, createRes.UploadId)
+			return "", fmt.Errorf("copy part %d: missing result", partNumber)
+		}
+
+		parts = append(parts, types.CompletedPart{
+			ETag:           partRes.CopyPartResult.ETag,
+			PartNumber:     aws.Int32(partNumber),
+			ChecksumCRC32:  partRes.CopyPartResult.ChecksumCRC32,
+			ChecksumCRC32C: partRes.CopyPartResult.ChecksumCRC32C,
+			ChecksumSHA1:   partRes.CopyPartResult.ChecksumSHA1,
+			ChecksumSHA256: partRes.CopyPartResult.ChecksumSHA256,
+		})
+	}
+
+	completeRes, err := s3fs.s3client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s3fs.bucket),
+		Key:             aws.String(dstKey),
+		UploadId:        createRes.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		s3fs.abortUpload(dstKey, createRes.UploadId)
+		return "", err
+	}
+
+	return aws.ToString(completeRes.ETag), nil
+}
+
+// abortUpload discards a failed multipart upload, this uses a fresh context as the
+// context of the failed operation may have been cancelled.
+func (s3fs *S3FS) abortUpload(key string, uploadID *string) {
+	_, _ = s3fs.s3client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s3fs.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+}
@@ -0,0 +1,312 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_Copy(t *testing.T) {
+	setup := func() (*fakes3.Backend, *S3FS) {
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		_, err := s3fs.WriteFileResult("src/report.csv", []byte("a,b\n1,2\n"), 0o644,
+			WithMetadata(map[string]string{"producer": "report"}),
+			WithTags(map[string]string{"retention": "90d"}),
+		)
+		require.NoError(t, err)
+
+		return backend, s3fs
+	}
+
+	t.Run("copies between prefixes", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+
+		err := s3fs.Copy("src/report.csv", "dst/report.csv")
+		assert.NoError(err)
+
+		src, dst := backend.Get("fooBucket", "src/report.csv"), backend.Get("fooBucket", "dst/report.csv")
+		assert.NotNil(src)
+		assert.Equal(src.Data, dst.Data)
+		assert.Equal("text/csv; charset=utf-8", dst.ContentType)
+		assert.Equal(map[string]string{"producer": "report"}, dst.Metadata)
+		assert.Equal(map[string]string{"retention": "90d"}, dst.Tags)
+		assert.Equal(0, backend.Calls("GetObject"))
+	})
+
+	t.Run("overwrites an existing destination", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+		backend.Put("fooBucket", "dst/report.csv", []byte("old"))
+
+		err := s3fs.Copy("src/report.csv", "dst/report.csv")
+		assert.NoError(err)
+		assert.Equal("a,b\n1,2\n", string(backend.Get("fooBucket", "dst/report.csv").Data))
+	})
+
+	t.Run("options replace the metadata", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+
+		err := s3fs.Copy("src/report.csv", "dst/report.csv",
+			WithMetadata(map[string]string{"reviewed": "true"}),
+			WithStorageClass(types.StorageClassStandardIa),
+		)
+		assert.NoError(err)
+
+		dst := backend.Get("fooBucket", "dst/report.csv")
+		assert.Equal(map[string]string{"reviewed": "true"}, dst.Metadata)
+		assert.Equal(types.StorageClassStandardIa, dst.StorageClass)
+		assert.Equal("text/csv; charset=utf-8", dst.ContentType, "the content type of the source is kept")
+		assert.Equal(map[string]string{"retention": "90d"}, dst.Tags, "the tags of the source are kept")
+
+		err = s3fs.Copy("src/report.csv", "dst/report.csv", WithContentType("text/plain"), WithTags(map[string]string{"stage": "raw"}))
+		assert.NoError(err)
+
+		dst = backend.Get("fooBucket", "dst/report.csv")
+		assert.Equal("text/plain", dst.ContentType)
+		assert.Equal(map[string]string{"stage": "raw"}, dst.Tags)
+	})
+
+	t.Run("options keep what they don't replace", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+
+		_, err := s3fs.WriteFileResult("src/page.html", []byte("<html></html>"), 0o644,
+			WithMetadata(map[string]string{"producer": "site"}),
+			WithCacheControl("max-age=60"),
+			WithContentDisposition("inline"),
+			WithContentEncoding("identity"),
+		)
+		assert.NoError(err)
+
+		err = s3fs.Copy("src/page.html", "dst/page.html", WithStorageClass(types.StorageClassStandardIa))
+		assert.NoError(err)
+
+		dst := backend.Get("fooBucket", "dst/page.html")
+		assert.Equal(types.StorageClassStandardIa, dst.StorageClass)
+		assert.Equal(map[string]string{"producer": "site"}, dst.Metadata)
+		assert.Equal("max-age=60", dst.CacheControl)
+		assert.Equal("inline", dst.ContentDisposition)
+		assert.Equal("identity", dst.ContentEncoding)
+		assert.Equal("text/html; charset=utf-8", dst.ContentType)
+
+		err = s3fs.Copy("dst/page.html", "dst/page.html", WithCacheControl("no-cache"))
+		assert.NoError(err)
+
+		dst = backend.Get("fooBucket", "dst/page.html")
+		assert.Equal("no-cache", dst.CacheControl)
+		assert.Equal(map[string]string{"producer": "site"}, dst.Metadata)
+		assert.Equal("inline", dst.ContentDisposition)
+	})
+
+	t.Run("same key updates the metadata in place", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+
+		err := s3fs.Copy("src/report.csv", "src/report.csv", WithCacheControl("no-cache"))
+		assert.NoError(err)
+
+		obj := backend.Get("fooBucket", "src/report.csv")
+		assert.Equal("no-cache", obj.CacheControl)
+		assert.Equal("a,b\n1,2\n", string(obj.Data))
+
+		// without options there is nothing to change
+		err = s3fs.Copy("src/report.csv", "src/report.csv")
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("CopyObject"))
+	})
+
+	t.Run("errors name the source", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, s3fs := setup()
+
+		err := s3fs.Copy("src/missing.csv", "dst/report.csv")
+		assert.ErrorIs(err, fs.ErrNotExist)
+		assert.ErrorContains(err, "src/missing.csv")
+
+		var pathErr *fs.PathError
+		assert.True(errors.As(err, &pathErr))
+		assert.Equal("copy", pathErr.Op)
+		assert.Equal("dst/report.csv", pathErr.Path)
+
+		assert.ErrorIs(s3fs.Copy("src/report.csv", "."), fs.ErrInvalid)
+		assert.ErrorIs(s3fs.Copy("src/report.csv", "dst.csv", WithStorageClass("COLD")), ErrInvalidStorageClass)
+	})
+}
+
+func TestS3FS_CopyMultipart(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), (2*DefaultPartSize+1024)/16)
+
+	setup := func() *fakes3.Backend {
+		backend := fakes3.New("fooBucket")
+		obj := backend.Put("fooBucket", "big.bin", data)
+		obj.ContentType = "application/x-parquet"
+		obj.Metadata = map[string]string{"producer": "etl"}
+		obj.CacheControl = "no-cache"
+		obj.Tags = map[string]string{"retention": "90d"}
+		return backend
+	}
+
+	opts := []Option{WithCopyThreshold(DefaultPartSize), WithCopyPartSize(DefaultPartSize)}
+
+	t.Run("copies in parts above the threshold", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		s3fs := NewWithClient("fooBucket", backend, opts...)
+
+		err := s3fs.Copy("big.bin", "copy.bin")
+		assert.NoError(err)
+		assert.Equal(3, backend.Calls("UploadPartCopy"))
+		assert.Equal(0, backend.Calls("CopyObject"))
+		assert.Equal(0, backend.Uploads())
+
+		dst := backend.Get("fooBucket", "copy.bin")
+		assert.True(bytes.Equal(data, dst.Data))
+		assert.Equal("application/x-parquet", dst.ContentType)
+		assert.Equal(map[string]string{"producer": "etl"}, dst.Metadata)
+		assert.Equal("no-cache", dst.CacheControl)
+		assert.Equal(map[string]string{"retention": "90d"}, dst.Tags)
+	})
+
+	t.Run("options replace the metadata", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		s3fs := NewWithClient("fooBucket", backend, opts...)
+
+		err := s3fs.Copy("big.bin", "copy.bin", WithMetadata(map[string]string{"reviewed": "true"}), WithChecksumAlgorithm(types.ChecksumAlgorithmCrc32c))
+		assert.NoError(err)
+
+		dst := backend.Get("fooBucket", "copy.bin")
+		assert.Equal(map[string]string{"reviewed": "true"}, dst.Metadata)
+		assert.Equal("application/x-parquet", dst.ContentType)
+		assert.Equal(map[string]string{"retention": "90d"}, dst.Tags)
+	})
+
+	t.Run("rename uses the threshold", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		s3fs := NewWithClient("fooBucket", backend, opts...)
+
+		err := s3fs.Rename("big.bin", "moved.bin")
+		assert.NoError(err)
+		assert.Equal(3, backend.Calls("UploadPartCopy"))
+		assert.Equal([]string{"moved.bin"}, backend.Keys("fooBucket"))
+	})
+
+	t.Run("failed part aborts the upload", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "UploadPartCopy" && backend.Calls("UploadPartCopy") == 2 {
+				return errors.New("part failed")
+			}
+			return nil
+		}
+		s3fs := NewWithClient("fooBucket", backend, opts...)
+
+		err := s3fs.Copy("big.bin", "copy.bin")
+		assert.ErrorContains(err, "part failed")
+		assert.Equal(0, backend.Uploads())
+		assert.Nil(backend.Get("fooBucket", "copy.bin"))
+	})
+
+	t.Run("source replaced between parts", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "UploadPartCopy" && backend.Calls("UploadPartCopy") == 2 {
+				backend.Put("fooBucket", "big.bin", bytes.Repeat([]byte("x"), len(data)))
+			}
+			return nil
+		}
+		s3fs := NewWithClient("fooBucket", backend, opts...)
+
+		err := s3fs.Copy("big.bin", "copy.bin")
+		assert.ErrorIs(err, ErrObjectChanged)
+		assert.Equal(2, backend.Calls("UploadPartCopy"))
+		assert.Equal(0, backend.Uploads())
+		assert.Nil(backend.Get("fooBucket", "copy.bin"))
+	})
+
+	t.Run("part without a result aborts the upload", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(int64(len(data))),
+		}, nil)
+		mockClient.On("GetObjectTagging", mock.Anything, mock.Anything, mock.Anything).Return(&s3.GetObjectTaggingOutput{}, nil)
+		mockClient.On("CreateMultipartUpload", mock.Anything, mock.Anything, mock.Anything).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("upload-1"),
+		}, nil)
+		mockClient.On("UploadPartCopy", mock.Anything, mock.Anything, mock.Anything).Return(&s3.UploadPartCopyOutput{}, nil).Once()
+		mockClient.On("AbortMultipartUpload", mock.Anything, mock.MatchedBy(func(params *s3.AbortMultipartUploadInput) bool {
+			return aws.ToString(params.UploadId) == "upload-1"
+		}), mock.Anything).Return(&s3.AbortMultipartUploadOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, opts...)
+
+		err := s3fs.Copy("big.bin", "copy.bin")
+		assert.ErrorContains(err, "copy part 1: missing result")
+
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "CompleteMultipartUpload", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("cancelled between parts", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		backend := setup()
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "UploadPartCopy" {
+				cancel()
+			}
+			return nil
+		}
+		s3fs := NewWithClient("fooBucket", backend, opts...)
+
+		err := s3fs.CopyContext(ctx, "big.bin", "copy.bin")
+		assert.ErrorIs(err, context.Canceled)
+		assert.Equal(1, backend.Calls("UploadPartCopy"))
+		assert.Equal(0, backend.Uploads())
+	})
+
+	t.Run("option limits", func(t *testing.T) {
+		assert := require.New(t)
+
+		fo := newFSOptions([]Option{WithCopyThreshold(10 * maxCopyObjectSize), WithCopyPartSize(1024)})
+		assert.Equal(int64(maxCopyObjectSize), fo.copyThreshold)
+		assert.Equal(int64(defaultCopyPartSize), fo.copyPartSize)
+
+		s3fs := NewWithClient("fooBucket", fakes3.New("fooBucket"), WithCopyPartSize(DefaultPartSize))
+		assert.Equal(int64(DefaultPartSize), s3fs.copyPartSize(maxCopyObjectSize))
+		// 100GiB needs larger parts to stay within 10000 parts
+		assert.Equal(int64(11*mebibyte), s3fs.copyPartSize(100*1024*mebibyte))
+	})
+}
@@ -0,0 +1,210 @@
+package s3iofs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// WithInclude limits CopyToDir to keys whose path relative to the source prefix matches one of the
+// patterns, using the syntax of path.Match.
+func WithInclude(patterns ...string) BulkOption {
+	return func(bo *bulkOptions) {
+		bo.include = append(bo.include, patterns...)
+	}
+}
+
+// WithExclude makes CopyToDir skip keys whose path relative to the source prefix matches one of the
+// patterns, using the syntax of path.Match.
+func WithExclude(patterns ...string) BulkOption {
+	return func(bo *bulkOptions) {
+		bo.exclude = append(bo.exclude, patterns...)
+	}
+}
+
+// WithSkipUnchanged makes CopyToDir skip objects where the local file has the same size and
+// modification time, which makes repeated downloads of the same prefix incremental.
+func WithSkipUnchanged() BulkOption {
+	return func(bo *bulkOptions) {
+		bo.skipUnchanged = true
+	}
+}
+
+// CopyToDir downloads every object under the srcPrefix directory to the same relative path under the
+// local destDir, use "." to download the whole bucket.
+//
+// Note:
+//   - Directories are created as needed and the modification time of each file is set from the object.
+//   - Files are written to a temporary file which is renamed into place once the download completes.
+//   - Keys which are not valid relative paths, such as those containing "..", are reported as failures.
+//   - Downloads run concurrently, see WithBulkConcurrency, keys which fail to download are reported
+//     with a *BatchError.
+//   - If the context is cancelled the in flight downloads are finished and a *CancelledError is
+//     returned, joined with a *BatchError if any keys failed before it stopped.
+func (s3fs *S3FS) CopyToDir(ctx context.Context, srcPrefix string, destDir string, opts ...BulkOption) error {
+	if !fs.ValidPath(srcPrefix) {
+		return &fs.PathError{Op: "copy", Path: srcPrefix, Err: fs.ErrInvalid}
+	}
+
+	bo := newBulkOptions(opts)
+
+	for _, patterns := range [][]string{bo.include, bo.exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	prefix := dirPrefix(srcPrefix)
+
+	objects, err := s3fs.listObjects(ctx, prefix)
+	if err != nil {
+		return pathError("copy", srcPrefix, err)
+	}
+
+	var (
+		mu     sync.Mutex
+		failed []KeyError
+	)
+
+	runConcurrently(bo.concurrency, len(objects), func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		obj := objects[i]
+		key := aws.ToString(obj.Key)
+		rel := strings.TrimPrefix(key, prefix)
+
+		// keys ending in a slash are directory markers
+		dir := strings.HasSuffix(rel, "/")
+		rel = strings.TrimSuffix(rel, "/")
+
+		var err error
+
+		switch {
+		case rel == "":
+			// the marker for the source prefix itself
+		case !fs.ValidPath(rel):
+			err = fs.ErrInvalid
+		case !bo.matches(rel):
+			return
+		case dir:
+			err = os.MkdirAll(filepath.Join(destDir, filepath.FromSlash(rel)), 0o755)
+		default:
+			// in flight downloads are finished even if the context is cancelled
+			err = s3fs.downloadFile(context.WithoutCancel(ctx), obj, filepath.Join(destDir, filepath.FromSlash(rel)), bo)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			failed = append(failed, KeyError{Key: key, Message: err.Error(), Err: err})
+			bo.completed(0, 1, key)
+			return
+		}
+
+		bo.completed(1, 0, key)
+	})
+
+	if err := ctx.Err(); err != nil {
+		return cancelledWithFailures("copy", bo.cancelled(err), failed)
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Key < failed[j].Key })
+
+	return &BatchError{op: "copy", failed: failed}
+}
+
+// matches reports whether the relative path passes the include and exclude patterns.
+func (bo *bulkOptions) matches(rel string) bool {
+	for _, pattern := range bo.exclude {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return false
+		}
+	}
+
+	if len(bo.include) == 0 {
+		return true
+	}
+
+	for _, pattern := range bo.include {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// downloadFile writes the object to the local file at dst.
+func (s3fs *S3FS) downloadFile(ctx context.Context, obj types.Object, dst string, bo *bulkOptions) error {
+	modTime := aws.ToTime(obj.LastModified)
+
+	if bo.skipUnchanged {
+		info, err := os.Stat(dst)
+		if err == nil && info.Mode().IsRegular() && info.Size() == aws.ToInt64(obj.Size) && info.ModTime().Equal(modTime) {
+			return nil
+		}
+	}
+
+	dir := filepath.Dir(dst)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	res, err := s3fs.s3client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    obj.Key,
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	tmp, err := os.CreateTemp(dir, ".s3iofs-*")
+	if err != nil {
+		return err
+	}
+
+	// the temporary file is removed unless it was renamed into place
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, res.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// temporary files are created private to the user
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
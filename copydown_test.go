@@ -0,0 +1,147 @@
+package s3iofs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_CopyToDir(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	newBackend := func() *fakes3.Backend {
+		backend := fakes3.New("fooBucket")
+		backend.Now = func() time.Time { return modTime }
+		backend.Put("fooBucket", "site/index.html", []byte("<html></html>"))
+		backend.Put("fooBucket", "site/css/style.css", []byte("body {}"))
+		backend.Put("fooBucket", "site/empty/", nil)
+		backend.Put("fooBucket", "site/tmp/scratch.log", []byte("log"))
+		backend.Put("fooBucket", "other/file.txt", []byte("other"))
+		return backend
+	}
+
+	t.Run("restores the tree", func(t *testing.T) {
+		assert := require.New(t)
+
+		dest := t.TempDir()
+
+		s3fs := NewWithClient("fooBucket", newBackend())
+
+		err := s3fs.CopyToDir(context.Background(), "site", dest)
+		assert.NoError(err)
+
+		assert.Equal(map[string]string{
+			"index.html":      "<html></html>",
+			"css/style.css":   "body {}",
+			"tmp/scratch.log": "log",
+		}, walkFiles(t, os.DirFS(dest)))
+
+		info, err := os.Stat(filepath.Join(dest, "empty"))
+		assert.NoError(err)
+		assert.True(info.IsDir())
+
+		info, err = os.Stat(filepath.Join(dest, "css", "style.css"))
+		assert.NoError(err)
+		assert.True(info.ModTime().Equal(modTime))
+	})
+
+	t.Run("include and exclude", func(t *testing.T) {
+		assert := require.New(t)
+
+		dest := t.TempDir()
+
+		s3fs := NewWithClient("fooBucket", newBackend())
+
+		err := s3fs.CopyToDir(context.Background(), "site", dest, WithInclude("*.html", "*/*"), WithExclude("tmp/*"))
+		assert.NoError(err)
+
+		assert.Equal(map[string]string{
+			"index.html":    "<html></html>",
+			"css/style.css": "body {}",
+		}, walkFiles(t, os.DirFS(dest)))
+
+		err = s3fs.CopyToDir(context.Background(), "site", dest, WithInclude("[bad"))
+		assert.Error(err)
+	})
+
+	t.Run("skip unchanged", func(t *testing.T) {
+		assert := require.New(t)
+
+		dest := t.TempDir()
+
+		backend := newBackend()
+		s3fs := NewWithClient("fooBucket", backend)
+
+		assert.NoError(s3fs.CopyToDir(context.Background(), "site", dest))
+
+		// a local edit with the same size and modification time is left alone
+		local := filepath.Join(dest, "index.html")
+		assert.NoError(os.WriteFile(local, []byte("<p>edited</p>"), 0o644))
+		assert.NoError(os.Chtimes(local, modTime, modTime))
+
+		backend.ResetCalls()
+
+		assert.NoError(s3fs.CopyToDir(context.Background(), "site", dest, WithSkipUnchanged()))
+		assert.Equal(0, backend.Calls("GetObject"))
+
+		data, err := os.ReadFile(local)
+		assert.NoError(err)
+		assert.Equal("<p>edited</p>", string(data))
+	})
+
+	t.Run("invalid keys are reported", func(t *testing.T) {
+		assert := require.New(t)
+
+		dest := t.TempDir()
+
+		backend := newBackend()
+		backend.Put("fooBucket", "site/../escape.txt", []byte("escape"))
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.CopyToDir(context.Background(), "site", dest)
+
+		var batchErr *BatchError
+		assert.ErrorAs(err, &batchErr)
+		assert.Equal([]string{"site/../escape.txt"}, batchErr.Keys())
+
+		// the remaining keys are still downloaded
+		_, err = os.Stat(filepath.Join(dest, "index.html"))
+		assert.NoError(err)
+
+		_, err = os.Stat(filepath.Join(filepath.Dir(dest), "escape.txt"))
+		assert.ErrorIs(err, os.ErrNotExist)
+	})
+
+	t.Run("failures are kept when cancelled", func(t *testing.T) {
+		assert := require.New(t)
+
+		dest := t.TempDir()
+
+		backend := newBackend()
+		backend.Put("fooBucket", "site/../escape.txt", []byte("escape"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		// the invalid key is listed first and fails, then the copy is cancelled
+		err := s3fs.CopyToDir(ctx, "site", dest, WithBulkConcurrency(1), WithBulkProgress(func(done, failed int64, currentKey string) {
+			cancel()
+		}))
+
+		var cancelledErr *CancelledError
+		assert.ErrorAs(err, &cancelledErr)
+		assert.Equal(int64(1), cancelledErr.Failed)
+
+		var batchErr *BatchError
+		assert.ErrorAs(err, &batchErr)
+		assert.Equal([]string{"site/../escape.txt"}, batchErr.Keys())
+	})
+}
@@ -0,0 +1,204 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// ErrIrregularFile is returned by CopyFS for a source file which is not a regular file, such as a
+// symlink or device, when WithIrregularFileError is set.
+var ErrIrregularFile = errors.New("irregular file")
+
+// MetadataFunc returns the user metadata stored with a file uploaded by CopyFS, name is the path of
+// the file in the source filesystem.
+type MetadataFunc func(name string, info fs.FileInfo) map[string]string
+
+// WithDeleteMissing makes CopyFS delete keys under the destination prefix which don't exist in the
+// source, the delete only runs if every upload succeeded.
+func WithDeleteMissing() BulkOption {
+	return func(bo *bulkOptions) {
+		bo.deleteMissing = true
+	}
+}
+
+// WithIrregularFileError makes CopyFS fail with ErrIrregularFile on irregular files rather than skipping them.
+func WithIrregularFileError() BulkOption {
+	return func(bo *bulkOptions) {
+		bo.irregularError = true
+	}
+}
+
+// WithMetadataFunc registers a function which supplies the user metadata of each file uploaded by CopyFS.
+func WithMetadataFunc(fn MetadataFunc) BulkOption {
+	return func(bo *bulkOptions) {
+		bo.metadata = fn
+	}
+}
+
+// CopyFS uploads every regular file in src to the same relative path under the destPrefix directory,
+// use "." to upload to the root of the bucket.
+//
+// Note:
+//   - The Content-Type of each object is detected from the file extension, falling back to the
+//     content of the file.
+//   - Irregular files such as symlinks are skipped unless WithIrregularFileError is set.
+//   - Uploads run concurrently, see WithBulkConcurrency, files which fail to upload are reported
+//     with a *BatchError.
+//   - If the context is cancelled the in flight uploads are finished and a *CancelledError is
+//     returned, joined with a *BatchError if any files failed before it stopped.
+func (s3fs *S3FS) CopyFS(ctx context.Context, destPrefix string, src fs.FS, opts ...BulkOption) error {
+	if !fs.ValidPath(destPrefix) {
+		return &fs.PathError{Op: "copy", Path: destPrefix, Err: fs.ErrInvalid}
+	}
+
+	bo := newBulkOptions(opts)
+
+	var files []string
+
+	err := fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return nil
+		case d.Type().IsRegular():
+			files = append(files, name)
+			return nil
+		case bo.irregularError:
+			return &fs.PathError{Op: "copy", Path: name, Err: ErrIrregularFile}
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu       sync.Mutex
+		failed   []KeyError
+		uploaded = map[string]bool{}
+	)
+
+	runConcurrently(bo.concurrency, len(files), func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		key := path.Join(destPrefix, files[i])
+
+		// in flight uploads are finished even if the context is cancelled
+		err := s3fs.copyFile(context.WithoutCancel(ctx), src, files[i], key, bo)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		uploaded[key] = true
+
+		if err != nil {
+			failed = append(failed, KeyError{Key: key, Message: err.Error(), Err: err})
+			bo.completed(0, 1, key)
+			return
+		}
+
+		bo.completed(1, 0, key)
+	})
+
+	if err := ctx.Err(); err != nil {
+		return cancelledWithFailures("copy", bo.cancelled(err), failed)
+	}
+
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].Key < failed[j].Key })
+		return &BatchError{op: "copy", failed: failed}
+	}
+
+	if !bo.deleteMissing {
+		return nil
+	}
+
+	objects, err := s3fs.listObjects(ctx, dirPrefix(destPrefix))
+	if err != nil {
+		return pathError("copy", destPrefix, err)
+	}
+
+	var missing []string
+	for _, obj := range objects {
+		if key := aws.ToString(obj.Key); !uploaded[key] {
+			missing = append(missing, key)
+		}
+	}
+
+	return s3fs.deleteKeys(ctx, missing, bo)
+}
+
+// copyFile uploads the named file from src to the key.
+func (s3fs *S3FS) copyFile(ctx context.Context, src fs.FS, name, key string, bo *bulkOptions) error {
+	f, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	contentType, r, err := detectContentType(name, f)
+	if err != nil {
+		return fmt.Errorf("detect content type: %w", err)
+	}
+
+	opts := []WriteOption{WithContentType(contentType)}
+
+	if bo.metadata != nil {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithMetadata(bo.metadata(name, info)))
+	}
+
+	_, err = s3fs.writeFrom(ctx, key, r, opts...)
+
+	return err
+}
+
+// detectContentType returns the MIME type for the file from its extension, or by sniffing the start of
+// the content, along with a reader positioned at the start of the file.
+func detectContentType(name string, r io.Reader) (string, io.Reader, error) {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType, r, nil
+	}
+
+	buf := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, err
+	}
+
+	contentType := http.DetectContentType(buf[:n])
+
+	// rewind so the upload body remains seekable
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if _, err := rs.Seek(-int64(n), io.SeekCurrent); err != nil {
+			return "", nil, err
+		}
+		return contentType, rs, nil
+	}
+
+	return contentType, io.MultiReader(bytes.NewReader(buf[:n]), r), nil
+}
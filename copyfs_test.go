@@ -0,0 +1,130 @@
+package s3iofs
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+//go:embed testdata/site
+var siteFS embed.FS
+
+func TestS3FS_CopyFS(t *testing.T) {
+	site, err := fs.Sub(siteFS, "testdata/site")
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.CopyFS(context.Background(), "www", site, WithMetadataFunc(func(name string, info fs.FileInfo) map[string]string {
+			return map[string]string{"source": name}
+		}))
+		assert.NoError(err)
+
+		www, err := fs.Sub(s3fs, "www")
+		assert.NoError(err)
+
+		assert.Equal(walkFiles(t, site), walkFiles(t, www))
+
+		obj := backend.Get("fooBucket", "www/css/style.css")
+		assert.Equal("text/css; charset=utf-8", obj.ContentType)
+		assert.Equal(map[string]string{"source": "css/style.css"}, obj.Metadata)
+
+		// no extension, the content is sniffed
+		obj = backend.Get("fooBucket", "www/LICENSE")
+		assert.Equal("text/plain; charset=utf-8", obj.ContentType)
+		assert.Equal("plain text without an extension\n", string(obj.Data))
+	})
+
+	t.Run("delete missing", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "www/stale.html", []byte("stale"))
+		backend.Put("fooBucket", "other/keep.txt", []byte("keep"))
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.CopyFS(context.Background(), "www", site, WithDeleteMissing())
+		assert.NoError(err)
+
+		assert.Nil(backend.Get("fooBucket", "www/stale.html"))
+		assert.NotNil(backend.Get("fooBucket", "www/index.html"))
+		assert.NotNil(backend.Get("fooBucket", "other/keep.txt"))
+	})
+
+	t.Run("irregular files", func(t *testing.T) {
+		assert := require.New(t)
+
+		src := fstest.MapFS{
+			"file.txt": {Data: []byte("file")},
+			"link":     {Data: []byte("file.txt"), Mode: fs.ModeSymlink},
+		}
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.CopyFS(context.Background(), ".", src)
+		assert.NoError(err)
+		assert.Equal([]string{"file.txt"}, backend.Keys("fooBucket"))
+
+		err = s3fs.CopyFS(context.Background(), ".", src, WithIrregularFileError())
+		assert.ErrorIs(err, ErrIrregularFile)
+	})
+
+	t.Run("upload failures", func(t *testing.T) {
+		assert := require.New(t)
+
+		errDenied := errors.New("access denied")
+
+		backend := fakes3.New("fooBucket")
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if op == "PutObject" {
+				return errDenied
+			}
+			return nil
+		}
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.CopyFS(context.Background(), "www", site, WithBulkConcurrency(2))
+		assert.ErrorIs(err, errDenied)
+
+		var batchErr *BatchError
+		assert.ErrorAs(err, &batchErr)
+		assert.Equal([]string{"www/LICENSE", "www/css/style.css", "www/index.html", "www/js/app.js"}, batchErr.Keys())
+	})
+}
+
+// walkFiles returns the contents of every file in fsys keyed by path.
+func walkFiles(t *testing.T, fsys fs.FS) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		files[name] = string(data)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return files
+}
@@ -0,0 +1,385 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// defaultDownloadPartSize is the size of the ranges of a parallel download when WithDownloadConcurrency
+// isn't given a part size.
+const defaultDownloadPartSize = 8 * mebibyte
+
+// ErrObjectChanged is returned when an object is replaced part way through a download, a read or a
+// multipart copy, the reads of an open file are pinned to the object it opened so they fail rather
+// than return a mix of the old and new data, see WithoutETagPinning. The read must be restarted from
+// the beginning.
+var ErrObjectChanged = errors.New("object changed")
+
+// WithDownloadConcurrency makes ReadFile, DownloadTo and the WriteTo of open files fetch objects
+// larger than partSize as up to n ranges at once rather than as a single stream, a partSize of zero
+// or less uses 8MiB. This is disabled by default, an n of one or less leaves it disabled.
+//
+// Note:
+//   - The ranges are written to the destination in order, so memory use is bounded by n multiplied
+//     by the part size.
+//   - Read still reads the object as a single stream.
+//   - If a range fails the ranges in flight are cancelled and the first error is returned, the bytes
+//     written before the failure are counted.
+//   - The ranges are pinned to the object which was opened, see ErrObjectChanged.
+func WithDownloadConcurrency(n int, partSize int64) Option {
+	return func(fo *fsOptions) {
+		if n <= 1 {
+			return
+		}
+		if partSize <= 0 {
+			partSize = defaultDownloadPartSize
+		}
+		fo.download = downloadOptions{concurrency: n, partSize: partSize}
+	}
+}
+
+// downloadOptions holds the settings of parallel downloads, which are disabled when concurrency is zero.
+type downloadOptions struct {
+	concurrency int
+	partSize    int64
+}
+
+// parallel reports whether the remaining bytes of an object are fetched as concurrent ranges.
+func (do downloadOptions) parallel(remaining int64) bool {
+	return do.concurrency > 1 && remaining > do.partSize
+}
+
+// ReadFile reads the named file and returns its contents, with WithDownloadConcurrency large files
+// are fetched as concurrent ranges.
+func (s3fs *S3FS) ReadFile(name string) ([]byte, error) {
+	f, err := s3fs.OpenContext(s3fs.context(), name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s3f := f.(*s3File)
+
+	var buf bytes.Buffer
+	if size := s3f.Size(); size > 0 {
+		// room for the final read of the buffer which finds the end of the data
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+
+	if _, err := s3f.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DownloadTo writes the named file to w, returning the number of bytes written, with
+// WithDownloadConcurrency large files are fetched as concurrent ranges which are written in order.
+func (s3fs *S3FS) DownloadTo(ctx context.Context, name string, w io.Writer) (int64, error) {
+	f, err := s3fs.OpenContext(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return f.(*s3File).WriteTo(w)
+}
+
+// downloadParts writes the object from the offset of the file to the end to w, fetching parts of it
+// concurrently and writing them in order. The open body, if any, is used for the first part.
+//
+// A buffer is held for each part from when it is fetched until it is written, and parts are started
+// in order, so the part written next is always in flight.
+func (s3f *s3File) downloadParts(w io.Writer, size int64) (int64, error) {
+	d := newPartDownloader(s3f)
+	defer d.cancel()
+
+	body := s3f.body
+	s3f.body = nil
+
+	partSize := s3f.download.partSize
+	concurrency := s3f.download.concurrency
+	start := s3f.offset
+	parts := int((size - start + partSize - 1) / partSize)
+
+	pool := make(chan []byte, concurrency)
+	allocated := 0
+
+	nextBuffer := func() ([]byte, bool) {
+		select {
+		case buf := <-pool:
+			return buf, true
+		default:
+		}
+
+		if allocated < concurrency {
+			allocated++
+			return make([]byte, partSize), true
+		}
+
+		select {
+		case buf := <-pool:
+			return buf, true
+		case <-d.ctx.Done():
+			return nil, false
+		}
+	}
+
+	results := make([]chan []byte, parts)
+	for i := range results {
+		results[i] = make(chan []byte, 1)
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		for i := range parts {
+			buf, ok := nextBuffer()
+			if !ok {
+				return
+			}
+
+			offset := start + int64(i)*partSize
+			part := buf[:min(partSize, size-offset)]
+
+			var first io.Reader
+			if i == 0 {
+				first = body
+			}
+
+			d.start(first, part, offset, results[i])
+		}
+	}()
+
+	var written int64
+
+	for i := range parts {
+		var part []byte
+		select {
+		case part = <-results[i]:
+		case <-d.ctx.Done():
+		}
+		if part == nil {
+			break
+		}
+
+		n, err := w.Write(part)
+		written += int64(n)
+		if err != nil {
+			d.fail(err)
+			break
+		}
+
+		pool <- part[:cap(part)]
+	}
+
+	// the rest of the first body is unread, closing it stops the first part if it is in flight
+	d.cancel()
+	if body != nil {
+		body.Close()
+	}
+	d.wg.Wait()
+
+	if written == size-start {
+		return written, nil
+	}
+
+	return written, d.result()
+}
+
+// partDownloader fetches the parts of a download concurrently, recording the first failure and
+// cancelling the parts in flight.
+type partDownloader struct {
+	s3f    *s3File
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg  sync.WaitGroup
+	mu  sync.Mutex
+	err error
+}
+
+func newPartDownloader(s3f *s3File) *partDownloader {
+	ctx, cancel := context.WithCancel(s3f.context())
+
+	return &partDownloader{
+		s3f:    s3f,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// start fills the part from the offset in the background, reading from body if it isn't nil, and
+// sends it to done once it is complete.
+func (d *partDownloader) start(body io.Reader, part []byte, offset int64, done chan<- []byte) {
+	d.wg.Add(1)
+
+	go func() {
+		defer d.wg.Done()
+
+		if err := d.fetch(body, part, offset); err != nil {
+			d.fail(err)
+			return
+		}
+
+		done <- part
+	}()
+}
+
+// fetch fills the part from the offset, with a ranged GetObject made with the ETag of the file if
+// there is no body.
+func (d *partDownloader) fetch(body io.Reader, part []byte, offset int64) error {
+	s3f := d.s3f
+
+	if body == nil {
+		res, err := s3f.s3client.GetObject(d.ctx, s3f.rangeRequest(offset, int64(len(part))))
+		if err != nil {
+			if isPreconditionFailed(err) {
+				return &fs.PathError{Op: opRead, Path: s3f.name, Err: ErrObjectChanged}
+			}
+			return pathError(opRead, s3f.name, err)
+		}
+		defer res.Body.Close()
+
+		body = res.Body
+	}
+
+	if _, err := io.ReadFull(body, part); err != nil {
+		return pathError(opRead, s3f.name, fmt.Errorf("read part at offset %d: %w", offset, err))
+	}
+
+	return nil
+}
+
+// fail records the error if it is the first, and cancels the parts in flight.
+func (d *partDownloader) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err == nil && d.ctx.Err() == nil {
+		d.err = err
+	}
+	d.cancel()
+}
+
+// result returns the first failure, or the error of the context if it was cancelled by the caller.
+func (d *partDownloader) result() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		return d.err
+	}
+
+	return context.Cause(d.s3f.context())
+}
+
+// DownloadState records the progress of a download made with ResumeDownload, it is persisted by the
+// caller so the download can be resumed after a restart.
+type DownloadState struct {
+	// Offset is the number of bytes which have been written.
+	Offset int64 `json:"offset"`
+	// ETag is the entity tag of the object when the download started.
+	ETag string `json:"etag"`
+	// Size is the length of the object, this is zero until the first request succeeds.
+	Size int64 `json:"size"`
+}
+
+// Complete reports whether every byte of the object has been written.
+func (ds *DownloadState) Complete() bool {
+	return ds.ETag != "" && ds.Offset == ds.Size
+}
+
+// ResumeDownload writes the named file to w, starting from the offset in the state, and updates the
+// state as data is written so it reflects the progress made when an error is returned.
+//
+// Note:
+//   - A zero state starts a new download, the ETag of the object is recorded in the state so the
+//     object can't change between attempts.
+//   - If the object has been replaced since the download started, ErrObjectChanged is returned and
+//     the caller must restart with a zero state and truncate the destination.
+//   - w is positioned at the state offset before writing, so a partially written file can be reopened.
+func (s3fs *S3FS) ResumeDownload(ctx context.Context, name string, w io.WriteSeeker, state *DownloadState) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "download", Path: name, Err: fs.ErrInvalid}
+	}
+	if state.Offset < 0 || (state.Offset > 0 && state.ETag == "") {
+		return &fs.PathError{Op: "download", Path: name, Err: fs.ErrInvalid}
+	}
+
+	// nothing remains, and s3 rejects a range starting at the end of the object
+	if state.Complete() {
+		return nil
+	}
+
+	req := &s3.GetObjectInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(name),
+	}
+	if state.ETag != "" {
+		req.IfMatch = aws.String(state.ETag)
+	}
+	if state.Offset > 0 {
+		req.Range = aws.String(fmt.Sprintf("bytes=%d-", state.Offset))
+	}
+
+	res, err := s3fs.s3client.GetObject(ctx, req)
+	if err != nil {
+		if isNotFound(err) {
+			return &fs.PathError{Op: "download", Path: name, Err: fs.ErrNotExist}
+		}
+		if isPreconditionFailed(err) {
+			return &fs.PathError{Op: "download", Path: name, Err: ErrObjectChanged}
+		}
+		return pathError("download", name, err)
+	}
+	defer res.Body.Close()
+
+	if state.ETag == "" {
+		state.ETag = aws.ToString(res.ETag)
+	}
+	state.Size = state.Offset + aws.ToInt64(res.ContentLength)
+
+	if _, err := w.Seek(state.Offset, io.SeekStart); err != nil {
+		return &fs.PathError{Op: "download", Path: name, Err: err}
+	}
+
+	_, err = io.Copy(&progressWriter{w: w, state: state}, res.Body)
+	if err != nil {
+		return pathError("download", name, err)
+	}
+
+	if state.Offset != state.Size {
+		return &fs.PathError{Op: "download", Path: name, Err: io.ErrUnexpectedEOF}
+	}
+
+	return nil
+}
+
+// progressWriter advances the offset of the download state as data is written.
+type progressWriter struct {
+	w     io.Writer
+	state *DownloadState
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.state.Offset += int64(n)
+	return n, err
+}
+
+// isPreconditionFailed reports whether the error indicates an If-Match condition didn't hold.
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed"
+}
@@ -0,0 +1,274 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// failingWriter fails once limit bytes have been written, simulating a dropped connection or restart.
+type failingWriter struct {
+	*os.File
+	limit int64
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > fw.limit {
+		n, _ := fw.File.Write(p[:fw.limit])
+		fw.limit = 0
+		return n, errors.New("connection reset")
+	}
+	fw.limit -= int64(len(p))
+	return fw.File.Write(p)
+}
+
+func TestS3FS_ResumeDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "large.bin", data)
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	openFile := func(t *testing.T) *os.File {
+		t.Helper()
+		f, err := os.OpenFile(filepath.Join(t.TempDir(), "large.bin"), os.O_RDWR|os.O_CREATE, 0o600)
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	t.Run("resume after interruption", func(t *testing.T) {
+		assert := require.New(t)
+
+		f := openFile(t)
+
+		var state DownloadState
+
+		err := s3fs.ResumeDownload(context.Background(), "large.bin", &failingWriter{File: f, limit: 300_000}, &state)
+		assert.ErrorContains(err, "connection reset")
+		assert.Equal(int64(300_000), state.Offset)
+		assert.Equal(int64(len(data)), state.Size)
+		assert.NotEmpty(state.ETag)
+		assert.False(state.Complete())
+
+		// a second interruption part way through the remainder
+		err = s3fs.ResumeDownload(context.Background(), "large.bin", &failingWriter{File: f, limit: 123_457}, &state)
+		assert.Error(err)
+		assert.Equal(int64(423_457), state.Offset)
+
+		backend.ResetCalls()
+
+		err = s3fs.ResumeDownload(context.Background(), "large.bin", f, &state)
+		assert.NoError(err)
+		assert.True(state.Complete())
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		got, err := os.ReadFile(f.Name())
+		assert.NoError(err)
+		assert.Equal(data, got)
+
+		// a completed download makes no requests
+		err = s3fs.ResumeDownload(context.Background(), "large.bin", f, &state)
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("GetObject"))
+	})
+
+	t.Run("object changed", func(t *testing.T) {
+		assert := require.New(t)
+
+		f := openFile(t)
+
+		var state DownloadState
+
+		err := s3fs.ResumeDownload(context.Background(), "large.bin", &failingWriter{File: f, limit: 1000}, &state)
+		assert.Error(err)
+
+		changed := bytes.Repeat([]byte("changed"), 1000)
+		backend.Put("fooBucket", "large.bin", changed)
+
+		err = s3fs.ResumeDownload(context.Background(), "large.bin", f, &state)
+		assert.ErrorIs(err, ErrObjectChanged)
+		assert.Equal(int64(1000), state.Offset)
+
+		// restart from the beginning
+		state = DownloadState{}
+		assert.NoError(f.Truncate(0))
+
+		err = s3fs.ResumeDownload(context.Background(), "large.bin", f, &state)
+		assert.NoError(err)
+
+		got, err := os.ReadFile(f.Name())
+		assert.NoError(err)
+		assert.Equal(changed, got)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		f := openFile(t)
+
+		err := s3fs.ResumeDownload(context.Background(), "missing.bin", f, &DownloadState{})
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		// an offset without the ETag can't be validated
+		err = s3fs.ResumeDownload(context.Background(), "large.bin", f, &DownloadState{Offset: 10})
+		assert.ErrorIs(err, fs.ErrInvalid)
+	})
+}
+
+func TestS3FS_DownloadConcurrency(t *testing.T) {
+	const partSize = 256 * 1024
+
+	data := make([]byte, 2*1024*1024+100)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	newFS := func(opts ...Option) (*fakes3.Backend, *S3FS) {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "large.bin", data)
+		backend.Put("fooBucket", "small.bin", data[:100])
+		return backend, NewWithClient("fooBucket", backend, opts...)
+	}
+
+	t.Run("read file fetches ranges", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithDownloadConcurrency(4, partSize))
+
+		got, err := fs.ReadFile(s3fs, "large.bin")
+		assert.NoError(err)
+		assert.Equal(data, got)
+
+		// the first part is read from the body of the open, the rest are ranged requests
+		assert.Equal(9, backend.Calls("GetObject"))
+
+		backend.ResetCalls()
+
+		got, err = fs.ReadFile(s3fs, "small.bin")
+		assert.NoError(err)
+		assert.Equal(data[:100], got)
+		assert.Equal(1, backend.Calls("GetObject"))
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS()
+
+		got, err := fs.ReadFile(s3fs, "large.bin")
+		assert.NoError(err)
+		assert.Equal(data, got)
+		assert.Equal(1, backend.Calls("GetObject"))
+	})
+
+	t.Run("download to", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, s3fs := newFS(WithDownloadConcurrency(3, partSize))
+
+		var buf bytes.Buffer
+		n, err := s3fs.DownloadTo(context.Background(), "large.bin", &buf)
+		assert.NoError(err)
+		assert.Equal(int64(len(data)), n)
+		assert.Equal(data, buf.Bytes())
+
+		_, err = s3fs.DownloadTo(context.Background(), "missing.bin", &buf)
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("write to from the offset", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithDownloadConcurrency(4, partSize))
+
+		f, err := s3fs.OpenObject("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		_, err = f.Seek(1000, io.SeekStart)
+		assert.NoError(err)
+
+		backend.ResetCalls()
+
+		var buf bytes.Buffer
+		n, err := f.WriteTo(&buf)
+		assert.NoError(err)
+		assert.Equal(int64(len(data)-1000), n)
+		assert.Equal(data[1000:], buf.Bytes())
+		assert.Equal(8, backend.Calls("GetObject"))
+
+		// the file is consumed
+		n, err = f.WriteTo(&buf)
+		assert.NoError(err)
+		assert.Zero(n)
+	})
+
+	t.Run("failed range cancels the download", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithDownloadConcurrency(4, partSize))
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if params, ok := input.(*s3.GetObjectInput); ok && aws.ToString(params.Range) == "bytes=524288-786431" {
+				return errors.New("connection reset")
+			}
+			return nil
+		}
+
+		var buf bytes.Buffer
+		n, err := s3fs.DownloadTo(context.Background(), "large.bin", &buf)
+		assert.ErrorContains(err, "connection reset")
+		// only the parts before the failure are written
+		assert.LessOrEqual(n, int64(2*partSize))
+		assert.True(bytes.Equal(data[:n], buf.Bytes()))
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("large.bin", pathErr.Path)
+	})
+
+	t.Run("object replaced during the download", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithDownloadConcurrency(4, partSize))
+
+		f, err := s3fs.OpenObject("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.Put("fooBucket", "large.bin", bytes.Repeat([]byte("x"), len(data)))
+
+		_, err = f.WriteTo(io.Discard)
+		assert.ErrorIs(err, ErrObjectChanged)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithDownloadConcurrency(4, partSize))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if params, ok := input.(*s3.GetObjectInput); ok && params.Range != nil {
+				cancel()
+			}
+			return nil
+		}
+
+		_, err := s3fs.DownloadTo(ctx, "large.bin", io.Discard)
+		assert.ErrorIs(err, context.Canceled)
+	})
+}
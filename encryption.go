@@ -0,0 +1,167 @@
+package s3iofs
+
+import (
+	"context"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var _ EncryptionInfo = (*s3File)(nil)
+
+// EncryptionInfo provides the server side encryption settings of an object, this is implemented
+// by the fs.FileInfo values returned by Open, and by DirEntry.Info for entries returned by ReadDir.
+type EncryptionInfo interface {
+	// ServerSideEncryption returns the algorithm used to encrypt the object, such as "AES256" or "aws:kms".
+	ServerSideEncryption() string
+	// SSEKMSKeyID returns the KMS key used to encrypt the object, if any.
+	SSEKMSKeyID() string
+	// BucketKeyEnabled reports whether an S3 Bucket Key was used with SSE-KMS.
+	BucketKeyEnabled() bool
+}
+
+// ServerSideEncryption returns the algorithm used to encrypt the object.
+func (s3f *s3File) ServerSideEncryption() string {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return s3f.serverSideEncryption
+}
+
+// SSEKMSKeyID returns the KMS key used to encrypt the object.
+func (s3f *s3File) SSEKMSKeyID() string {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return s3f.sseKMSKeyID
+}
+
+// BucketKeyEnabled reports whether an S3 Bucket Key was used with SSE-KMS.
+func (s3f *s3File) BucketKeyEnabled() bool {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return s3f.bucketKeyEnabled
+}
+
+// WithSSEKMS encrypts the stored object with SSE-KMS using the key id or ARN, an empty keyID uses the
+// AWS managed key of the account. This replaces the default set with WithDefaultSSEKMS or WithDefaultSSES3.
+func WithSSEKMS(keyID string) WriteOption {
+	return func(wo *writeOptions) {
+		wo.serverSideEncryption = types.ServerSideEncryptionAwsKms
+		wo.sseKMSKeyID = keyID
+	}
+}
+
+// WithSSES3 encrypts the stored object with SSE-S3 using keys managed by s3. This replaces the default
+// set with WithDefaultSSEKMS or WithDefaultSSES3.
+func WithSSES3() WriteOption {
+	return func(wo *writeOptions) {
+		wo.serverSideEncryption = types.ServerSideEncryptionAes256
+		wo.sseKMSKeyID = ""
+	}
+}
+
+// WithDefaultSSEKMS encrypts every object written by the filesystem with SSE-KMS using the key id or
+// ARN, unless it is replaced by a write option, this is useful for buckets with a policy which
+// denies unencrypted puts.
+func WithDefaultSSEKMS(keyID string) Option {
+	return WithDefaultWriteOptions(WithSSEKMS(keyID))
+}
+
+// WithDefaultSSES3 encrypts every object written by the filesystem with SSE-S3, unless it is
+// replaced by a write option.
+func WithDefaultSSES3() Option {
+	return WithDefaultWriteOptions(WithSSES3())
+}
+
+// EncryptionFinding describes an object which doesn't meet the expected encryption settings.
+type EncryptionFinding struct {
+	Key                  string
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+	// Reason is either "unencrypted" or "wrong key".
+	Reason string
+}
+
+// AuditEncryption checks the encryption of every object under the named directory, returning a finding
+// for each object which is unencrypted, or when kmsKeyID is not empty, isn't encrypted with that KMS key.
+//
+// The kmsKeyID may be a key id or ARN, key ids are matched against the ARN reported by s3.
+func (s3fs *S3FS) AuditEncryption(ctx context.Context, name string, kmsKeyID string) ([]EncryptionFinding, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "audit", Path: name, Err: fs.ErrInvalid}
+	}
+
+	objects, err := s3fs.listObjects(ctx, dirPrefix(name))
+	if err != nil {
+		return nil, pathError("audit", name, err)
+	}
+
+	var (
+		mu       sync.Mutex
+		findings []EncryptionFinding
+		errs     []error
+	)
+
+	runConcurrently(defaultBulkConcurrency, len(objects), func(i int) {
+		finding, err := s3fs.auditObject(ctx, objects[i], kmsKeyID)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	})
+
+	if len(errs) > 0 {
+		return nil, pathError("audit", name, errs[0])
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Key < findings[j].Key })
+
+	return findings, nil
+}
+
+func (s3fs *S3FS) auditObject(ctx context.Context, obj types.Object, kmsKeyID string) (*EncryptionFinding, error) {
+	res, err := s3fs.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    obj.Key,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			// removed since it was listed
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	finding := &EncryptionFinding{
+		Key:                  aws.ToString(obj.Key),
+		ServerSideEncryption: string(res.ServerSideEncryption),
+		SSEKMSKeyID:          aws.ToString(res.SSEKMSKeyId),
+	}
+
+	switch {
+	case finding.ServerSideEncryption == "":
+		finding.Reason = "unencrypted"
+	case kmsKeyID != "" && !matchesKMSKey(finding.SSEKMSKeyID, kmsKeyID):
+		finding.Reason = "wrong key"
+	default:
+		return nil, nil
+	}
+
+	return finding, nil
+}
+
+// matchesKMSKey reports whether the key ARN reported by s3 refers to the expected key id or ARN.
+func matchesKMSKey(actual, expected string) bool {
+	return actual == expected || strings.HasSuffix(actual, ":key/"+expected)
+}
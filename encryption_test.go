@@ -0,0 +1,196 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+const testKeyARN = "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+func TestOpenEncryption(t *testing.T) {
+	assert := require.New(t)
+
+	mockClient := new(mockS3Client)
+
+	mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket: aws.String("fooBucket"),
+		Key:    aws.String("barKey"),
+	}, mock.Anything).Return(&s3.GetObjectOutput{
+		Body:                 io.NopCloser(bytes.NewReader([]byte("a"))),
+		ContentLength:        aws.Int64(1),
+		ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:          aws.String(testKeyARN),
+		BucketKeyEnabled:     aws.Bool(true),
+	}, nil).Once()
+
+	sysfs := NewWithClient("fooBucket", mockClient)
+
+	f, err := sysfs.Open("barKey")
+	assert.NoError(err)
+
+	info, err := f.Stat()
+	assert.NoError(err)
+
+	enc, ok := info.(EncryptionInfo)
+	assert.True(ok)
+	assert.Equal("aws:kms", enc.ServerSideEncryption())
+	assert.Equal(testKeyARN, enc.SSEKMSKeyID())
+	assert.True(enc.BucketKeyEnabled())
+}
+
+func TestReadDirInfoEncryption(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	_, err := backend.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:               aws.String("fooBucket"),
+		Key:                  aws.String("dir/encrypted.txt"),
+		Body:                 bytes.NewReader([]byte("data")),
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+	})
+	assert.NoError(err)
+
+	sysfs := NewWithClient("fooBucket", backend)
+
+	entries, err := sysfs.ReadDir("dir")
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal(0, backend.Calls("HeadObject"))
+
+	info, err := entries[0].Info()
+	assert.NoError(err)
+	assert.Equal("AES256", info.(EncryptionInfo).ServerSideEncryption())
+	assert.Equal(int64(4), info.Size())
+
+	_, err = entries[0].Info()
+	assert.NoError(err)
+	assert.Equal(1, backend.Calls("HeadObject"))
+
+	entries, err = sysfs.ReadDir("dir")
+	assert.NoError(err)
+
+	backend.Put("fooBucket", "dir/other.txt", nil)
+	_, err = sysfs.RemoveResult("dir/encrypted.txt")
+	assert.NoError(err)
+
+	_, err = entries[0].Info()
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
+
+func TestS3FS_AuditEncryption(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+
+	put := func(key string, sse types.ServerSideEncryption, keyID string) {
+		_, err := backend.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:               aws.String("fooBucket"),
+			Key:                  aws.String(key),
+			ServerSideEncryption: sse,
+			SSEKMSKeyId:          aws.String(keyID),
+		})
+		assert.NoError(err)
+	}
+
+	put("audit/kms.txt", types.ServerSideEncryptionAwsKms, testKeyARN)
+	put("audit/nested/other-key.txt", types.ServerSideEncryptionAwsKms, "arn:aws:kms:us-east-1:123456789012:key/other")
+	put("audit/nested/plain.txt", "", "")
+	put("audit/s3.txt", types.ServerSideEncryptionAes256, "")
+	put("outside.txt", "", "")
+
+	sysfs := NewWithClient("fooBucket", backend)
+
+	findings, err := sysfs.AuditEncryption(context.Background(), "audit", "")
+	assert.NoError(err)
+	assert.Equal([]EncryptionFinding{
+		{Key: "audit/nested/plain.txt", Reason: "unencrypted"},
+	}, findings)
+
+	findings, err = sysfs.AuditEncryption(context.Background(), "audit", "1234abcd-12ab-34cd-56ef-1234567890ab")
+	assert.NoError(err)
+	assert.Equal([]EncryptionFinding{
+		{Key: "audit/nested/other-key.txt", ServerSideEncryption: "aws:kms", SSEKMSKeyID: "arn:aws:kms:us-east-1:123456789012:key/other", Reason: "wrong key"},
+		{Key: "audit/nested/plain.txt", Reason: "unencrypted"},
+		{Key: "audit/s3.txt", ServerSideEncryption: "AES256", Reason: "wrong key"},
+	}, findings)
+}
+
+func TestS3FS_WriteEncryption(t *testing.T) {
+	t.Run("put object", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+			return aws.ToString(params.Key) == "default.txt" &&
+				params.ServerSideEncryption == types.ServerSideEncryptionAwsKms &&
+				aws.ToString(params.SSEKMSKeyId) == testKeyARN
+		}), mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+			return aws.ToString(params.Key) == "s3.txt" &&
+				params.ServerSideEncryption == types.ServerSideEncryptionAes256 &&
+				params.SSEKMSKeyId == nil
+		}), mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithDefaultSSEKMS(testKeyARN))
+
+		err := s3fs.WriteFile("default.txt", []byte("data"), 0o644)
+		assert.NoError(err)
+
+		_, err = s3fs.WriteFileResult("s3.txt", []byte("data"), 0o644, WithSSES3())
+		assert.NoError(err)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(DefaultPartSize))
+
+		err := s3fs.WriteReader("large.bin", bytes.NewReader(make([]byte, DefaultPartSize+1)), -1, WithSSEKMS(testKeyARN))
+		assert.NoError(err)
+
+		info, err := s3fs.StatObject("large.bin")
+		assert.NoError(err)
+		assert.Equal("aws:kms", info.(EncryptionInfo).ServerSideEncryption())
+		assert.Equal(testKeyARN, info.(EncryptionInfo).SSEKMSKeyID())
+	})
+
+	t.Run("denied put", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.Anything, mock.Anything, mock.Anything).
+			Return((*s3.PutObjectOutput)(nil), &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.WriteFile("plain.txt", []byte("data"), 0o644)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("plain.txt", pathErr.Path)
+
+		var apiErr smithy.APIError
+		assert.ErrorAs(err, &apiErr)
+		assert.Equal("AccessDenied", apiErr.ErrorCode())
+
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,163 @@
+package s3iofs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// isNotFound reports whether the error indicates the key doesn't exist, GetObject returns NoSuchKey
+// while HeadObject returns NotFound, and other s3 implementations vary in which they return.
+func isNotFound(err error) bool {
+	var (
+		nsk *types.NoSuchKey
+		nfe *types.NotFound
+	)
+	if errors.As(err, &nsk) || errors.As(err, &nfe) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return true
+		}
+	}
+
+	return false
+}
+
+// isInvalidRange reports whether the error is the response to a range which starts past the end of
+// the object.
+func isInvalidRange(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange"
+}
+
+// isAccessDenied reports whether the error indicates the credentials aren't allowed to make the
+// request, s3 returns AccessDenied with a body while a HeadObject, which has none, returns Forbidden.
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "AccessDenied", "Forbidden":
+			return true
+		}
+	}
+
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+// pathError returns a fs.PathError for the operation on the named file, errors returned by s3 are
+// wrapped in a ResponseError so the message includes the http status and request id.
+func pathError(op, name string, err error) *fs.PathError {
+	return &fs.PathError{Op: op, Path: name, Err: withResponseInfo(err)}
+}
+
+// withResponseInfo wraps err in a ResponseError if it came from an s3 response and isn't already
+// wrapped, an access denied error without a response is wrapped so it still matches fs.ErrPermission.
+func withResponseInfo(err error) error {
+	var re *ResponseError
+	if errors.As(err, &re) {
+		return err
+	}
+
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) {
+		if isAccessDenied(err) && !errors.Is(err, fs.ErrPermission) {
+			return &permissionError{err: err}
+		}
+		return err
+	}
+
+	re = &ResponseError{
+		StatusCode: respErr.HTTPStatusCode(),
+		RequestID:  respErr.ServiceRequestID(),
+		err:        err,
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		re.Code, re.Message = apiErr.ErrorCode(), apiErr.ErrorMessage()
+	} else if respErr.Err != nil {
+		re.Message = respErr.Err.Error()
+	}
+
+	return re
+}
+
+// ResponseError describes a failed s3 request, it is the Err of the fs.PathError returned by the
+// filesystem and unwraps to the error returned by the s3 client.
+//
+// The message is in the form "AccessDenied: Access Denied (status 403, request id ABC123)", the
+// request id is what AWS support ask for when investigating a failure.
+type ResponseError struct {
+	// Code is the s3 error code, such as AccessDenied, this is empty if the response couldn't be decoded.
+	Code string
+	// Message is the message returned by s3.
+	Message string
+	// StatusCode is the http status of the response.
+	StatusCode int
+	// RequestID is the x-amz-request-id of the response, this is empty if s3 didn't return one.
+	RequestID string
+
+	err error
+}
+
+func (e *ResponseError) Error() string {
+	msg := e.Code
+	switch {
+	case msg == "":
+		msg = e.Message
+	case e.Message != "":
+		msg += ": " + e.Message
+	}
+
+	if e.RequestID == "" {
+		return fmt.Sprintf("%s (status %d)", msg, e.StatusCode)
+	}
+
+	return fmt.Sprintf("%s (status %d, request id %s)", msg, e.StatusCode, e.RequestID)
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether the response matches a sentinel error of the package, such as ErrChecksumMismatch,
+// or fs.ErrPermission for an AccessDenied or Forbidden response.
+func (e *ResponseError) Is(target error) bool {
+	switch target {
+	case ErrChecksumMismatch:
+		return isChecksumMismatch(e.Code)
+	case fs.ErrPermission:
+		return isAccessDenied(e.err)
+	}
+
+	return false
+}
+
+// permissionError is an access denied error which matches fs.ErrPermission, it has the message of
+// the error returned by the s3 client and unwraps to it.
+type permissionError struct {
+	err error
+}
+
+func (e *permissionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permissionError) Unwrap() error {
+	return e.err
+}
+
+func (e *permissionError) Is(target error) bool {
+	return target == fs.ErrPermission
+}
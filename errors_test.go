@@ -0,0 +1,171 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// operationError builds the error chain returned by the aws sdk for a failed response.
+func operationError(status int, requestID string, err error) error {
+	return &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "GetObject",
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+				Err:      err,
+			},
+			RequestID: requestID,
+		},
+	}
+}
+
+func Test_pathError(t *testing.T) {
+	accessDenied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "api error",
+			err:  operationError(403, "ABC123", accessDenied),
+			want: "open foo.txt: AccessDenied: Access Denied (status 403, request id ABC123)",
+		},
+		{
+			name: "api error without message",
+			err:  operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NotFound"}),
+			want: "open foo.txt: NotFound (status 404, request id ABC123)",
+		},
+		{
+			name: "missing request id",
+			err:  operationError(503, "", &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}),
+			want: "open foo.txt: SlowDown: Please reduce your request rate. (status 503)",
+		},
+		{
+			name: "response which couldn't be decoded",
+			err:  operationError(502, "ABC123", errors.New("failed to decode response body")),
+			want: "open foo.txt: failed to decode response body (status 502, request id ABC123)",
+		},
+		{
+			name: "not a response error",
+			err:  fs.ErrNotExist,
+			want: "open foo.txt: file does not exist",
+		},
+		{
+			name: "already wrapped",
+			err:  pathError("read", "foo.txt", operationError(403, "ABC123", accessDenied)),
+			want: "open foo.txt: read foo.txt: AccessDenied: Access Denied (status 403, request id ABC123)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			err := pathError("open", "foo.txt", tt.err)
+			assert.EqualError(err, tt.want)
+			assert.ErrorIs(err, tt.err)
+		})
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "protected.txt", []byte("data"))
+	backend.Protect("fooBucket", "protected.txt")
+
+	srv, client := fakes3.NewServer(backend)
+	defer srv.Close()
+
+	s3fs := NewWithClient("fooBucket", client)
+
+	err := s3fs.Remove("protected.txt")
+	assert.Regexp(`^remove protected.txt: AccessDenied: Access Denied \(status 403, request id \w+\)$`, err.Error())
+
+	var respErr *ResponseError
+	assert.True(errors.As(err, &respErr))
+	assert.Equal("AccessDenied", respErr.Code)
+	assert.Equal(http.StatusForbidden, respErr.StatusCode)
+	assert.NotEmpty(respErr.RequestID)
+
+	// the sdk error is still available
+	var apiErr smithy.APIError
+	assert.True(errors.As(err, &apiErr))
+	assert.Equal("AccessDenied", apiErr.ErrorCode())
+}
+
+func TestS3FS_AccessDenied(t *testing.T) {
+	denied := map[string]error{
+		"api error":          &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"},
+		"response error":     operationError(403, "ABC123", &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}),
+		"head response":      operationError(403, "ABC123", &smithy.GenericAPIError{Code: "Forbidden"}),
+		"undecoded response": operationError(403, "ABC123", errors.New("failed to decode response body")),
+	}
+
+	for name, deniedErr := range denied {
+		t.Run(name, func(t *testing.T) {
+			assert := require.New(t)
+
+			backend := fakes3.New("fooBucket")
+			backend.Put("fooBucket", "dir/file.txt", []byte("data"))
+			s3fs := NewWithClient("fooBucket", backend)
+
+			f, err := s3fs.Open("dir/file.txt")
+			assert.NoError(err)
+			defer f.Close()
+
+			backend.OnCall = func(context.Context, string, any) error {
+				return deniedErr
+			}
+
+			_, readAtErr := f.(io.ReaderAt).ReadAt(make([]byte, 2), 1)
+			_, openErr := s3fs.Open("dir/file.txt")
+			_, statErr := s3fs.Stat("dir/file.txt")
+			_, dirStatErr := s3fs.Stat("dir")
+			_, readDirErr := s3fs.ReadDir("dir")
+
+			errs := map[string]error{
+				"open":     openErr,
+				"stat":     statErr,
+				"stat dir": dirStatErr,
+				"read dir": readDirErr,
+				"remove":   s3fs.Remove("dir/file.txt"),
+				"write":    s3fs.WriteFile("dir/other.txt", []byte("data"), 0o644),
+				"read at":  readAtErr,
+			}
+
+			for op, err := range errs {
+				assert.ErrorIs(err, fs.ErrPermission, op)
+				assert.NotErrorIs(err, fs.ErrNotExist, op)
+				assert.ErrorIs(err, deniedErr, op)
+
+				var pathErr *fs.PathError
+				assert.ErrorAs(err, &pathErr, op)
+			}
+		})
+	}
+
+	t.Run("other errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := pathError("open", "foo.txt", operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NotFound"}))
+		assert.NotErrorIs(err, fs.ErrPermission)
+
+		err = pathError("open", "foo.txt", &smithy.GenericAPIError{Code: "SlowDown"})
+		assert.NotErrorIs(err, fs.ErrPermission)
+		assert.EqualError(err, "open foo.txt: api error SlowDown: ")
+	})
+}
@@ -0,0 +1,158 @@
+package s3iofs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPartSize is the part size used by this package for multipart uploads.
+	DefaultPartSize = 5 * 1024 * 1024
+
+	mebibyte = 1024 * 1024
+)
+
+// ErrMalformedETag is returned when an ETag is neither an MD5 digest nor a multipart ETag.
+var ErrMalformedETag = errors.New("malformed etag")
+
+// commonPartSizes are the part sizes used by popular upload tools, such as the aws cli.
+var commonPartSizes = []int64{8 * mebibyte, 16 * mebibyte}
+
+// ComputeETag calculates the ETag s3 assigns to an object of the given size uploaded in parts of partSize.
+//
+// Objects which fit in a single part have an ETag which is the MD5 of the content, larger objects
+// have the MD5 of the concatenated part MD5s with the number of parts appended, for example "<md5>-3".
+// The returned ETag is not quoted.
+func ComputeETag(r io.ReaderAt, size int64, partSize int64) (string, error) {
+	if partSize <= 0 || size <= partSize {
+		return computeETag(r, size, size, false)
+	}
+
+	return computeETag(r, size, partSize, true)
+}
+
+// MatchesETag reports whether the local file has the content described by the remote ETag.
+//
+// Multipart ETags don't record the part size, so the package default, common tool defaults and sizes
+// derived from the number of parts are tried. A false result is returned if none of these reproduce the
+// ETag, as is the case for objects encrypted with SSE-KMS or SSE-C.
+func MatchesETag(localPath string, remoteETag string) (bool, error) {
+	digest, parts, err := parseETag(remoteETag)
+	if err != nil {
+		return false, err
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	size := info.Size()
+
+	if parts == 0 {
+		etag, err := computeETag(f, size, size, false)
+		if err != nil {
+			return false, err
+		}
+		return etag == digest, nil
+	}
+
+	for _, partSize := range candidatePartSizes(size, parts) {
+		etag, err := computeETag(f, size, partSize, true)
+		if err != nil {
+			return false, err
+		}
+		if etag == fmt.Sprintf("%s-%d", digest, parts) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// parseETag splits the ETag into the hex digest and the number of parts, which is zero for
+// objects which were not uploaded using multipart.
+func parseETag(etag string) (string, int64, error) {
+	etag = strings.Trim(etag, `"`)
+
+	digest, suffix, multipart := strings.Cut(etag, "-")
+
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != md5.Size*2 {
+		return "", 0, fmt.Errorf("%w: %q", ErrMalformedETag, etag)
+	}
+
+	if !multipart {
+		return digest, 0, nil
+	}
+
+	parts, err := strconv.ParseInt(suffix, 10, 64)
+	if err != nil || parts < 1 {
+		return "", 0, fmt.Errorf("%w: %q", ErrMalformedETag, etag)
+	}
+
+	return digest, parts, nil
+}
+
+// candidatePartSizes returns the plausible part sizes which split size into the given number of parts.
+func candidatePartSizes(size, parts int64) []int64 {
+	derived := (size + parts - 1) / parts
+
+	candidates := append([]int64{DefaultPartSize}, commonPartSizes...)
+	candidates = append(candidates,
+		derived,
+		(derived+mebibyte-1)/mebibyte*mebibyte, // tools typically use whole MiB part sizes
+	)
+
+	var res []int64
+	seen := map[int64]bool{}
+
+	for _, partSize := range candidates {
+		if partSize <= 0 || seen[partSize] || (size+partSize-1)/partSize != parts {
+			continue
+		}
+		seen[partSize] = true
+		res = append(res, partSize)
+	}
+
+	return res
+}
+
+func computeETag(r io.ReaderAt, size, partSize int64, multipart bool) (string, error) {
+	if !multipart {
+		h := md5.New()
+		if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	var (
+		sums  []byte
+		parts int
+	)
+
+	for offset := int64(0); offset < size || parts == 0; offset += partSize {
+		h := md5.New()
+		if _, err := io.Copy(h, io.NewSectionReader(r, offset, min(partSize, size-offset))); err != nil {
+			return "", err
+		}
+		sums = h.Sum(sums)
+		parts++
+	}
+
+	sum := md5.Sum(sums)
+
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts), nil
+}
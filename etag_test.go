@@ -0,0 +1,84 @@
+package s3iofs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func multipartETag(data []byte, partSize int) string {
+	var sums []byte
+	parts := 0
+	for offset := 0; offset < len(data); offset += partSize {
+		sum := md5.Sum(data[offset:min(offset+partSize, len(data))])
+		sums = append(sums, sum[:]...)
+		parts++
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts)
+}
+
+func TestComputeETag(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	single := md5.Sum(data)
+
+	tests := []struct {
+		name     string
+		partSize int64
+		want     string
+	}{
+		{name: "single part", partSize: 20000, want: hex.EncodeToString(single[:])},
+		{name: "no part size", partSize: 0, want: hex.EncodeToString(single[:])},
+		{name: "multipart", partSize: 3000, want: multipartETag(data, 3000)},
+		{name: "multipart exact parts", partSize: 2500, want: multipartETag(data, 2500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeETag(bytes.NewReader(data), int64(len(data)), tt.partSize)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 20*mebibyte)
+
+	localPath := filepath.Join(t.TempDir(), "data.bin")
+	require.NoError(t, os.WriteFile(localPath, data, 0600))
+
+	single := md5.Sum(data)
+
+	tests := []struct {
+		name    string
+		etag    string
+		want    bool
+		wantErr error
+	}{
+		{name: "single part", etag: `"` + hex.EncodeToString(single[:]) + `"`, want: true},
+		{name: "single part changed", etag: `"d41d8cd98f00b204e9800998ecf8427e"`, want: false},
+		{name: "multipart package default", etag: `"` + multipartETag(data, DefaultPartSize) + `"`, want: true},
+		{name: "multipart common size", etag: multipartETag(data, 16*mebibyte), want: true},
+		{name: "multipart derived from part count", etag: multipartETag(data, 7*mebibyte), want: true},
+		{name: "multipart undeterminable part size", etag: multipartETag(data, 6*mebibyte+512*1024), want: false},
+		{name: "malformed", etag: `"not-an-etag"`, wantErr: ErrMalformedETag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchesETag(localPath, tt.etag)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
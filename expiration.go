@@ -0,0 +1,92 @@
+package s3iofs
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// expiryDateFormats are the formats seen in the expiry-date of the Expiration header, s3 uses the
+// http date format but some compatible services use the numeric zone form.
+var expiryDateFormats = []string{http.TimeFormat, time.RFC1123, time.RFC1123Z}
+
+// ExpiresAt returns the time the object will be removed by a lifecycle rule and the id of the rule,
+// the result is false if the object has no expiration.
+//
+// Note for entries returned by ReadDir the expiration is only available after Info is called.
+func (s3f *s3File) ExpiresAt() (time.Time, string, bool) {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return parseExpiration(s3f.expiration)
+}
+
+// parseExpiration parses the Expiration header returned by HeadObject and GetObject, which has the form:
+//
+//	expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="picture-deletion-rule"
+func parseExpiration(header string) (time.Time, string, bool) {
+	var (
+		expiry time.Time
+		ruleID string
+		found  bool
+	)
+
+	for s := header; s != ""; {
+		s = strings.TrimLeft(s, " ,")
+
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		value, s = headerValue(rest)
+
+		switch strings.TrimSpace(key) {
+		case "expiry-date":
+			for _, layout := range expiryDateFormats {
+				if t, err := time.Parse(layout, value); err == nil {
+					expiry, found = t, true
+					break
+				}
+			}
+		case "rule-id":
+			ruleID = value
+		}
+	}
+
+	if !found {
+		return time.Time{}, "", false
+	}
+
+	return expiry, ruleID, true
+}
+
+// headerValue splits the value of a key="value" pair from the remainder of the header, values
+// may be quoted, in which case they may contain commas and escaped quotes.
+func headerValue(s string) (string, string) {
+	s = strings.TrimLeft(s, " ")
+
+	if !strings.HasPrefix(s, `"`) {
+		value, rest, _ := strings.Cut(s, ",")
+		return strings.TrimSpace(value), rest
+	}
+
+	var value strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	// unterminated quote, use the remainder as the value
+	return value.String(), ""
+}
@@ -0,0 +1,96 @@
+package s3iofs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseExpiration(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		expiry time.Time
+		ruleID string
+		found  bool
+	}{
+		{
+			name:   "s3 format",
+			header: `expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="picture-deletion-rule"`,
+			expiry: time.Date(2012, 12, 23, 0, 0, 0, 0, time.UTC),
+			ruleID: "picture-deletion-rule",
+			found:  true,
+		},
+		{
+			name:   "rule id first with a comma",
+			header: `rule-id="expire, then delete",expiry-date="Mon, 01 Jan 2024 00:00:00 GMT"`,
+			expiry: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			ruleID: "expire, then delete",
+			found:  true,
+		},
+		{
+			name:   "escaped quote in rule id",
+			header: `expiry-date="Mon, 01 Jan 2024 00:00:00 GMT", rule-id="the \"old\" rule"`,
+			expiry: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			ruleID: `the "old" rule`,
+			found:  true,
+		},
+		{
+			name:   "numeric zone",
+			header: `expiry-date="Mon, 01 Jan 2024 10:00:00 +1000", rule-id="rule"`,
+			expiry: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			ruleID: "rule",
+			found:  true,
+		},
+		{
+			name:   "unquoted values",
+			header: `expiry-date=Mon, 01 Jan 2024 00:00:00 GMT`,
+			found:  false,
+		},
+		{
+			name:   "absent",
+			header: "",
+			found:  false,
+		},
+		{
+			name:   "invalid date",
+			header: `expiry-date="tomorrow", rule-id="rule"`,
+			found:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			expiry, ruleID, found := parseExpiration(tt.header)
+			assert.Equal(tt.found, found)
+			assert.True(tt.expiry.Equal(expiry), "expected %s got %s", tt.expiry, expiry)
+			assert.Equal(tt.ruleID, ruleID)
+		})
+	}
+}
+
+func TestS3FS_ExpiresAt(t *testing.T) {
+	assert := require.New(t)
+
+	mockClient := new(mockS3Client)
+	mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(3),
+		Expiration:    aws.String(`expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="thirty-days"`),
+	}, nil)
+
+	s3fs := NewWithClient("fooBucket", mockClient)
+
+	info, err := s3fs.StatObject("file.txt")
+	assert.NoError(err)
+
+	expiry, ruleID, ok := info.(File).ExpiresAt()
+	assert.True(ok)
+	assert.Equal("thirty-days", ruleID)
+	assert.True(time.Date(2012, 12, 23, 0, 0, 0, 0, time.UTC).Equal(expiry))
+}
@@ -0,0 +1,63 @@
+package s3iofs
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"time"
+)
+
+var (
+	_ File       = (*s3File)(nil)
+	_ ObjectInfo = (*s3File)(nil)
+)
+
+// ObjectInfo is implemented by the entries returned by ReadDir and the other listings, giving the
+// fields ListObjectsV2 returns for each object without a HeadObject.
+type ObjectInfo interface {
+	// ETag returns the entity tag of the object, this is empty for directories.
+	ETag() string
+	// StorageClass returns the storage class of the object, this is empty for directories.
+	StorageClass() string
+	// Owner returns the canonical user id of the owner of the object, this is empty unless the
+	// filesystem was created with WithFetchOwner.
+	Owner() string
+}
+
+// File is implemented by every file and directory returned by S3FS, such as from Open or OpenObject,
+// which avoids type assertions to reach the random access and s3 specific methods.
+type File interface {
+	fs.ReadDirFile
+	io.ReaderAt
+	io.Seeker
+	io.WriterTo
+	EncryptionInfo
+	ObjectInfo
+
+	// ContentType returns the MIME type of the object, this is empty for directories.
+	ContentType() string
+	// VersionID returns the version of the object the file reads, this is empty if the bucket isn't
+	// versioned, for directories and for entries returned by a listing.
+	VersionID() string
+	// Metadata returns the user metadata of the object with lowercase keys, this is empty for
+	// directories and entries which haven't been loaded with a HeadObject.
+	Metadata() map[string]string
+	// Key returns the s3 key of the object, for directories this is the prefix of the keys within it.
+	Key() string
+	// ExpiresAt returns the time the object will be removed by a lifecycle rule and the id of the rule,
+	// the result is false if the object has no expiration.
+	ExpiresAt() (time.Time, string, bool)
+	// Refresh reloads the metadata of the object with a HeadObject, returning fs.ErrNotExist if
+	// it has been removed.
+	Refresh(ctx context.Context) error
+}
+
+// OpenObject opens the named file or directory, this is the same as Open with the result typed as a File.
+func (s3fs *S3FS) OpenObject(name string) (File, error) {
+	f, err := s3fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.(File), nil
+}
@@ -0,0 +1,144 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_OpenObject(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "dir/file.txt", []byte("hello world"))
+	backend.Put("fooBucket", "dir/sub/nested.txt", []byte("nested"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("file", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenObject("dir/file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		assert.Equal("dir/file.txt", f.Key())
+		assert.NotEmpty(f.ETag())
+
+		buf := make([]byte, 5)
+		_, err = f.ReadAt(buf, 6)
+		assert.NoError(err)
+		assert.Equal("world", string(buf))
+
+		_, err = f.Seek(6, io.SeekStart)
+		assert.NoError(err)
+
+		var out bytes.Buffer
+		n, err := f.WriteTo(&out)
+		assert.NoError(err)
+		assert.Equal(int64(5), n)
+		assert.Equal("world", out.String())
+
+		// the file is consumed
+		n, err = f.WriteTo(&out)
+		assert.NoError(err)
+		assert.Zero(n)
+	})
+
+	t.Run("write to from the open body", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenObject("dir/file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.ResetCalls()
+
+		var out bytes.Buffer
+		_, err = f.WriteTo(&out)
+		assert.NoError(err)
+		assert.Equal("hello world", out.String())
+		assert.Equal(0, backend.Calls("GetObject"))
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenObject("dir")
+		assert.NoError(err)
+		defer f.Close()
+
+		assert.Equal("dir/", f.Key())
+
+		entries, err := f.ReadDir(-1)
+		assert.NoError(err)
+		assert.Equal([]string{"file.txt", "sub"}, entryNames(entries))
+
+		_, err = f.WriteTo(io.Discard)
+		assert.Error(err)
+	})
+}
+
+func TestFile_Refresh(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "dir/file.txt", []byte("hello"))
+	backend.Put("fooBucket", "dir/removed.txt", []byte("removed"))
+	backend.Put("fooBucket", "dir/sub/nested.txt", []byte("nested"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	entries, err := s3fs.ReadDir("dir")
+	assert.NoError(err)
+	assert.Equal([]string{"file.txt", "removed.txt", "sub"}, entryNames(entries))
+
+	file, removed, dir := entries[0].(File), entries[1].(File), entries[2].(File)
+
+	listedETag := file.ETag()
+	assert.NotEmpty(listedETag)
+	assert.Equal("STANDARD", file.StorageClass())
+
+	backend.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	backend.Put("fooBucket", "dir/file.txt", []byte("hello world"))
+	_, err = backend.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("fooBucket"),
+		Key:    aws.String("dir/removed.txt"),
+	})
+	assert.NoError(err)
+
+	backend.ResetCalls()
+
+	err = file.Refresh(context.Background())
+	assert.NoError(err)
+
+	info, err := file.Stat()
+	assert.NoError(err)
+	assert.Equal(int64(11), info.Size())
+	assert.True(info.ModTime().After(time.Now()))
+	assert.NotEqual(listedETag, file.ETag())
+	assert.Equal("STANDARD", file.StorageClass())
+	assert.Equal(1, backend.Calls("HeadObject"))
+
+	// the refreshed metadata is used by Info without another request
+	_, err = entries[0].Info()
+	assert.NoError(err)
+	assert.Equal(1, backend.Calls("HeadObject"))
+
+	err = removed.Refresh(context.Background())
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	var pathErr *fs.PathError
+	assert.ErrorAs(err, &pathErr)
+	assert.Equal("dir/removed.txt", pathErr.Path)
+
+	// directories are unchanged
+	assert.NoError(dir.Refresh(context.Background()))
+	assert.Equal(2, backend.Calls("HeadObject"))
+}
@@ -0,0 +1,31 @@
+package s3iofs
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_TestFS(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	for _, key := range []string{
+		"root.txt",
+		"dir/a.txt",
+		"dir/b.txt",
+		"dir/sub/c.txt",
+		"dir-other/d.txt",
+		"empty.txt",
+	} {
+		backend.Put("fooBucket", key, []byte("data of "+key))
+	}
+	backend.Put("fooBucket", "empty.txt", []byte{})
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	err := fstest.TestFS(s3fs, "root.txt", "dir/a.txt", "dir/b.txt", "dir/sub/c.txt", "dir-other/d.txt", "empty.txt")
+	assert.NoError(err)
+}
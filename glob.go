@@ -0,0 +1,127 @@
+package s3iofs
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var _ fs.GlobFS = (*S3FS)(nil)
+
+// Glob returns the names of all files matching the pattern, using the syntax of path.Match, the
+// result is in the same order as fs.Glob and nil if there is no match.
+//
+// Rather than reading every directory the pattern passes through, the keys are listed from the
+// longest literal prefix of the pattern, for example "logs/2024/*/app-*.json" lists "logs/2024/".
+//
+// Note:
+//   - A pattern without wildcards is checked with a single Stat.
+//   - When only the last element of the pattern has wildcards, the prefix is listed with a delimiter
+//     so the keys below the matching directories aren't read.
+//   - Otherwise the prefix is listed without a delimiter, which reads every key below it.
+func (s3fs *S3FS) Glob(pattern string) ([]string, error) {
+	// check the pattern is well formed
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	literal, ok := globLiteral(pattern)
+	if ok {
+		info, err := s3fs.Stat(pattern)
+		if err != nil || (!info.IsDir() && s3fs.opts.dir.isHidden(pattern)) {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	depth := strings.Count(pattern, "/") + 1
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s3fs.bucket),
+		Prefix:  aws.String(literal),
+		MaxKeys: s3fs.opts.dir.maxKeys(0),
+	}
+
+	// wildcards only in the last element need a single level listing
+	if !strings.Contains(pattern[len(literal):], "/") {
+		input.Delimiter = aws.String("/")
+	}
+
+	seen := map[string]bool{}
+	var matches []string
+
+	match := func(key string) error {
+		// keys deeper than the pattern are matched by the directory at the depth of the pattern
+		elems := strings.Split(strings.TrimSuffix(key, "/"), "/")
+		if len(elems) < depth {
+			return nil
+		}
+
+		name := strings.Join(elems[:depth], "/")
+		if seen[name] || !fs.ValidPath(name) {
+			return nil
+		}
+		seen[name] = true
+
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, name)
+		}
+
+		return nil
+	}
+
+	for {
+		listRes, err := s3fs.s3client.ListObjectsV2(s3fs.context(), input)
+		if err != nil {
+			return nil, pathError("glob", pattern, err)
+		}
+
+		for _, commonPrefix := range listRes.CommonPrefixes {
+			if err := match(aws.ToString(commonPrefix.Prefix)); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, obj := range listRes.Contents {
+			// hidden objects at the depth of the pattern are files, deeper ones still match their directory
+			key := aws.ToString(obj.Key)
+			if strings.Count(key, "/")+1 == depth && s3fs.opts.dir.isHidden(key) {
+				continue
+			}
+
+			if err := match(key); err != nil {
+				return nil, err
+			}
+		}
+
+		if !aws.ToBool(listRes.IsTruncated) {
+			break
+		}
+
+		input.ContinuationToken = listRes.NextContinuationToken
+	}
+
+	// all of the matches have the same depth, so this is the order fs.Glob returns them in
+	slices.SortFunc(matches, comparePaths)
+
+	return matches, nil
+}
+
+// globLiteral returns the part of the pattern before the first special character, and whether the
+// whole pattern is literal.
+func globLiteral(pattern string) (string, bool) {
+	i := strings.IndexAny(pattern, `*?[\`)
+	if i < 0 {
+		return pattern, true
+	}
+
+	return pattern[:i], false
+}
@@ -0,0 +1,89 @@
+package s3iofs
+
+import (
+	"io/fs"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// genericFS hides the Glob method so fs.Glob uses ReadDir.
+type genericFS struct {
+	fs.ReadDirFS
+}
+
+func TestS3FS_Glob(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	for _, key := range []string{
+		"logs/2024/01/app-1.json",
+		"logs/2024/01/app-2.json",
+		"logs/2024/01/db-1.json",
+		"logs/2024/02/app-1.json",
+		"logs/2024/02/app-1.txt",
+		"logs/2024-archive/01/app-1.json",
+		"logs/2023/01/app-1.json",
+		"other/01/app-1.json",
+		"root.txt",
+	} {
+		backend.Put("fooBucket", key, []byte("data"))
+	}
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "logs/2024/*/app-*.json", want: []string{"logs/2024/01/app-1.json", "logs/2024/01/app-2.json", "logs/2024/02/app-1.json"}},
+		{pattern: "logs/2024/*", want: []string{"logs/2024/01", "logs/2024/02"}},
+		{pattern: "logs/*", want: []string{"logs/2023", "logs/2024", "logs/2024-archive"}},
+		{pattern: "*/2024*/01", want: []string{"logs/2024/01", "logs/2024-archive/01"}},
+		{pattern: "*", want: []string{"logs", "other", "root.txt"}},
+		{pattern: "logs/2024/01/app-1.json", want: []string{"logs/2024/01/app-1.json"}},
+		{pattern: "logs/2024", want: []string{"logs/2024"}},
+		{pattern: "logs/missing", want: nil},
+		{pattern: "logs/2024/0[2-9]/*.txt", want: []string{"logs/2024/02/app-1.txt"}},
+		{pattern: "missing/*", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			assert := require.New(t)
+
+			got, err := s3fs.Glob(tt.pattern)
+			assert.NoError(err)
+			assert.Equal(tt.want, got)
+
+			generic, err := fs.Glob(genericFS{s3fs}, tt.pattern)
+			assert.NoError(err)
+			assert.Equal(generic, got)
+		})
+	}
+
+	t.Run("fewer listings than the generic glob", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+		_, err := fs.Glob(genericFS{s3fs}, "logs/2024/*/app-*.json")
+		assert.NoError(err)
+		generic := backend.Calls("ListObjectsV2")
+
+		backend.ResetCalls()
+		_, err = fs.Glob(s3fs, "logs/2024/*/app-*.json")
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+		assert.Less(backend.Calls("ListObjectsV2"), generic)
+	})
+
+	t.Run("bad pattern", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.Glob("logs/[")
+		assert.ErrorIs(err, path.ErrBadPattern)
+
+		_, err = s3fs.Glob("logs/\\")
+		assert.ErrorIs(err, path.ErrBadPattern)
+	})
+}
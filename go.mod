@@ -1,6 +1,6 @@
 module github.com/wolfeidau/s3iofs
 
-go 1.22
+go 1.23
 
 require (
 	github.com/aws/aws-sdk-go-v2 v1.32.4
@@ -9,6 +9,7 @@ require (
 	github.com/aws/smithy-go v1.22.0
 	github.com/rs/zerolog v1.33.0
 	github.com/stretchr/testify v1.9.0
+	go.uber.org/goleak v1.3.0
 	golang.org/x/net v0.31.0
 )
 
@@ -0,0 +1,70 @@
+package integration
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs"
+	"github.com/wolfeidau/s3iofs/s3afero"
+)
+
+func TestAferoFs(t *testing.T) {
+	assert := require.New(t)
+
+	afs := afero.NewBasePathFs(s3afero.NewAferoFs(s3iofs.NewWithClient(testBucketName, client)), "/test_afero")
+
+	err := afs.MkdirAll("/empty", 0o755)
+	assert.NoError(err)
+
+	info, err := afs.Stat("/empty")
+	assert.NoError(err)
+	assert.True(info.IsDir())
+
+	err = afero.WriteFile(afs, "/docs/readme.txt", generateData(oneMegabyte), 0o644)
+	assert.NoError(err)
+
+	f, err := afs.Create("/docs/notes.txt")
+	assert.NoError(err)
+	_, err = f.WriteString("notes")
+	assert.NoError(err)
+	assert.NoError(f.Close())
+
+	names, err := afero.ReadDir(afs, "/docs")
+	assert.NoError(err)
+	assert.Len(names, 2)
+
+	data, err := afero.ReadFile(afs, "/docs/readme.txt")
+	assert.NoError(err)
+	assert.Equal(generateData(oneMegabyte), data)
+
+	err = afs.Rename("/docs/notes.txt", "/docs/renamed.txt")
+	assert.NoError(err)
+
+	exists, err := afero.Exists(afs, "/docs/notes.txt")
+	assert.NoError(err)
+	assert.False(exists)
+
+	err = afs.Rename("/docs", "/moved")
+	assert.NoError(err)
+
+	data, err = afero.ReadFile(afs, "/moved/renamed.txt")
+	assert.NoError(err)
+	assert.Equal("notes", string(data))
+
+	err = afs.Remove("/moved")
+	assert.ErrorIs(err, os.ErrExist)
+
+	err = afs.RemoveAll("/moved")
+	assert.NoError(err)
+
+	err = afs.Remove("/empty")
+	assert.NoError(err)
+
+	exists, err = afero.DirExists(afs, "/moved")
+	assert.NoError(err)
+	assert.False(exists)
+
+	assert.ErrorIs(afs.Chmod("/file.txt", 0o600), os.ErrPermission)
+}
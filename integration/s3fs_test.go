@@ -1,15 +1,22 @@
 package integration
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/require"
 	"github.com/wolfeidau/s3iofs"
 )
@@ -63,6 +70,32 @@ func TestOpen(t *testing.T) {
 	assert.Error(err)
 }
 
+func TestOpenDirectory(t *testing.T) {
+	assert := require.New(t)
+
+	err := writeTestFile("test_open_dir/file.txt", oneKilobyte)
+	assert.NoError(err)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	// GetObject of the prefix fails with NoSuchKey, so the open falls back to listing it
+	f, err := s3fs.Open("test_open_dir")
+	assert.NoError(err)
+
+	info, err := f.Stat()
+	assert.NoError(err)
+	assert.True(info.IsDir())
+
+	entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal("file.txt", entries[0].Name())
+	assert.NoError(f.Close())
+
+	_, err = s3fs.Open("test_open_dir_missing")
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
+
 func TestStat(t *testing.T) {
 	assert := require.New(t)
 
@@ -194,6 +227,31 @@ func TestReaderAtBig(t *testing.T) {
 	assert.Equal(twoMegabytes, n)
 }
 
+func TestOpenObject(t *testing.T) {
+	assert := require.New(t)
+
+	err := writeTestFile("test_open_object.txt", oneKilobyte)
+	assert.NoError(err)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	f, err := s3fs.OpenObject("test_open_object.txt")
+	assert.NoError(err)
+
+	defer f.Close()
+
+	assert.Equal("test_open_object.txt", f.Key())
+	assert.NotEmpty(f.ETag())
+
+	n, err := f.ReadAt(make([]byte, 512), 512)
+	assert.NoError(err)
+	assert.Equal(512, n)
+
+	written, err := f.WriteTo(io.Discard)
+	assert.NoError(err)
+	assert.Equal(int64(1024), written)
+}
+
 func TestReadFile(t *testing.T) {
 	assert := require.New(t)
 
@@ -267,6 +325,45 @@ func TestRemove(t *testing.T) {
 	})
 }
 
+func TestRemoveResult(t *testing.T) {
+	assert := require.New(t)
+
+	bucket := createVersionedBucket(t, "testbucketremoveresult")
+
+	_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String("test_remove_result.txt"),
+		Body:   bytes.NewReader(oneKilobyte),
+	})
+	assert.NoError(err)
+
+	s3fs := s3iofs.NewWithClient(bucket, client)
+
+	res, err := s3fs.RemoveResult("test_remove_result.txt")
+	assert.NoError(err)
+	assert.True(res.DeleteMarkerCreated)
+	assert.NotEmpty(res.VersionID)
+}
+
+func TestAuditEncryption(t *testing.T) {
+	assert := require.New(t)
+
+	err := writeTestFile("test_audit_encryption/one.txt", oneKilobyte)
+	assert.NoError(err)
+
+	err = writeTestFile("test_audit_encryption/nested/two.txt", oneKilobyte)
+	assert.NoError(err)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	findings, err := s3fs.AuditEncryption(context.Background(), "test_audit_encryption", "")
+	assert.NoError(err)
+	assert.Len(findings, 2)
+	assert.Equal("test_audit_encryption/nested/two.txt", findings[0].Key)
+	assert.Equal("unencrypted", findings[0].Reason)
+	assert.Equal("test_audit_encryption/one.txt", findings[1].Key)
+}
+
 func TestWriteFile(t *testing.T) {
 
 	t.Run("should write and read file", func(t *testing.T) {
@@ -292,6 +389,228 @@ func TestWriteFile(t *testing.T) {
 	})
 }
 
+func TestWriteFrom(t *testing.T) {
+	assert := require.New(t)
+
+	// spool the upload to a temporary file
+	s3fs := s3iofs.NewWithClient(testBucketName, client, s3iofs.WithSpoolMemoryThreshold(int64(oneMegabyte)))
+
+	data := generateData(twoMegabytes)
+
+	res, err := s3fs.WriteFrom("test_write_from.txt", io.LimitReader(bytes.NewReader(data), int64(len(data))))
+	assert.NoError(err)
+	assert.NotEmpty(res.ETag)
+
+	got, err := fs.ReadFile(s3fs, "test_write_from.txt")
+	assert.NoError(err)
+	assert.Equal(data, got)
+}
+
+func TestCopyFS(t *testing.T) {
+	assert := require.New(t)
+
+	src := fstest.MapFS{
+		"index.html":    {Data: []byte("<html></html>")},
+		"css/style.css": {Data: []byte("body {}")},
+	}
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	err := s3fs.CopyFS(context.Background(), "test_copy_fs", src)
+	assert.NoError(err)
+
+	data, err := fs.ReadFile(s3fs, "test_copy_fs/css/style.css")
+	assert.NoError(err)
+	assert.Equal("body {}", string(data))
+
+	f, err := s3fs.OpenObject("test_copy_fs/index.html")
+	assert.NoError(err)
+	defer f.Close()
+
+	assert.Equal("text/html; charset=utf-8", f.ContentType())
+}
+
+func TestCopyToDir(t *testing.T) {
+	assert := require.New(t)
+
+	src := fstest.MapFS{
+		"a.txt":         {Data: generateData(oneMegabyte)},
+		"nested/b.bin":  {Data: []byte{0, 1, 2, 3}},
+		"nested/c/d.md": {Data: []byte("# d")},
+	}
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	err := s3fs.CopyFS(context.Background(), "test_copy_to_dir", src)
+	assert.NoError(err)
+
+	dest := t.TempDir()
+
+	err = s3fs.CopyToDir(context.Background(), "test_copy_to_dir", dest)
+	assert.NoError(err)
+
+	for name, file := range src {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		assert.NoError(err)
+		assert.Equal(file.Data, data, name)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	assert := require.New(t)
+
+	bucket := createVersionedBucket(t, "testbucketrestoreversion")
+
+	s3fs := s3iofs.NewWithClient(bucket, client)
+
+	var versions []*s3iofs.UploadResult
+	for _, data := range []string{"v1", "v2", "v3"} {
+		res, err := s3fs.WriteFileResult("config.json", []byte(data), 0644)
+		assert.NoError(err)
+		versions = append(versions, res)
+	}
+
+	res, err := s3fs.RestoreVersion(context.Background(), "config.json", versions[0].VersionID)
+	assert.NoError(err)
+	assert.NotEmpty(res.VersionID)
+
+	data, err := fs.ReadFile(s3fs, "config.json")
+	assert.NoError(err)
+	assert.Equal("v1", string(data))
+
+	_, err = s3fs.RollbackLatest(context.Background(), "config.json")
+	assert.NoError(err)
+
+	data, err = fs.ReadFile(s3fs, "config.json")
+	assert.NoError(err)
+	assert.Equal("v3", string(data))
+
+	_, err = s3fs.RestoreVersion(context.Background(), "config.json", "00000000-0000-0000-0000-000000000000")
+	assert.ErrorIs(err, s3iofs.ErrVersionNotFound)
+
+	err = s3fs.Remove("config.json")
+	assert.NoError(err)
+
+	_, err = s3fs.RollbackLatest(context.Background(), "config.json")
+	assert.ErrorIs(err, s3iofs.ErrDeleteMarker)
+
+	err = writeTestFile("test_restore_version.txt", oneKilobyte)
+	assert.NoError(err)
+
+	_, err = s3iofs.NewWithClient(testBucketName, client).RollbackLatest(context.Background(), "test_restore_version.txt")
+	assert.ErrorIs(err, s3iofs.ErrVersioningDisabled)
+}
+
+func TestRemoveVersion(t *testing.T) {
+	assert := require.New(t)
+
+	bucket := createVersionedBucket(t, "testbucketremoveversion")
+
+	s3fs := s3iofs.NewWithClient(bucket, client)
+
+	var versions []*s3iofs.UploadResult
+	for _, data := range []string{"v1", "v2"} {
+		res, err := s3fs.WriteFileResult("erase.txt", []byte(data), 0644)
+		assert.NoError(err)
+		versions = append(versions, res)
+	}
+
+	err := s3fs.RemoveVersion("erase.txt", versions[1].VersionID)
+	assert.NoError(err)
+
+	data, err := fs.ReadFile(s3fs, "erase.txt")
+	assert.NoError(err)
+	assert.Equal("v1", string(data))
+
+	err = s3fs.RemoveVersion("erase.txt", versions[0].VersionID)
+	assert.NoError(err)
+
+	_, err = s3fs.Stat("erase.txt")
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	err = s3fs.RemoveVersion("erase.txt", versions[0].VersionID)
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	err = s3fs.RemoveVersion("erase.txt", "")
+	assert.ErrorIs(err, fs.ErrInvalid)
+}
+
+func TestOpenVersion(t *testing.T) {
+	assert := require.New(t)
+
+	bucket := createVersionedBucket(t, "testbucketopenversion")
+
+	s3fs := s3iofs.NewWithClient(bucket, client)
+
+	contents := []string{"first version", "second"}
+
+	var versions []*s3iofs.UploadResult
+	for _, data := range contents {
+		res, err := s3fs.WriteFileResult("history.txt", []byte(data), 0644)
+		assert.NoError(err)
+		versions = append(versions, res)
+	}
+
+	for i, version := range versions {
+		f, err := s3fs.OpenVersion("history.txt", version.VersionID)
+		assert.NoError(err)
+
+		data, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(contents[i], string(data))
+
+		info, err := f.Stat()
+		assert.NoError(err)
+		assert.Equal(int64(len(contents[i])), info.Size())
+
+		assert.NoError(f.Close())
+	}
+
+	// a file opened before the object is replaced keeps reading the version it saw
+	f, err := s3fs.OpenObject("history.txt")
+	assert.NoError(err)
+	defer f.Close()
+
+	assert.Equal(versions[1].VersionID, f.VersionID())
+
+	_, err = s3fs.WriteFileResult("history.txt", []byte("third version"), 0644)
+	assert.NoError(err)
+
+	buf := make([]byte, 3)
+	_, err = f.ReadAt(buf, 3)
+	assert.NoError(err)
+	assert.Equal("ond", string(buf))
+
+	_, err = s3fs.OpenVersion("history.txt", "00000000-0000-0000-0000-000000000000")
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
+
+func TestOpenZipFS(t *testing.T) {
+	assert := require.New(t)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	w, err := zw.Create("nested/readme.txt")
+	assert.NoError(err)
+	_, err = w.Write(oneKilobyte)
+	assert.NoError(err)
+	assert.NoError(zw.Close())
+
+	err = writeTestFile("test_open_zip_fs/archive.zip", buf.Bytes())
+	assert.NoError(err)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	zfs, closer, err := s3fs.OpenZipFS("test_open_zip_fs/archive.zip")
+	assert.NoError(err)
+	defer closer.Close()
+
+	data, err := fs.ReadFile(zfs, "nested/readme.txt")
+	assert.NoError(err)
+	assert.Equal(oneKilobyte, data)
+}
+
 func TestReadDir(t *testing.T) {
 	assert := require.New(t)
 
@@ -313,6 +632,57 @@ func TestReadDir(t *testing.T) {
 	assert.True(entries[0].IsDir())
 }
 
+func TestFileAndDirectorySameName(t *testing.T) {
+	assert := require.New(t)
+
+	err := writeTestFile("test_same_name/data", oneKilobyte)
+	assert.NoError(err)
+
+	err = writeTestFile("test_same_name/data/one.txt", oneKilobyte)
+	assert.NoError(err)
+
+	err = writeTestFile("test_same_name/data/sub/two.txt", oneKilobyte)
+	assert.NoError(err)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	// the name is the file
+	finfo, err := s3fs.Stat("test_same_name/data")
+	assert.NoError(err)
+	assert.False(finfo.IsDir())
+	assert.Equal(int64(1024), finfo.Size())
+
+	data, err := fs.ReadFile(s3fs, "test_same_name/data")
+	assert.NoError(err)
+	assert.Equal(oneKilobyte, data)
+
+	// while reading it as a directory lists the prefix
+	entries, err := s3fs.ReadDir("test_same_name/data")
+	assert.NoError(err)
+	assert.Equal([]string{"one.txt", "sub"}, getNames(entries))
+
+	var walked []string
+	err = fs.WalkDir(s3fs, "test_same_name", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name += "/"
+		}
+		walked = append(walked, name)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{
+		"test_same_name/",
+		"test_same_name/data",
+		"test_same_name/data/",
+		"test_same_name/data/one.txt",
+		"test_same_name/data/sub/",
+		"test_same_name/data/sub/two.txt",
+	}, walked)
+}
+
 func TestFileReadDir(t *testing.T) {
 	assert := require.New(t)
 
@@ -346,6 +716,59 @@ func TestFileReadDir(t *testing.T) {
 	assert.Equal(io.EOF, err)
 }
 
+func TestUnion(t *testing.T) {
+	assert := require.New(t)
+
+	err := writeTestFile("test_union/hot/config.json", []byte("hot"))
+	assert.NoError(err)
+
+	err = writeTestFile("test_union/cold/config.json", []byte("cold"))
+	assert.NoError(err)
+
+	err = writeTestFile("test_union/cold/archive/2023.txt", oneKilobyte)
+	assert.NoError(err)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	hot, err := fs.Sub(s3fs, "test_union/hot")
+	assert.NoError(err)
+
+	cold, err := fs.Sub(s3fs, "test_union/cold")
+	assert.NoError(err)
+
+	union := s3iofs.NewUnion(hot, cold)
+
+	data, err := fs.ReadFile(union, "config.json")
+	assert.NoError(err)
+	assert.Equal("hot", string(data))
+
+	entries, err := fs.ReadDir(union, ".")
+	assert.NoError(err)
+	assert.Equal([]string{"archive", "config.json"}, getNames(entries))
+
+	_, err = fs.Stat(union, "missing.txt")
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
+
+func createVersionedBucket(t *testing.T, bucket string) string {
+	t.Helper()
+
+	_, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	require.NoError(t, err)
+
+	_, err = client.PutBucketVersioning(context.Background(), &s3.PutBucketVersioningInput{
+		Bucket: aws.String(bucket),
+		VersioningConfiguration: &types.VersioningConfiguration{
+			Status: types.BucketVersioningStatusEnabled,
+		},
+	})
+	require.NoError(t, err)
+
+	return bucket
+}
+
 func getNames(entries []fs.DirEntry) []string {
 	names := make([]string, len(entries))
 	for i, entry := range entries {
@@ -353,3 +776,308 @@ func getNames(entries []fs.DirEntry) []string {
 	}
 	return names
 }
+
+func TestSub(t *testing.T) {
+	assert := require.New(t)
+
+	for _, key := range []string{"test_sub/a.txt", "test_sub/nested/b.txt", "test_sub_other/c.txt"} {
+		err := writeTestFile(key, oneKilobyte)
+		assert.NoError(err)
+	}
+
+	var prefixes []string
+	s3fs := s3iofs.NewWithClient(testBucketName, client, s3iofs.WithInterceptor(
+		func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+			if params, ok := input.(*s3.ListObjectsV2Input); ok {
+				prefixes = append(prefixes, aws.ToString(params.Prefix))
+			}
+			return next(ctx)
+		},
+	))
+
+	sub, err := fs.Sub(s3fs, "test_sub")
+	assert.NoError(err)
+
+	var paths []string
+	err = fs.WalkDir(sub, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{".", "a.txt", "nested", "nested/b.txt"}, paths)
+
+	assert.NotEmpty(prefixes)
+	for _, prefix := range prefixes {
+		assert.True(prefix == "test_sub" || strings.HasPrefix(prefix, "test_sub/"), prefix)
+	}
+}
+
+func TestFSCompliance(t *testing.T) {
+	assert := require.New(t)
+
+	keys := []string{"root.txt", "dir/a.txt", "dir/b.txt", "dir/sub/c.txt", "dir-other/d.txt"}
+	for _, key := range keys {
+		err := writeTestFile("test_fstest/"+key, oneKilobyte)
+		assert.NoError(err)
+	}
+
+	sub, err := fs.Sub(s3iofs.NewWithClient(testBucketName, client), "test_fstest")
+	assert.NoError(err)
+
+	err = fstest.TestFS(sub, keys...)
+	assert.NoError(err)
+}
+
+func TestWriteFileMultipart(t *testing.T) {
+	assert := require.New(t)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client, s3iofs.WithMultipartThreshold(int64(oneMegabyte)))
+
+	data := make([]byte, 12*oneMegabyte)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	err := s3fs.WriteFile("test_write_multipart.bin", data, 0o644)
+	assert.NoError(err)
+
+	got, err := fs.ReadFile(s3fs, "test_write_multipart.bin")
+	assert.NoError(err)
+	assert.True(bytes.Equal(data, got))
+}
+
+func TestWriteMetadata(t *testing.T) {
+	assert := require.New(t)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	w, err := s3fs.Create("test_metadata.txt", s3iofs.WithMetadata(map[string]string{"Producer-ID": "abc"}))
+	assert.NoError(err)
+
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+
+	f, err := s3fs.OpenObject("test_metadata.txt")
+	assert.NoError(err)
+	defer f.Close()
+
+	assert.Equal(map[string]string{"producer-id": "abc"}, f.Metadata())
+}
+
+func TestWriteStorageClass(t *testing.T) {
+	assert := require.New(t)
+
+	// minio only supports the STANDARD and REDUCED_REDUNDANCY classes
+	s3fs := s3iofs.NewWithClient(testBucketName, client, s3iofs.WithDefaultStorageClass(types.StorageClassStandard))
+
+	err := s3fs.WriteFile("test_storage_class.txt", []byte("hello"), 0o644)
+	assert.NoError(err)
+
+	info, err := s3fs.StatObject("test_storage_class.txt")
+	assert.NoError(err)
+	assert.Equal("STANDARD", info.(s3iofs.File).StorageClass())
+
+	_, err = s3fs.WriteFileResult("test_storage_class.txt", []byte("hello"), 0o644, s3iofs.WithStorageClass("COLD"))
+	assert.ErrorIs(err, s3iofs.ErrInvalidStorageClass)
+}
+
+func TestWriteChecksum(t *testing.T) {
+	assert := require.New(t)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client, s3iofs.WithMultipartThreshold(int64(oneMegabyte)))
+
+	data := generateData(12 * oneMegabyte)
+
+	for _, name := range []string{"test_checksum_small.bin", "test_checksum_multipart.bin"} {
+		body := data
+		if name == "test_checksum_small.bin" {
+			body = data[:oneMegabyte]
+		}
+
+		_, err := s3fs.WriteFileResult(name, body, 0o644, s3iofs.WithChecksumAlgorithm(types.ChecksumAlgorithmCrc32c))
+		assert.NoError(err)
+
+		res, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket:       aws.String(testBucketName),
+			Key:          aws.String(name),
+			ChecksumMode: types.ChecksumModeEnabled,
+		})
+		assert.NoError(err)
+		assert.NotEmpty(aws.ToString(res.ChecksumCRC32C))
+
+		got, err := fs.ReadFile(s3fs, name)
+		assert.NoError(err)
+		assert.True(bytes.Equal(body, got))
+	}
+}
+
+func TestTags(t *testing.T) {
+	assert := require.New(t)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	w, err := s3fs.Create("test_tags.txt", s3iofs.WithTags(map[string]string{"cost-centre": "data eng"}))
+	assert.NoError(err)
+
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+
+	tags, err := s3fs.GetTags("test_tags.txt")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"cost-centre": "data eng"}, tags)
+
+	err = s3fs.SetTags("test_tags.txt", map[string]string{"retention": "90d"})
+	assert.NoError(err)
+
+	tags, err = s3fs.GetTags("test_tags.txt")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"retention": "90d"}, tags)
+}
+
+func TestWriteIfNoneMatch(t *testing.T) {
+	assert := require.New(t)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	_, err := s3fs.WriteFileResult("test_if_none_match.txt", []byte("first"), 0o644, s3iofs.WithIfNoneMatch())
+	assert.NoError(err)
+
+	_, err = s3fs.WriteFileResult("test_if_none_match.txt", []byte("second"), 0o644, s3iofs.WithIfNoneMatch())
+	assert.ErrorIs(err, fs.ErrExist)
+
+	data, err := fs.ReadFile(s3fs, "test_if_none_match.txt")
+	assert.NoError(err)
+	assert.Equal("first", string(data))
+}
+
+func TestWriteIfMatch(t *testing.T) {
+	assert := require.New(t)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	first, err := s3fs.WriteFileResult("test_if_match.txt", []byte("first"), 0o644)
+	assert.NoError(err)
+
+	_, err = s3fs.WriteFileResult("test_if_match.txt", []byte("second"), 0o644, s3iofs.WithIfMatch(first.ETag))
+	assert.NoError(err)
+
+	_, err = s3fs.WriteFileResult("test_if_match.txt", []byte("third"), 0o644, s3iofs.WithIfMatch(first.ETag))
+	assert.ErrorIs(err, s3iofs.ErrPreconditionFailed)
+
+	data, err := fs.ReadFile(s3fs, "test_if_match.txt")
+	assert.NoError(err)
+	assert.Equal("second", string(data))
+}
+
+func TestRename(t *testing.T) {
+	assert := require.New(t)
+
+	s3fs := s3iofs.NewWithClient(testBucketName, client)
+
+	err := s3fs.WriteFile("test_rename.csv", []byte("a,b\n1,2\n"), 0o644)
+	assert.NoError(err)
+
+	err = s3fs.Rename("test_rename.csv", "renamed/test_rename.csv")
+	assert.NoError(err)
+
+	_, err = s3fs.Stat("test_rename.csv")
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	f, err := s3fs.OpenObject("renamed/test_rename.csv")
+	assert.NoError(err)
+	defer f.Close()
+
+	assert.Equal("text/csv; charset=utf-8", f.ContentType())
+
+	data, err := io.ReadAll(f)
+	assert.NoError(err)
+	assert.Equal("a,b\n1,2\n", string(data))
+}
+
+func TestCopyMultipart(t *testing.T) {
+	assert := require.New(t)
+
+	// a low threshold exercises the multipart copy without a 5GiB object
+	s3fs := s3iofs.NewWithClient(testBucketName, client,
+		s3iofs.WithCopyThreshold(int64(oneMegabyte)),
+		s3iofs.WithCopyPartSize(s3iofs.DefaultPartSize),
+	)
+
+	data := generateData(12 * oneMegabyte)
+
+	_, err := s3fs.WriteFileResult("test_copy_multipart.bin", data, 0o644, s3iofs.WithMetadata(map[string]string{"producer": "etl"}))
+	assert.NoError(err)
+
+	err = s3fs.Copy("test_copy_multipart.bin", "test_copy_multipart_dst.bin")
+	assert.NoError(err)
+
+	f, err := s3fs.OpenObject("test_copy_multipart_dst.bin")
+	assert.NoError(err)
+	defer f.Close()
+
+	assert.Equal(map[string]string{"producer": "etl"}, f.Metadata())
+
+	got, err := io.ReadAll(f)
+	assert.NoError(err)
+	assert.True(bytes.Equal(data, got))
+}
+
+func BenchmarkWriteReaderConcurrency(b *testing.B) {
+	data := generateData(256 * oneMegabyte)
+
+	for _, concurrency := range []int{1, 4} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			s3fs := s3iofs.NewWithClient(testBucketName, client, s3iofs.WithUploadConcurrency(concurrency))
+
+			b.SetBytes(int64(len(data)))
+
+			for i := 0; i < b.N; i++ {
+				// hide the size so the data is streamed in parts
+				err := s3fs.WriteReader("bench_write_reader.bin", io.MultiReader(bytes.NewReader(data)), -1)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDownload(b *testing.B) {
+	const size = 256 * 1024 * 1024
+
+	err := writeTestFile("bench_download.bin", generateData(size))
+	require.NoError(b, err)
+
+	benchmarks := []struct {
+		name string
+		opts []s3iofs.Option
+	}{
+		{name: "single stream"},
+		{name: "4 ranges of 8MiB", opts: []s3iofs.Option{s3iofs.WithDownloadConcurrency(4, 8*1024*1024)}},
+		{name: "8 ranges of 16MiB", opts: []s3iofs.Option{s3iofs.WithDownloadConcurrency(8, 16*1024*1024)}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			s3fs := s3iofs.NewWithClient(testBucketName, client, bm.opts...)
+
+			b.SetBytes(size)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				n, err := s3fs.DownloadTo(context.Background(), "bench_download.bin", io.Discard)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != size {
+					b.Fatalf("downloaded %d of %d bytes", n, size)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var _ S3API = (*interceptedClient)(nil)
+
+// ErrInterceptorPanic is matched by the error returned when an interceptor panics.
+var ErrInterceptorPanic = errors.New("interceptor panicked")
+
+// Interceptor wraps every s3 call made by an S3FS, op is the name of the operation such as "GetObject"
+// and input is the request, for example a *s3.GetObjectInput, which may be modified before calling next.
+//
+// The interceptor controls the call, it may call next zero or more times, and must return either the
+// output returned by next or a value of the same type, for example a *s3.GetObjectOutput.
+type Interceptor func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error)
+
+// WithInterceptor adds an interceptor to the calls made by the filesystem.
+//
+// Interceptors run in the order they are added, the first is the outermost so it sees the call
+// before, and the result after, all of the others. A panic within an interceptor, or the call it
+// wraps, is recovered and returned as an error matching ErrInterceptorPanic.
+func WithInterceptor(interceptor Interceptor) Option {
+	return func(fo *fsOptions) {
+		fo.interceptors = append(fo.interceptors, interceptor)
+	}
+}
+
+// interceptedClient runs the interceptors around each call to the wrapped client.
+type interceptedClient struct {
+	inner        S3API
+	interceptors []Interceptor
+}
+
+func intercept[Out any](ctx context.Context, interceptors []Interceptor, op string, input any, call func(ctx context.Context) (Out, error)) (out Out, err error) {
+	next := func(ctx context.Context) (any, error) {
+		return call(ctx)
+	}
+
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(ctx context.Context) (any, error) {
+			return interceptor(ctx, op, input, inner)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %w: %v", op, ErrInterceptorPanic, r)
+		}
+	}()
+
+	res, err := next(ctx)
+	if err != nil {
+		return out, err
+	}
+
+	out, ok := res.(Out)
+	if !ok {
+		return out, fmt.Errorf("%s: interceptor returned %T, expected %T", op, res, out)
+	}
+
+	return out, nil
+}
+
+func (c *interceptedClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return intercept(ctx, c.interceptors, "GetObject", params, func(ctx context.Context) (*s3.GetObjectOutput, error) {
+		return c.inner.GetObject(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return intercept(ctx, c.interceptors, "ListObjectsV2", params, func(ctx context.Context) (*s3.ListObjectsV2Output, error) {
+		return c.inner.ListObjectsV2(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return intercept(ctx, c.interceptors, "HeadObject", params, func(ctx context.Context) (*s3.HeadObjectOutput, error) {
+		return c.inner.HeadObject(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return intercept(ctx, c.interceptors, "DeleteObject", params, func(ctx context.Context) (*s3.DeleteObjectOutput, error) {
+		return c.inner.DeleteObject(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return intercept(ctx, c.interceptors, "PutObject", params, func(ctx context.Context) (*s3.PutObjectOutput, error) {
+		return c.inner.PutObject(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	return intercept(ctx, c.interceptors, "CopyObject", params, func(ctx context.Context) (*s3.CopyObjectOutput, error) {
+		return c.inner.CopyObject(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return intercept(ctx, c.interceptors, "DeleteObjects", params, func(ctx context.Context) (*s3.DeleteObjectsOutput, error) {
+		return c.inner.DeleteObjects(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return intercept(ctx, c.interceptors, "CreateMultipartUpload", params, func(ctx context.Context) (*s3.CreateMultipartUploadOutput, error) {
+		return c.inner.CreateMultipartUpload(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return intercept(ctx, c.interceptors, "UploadPart", params, func(ctx context.Context) (*s3.UploadPartOutput, error) {
+		return c.inner.UploadPart(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	return intercept(ctx, c.interceptors, "UploadPartCopy", params, func(ctx context.Context) (*s3.UploadPartCopyOutput, error) {
+		return c.inner.UploadPartCopy(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return intercept(ctx, c.interceptors, "CompleteMultipartUpload", params, func(ctx context.Context) (*s3.CompleteMultipartUploadOutput, error) {
+		return c.inner.CompleteMultipartUpload(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return intercept(ctx, c.interceptors, "AbortMultipartUpload", params, func(ctx context.Context) (*s3.AbortMultipartUploadOutput, error) {
+		return c.inner.AbortMultipartUpload(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	return intercept(ctx, c.interceptors, "ListObjectVersions", params, func(ctx context.Context) (*s3.ListObjectVersionsOutput, error) {
+		return c.inner.ListObjectVersions(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return intercept(ctx, c.interceptors, "GetObjectTagging", params, func(ctx context.Context) (*s3.GetObjectTaggingOutput, error) {
+		return c.inner.GetObjectTagging(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	return intercept(ctx, c.interceptors, "PutObjectTagging", params, func(ctx context.Context) (*s3.PutObjectTaggingOutput, error) {
+		return c.inner.PutObjectTagging(ctx, params, optFns...)
+	})
+}
+
+func (c *interceptedClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return intercept(ctx, c.interceptors, "HeadBucket", params, func(ctx context.Context) (*s3.HeadBucketOutput, error) {
+		return c.inner.HeadBucket(ctx, params, optFns...)
+	})
+}
@@ -0,0 +1,112 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_WithInterceptor(t *testing.T) {
+	newBackend := func() *fakes3.Backend {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "file.txt", []byte("file"))
+		backend.Put("fooBucket", "other.txt", []byte("other"))
+		return backend
+	}
+
+	t.Run("order", func(t *testing.T) {
+		assert := require.New(t)
+
+		var calls []string
+
+		record := func(name string) Interceptor {
+			return func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+				calls = append(calls, name+" before "+op)
+				res, err := next(ctx)
+				calls = append(calls, name+" after "+op)
+				return res, err
+			}
+		}
+
+		s3fs := NewWithClient("fooBucket", newBackend(), WithInterceptor(record("outer")), WithInterceptor(record("inner")))
+
+		_, err := fs.ReadFile(s3fs, "file.txt")
+		assert.NoError(err)
+		assert.Equal([]string{
+			"outer before GetObject",
+			"inner before GetObject",
+			"inner after GetObject",
+			"outer after GetObject",
+		}, calls)
+	})
+
+	t.Run("modify input", func(t *testing.T) {
+		assert := require.New(t)
+
+		redirect := func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+			if in, ok := input.(*s3.GetObjectInput); ok {
+				in.Key = aws.String("other.txt")
+			}
+			return next(ctx)
+		}
+
+		s3fs := NewWithClient("fooBucket", newBackend(), WithInterceptor(redirect))
+
+		data, err := fs.ReadFile(s3fs, "file.txt")
+		assert.NoError(err)
+		assert.Equal("other", string(data))
+	})
+
+	t.Run("short circuit", func(t *testing.T) {
+		assert := require.New(t)
+
+		errDenied := errors.New("denied by policy")
+
+		deny := func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+			if op == "DeleteObject" {
+				return nil, errDenied
+			}
+			return next(ctx)
+		}
+
+		backend := newBackend()
+		s3fs := NewWithClient("fooBucket", backend, WithInterceptor(deny))
+
+		err := s3fs.Remove("file.txt")
+		assert.ErrorIs(err, errDenied)
+		assert.Equal(0, backend.Calls("DeleteObject"))
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		assert := require.New(t)
+
+		boom := func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+			panic("boom")
+		}
+
+		s3fs := NewWithClient("fooBucket", newBackend(), WithInterceptor(boom))
+
+		_, err := s3fs.ReadDir(".")
+		assert.ErrorIs(err, ErrInterceptorPanic)
+		assert.ErrorContains(err, "boom")
+	})
+
+	t.Run("wrong output type", func(t *testing.T) {
+		assert := require.New(t)
+
+		wrong := func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+			return &s3.HeadObjectOutput{}, nil
+		}
+
+		s3fs := NewWithClient("fooBucket", newBackend(), WithInterceptor(wrong))
+
+		_, err := s3fs.Open("file.txt")
+		assert.ErrorContains(err, "interceptor returned *s3.HeadObjectOutput")
+	})
+}
@@ -0,0 +1,1208 @@
+// Package fakes3 provides an in-memory implementation of the s3 operations used by s3iofs,
+// this is used to exercise pagination, ranges and bulk operations in tests without docker.
+package fakes3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const maxKeys = 1000
+
+// Object is a single version of an object stored in the fake backend.
+type Object struct {
+	Key          string
+	VersionID    string
+	Data         []byte
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+	Metadata     map[string]string
+	StorageClass types.StorageClass // empty for the default STANDARD class
+	DeleteMarker bool
+
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	Expires            *time.Time
+	Tags               map[string]string
+
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          string
+	BucketKeyEnabled     bool
+}
+
+type bucket struct {
+	versioned bool
+	objects   map[string][]*Object // versions of each key, the last entry is the current version
+	protected map[string]bool
+}
+
+type upload struct {
+	bucket string
+	key    string
+	input  *s3.CreateMultipartUploadInput
+	parts  map[int32][]byte
+}
+
+// Backend is an in-memory s3 backend.
+type Backend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	uploads map[string]*upload
+	calls   map[string]int
+	seq     int
+
+	// Now returns the time used for LastModified, it defaults to time.Now.
+	Now func() time.Time
+
+	// OnCall is invoked before every operation with the operation name and input, returning an
+	// error from it fails the operation with that error.
+	OnCall func(ctx context.Context, op string, input any) error
+}
+
+// New returns a backend containing the named empty buckets.
+func New(buckets ...string) *Backend {
+	b := &Backend{
+		buckets: map[string]*bucket{},
+		uploads: map[string]*upload{},
+		calls:   map[string]int{},
+		Now:     time.Now,
+	}
+	for _, name := range buckets {
+		b.buckets[name] = &bucket{objects: map[string][]*Object{}, protected: map[string]bool{}}
+	}
+	return b
+}
+
+// EnableVersioning turns on versioning for the named bucket.
+func (b *Backend) EnableVersioning(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buckets[name].versioned = true
+}
+
+// Protect makes deletes of the key fail with AccessDenied, as object lock would.
+func (b *Backend) Protect(bucketName, key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buckets[bucketName].protected[key] = true
+}
+
+// Put stores an object in the named bucket without recording a call.
+func (b *Backend) Put(bucketName, key string, data []byte) *Object {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.put(b.buckets[bucketName], &Object{Key: key, Data: data})
+}
+
+// Get returns the current version of the object, or nil if it doesn't exist.
+func (b *Backend) Get(bucketName, key string) *Object {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return current(b.buckets[bucketName], key)
+}
+
+// Keys returns the sorted keys of the current objects in the named bucket.
+func (b *Backend) Keys(bucketName string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedKeys(b.buckets[bucketName])
+}
+
+// Calls returns the number of times the named operation was invoked.
+func (b *Backend) Calls(op string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls[op]
+}
+
+// ResetCalls clears the recorded call counts.
+func (b *Backend) ResetCalls() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = map[string]int{}
+}
+
+func (b *Backend) enter(ctx context.Context, op string, input any) error {
+	b.mu.Lock()
+	b.calls[op]++
+	hook := b.OnCall
+	b.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if hook != nil {
+		return hook(ctx, op, input)
+	}
+
+	return nil
+}
+
+// GetObject returns the object data, honouring Range and IfMatch.
+func (b *Backend) GetObject(ctx context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := b.enter(ctx, "GetObject", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := lookup(bkt, aws.ToString(params.Key), aws.ToString(params.VersionId))
+	if obj == nil {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	if params.IfMatch != nil && aws.ToString(params.IfMatch) != obj.ETag {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+
+	data := obj.Data
+	out := &s3.GetObjectOutput{
+		ETag:         aws.String(obj.ETag),
+		LastModified: aws.Time(obj.LastModified),
+		ContentType:  aws.String(obj.ContentType),
+		Metadata:     copyMetadata(obj.Metadata),
+
+		CacheControl:       nilIfEmpty(obj.CacheControl),
+		ContentDisposition: nilIfEmpty(obj.ContentDisposition),
+		ContentEncoding:    nilIfEmpty(obj.ContentEncoding),
+		Expires:            obj.Expires,
+
+		ServerSideEncryption: obj.ServerSideEncryption,
+		SSEKMSKeyId:          nilIfEmpty(obj.SSEKMSKeyID),
+		BucketKeyEnabled:     aws.Bool(obj.BucketKeyEnabled),
+	}
+	if bkt.versioned {
+		out.VersionId = aws.String(obj.VersionID)
+	}
+
+	if params.Range != nil {
+		start, end, err := parseRange(aws.ToString(params.Range), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		data = data[start : end+1]
+		out.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.Data)))
+	}
+
+	out.ContentLength = aws.Int64(int64(len(data)))
+	out.Body = io.NopCloser(bytes.NewReader(data))
+
+	return out, nil
+}
+
+// HeadObject returns the object metadata.
+func (b *Backend) HeadObject(ctx context.Context, params *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := b.enter(ctx, "HeadObject", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := lookup(bkt, aws.ToString(params.Key), aws.ToString(params.VersionId))
+	if obj == nil {
+		// s3 refuses a head of a delete marker by version id
+		for _, version := range bkt.objects[aws.ToString(params.Key)] {
+			if version.DeleteMarker && version.VersionID == aws.ToString(params.VersionId) {
+				return nil, &smithy.GenericAPIError{Code: "MethodNotAllowed", Message: "The specified method is not allowed against this resource."}
+			}
+		}
+		return nil, &types.NotFound{Message: aws.String("Not Found")}
+	}
+
+	out := &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(obj.Data))),
+		ETag:          aws.String(obj.ETag),
+		LastModified:  aws.Time(obj.LastModified),
+		ContentType:   aws.String(obj.ContentType),
+		Metadata:      copyMetadata(obj.Metadata),
+		StorageClass:  obj.StorageClass,
+
+		CacheControl:       nilIfEmpty(obj.CacheControl),
+		ContentDisposition: nilIfEmpty(obj.ContentDisposition),
+		ContentEncoding:    nilIfEmpty(obj.ContentEncoding),
+		Expires:            obj.Expires,
+
+		ServerSideEncryption: obj.ServerSideEncryption,
+		SSEKMSKeyId:          nilIfEmpty(obj.SSEKMSKeyID),
+		BucketKeyEnabled:     aws.Bool(obj.BucketKeyEnabled),
+	}
+	if bkt.versioned {
+		out.VersionId = aws.String(obj.VersionID)
+	}
+
+	return out, nil
+}
+
+// ListObjectsV2 lists the current objects, honouring Prefix, Delimiter, MaxKeys, StartAfter
+// and ContinuationToken.
+func (b *Backend) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if err := b.enter(ctx, "ListObjectsV2", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := aws.ToString(params.Prefix)
+	delimiter := aws.ToString(params.Delimiter)
+	startAfter := aws.ToString(params.StartAfter)
+	token := aws.ToString(params.ContinuationToken)
+
+	limit := int(aws.ToInt32(params.MaxKeys))
+	if params.MaxKeys == nil || limit > maxKeys {
+		limit = maxKeys
+	}
+
+	out := &s3.ListObjectsV2Output{
+		Name:              params.Bucket,
+		Prefix:            params.Prefix,
+		Delimiter:         params.Delimiter,
+		MaxKeys:           aws.Int32(int32(limit)),
+		StartAfter:        params.StartAfter,
+		ContinuationToken: params.ContinuationToken,
+		IsTruncated:       aws.Bool(false),
+	}
+
+	var (
+		count int
+		last  string
+	)
+
+	for _, key := range sortedKeys(bkt) {
+		if !strings.HasPrefix(key, prefix) || key <= startAfter {
+			continue
+		}
+
+		// the continuation token records the last key or common prefix returned
+		if token != "" && (key <= token || strings.HasSuffix(token, delimiter) && delimiter != "" && strings.HasPrefix(key, token)) {
+			continue
+		}
+
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				commonPrefix := key[:len(prefix)+idx+len(delimiter)]
+				if commonPrefix == last {
+					continue
+				}
+
+				if count == limit {
+					out.IsTruncated = aws.Bool(true)
+					break
+				}
+
+				out.CommonPrefixes = append(out.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+				last = commonPrefix
+				count++
+				continue
+			}
+		}
+
+		if count == limit {
+			out.IsTruncated = aws.Bool(true)
+			break
+		}
+
+		obj := current(bkt, key)
+		out.Contents = append(out.Contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(obj.Data))),
+			ETag:         aws.String(obj.ETag),
+			LastModified: aws.Time(obj.LastModified),
+			StorageClass: objectStorageClass(obj.StorageClass),
+		})
+		last = key
+		count++
+	}
+
+	out.KeyCount = aws.Int32(int32(count))
+	if aws.ToBool(out.IsTruncated) {
+		out.NextContinuationToken = aws.String(last)
+	}
+
+	return out, nil
+}
+
+// DeleteObject removes the object, adding a delete marker when the bucket is versioned.
+func (b *Backend) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := b.enter(ctx, "DeleteObject", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if bkt.protected[aws.ToString(params.Key)] {
+		return nil, accessDenied()
+	}
+
+	return b.delete(bkt, aws.ToString(params.Key), aws.ToString(params.VersionId)), nil
+}
+
+// PutObject stores the object.
+func (b *Backend) PutObject(ctx context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := b.enter(ctx, "PutObject", params); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if params.Body != nil {
+		var err error
+		data, err = io.ReadAll(params.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.ToString(params.IfNoneMatch) == "*" && current(bkt, aws.ToString(params.Key)) != nil {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+
+	obj := b.put(bkt, &Object{
+		Key:          aws.ToString(params.Key),
+		Data:         data,
+		ContentType:  aws.ToString(params.ContentType),
+		Metadata:     copyMetadata(params.Metadata),
+		StorageClass: params.StorageClass,
+
+		CacheControl:       aws.ToString(params.CacheControl),
+		ContentDisposition: aws.ToString(params.ContentDisposition),
+		ContentEncoding:    aws.ToString(params.ContentEncoding),
+		Expires:            params.Expires,
+		Tags:               parseTagging(params.Tagging),
+
+		ServerSideEncryption: params.ServerSideEncryption,
+		SSEKMSKeyID:          aws.ToString(params.SSEKMSKeyId),
+		BucketKeyEnabled:     aws.ToBool(params.BucketKeyEnabled),
+	})
+
+	out := &s3.PutObjectOutput{ETag: aws.String(obj.ETag)}
+	if bkt.versioned {
+		out.VersionId = aws.String(obj.VersionID)
+	}
+
+	return out, nil
+}
+
+// CopyObject copies an object within the backend.
+func (b *Backend) CopyObject(ctx context.Context, params *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if err := b.enter(ctx, "CopyObject", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	src, err := b.copySource(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, err
+	}
+
+	if params.CopySourceIfMatch != nil && aws.ToString(params.CopySourceIfMatch) != src.ETag {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{
+		Key:         aws.ToString(params.Key),
+		Data:        src.Data,
+		ContentType: src.ContentType,
+		Metadata:    copyMetadata(src.Metadata),
+
+		CacheControl:       src.CacheControl,
+		ContentDisposition: src.ContentDisposition,
+		ContentEncoding:    src.ContentEncoding,
+		Expires:            src.Expires,
+		Tags:               copyMetadata(src.Tags),
+
+		// the storage class isn't copied from the source
+		StorageClass: params.StorageClass,
+	}
+	if params.TaggingDirective == types.TaggingDirectiveReplace {
+		obj.Tags = parseTagging(params.Tagging)
+	}
+	if params.MetadataDirective == types.MetadataDirectiveReplace {
+		obj.ContentType = aws.ToString(params.ContentType)
+		obj.Metadata = copyMetadata(params.Metadata)
+		obj.CacheControl = aws.ToString(params.CacheControl)
+		obj.ContentDisposition = aws.ToString(params.ContentDisposition)
+		obj.ContentEncoding = aws.ToString(params.ContentEncoding)
+		obj.Expires = params.Expires
+	}
+
+	obj = b.put(bkt, obj)
+
+	out := &s3.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{
+			ETag:         aws.String(obj.ETag),
+			LastModified: aws.Time(obj.LastModified),
+		},
+	}
+	if bkt.versioned {
+		out.VersionId = aws.String(obj.VersionID)
+	}
+
+	return out, nil
+}
+
+// DeleteObjects removes a batch of objects.
+func (b *Backend) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	if err := b.enter(ctx, "DeleteObjects", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params.Delete.Objects) > maxKeys {
+		return nil, &smithy.GenericAPIError{Code: "MalformedXML", Message: "too many keys"}
+	}
+
+	out := &s3.DeleteObjectsOutput{}
+	for _, obj := range params.Delete.Objects {
+		if bkt.protected[aws.ToString(obj.Key)] {
+			out.Errors = append(out.Errors, types.Error{
+				Key:     obj.Key,
+				Code:    aws.String("AccessDenied"),
+				Message: aws.String("Access Denied because object protected by object lock."),
+			})
+			continue
+		}
+
+		res := b.delete(bkt, aws.ToString(obj.Key), aws.ToString(obj.VersionId))
+		if !aws.ToBool(params.Delete.Quiet) {
+			out.Deleted = append(out.Deleted, types.DeletedObject{
+				Key:          obj.Key,
+				VersionId:    res.VersionId,
+				DeleteMarker: res.DeleteMarker,
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// CreateMultipartUpload starts a multipart upload.
+func (b *Backend) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if err := b.enter(ctx, "CreateMultipartUpload", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.bucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	b.seq++
+	id := fmt.Sprintf("upload-%d", b.seq)
+	b.uploads[id] = &upload{
+		bucket: aws.ToString(params.Bucket),
+		key:    aws.ToString(params.Key),
+		input:  params,
+		parts:  map[int32][]byte{},
+	}
+
+	return &s3.CreateMultipartUploadOutput{
+		Bucket:   params.Bucket,
+		Key:      params.Key,
+		UploadId: aws.String(id),
+	}, nil
+}
+
+// UploadPart stores the body as a part of a multipart upload.
+func (b *Backend) UploadPart(ctx context.Context, params *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if err := b.enter(ctx, "UploadPart", params); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	up, ok := b.uploads[aws.ToString(params.UploadId)]
+	if !ok {
+		return nil, &types.NoSuchUpload{Message: aws.String("The specified upload does not exist.")}
+	}
+
+	out := &s3.UploadPartOutput{ETag: aws.String(etag(data))}
+
+	// parts of an upload with a checksum algorithm carry their checksum, which is checked against
+	// the one sent by the client
+	if algorithm := up.input.ChecksumAlgorithm; algorithm != "" {
+		if params.ChecksumAlgorithm != algorithm {
+			return nil, &smithy.GenericAPIError{Code: "InvalidRequest", Message: "Checksum Type mismatch occurred."}
+		}
+
+		sum := checksum(algorithm, data)
+		sent := partChecksum(algorithm, params.ChecksumCRC32, params.ChecksumCRC32C, params.ChecksumSHA1, params.ChecksumSHA256)
+		if sent != nil && aws.ToString(sent) != sum {
+			return nil, &smithy.GenericAPIError{Code: "BadDigest", Message: "The " + string(algorithm) + " you specified did not match the calculated checksum."}
+		}
+
+		switch algorithm {
+		case types.ChecksumAlgorithmCrc32:
+			out.ChecksumCRC32 = aws.String(sum)
+		case types.ChecksumAlgorithmCrc32c:
+			out.ChecksumCRC32C = aws.String(sum)
+		case types.ChecksumAlgorithmSha1:
+			out.ChecksumSHA1 = aws.String(sum)
+		case types.ChecksumAlgorithmSha256:
+			out.ChecksumSHA256 = aws.String(sum)
+		}
+	}
+
+	up.parts[aws.ToInt32(params.PartNumber)] = data
+
+	return out, nil
+}
+
+// UploadPartCopy copies a range of an existing object into a part of a multipart upload.
+func (b *Backend) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, _ ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	if err := b.enter(ctx, "UploadPartCopy", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	up, ok := b.uploads[aws.ToString(params.UploadId)]
+	if !ok {
+		return nil, &types.NoSuchUpload{Message: aws.String("The specified upload does not exist.")}
+	}
+
+	src, err := b.copySource(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, err
+	}
+
+	if params.CopySourceIfMatch != nil && aws.ToString(params.CopySourceIfMatch) != src.ETag {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+
+	data := src.Data
+	if params.CopySourceRange != nil {
+		start, end, err := parseRange(aws.ToString(params.CopySourceRange), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		data = data[start : end+1]
+	}
+
+	up.parts[aws.ToInt32(params.PartNumber)] = append([]byte(nil), data...)
+
+	res := &types.CopyPartResult{ETag: aws.String(etag(data))}
+
+	// parts of an upload with a checksum algorithm carry their checksum, as they do for UploadPart
+	if algorithm := up.input.ChecksumAlgorithm; algorithm != "" {
+		sum := aws.String(checksum(algorithm, data))
+		switch algorithm {
+		case types.ChecksumAlgorithmCrc32:
+			res.ChecksumCRC32 = sum
+		case types.ChecksumAlgorithmCrc32c:
+			res.ChecksumCRC32C = sum
+		case types.ChecksumAlgorithmSha1:
+			res.ChecksumSHA1 = sum
+		case types.ChecksumAlgorithmSha256:
+			res.ChecksumSHA256 = sum
+		}
+	}
+
+	return &s3.UploadPartCopyOutput{CopyPartResult: res}, nil
+}
+
+// CompleteMultipartUpload assembles the parts of a multipart upload into an object.
+func (b *Backend) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := b.enter(ctx, "CompleteMultipartUpload", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	up, ok := b.uploads[aws.ToString(params.UploadId)]
+	if !ok {
+		return nil, &types.NoSuchUpload{Message: aws.String("The specified upload does not exist.")}
+	}
+
+	var (
+		data []byte
+		sums []byte
+	)
+
+	for i, part := range params.MultipartUpload.Parts {
+		if aws.ToInt32(part.PartNumber) != int32(i+1) {
+			return nil, &smithy.GenericAPIError{Code: "InvalidPartOrder", Message: "The list of parts was not in ascending order."}
+		}
+		body, ok := up.parts[aws.ToInt32(part.PartNumber)]
+		if !ok {
+			return nil, &smithy.GenericAPIError{Code: "InvalidPart", Message: "One or more of the specified parts could not be found."}
+		}
+		if algorithm := up.input.ChecksumAlgorithm; algorithm != "" {
+			sent := partChecksum(algorithm, part.ChecksumCRC32, part.ChecksumCRC32C, part.ChecksumSHA1, part.ChecksumSHA256)
+			if aws.ToString(sent) != checksum(algorithm, body) {
+				return nil, &smithy.GenericAPIError{Code: "InvalidPart", Message: "One or more of the specified parts could not be found."}
+			}
+		}
+		sum := md5.Sum(body)
+		sums = append(sums, sum[:]...)
+		data = append(data, body...)
+	}
+
+	bkt := b.buckets[up.bucket]
+
+	if aws.ToString(params.IfNoneMatch) == "*" && current(bkt, up.key) != nil {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+
+	delete(b.uploads, aws.ToString(params.UploadId))
+	obj := b.put(bkt, &Object{
+		Key:          up.key,
+		Data:         data,
+		ContentType:  aws.ToString(up.input.ContentType),
+		Metadata:     copyMetadata(up.input.Metadata),
+		StorageClass: up.input.StorageClass,
+
+		CacheControl:       aws.ToString(up.input.CacheControl),
+		ContentDisposition: aws.ToString(up.input.ContentDisposition),
+		ContentEncoding:    aws.ToString(up.input.ContentEncoding),
+		Expires:            up.input.Expires,
+		Tags:               parseTagging(up.input.Tagging),
+
+		ServerSideEncryption: up.input.ServerSideEncryption,
+		SSEKMSKeyID:          aws.ToString(up.input.SSEKMSKeyId),
+		BucketKeyEnabled:     aws.ToBool(up.input.BucketKeyEnabled),
+	})
+
+	sum := md5.Sum(sums)
+	obj.ETag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(params.MultipartUpload.Parts))
+
+	out := &s3.CompleteMultipartUploadOutput{
+		Bucket: aws.String(up.bucket),
+		Key:    aws.String(up.key),
+		ETag:   aws.String(obj.ETag),
+	}
+	if bkt.versioned {
+		out.VersionId = aws.String(obj.VersionID)
+	}
+
+	return out, nil
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts.
+func (b *Backend) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if err := b.enter(ctx, "AbortMultipartUpload", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.uploads[aws.ToString(params.UploadId)]; !ok {
+		return nil, &types.NoSuchUpload{Message: aws.String("The specified upload does not exist.")}
+	}
+
+	delete(b.uploads, aws.ToString(params.UploadId))
+
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// GetObjectTagging returns the tags of an object.
+func (b *Backend) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, _ ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	if err := b.enter(ctx, "GetObjectTagging", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := lookup(bkt, aws.ToString(params.Key), aws.ToString(params.VersionId))
+	if obj == nil {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	out := &s3.GetObjectTaggingOutput{TagSet: []types.Tag{}}
+	for k, v := range obj.Tags {
+		out.TagSet = append(out.TagSet, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	sort.Slice(out.TagSet, func(i, j int) bool { return aws.ToString(out.TagSet[i].Key) < aws.ToString(out.TagSet[j].Key) })
+
+	if bkt.versioned {
+		out.VersionId = aws.String(obj.VersionID)
+	}
+
+	return out, nil
+}
+
+// PutObjectTagging replaces the tags of an object, this doesn't create a new version.
+func (b *Backend) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, _ ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	if err := b.enter(ctx, "PutObjectTagging", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := lookup(bkt, aws.ToString(params.Key), aws.ToString(params.VersionId))
+	if obj == nil {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	tags := map[string]string{}
+	if params.Tagging != nil {
+		for _, tag := range params.Tagging.TagSet {
+			tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+	obj.Tags = tags
+
+	out := &s3.PutObjectTaggingOutput{}
+	if bkt.versioned {
+		out.VersionId = aws.String(obj.VersionID)
+	}
+
+	return out, nil
+}
+
+// HeadBucket succeeds when the bucket exists.
+func (b *Backend) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, _ ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if err := b.enter(ctx, "HeadBucket", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.bucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// ListObjectVersions lists every version and delete marker, newest first within each key,
+// honouring Prefix, MaxKeys, KeyMarker and VersionIdMarker.
+func (b *Backend) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, _ ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if err := b.enter(ctx, "ListObjectVersions", params); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt, err := b.bucket(params.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := aws.ToString(params.Prefix)
+	keyMarker := aws.ToString(params.KeyMarker)
+	versionMarker := aws.ToString(params.VersionIdMarker)
+
+	limit := int(aws.ToInt32(params.MaxKeys))
+	if params.MaxKeys == nil || limit > maxKeys {
+		limit = maxKeys
+	}
+
+	out := &s3.ListObjectVersionsOutput{
+		Name:            params.Bucket,
+		Prefix:          params.Prefix,
+		MaxKeys:         aws.Int32(int32(limit)),
+		KeyMarker:       params.KeyMarker,
+		VersionIdMarker: params.VersionIdMarker,
+		IsTruncated:     aws.Bool(false),
+	}
+
+	keys := make([]string, 0, len(bkt.objects))
+	for key := range bkt.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var count int
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key < keyMarker {
+			continue
+		}
+
+		versions := bkt.objects[key]
+		for i := len(versions) - 1; i >= 0; i-- {
+			obj := versions[i]
+
+			// the markers record the last version returned
+			if key == keyMarker {
+				if versionMarker == "" {
+					break
+				}
+				if obj.VersionID != versionMarker {
+					continue
+				}
+				// resume with the next version of this key
+				keyMarker = ""
+				continue
+			}
+
+			if count == limit {
+				out.IsTruncated = aws.Bool(true)
+				return out, nil
+			}
+
+			latest := aws.Bool(i == len(versions)-1)
+			if obj.DeleteMarker {
+				out.DeleteMarkers = append(out.DeleteMarkers, types.DeleteMarkerEntry{
+					Key:          aws.String(key),
+					VersionId:    aws.String(obj.VersionID),
+					IsLatest:     latest,
+					LastModified: aws.Time(obj.LastModified),
+				})
+			} else {
+				out.Versions = append(out.Versions, types.ObjectVersion{
+					Key:          aws.String(key),
+					VersionId:    aws.String(obj.VersionID),
+					IsLatest:     latest,
+					ETag:         aws.String(obj.ETag),
+					Size:         aws.Int64(int64(len(obj.Data))),
+					LastModified: aws.Time(obj.LastModified),
+					StorageClass: types.ObjectVersionStorageClassStandard,
+				})
+			}
+
+			out.NextKeyMarker = aws.String(key)
+			out.NextVersionIdMarker = aws.String(obj.VersionID)
+			count++
+		}
+	}
+
+	out.NextKeyMarker = nil
+	out.NextVersionIdMarker = nil
+
+	return out, nil
+}
+
+// Uploads returns the number of multipart uploads which have not been completed or aborted.
+func (b *Backend) Uploads() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.uploads)
+}
+
+func (b *Backend) bucket(name *string) (*bucket, error) {
+	bkt, ok := b.buckets[aws.ToString(name)]
+	if !ok {
+		return nil, &types.NoSuchBucket{Message: aws.String("The specified bucket does not exist")}
+	}
+	return bkt, nil
+}
+
+func (b *Backend) copySource(source string) (*Object, error) {
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		return nil, &smithy.GenericAPIError{Code: "InvalidArgument", Message: err.Error()}
+	}
+
+	source, versionID, _ := strings.Cut(source, "?versionId=")
+
+	bucketName, key, ok := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if !ok {
+		return nil, &smithy.GenericAPIError{Code: "InvalidArgument", Message: "Invalid copy source"}
+	}
+
+	bkt, err := b.bucket(aws.String(bucketName))
+	if err != nil {
+		return nil, err
+	}
+
+	obj := lookup(bkt, key, versionID)
+	if obj == nil && versionID != "" {
+		for _, version := range bkt.objects[key] {
+			if version.VersionID == versionID {
+				return nil, &smithy.GenericAPIError{Code: "InvalidRequest", Message: "The source of a copy request may not specifically refer to a delete marker by version id."}
+			}
+		}
+		return nil, &smithy.GenericAPIError{Code: "NoSuchVersion", Message: "The specified version does not exist."}
+	}
+	if obj == nil {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	return obj, nil
+}
+
+func (b *Backend) put(bkt *bucket, obj *Object) *Object {
+	b.seq++
+	obj.ETag = etag(obj.Data)
+	obj.LastModified = b.Now().UTC().Truncate(time.Second)
+	obj.VersionID = "null"
+	if obj.ContentType == "" {
+		obj.ContentType = "binary/octet-stream"
+	}
+
+	if bkt.versioned {
+		obj.VersionID = strconv.Itoa(b.seq)
+		bkt.objects[obj.Key] = append(bkt.objects[obj.Key], obj)
+		return obj
+	}
+
+	bkt.objects[obj.Key] = []*Object{obj}
+
+	return obj
+}
+
+func (b *Backend) delete(bkt *bucket, key, versionID string) *s3.DeleteObjectOutput {
+	if versionID != "" {
+		versions := bkt.objects[key]
+		for i, obj := range versions {
+			if obj.VersionID == versionID {
+				bkt.objects[key] = append(versions[:i:i], versions[i+1:]...)
+				if len(bkt.objects[key]) == 0 {
+					delete(bkt.objects, key)
+				}
+				return &s3.DeleteObjectOutput{VersionId: aws.String(versionID), DeleteMarker: aws.Bool(obj.DeleteMarker)}
+			}
+		}
+		return &s3.DeleteObjectOutput{}
+	}
+
+	if !bkt.versioned {
+		delete(bkt.objects, key)
+		return &s3.DeleteObjectOutput{}
+	}
+
+	b.seq++
+	marker := &Object{
+		Key:          key,
+		VersionID:    strconv.Itoa(b.seq),
+		LastModified: b.Now().UTC().Truncate(time.Second),
+		DeleteMarker: true,
+	}
+	bkt.objects[key] = append(bkt.objects[key], marker)
+
+	return &s3.DeleteObjectOutput{VersionId: aws.String(marker.VersionID), DeleteMarker: aws.Bool(true)}
+}
+
+func accessDenied() error {
+	return &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+}
+
+func current(bkt *bucket, key string) *Object {
+	versions := bkt.objects[key]
+	if len(versions) == 0 {
+		return nil
+	}
+
+	obj := versions[len(versions)-1]
+	if obj.DeleteMarker {
+		return nil
+	}
+
+	return obj
+}
+
+func lookup(bkt *bucket, key, versionID string) *Object {
+	if versionID == "" {
+		return current(bkt, key)
+	}
+
+	for _, obj := range bkt.objects[key] {
+		if obj.VersionID == versionID && !obj.DeleteMarker {
+			return obj
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys(bkt *bucket) []string {
+	keys := make([]string, 0, len(bkt.objects))
+	for key := range bkt.objects {
+		if current(bkt, key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseRange(rng string, size int64) (int64, int64, error) {
+	invalid := &smithy.GenericAPIError{Code: "InvalidRange", Message: "The requested range is not satisfiable"}
+
+	spec, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok {
+		return 0, 0, invalid
+	}
+
+	startStr, endStr, _ := strings.Cut(spec, "-")
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, invalid
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, invalid
+		}
+		end = min(end, size-1)
+	}
+
+	return start, end, nil
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+
+	res := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		res[k] = v
+	}
+
+	return res
+}
+
+// objectStorageClass returns the storage class reported for an object in a listing.
+func objectStorageClass(storageClass types.StorageClass) types.ObjectStorageClass {
+	if storageClass == "" {
+		return types.ObjectStorageClassStandard
+	}
+	return types.ObjectStorageClass(storageClass)
+}
+
+// checksum returns the base64 encoded checksum of the data with the algorithm.
+func checksum(algorithm types.ChecksumAlgorithm, data []byte) string {
+	var h hash.Hash
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		h = crc32.NewIEEE()
+	case types.ChecksumAlgorithmCrc32c:
+		h = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case types.ChecksumAlgorithmSha1:
+		h = sha1.New()
+	default:
+		h = sha256.New()
+	}
+	h.Write(data)
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// partChecksum returns the checksum for the algorithm from those of a part.
+func partChecksum(algorithm types.ChecksumAlgorithm, sumCRC32, sumCRC32C, sumSHA1, sumSHA256 *string) *string {
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		return sumCRC32
+	case types.ChecksumAlgorithmCrc32c:
+		return sumCRC32C
+	case types.ChecksumAlgorithmSha1:
+		return sumSHA1
+	default:
+		return sumSHA256
+	}
+}
+
+// parseTagging decodes the url encoded tags sent with PutObject.
+func parseTagging(tagging *string) map[string]string {
+	values, err := url.ParseQuery(aws.ToString(tagging))
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+
+	tags := make(map[string]string, len(values))
+	for k := range values {
+		tags[k] = values.Get(k)
+	}
+
+	return tags
+}
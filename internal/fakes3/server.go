@@ -0,0 +1,633 @@
+package fakes3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	xmlns         = "http://s3.amazonaws.com/doc/2006-03-01/"
+	timeFormat    = "2006-01-02T15:04:05.000Z"
+	metaPrefix    = "X-Amz-Meta-"
+	requestHeader = "X-Amz-Request-Id"
+)
+
+// NewServer starts a httptest server which serves the backend over the s3 REST API, and returns
+// a client configured to use it with path style addressing. The caller closes the server.
+func NewServer(b *Backend) (*httptest.Server, *s3.Client) {
+	srv := httptest.NewServer(b.Handler())
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "fakes3", SecretAccessKey: "fakes3"}, nil
+		}),
+	})
+
+	return srv, client
+}
+
+// Handler returns a http.Handler which serves the subset of the s3 REST API used by s3iofs, using
+// path style addressing. Multipart uploads are not supported.
+func (b *Backend) Handler() http.Handler {
+	return &handler{backend: b}
+}
+
+type handler struct {
+	backend  *Backend
+	requests atomic.Int64
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := fmt.Sprintf("%016X", h.requests.Add(1))
+	w.Header().Set(requestHeader, requestID)
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	var err error
+
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		err = h.listObjectsV2(w, r, bucket)
+	case key == "" && r.Method == http.MethodGet && query.Has("versions"):
+		err = h.listObjectVersions(w, r, bucket)
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		err = h.deleteObjects(w, r, bucket)
+	case key != "" && (query.Has("uploads") || query.Has("uploadId")):
+		err = &smithy.GenericAPIError{Code: "NotImplemented", Message: "multipart uploads are not supported"}
+	case key != "" && r.Method == http.MethodGet:
+		err = h.getObject(w, r, bucket, key)
+	case key != "" && r.Method == http.MethodHead:
+		err = h.headObject(w, r, bucket, key)
+	case key != "" && r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		err = h.copyObject(w, r, bucket, key)
+	case key != "" && r.Method == http.MethodPut:
+		err = h.putObject(w, r, bucket, key)
+	case key != "" && r.Method == http.MethodDelete:
+		err = h.deleteObject(w, r, bucket, key)
+	default:
+		err = &smithy.GenericAPIError{Code: "NotImplemented", Message: "operation is not supported"}
+	}
+
+	if err != nil {
+		writeError(w, r, requestID, err)
+	}
+}
+
+func (h *handler) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	res, err := h.backend.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: queryValue(r, "versionId"),
+		Range:     headerValue(r, "Range"),
+		IfMatch:   headerValue(r, "If-Match"),
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	writeObjectHeaders(w, objectHeaders{
+		contentLength:        res.ContentLength,
+		contentType:          res.ContentType,
+		etag:                 res.ETag,
+		lastModified:         res.LastModified,
+		versionID:            res.VersionId,
+		metadata:             res.Metadata,
+		serverSideEncryption: res.ServerSideEncryption,
+		sseKMSKeyID:          res.SSEKMSKeyId,
+		bucketKeyEnabled:     res.BucketKeyEnabled,
+	})
+
+	status := http.StatusOK
+	if res.ContentRange != nil {
+		w.Header().Set("Content-Range", aws.ToString(res.ContentRange))
+		status = http.StatusPartialContent
+	}
+
+	w.WriteHeader(status)
+
+	// the status is already sent so a failed copy can't be reported
+	_, _ = io.Copy(w, res.Body)
+
+	return nil
+}
+
+func (h *handler) headObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	res, err := h.backend.HeadObject(r.Context(), &s3.HeadObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: queryValue(r, "versionId"),
+	})
+	if err != nil {
+		return err
+	}
+
+	writeObjectHeaders(w, objectHeaders{
+		contentLength:        res.ContentLength,
+		contentType:          res.ContentType,
+		etag:                 res.ETag,
+		lastModified:         res.LastModified,
+		versionID:            res.VersionId,
+		metadata:             res.Metadata,
+		storageClass:         res.StorageClass,
+		serverSideEncryption: res.ServerSideEncryption,
+		sseKMSKeyID:          res.SSEKMSKeyId,
+		bucketKeyEnabled:     res.BucketKeyEnabled,
+		expiration:           res.Expiration,
+	})
+
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (h *handler) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	var bucketKeyEnabled *bool
+	if v := r.Header.Get("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"); v != "" {
+		bucketKeyEnabled = aws.Bool(v == "true")
+	}
+
+	// the sdk doesn't model If-Match on PutObject, so the backend can't check it
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		switch obj := h.backend.Get(bucket, key); {
+		case obj == nil:
+			return &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+		case obj.ETag != ifMatch:
+			return &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+		}
+	}
+
+	res, err := h.backend.PutObject(r.Context(), &s3.PutObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Body:                 r.Body,
+		ContentType:          headerValue(r, "Content-Type"),
+		Metadata:             requestMetadata(r),
+		StorageClass:         types.StorageClass(r.Header.Get("X-Amz-Storage-Class")),
+		ServerSideEncryption: types.ServerSideEncryption(r.Header.Get("X-Amz-Server-Side-Encryption")),
+		SSEKMSKeyId:          headerValue(r, "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+		BucketKeyEnabled:     bucketKeyEnabled,
+		IfNoneMatch:          headerValue(r, "If-None-Match"),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", aws.ToString(res.ETag))
+	if res.VersionId != nil {
+		w.Header().Set("X-Amz-Version-Id", aws.ToString(res.VersionId))
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (h *handler) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	res, err := h.backend.CopyObject(r.Context(), &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        headerValue(r, "X-Amz-Copy-Source"),
+		CopySourceIfMatch: headerValue(r, "X-Amz-Copy-Source-If-Match"),
+		MetadataDirective: types.MetadataDirective(r.Header.Get("X-Amz-Metadata-Directive")),
+		ContentType:       headerValue(r, "Content-Type"),
+		Metadata:          requestMetadata(r),
+	})
+	if err != nil {
+		return err
+	}
+
+	if res.VersionId != nil {
+		w.Header().Set("X-Amz-Version-Id", aws.ToString(res.VersionId))
+	}
+
+	return writeXML(w, http.StatusOK, &copyObjectResult{
+		ETag:         aws.ToString(res.CopyObjectResult.ETag),
+		LastModified: formatTime(res.CopyObjectResult.LastModified),
+	})
+}
+
+func (h *handler) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	res, err := h.backend.DeleteObject(r.Context(), &s3.DeleteObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: queryValue(r, "versionId"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if res.VersionId != nil {
+		w.Header().Set("X-Amz-Version-Id", aws.ToString(res.VersionId))
+	}
+	if aws.ToBool(res.DeleteMarker) {
+		w.Header().Set("X-Amz-Delete-Marker", "true")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *handler) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var req deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &smithy.GenericAPIError{Code: "MalformedXML", Message: err.Error()}
+	}
+
+	input := &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{Quiet: aws.Bool(req.Quiet)},
+	}
+	for _, obj := range req.Objects {
+		input.Delete.Objects = append(input.Delete.Objects, types.ObjectIdentifier{
+			Key:       aws.String(obj.Key),
+			VersionId: nilIfEmpty(obj.VersionID),
+		})
+	}
+
+	res, err := h.backend.DeleteObjects(r.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	out := &deleteResult{}
+	for _, deleted := range res.Deleted {
+		out.Deleted = append(out.Deleted, deletedObject{
+			Key:          aws.ToString(deleted.Key),
+			VersionID:    aws.ToString(deleted.VersionId),
+			DeleteMarker: aws.ToBool(deleted.DeleteMarker),
+		})
+	}
+	for _, e := range res.Errors {
+		out.Errors = append(out.Errors, deleteError{
+			Key:       aws.ToString(e.Key),
+			VersionID: aws.ToString(e.VersionId),
+			Code:      aws.ToString(e.Code),
+			Message:   aws.ToString(e.Message),
+		})
+	}
+
+	return writeXML(w, http.StatusOK, out)
+}
+
+func (h *handler) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) error {
+	maxKeys, err := queryInt32(r, "max-keys")
+	if err != nil {
+		return err
+	}
+
+	res, err := h.backend.ListObjectsV2(r.Context(), &s3.ListObjectsV2Input{
+		Bucket:            aws.String(bucket),
+		Prefix:            queryValue(r, "prefix"),
+		Delimiter:         queryValue(r, "delimiter"),
+		StartAfter:        queryValue(r, "start-after"),
+		ContinuationToken: queryValue(r, "continuation-token"),
+		MaxKeys:           maxKeys,
+	})
+	if err != nil {
+		return err
+	}
+
+	out := &listBucketResult{
+		Xmlns:                 xmlns,
+		Name:                  bucket,
+		Prefix:                aws.ToString(res.Prefix),
+		Delimiter:             aws.ToString(res.Delimiter),
+		StartAfter:            aws.ToString(res.StartAfter),
+		ContinuationToken:     aws.ToString(res.ContinuationToken),
+		NextContinuationToken: aws.ToString(res.NextContinuationToken),
+		MaxKeys:               aws.ToInt32(res.MaxKeys),
+		KeyCount:              aws.ToInt32(res.KeyCount),
+		IsTruncated:           aws.ToBool(res.IsTruncated),
+	}
+	for _, obj := range res.Contents {
+		out.Contents = append(out.Contents, listObject{
+			Key:          aws.ToString(obj.Key),
+			LastModified: formatTime(obj.LastModified),
+			ETag:         aws.ToString(obj.ETag),
+			Size:         aws.ToInt64(obj.Size),
+			StorageClass: string(obj.StorageClass),
+		})
+	}
+	for _, prefix := range res.CommonPrefixes {
+		out.CommonPrefixes = append(out.CommonPrefixes, commonPrefix{Prefix: aws.ToString(prefix.Prefix)})
+	}
+
+	return writeXML(w, http.StatusOK, out)
+}
+
+func (h *handler) listObjectVersions(w http.ResponseWriter, r *http.Request, bucket string) error {
+	maxKeys, err := queryInt32(r, "max-keys")
+	if err != nil {
+		return err
+	}
+
+	res, err := h.backend.ListObjectVersions(r.Context(), &s3.ListObjectVersionsInput{
+		Bucket:          aws.String(bucket),
+		Prefix:          queryValue(r, "prefix"),
+		KeyMarker:       queryValue(r, "key-marker"),
+		VersionIdMarker: queryValue(r, "version-id-marker"),
+		MaxKeys:         maxKeys,
+	})
+	if err != nil {
+		return err
+	}
+
+	out := &listVersionsResult{
+		Name:                bucket,
+		Prefix:              aws.ToString(res.Prefix),
+		KeyMarker:           aws.ToString(res.KeyMarker),
+		VersionIDMarker:     aws.ToString(res.VersionIdMarker),
+		NextKeyMarker:       aws.ToString(res.NextKeyMarker),
+		NextVersionIDMarker: aws.ToString(res.NextVersionIdMarker),
+		MaxKeys:             aws.ToInt32(res.MaxKeys),
+		IsTruncated:         aws.ToBool(res.IsTruncated),
+	}
+	for _, version := range res.Versions {
+		out.Versions = append(out.Versions, objectVersion{
+			Key:          aws.ToString(version.Key),
+			VersionID:    aws.ToString(version.VersionId),
+			IsLatest:     aws.ToBool(version.IsLatest),
+			LastModified: formatTime(version.LastModified),
+			ETag:         aws.ToString(version.ETag),
+			Size:         aws.ToInt64(version.Size),
+			StorageClass: string(version.StorageClass),
+		})
+	}
+	for _, marker := range res.DeleteMarkers {
+		out.DeleteMarkers = append(out.DeleteMarkers, deleteMarker{
+			Key:          aws.ToString(marker.Key),
+			VersionID:    aws.ToString(marker.VersionId),
+			IsLatest:     aws.ToBool(marker.IsLatest),
+			LastModified: formatTime(marker.LastModified),
+		})
+	}
+
+	return writeXML(w, http.StatusOK, out)
+}
+
+type objectHeaders struct {
+	contentLength        *int64
+	contentType          *string
+	etag                 *string
+	lastModified         *time.Time
+	versionID            *string
+	metadata             map[string]string
+	storageClass         types.StorageClass
+	serverSideEncryption types.ServerSideEncryption
+	sseKMSKeyID          *string
+	bucketKeyEnabled     *bool
+	expiration           *string
+}
+
+func writeObjectHeaders(w http.ResponseWriter, oh objectHeaders) {
+	header := w.Header()
+
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(aws.ToInt64(oh.contentLength), 10))
+	header.Set("Content-Type", aws.ToString(oh.contentType))
+	header.Set("ETag", aws.ToString(oh.etag))
+	header.Set("Last-Modified", aws.ToTime(oh.lastModified).UTC().Format(http.TimeFormat))
+
+	if oh.versionID != nil {
+		header.Set("X-Amz-Version-Id", aws.ToString(oh.versionID))
+	}
+	if oh.storageClass != "" {
+		header.Set("X-Amz-Storage-Class", string(oh.storageClass))
+	}
+	if oh.serverSideEncryption != "" {
+		header.Set("X-Amz-Server-Side-Encryption", string(oh.serverSideEncryption))
+	}
+	if oh.sseKMSKeyID != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", aws.ToString(oh.sseKMSKeyID))
+	}
+	if aws.ToBool(oh.bucketKeyEnabled) {
+		header.Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", "true")
+	}
+	if oh.expiration != nil {
+		header.Set("X-Amz-Expiration", aws.ToString(oh.expiration))
+	}
+	for k, v := range oh.metadata {
+		header.Set(metaPrefix+k, v)
+	}
+}
+
+// writeError sends an s3 error response, HEAD responses have no body so only the status is sent.
+func writeError(w http.ResponseWriter, r *http.Request, requestID string, err error) {
+	code, message := "InternalError", err.Error()
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code, message = apiErr.ErrorCode(), apiErr.ErrorMessage()
+	}
+
+	status := errorStatus(code)
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	_ = writeXML(w, status, &errorResponse{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: requestID,
+	})
+}
+
+func errorStatus(code string) int {
+	switch code {
+	case "NoSuchKey", "NoSuchBucket", "NoSuchVersion", "NotFound", "NoSuchUpload":
+		return http.StatusNotFound
+	case "AccessDenied":
+		return http.StatusForbidden
+	case "MethodNotAllowed":
+		return http.StatusMethodNotAllowed
+	case "PreconditionFailed":
+		return http.StatusPreconditionFailed
+	case "InvalidRange":
+		return http.StatusRequestedRangeNotSatisfiable
+	case "SlowDown":
+		return http.StatusServiceUnavailable
+	case "NotImplemented":
+		return http.StatusNotImplemented
+	case "InternalError":
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	_, err = w.Write(append([]byte(xml.Header), data...))
+	return err
+}
+
+func requestMetadata(r *http.Request) map[string]string {
+	var metadata map[string]string
+	for k := range r.Header {
+		if name, ok := strings.CutPrefix(k, metaPrefix); ok {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			metadata[strings.ToLower(name)] = r.Header.Get(k)
+		}
+	}
+	return metadata
+}
+
+func headerValue(r *http.Request, name string) *string {
+	return nilIfEmpty(r.Header.Get(name))
+}
+
+func queryValue(r *http.Request, name string) *string {
+	if !r.URL.Query().Has(name) {
+		return nil
+	}
+	return aws.String(r.URL.Query().Get(name))
+}
+
+func queryInt32(r *http.Request, name string) (*int32, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return nil, &smithy.GenericAPIError{Code: "InvalidArgument", Message: err.Error()}
+	}
+
+	return aws.Int32(int32(n)), nil
+}
+
+func formatTime(t *time.Time) string {
+	return aws.ToTime(t).UTC().Format(timeFormat)
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	MaxKeys               int32          `xml:"MaxKeys"`
+	KeyCount              int32          `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listVersionsResult struct {
+	XMLName             xml.Name        `xml:"ListVersionsResult"`
+	Name                string          `xml:"Name"`
+	Prefix              string          `xml:"Prefix"`
+	KeyMarker           string          `xml:"KeyMarker"`
+	VersionIDMarker     string          `xml:"VersionIdMarker"`
+	NextKeyMarker       string          `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string          `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int32           `xml:"MaxKeys"`
+	IsTruncated         bool            `xml:"IsTruncated"`
+	Versions            []objectVersion `xml:"Version"`
+	DeleteMarkers       []deleteMarker  `xml:"DeleteMarker"`
+}
+
+type objectVersion struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type deleteMarker struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+type deleteRequest struct {
+	Objects []struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+	} `xml:"Object"`
+	Quiet bool `xml:"Quiet"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+type deletedObject struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId,omitempty"`
+	DeleteMarker bool   `xml:"DeleteMarker,omitempty"`
+}
+
+type deleteError struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
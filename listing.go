@@ -0,0 +1,231 @@
+package s3iofs
+
+import (
+	"io/fs"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxListKeys is the maximum number of keys returned by a single ListObjectsV2 call.
+const maxListKeys = 1000
+
+// WithListPageSize sets the number of keys requested by each ListObjectsV2 page, between 1 and
+// 1000, this defaults to the s3 maximum of 1000. Smaller pages suit s3 compatible stores which
+// struggle with large listings.
+//
+// Note this applies to every listing made by the filesystem, including ReadDir, Stat, Glob and the
+// walks, a listing which asks for fewer keys, such as ReadDir(n) on an open directory, uses the
+// smaller of the two.
+func WithListPageSize(n int32) Option {
+	return func(fo *fsOptions) {
+		if n > 0 && n <= maxListKeys {
+			fo.dir.pageSize = n
+		}
+	}
+}
+
+// DefaultHiddenKeyPatterns are the placeholder objects left by common tools, the "_$folder$"
+// objects written by Hadoop and EMR, and the ".keep" and ".s3keep" files used to keep empty
+// directories, for use with WithHiddenKeyFilter.
+var DefaultHiddenKeyPatterns = []string{"*_$folder$", ".keep", ".s3keep"}
+
+// WithHiddenKeyFilter hides the objects whose base name matches one of the patterns from listings,
+// the patterns use the syntax of path.Match, malformed patterns are ignored.
+//
+// Note:
+//   - Hidden objects are left out of ReadDir, Glob and the walks, the directory containing them is
+//     still listed, so a directory holding only a hidden placeholder is an empty directory.
+//   - Hidden objects can still be opened, and are removed along with their directory by RemoveAll.
+func WithHiddenKeyFilter(patterns ...string) Option {
+	return func(fo *fsOptions) {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err == nil {
+				fo.dir.hidden = append(fo.dir.hidden, pattern)
+			}
+		}
+	}
+}
+
+// WithFetchOwner asks s3 for the owner of each object in listings, which is returned by the Owner
+// method of the entries, s3 leaves the owner out of ListObjectsV2 responses unless it is requested.
+func WithFetchOwner() Option {
+	return func(fo *fsOptions) {
+		fo.dir.owner = true
+	}
+}
+
+// dirOptions are the settings of the filesystem used to list directories, they are copied to the
+// directories it returns so they are listed the same way.
+type dirOptions struct {
+	modTime  bool     // see WithDirectoryModTime
+	pageSize int32    // see WithListPageSize, zero uses the s3 default
+	hidden   []string // see WithHiddenKeyFilter
+	owner    bool     // see WithFetchOwner
+}
+
+// fetchOwner returns the FetchOwner of a listing, nil unless WithFetchOwner is set.
+func (do dirOptions) fetchOwner() *bool {
+	if !do.owner {
+		return nil
+	}
+	return aws.Bool(true)
+}
+
+// isHidden reports whether the object with the key is left out of listings.
+func (do dirOptions) isHidden(key string) bool {
+	name := path.Base(key)
+	for _, pattern := range do.hidden {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// maxKeys returns the MaxKeys of a listing which wants at most n keys a page, zero for no limit.
+func (do dirOptions) maxKeys(n int32) *int32 {
+	if do.pageSize > 0 && (n <= 0 || do.pageSize < n) {
+		n = do.pageSize
+	}
+	if n <= 0 {
+		return nil
+	}
+	return aws.Int32(n)
+}
+
+// ListOption configures a listing made with ReadDirInfo or ReadDirRecursive.
+type ListOption func(*listOptions)
+
+type listOptions struct {
+	maxEntries int32
+	token      string
+	dirs       bool
+}
+
+func newListOptions(opts []ListOption) *listOptions {
+	lo := &listOptions{}
+	for _, opt := range opts {
+		opt(lo)
+	}
+	return lo
+}
+
+// WithMaxEntries caps the number of entries returned by a listing, by default all entries are
+// returned.
+//
+// Note:
+//   - ReadDirInfo returns the first n entries and marks the listing as truncated if there are more,
+//     the rest can be read with WithContinuationToken.
+//   - ReadDirRecursive fails with ErrTooManyEntries if there are more, rather than returning a
+//     partial result.
+func WithMaxEntries(n int32) ListOption {
+	return func(lo *listOptions) {
+		if n > 0 {
+			lo.maxEntries = n
+		}
+	}
+}
+
+// WithContinuationToken resumes a listing from the NextToken of a previous truncated DirListing.
+func WithContinuationToken(token string) ListOption {
+	return func(lo *listOptions) {
+		lo.token = token
+	}
+}
+
+// WithIntermediateDirs adds an entry for each directory between the listed directory and the files
+// returned by ReadDirRecursive, by default only the files and directory markers are returned.
+func WithIntermediateDirs() ListOption {
+	return func(lo *listOptions) {
+		lo.dirs = true
+	}
+}
+
+// DirListing is the result of ReadDirInfo, the entries along with the details of the listing.
+type DirListing struct {
+	// Entries are the directories and files, within each page of the listing directories come first.
+	Entries []fs.DirEntry
+	// Truncated is true when the listing stopped at the WithMaxEntries cap before the end of the directory.
+	Truncated bool
+	// KeyCount is the number of keys and common prefixes returned by s3.
+	KeyCount int32
+	// Prefix is the key prefix which was listed.
+	Prefix string
+	// Delimiter is the delimiter used to group keys into directories.
+	Delimiter string
+	// NextToken continues a truncated listing when passed to WithContinuationToken, it is empty otherwise.
+	NextToken string
+}
+
+// ReadDirInfo lists the named directory and returns the entries with the details of the listing.
+//
+// Note the listing follows continuation tokens until the end of the directory, or until the
+// WithMaxEntries cap is reached.
+func (s3fs *S3FS) ReadDirInfo(name string, opts ...ListOption) (*DirListing, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: fs.ErrInvalid}
+	}
+
+	lo := newListOptions(opts)
+
+	listing := &DirListing{
+		Entries:   []fs.DirEntry{},
+		Prefix:    dirPrefix(name),
+		Delimiter: "/",
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:     aws.String(s3fs.bucket),
+		Prefix:     aws.String(listing.Prefix),
+		Delimiter:  aws.String(listing.Delimiter),
+		FetchOwner: s3fs.opts.dir.fetchOwner(),
+	}
+
+	if lo.token != "" {
+		input.ContinuationToken = aws.String(lo.token)
+	}
+
+	var found bool
+
+	for {
+		if lo.maxEntries > 0 {
+			input.MaxKeys = s3fs.opts.dir.maxKeys(min(lo.maxEntries-int32(len(listing.Entries)), maxListKeys))
+		}
+
+		listRes, err := s3fs.s3client.ListObjectsV2(s3fs.context(), input)
+		if err != nil {
+			return nil, pathError(opRead, name, err)
+		}
+
+		entries, err := listResToEntries(s3fs.bucket, s3fs.s3client, aws.ToString(input.Prefix), s3fs.opts.dir, listRes)
+		if err != nil {
+			return nil, pathError(opRead, name, err)
+		}
+
+		listing.Entries = append(listing.Entries, entries...)
+		listing.KeyCount += aws.ToInt32(listRes.KeyCount)
+		found = found || len(listRes.Contents) > 0 || len(listRes.CommonPrefixes) > 0
+
+		if !aws.ToBool(listRes.IsTruncated) {
+			break
+		}
+
+		input.ContinuationToken = listRes.NextContinuationToken
+
+		if lo.maxEntries > 0 && int32(len(listing.Entries)) >= lo.maxEntries {
+			listing.Truncated = true
+			listing.NextToken = aws.ToString(listRes.NextContinuationToken)
+			break
+		}
+	}
+
+	// s3 has no directories, an empty listing means there is nothing under the prefix, a directory
+	// with only a marker is empty but exists
+	if lo.token == "" && name != "." && !found {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return listing, nil
+}
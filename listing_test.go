@@ -0,0 +1,323 @@
+package s3iofs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_ReadDirInfo(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	for i := 0; i < 1004; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("logs/%04d.log", i), []byte("log"))
+	}
+	backend.Put("fooBucket", "logs/archive/2023.log", []byte("log"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("all pages", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		listing, err := s3fs.ReadDirInfo("logs")
+		assert.NoError(err)
+		assert.Len(listing.Entries, 1005)
+		assert.Equal(int32(1005), listing.KeyCount)
+		assert.False(listing.Truncated)
+		assert.Empty(listing.NextToken)
+		assert.Equal("logs/", listing.Prefix)
+		assert.Equal("/", listing.Delimiter)
+		assert.Equal(2, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("capped and resumed", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		listing, err := s3fs.ReadDirInfo("logs", WithMaxEntries(1002))
+		assert.NoError(err)
+		assert.Len(listing.Entries, 1002)
+		assert.Equal(int32(1002), listing.KeyCount)
+		assert.True(listing.Truncated)
+		assert.NotEmpty(listing.NextToken)
+		assert.Equal(2, backend.Calls("ListObjectsV2"))
+
+		rest, err := s3fs.ReadDirInfo("logs", WithContinuationToken(listing.NextToken))
+		assert.NoError(err)
+		assert.Equal([]string{"archive", "1002.log", "1003.log"}, entryNames(rest.Entries))
+		assert.Equal(int32(3), rest.KeyCount)
+		assert.False(rest.Truncated)
+	})
+
+	t.Run("cap at the end of the directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		listing, err := s3fs.ReadDirInfo("logs", WithMaxEntries(1005))
+		assert.NoError(err)
+		assert.Len(listing.Entries, 1005)
+		assert.False(listing.Truncated)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.ReadDirInfo("missing")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		listing, err := s3fs.ReadDirInfo(".")
+		assert.NoError(err)
+		assert.Equal([]string{"logs"}, entryNames(listing.Entries))
+	})
+}
+
+func TestS3FS_ListPageSize(t *testing.T) {
+	t.Run("max keys is sent", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir" && aws.ToInt32(params.MaxKeys) == 1
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir/" && aws.ToInt32(params.MaxKeys) == 50
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/file.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithListPageSize(50))
+
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Equal([]string{"file.txt"}, entryNames(entries))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("small pages", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		for i := 0; i < 7; i++ {
+			backend.Put("fooBucket", fmt.Sprintf("dir/file%d.txt", i), []byte("data"))
+			backend.Put("fooBucket", fmt.Sprintf("dir/sub%d/file.txt", i), []byte("data"))
+		}
+
+		var (
+			mu      sync.Mutex
+			maxKeys []int32
+		)
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if in, ok := input.(*s3.ListObjectsV2Input); ok {
+				mu.Lock()
+				maxKeys = append(maxKeys, aws.ToInt32(in.MaxKeys))
+				mu.Unlock()
+			}
+			return nil
+		}
+
+		s3fs := NewWithClient("fooBucket", backend, WithListPageSize(3))
+
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Len(entries, 14)
+
+		var walked int
+		err = s3fs.WalkObjects(context.Background(), "dir", func(string, fs.FileInfo, error) error {
+			walked++
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal(14, walked)
+
+		matches, err := s3fs.Glob("dir/sub*/*.txt")
+		assert.NoError(err)
+		assert.Len(matches, 7)
+
+		// the smaller of the page size and the entries asked for
+		f, err := s3fs.Open("dir")
+		assert.NoError(err)
+		defer f.Close()
+
+		page, err := f.(fs.ReadDirFile).ReadDir(5)
+		assert.NoError(err)
+		assert.Len(page, 5)
+
+		page, err = f.(fs.ReadDirFile).ReadDir(2)
+		assert.NoError(err)
+		assert.Len(page, 2)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, n := range maxKeys {
+			assert.Contains([]int32{1, 2, 3}, n)
+		}
+		assert.Contains(maxKeys, int32(2))
+	})
+
+	t.Run("out of range sizes are ignored", func(t *testing.T) {
+		assert := require.New(t)
+
+		for _, n := range []int32{0, -1, 1001} {
+			s3fs := NewWithClient("fooBucket", fakes3.New("fooBucket"), WithListPageSize(n))
+			assert.Nil(s3fs.opts.dir.maxKeys(0))
+		}
+
+		s3fs := NewWithClient("fooBucket", fakes3.New("fooBucket"), WithListPageSize(1000))
+		assert.Equal(int32(1000), aws.ToInt32(s3fs.opts.dir.maxKeys(0)))
+		assert.Equal(int32(10), aws.ToInt32(s3fs.opts.dir.maxKeys(10)))
+	})
+}
+
+func TestS3FS_HiddenKeyFilter(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "data/empty/.keep", nil)
+	backend.Put("fooBucket", "data/table_$folder$", nil)
+	backend.Put("fooBucket", "data/table/part-0000.parquet", []byte("data"))
+	backend.Put("fooBucket", "data/other/.s3keep", nil)
+	backend.Put("fooBucket", "data/other/file.txt", []byte("data"))
+
+	s3fs := NewWithClient("fooBucket", backend, WithHiddenKeyFilter(DefaultHiddenKeyPatterns...))
+
+	t.Run("read dir", func(t *testing.T) {
+		assert := require.New(t)
+
+		entries, err := s3fs.ReadDir("data")
+		assert.NoError(err)
+		assert.Equal([]string{"empty", "other", "table"}, entryNames(entries))
+
+		info, err := s3fs.Stat("data/empty")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+
+		entries, err = s3fs.ReadDir("data/empty")
+		assert.NoError(err)
+		assert.Empty(entries)
+	})
+
+	t.Run("walks and glob", func(t *testing.T) {
+		assert := require.New(t)
+
+		var walked []string
+		err := fs.WalkDir(s3fs, "data", func(name string, d fs.DirEntry, err error) error {
+			assert.NoError(err)
+			walked = append(walked, name)
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([]string{"data", "data/empty", "data/other", "data/other/file.txt", "data/table", "data/table/part-0000.parquet"}, walked)
+
+		var keys []string
+		err = s3fs.WalkObjects(context.Background(), "data", func(key string, _ fs.FileInfo, err error) error {
+			keys = append(keys, key)
+			return err
+		})
+		assert.NoError(err)
+		assert.Equal([]string{"data/other/file.txt", "data/table/part-0000.parquet"}, keys)
+
+		entries, err := s3fs.ReadDirRecursive("data")
+		assert.NoError(err)
+		assert.Equal([]string{"other/file.txt", "table/part-0000.parquet"}, entryNames(entries))
+
+		matches, err := s3fs.Glob("data/*")
+		assert.NoError(err)
+		assert.Equal([]string{"data/empty", "data/other", "data/table"}, matches)
+
+		matches, err = s3fs.Glob("data/*/*")
+		assert.NoError(err)
+		assert.Equal([]string{"data/other/file.txt", "data/table/part-0000.parquet"}, matches)
+
+		matches, err = s3fs.Glob("data/empty/.keep")
+		assert.NoError(err)
+		assert.Nil(matches)
+	})
+
+	t.Run("shown without the option", func(t *testing.T) {
+		assert := require.New(t)
+
+		entries, err := NewWithClient("fooBucket", backend).ReadDir("data/empty")
+		assert.NoError(err)
+		assert.Equal([]string{".keep"}, entryNames(entries))
+	})
+}
+
+func TestS3FS_ObjectInfo(t *testing.T) {
+	listRes := &s3.ListObjectsV2Output{
+		CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/sub/")}},
+		Contents: []types.Object{{
+			Key:          aws.String("dir/file.txt"),
+			Size:         aws.Int64(4),
+			ETag:         aws.String(`"abc123"`),
+			StorageClass: types.ObjectStorageClassStandardIa,
+			Owner:        &types.Owner{ID: aws.String("owner-id"), DisplayName: aws.String("owner")},
+		}},
+	}
+
+	// the directory is found with a single key listing before it is read
+	isStat := mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return aws.ToString(input.Prefix) == "dir"
+	})
+	statRes := &s3.ListObjectsV2Output{CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}}}
+
+	t.Run("fetch owner", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, isStat, mock.Anything).Return(statRes, nil)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+			return aws.ToString(input.Prefix) == "dir/" && aws.ToBool(input.FetchOwner)
+		}), mock.Anything).Return(listRes, nil)
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithFetchOwner())
+
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Len(entries, 2)
+
+		info, ok := entries[0].(ObjectInfo)
+		assert.True(ok)
+		assert.Equal(`"abc123"`, info.ETag())
+		assert.Equal("STANDARD_IA", info.StorageClass())
+		assert.Equal("owner-id", info.Owner())
+
+		dir, ok := entries[1].(ObjectInfo)
+		assert.True(ok)
+		assert.Empty(dir.ETag())
+		assert.Empty(dir.Owner())
+
+		mockClient.AssertNotCalled(t, "HeadObject", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("owner not requested by default", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, isStat, mock.Anything).Return(statRes, nil)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+			return aws.ToString(input.Prefix) == "dir/" && input.FetchOwner == nil
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/file.txt"), ETag: aws.String(`"abc123"`)}},
+		}, nil)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Len(entries, 1)
+		assert.Equal(`"abc123"`, entries[0].(ObjectInfo).ETag())
+		assert.Empty(entries[0].(ObjectInfo).Owner())
+	})
+}
@@ -0,0 +1,101 @@
+package s3iofs
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// WithMinReadSize makes ReadAt fetch at least n bytes, keeping the bytes beyond the read on the file
+// so the reads which follow it, such as the small reads of a columnar reader, are served without
+// another request. This is disabled by default.
+//
+// Note:
+//   - The fetch is clamped to the end of the file, and reads of files of unknown size aren't
+//     extended.
+//   - Each file keeps the bytes of its last fetch, a ReadAt outside of them replaces them, and a Read
+//     after a Seek uses them before it opens the body again.
+//   - With WithBlockCache, ReadAt is served by the cache instead.
+func WithMinReadSize(n int64) Option {
+	return func(fo *fsOptions) {
+		if n > 0 {
+			fo.minReadSize = n
+		}
+	}
+}
+
+// readBuffer holds the bytes of the last fetch made by ReadAt, which is safe for concurrent use.
+type readBuffer struct {
+	mu     sync.Mutex
+	offset int64
+	data   []byte
+}
+
+// readAt copies the bytes from the offset if all of p is held.
+func (rb *readBuffer) readAt(p []byte, offset int64) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if offset < rb.offset || offset+int64(len(p)) > rb.offset+int64(len(rb.data)) {
+		return false
+	}
+
+	copy(p, rb.data[offset-rb.offset:])
+
+	return true
+}
+
+// read copies the bytes held from the offset, which may be fewer than len(p), the bytes are dropped
+// if the offset is outside of them.
+func (rb *readBuffer) read(p []byte, offset int64) int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if offset < rb.offset || offset >= rb.offset+int64(len(rb.data)) {
+		rb.data = nil
+		return 0
+	}
+
+	return copy(p, rb.data[offset-rb.offset:])
+}
+
+func (rb *readBuffer) set(data []byte, offset int64) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.data = data
+	rb.offset = offset
+}
+
+// readAtLeast reads len(p) bytes from the offset of an object of the given size, from the read
+// buffer if it holds them, otherwise by fetching at least the minimum read size and keeping it.
+func (s3f *s3File) readAtLeast(p []byte, offset, size int64) (int, error) {
+	if offset >= size {
+		return 0, io.EOF
+	}
+
+	end := min(offset+int64(len(p)), size)
+
+	if s3f.readBuf.readAt(p[:end-offset], offset) {
+		if end-offset < int64(len(p)) {
+			return int(end - offset), io.EOF
+		}
+		return len(p), nil
+	}
+
+	buf := make([]byte, min(max(end-offset, s3f.minRead), size-offset))
+
+	n, err := s3f.readAt(buf, offset, size)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	s3f.readBuf.set(buf[:n], offset)
+
+	m := copy(p, buf[:n])
+	if m < len(p) {
+		return m, io.EOF
+	}
+
+	return m, nil
+}
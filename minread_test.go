@@ -0,0 +1,99 @@
+package s3iofs
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3File_MinReadSize(t *testing.T) {
+	data := make([]byte, twoMegabytes+100)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "file.bin", data)
+
+	s3fs := NewWithClient("fooBucket", backend, WithMinReadSize(1024*1024))
+
+	readAt := func(assert *require.Assertions, f io.ReaderAt, offset int64, length int) {
+		buf := make([]byte, length)
+		n, err := f.ReadAt(buf, offset)
+		assert.NoError(err)
+		assert.Equal(length, n)
+		assert.Equal(data[offset:offset+int64(length)], buf)
+	}
+
+	t.Run("adjacent reads share a fetch", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.ResetCalls()
+
+		readAt(assert, f, 4096, 4096)
+		readAt(assert, f, 8192, 4096)
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		// a read outside of the fetch replaces it
+		readAt(assert, f, 1024*1024+4096, 4096)
+		assert.Equal(2, backend.Calls("GetObject"))
+
+		readAt(assert, f, 4096, 10)
+		assert.Equal(3, backend.Calls("GetObject"))
+	})
+
+	t.Run("reads after a seek use the fetch", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		readAt(assert, f, 1000, 100)
+
+		_, err = f.Seek(1100, io.SeekStart)
+		assert.NoError(err)
+
+		backend.ResetCalls()
+
+		buf := make([]byte, 4096)
+		_, err = io.ReadFull(f, buf)
+		assert.NoError(err)
+		assert.Equal(data[1100:1100+4096], buf)
+		assert.Zero(backend.Calls("GetObject"))
+	})
+
+	t.Run("end of the object", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.ResetCalls()
+
+		size := int64(len(data))
+
+		// the fetch is clamped to the end of the object
+		readAt(assert, f, size-5000, 1000)
+		readAt(assert, f, size-4000, 3900)
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		buf := make([]byte, 4096)
+		n, err := f.ReadAt(buf, size-100)
+		assert.ErrorIs(err, io.EOF)
+		assert.Equal(100, n)
+		assert.Equal(data[size-100:], buf[:n])
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		n, err = f.ReadAt(buf, size)
+		assert.ErrorIs(err, io.EOF)
+		assert.Zero(n)
+	})
+}
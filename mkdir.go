@@ -0,0 +1,83 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrNotDirectory is matched by the error returned when MkdirAll finds a file where a directory
+// is needed, and by the ReadDir of a file in a union.
+var ErrNotDirectory = errors.New("not a directory")
+
+// MkdirAll creates the named directory, along with any parents which don't exist, by writing a
+// zero byte marker object with a trailing slash, such as "a/" and "a/b/", for each missing level.
+//
+// Note:
+//   - s3 has no directories, a level which already has keys under it, or a marker, is skipped.
+//   - A directory created by MkdirAll is listed as an empty directory by ReadDir and Stat.
+//   - If a level is a file MkdirAll fails with ErrNotDirectory, nothing is created.
+//   - The perm is ignored, the markers are written with the write defaults of the filesystem.
+func (s3fs *S3FS) MkdirAll(path string, perm fs.FileMode) error {
+	return s3fs.MkdirAllContext(s3fs.context(), path, perm)
+}
+
+// MkdirAllContext creates the named directory, along with any parents which don't exist, using the
+// context for the requests made to s3.
+func (s3fs *S3FS) MkdirAllContext(ctx context.Context, name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	// walk up to the deepest level which exists, the levels below it are missing
+	var missing []string
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		info, err := s3fs.stat(ctx, dir)
+		if err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: name, Err: ErrNotDirectory}
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return pathError("mkdir", name, err)
+		}
+
+		missing = append(missing, dir)
+	}
+
+	wo, err := s3fs.newWriteOptions(nil)
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	// parents are created first so a failure never leaves a directory without its parents
+	for i := len(missing) - 1; i >= 0; i-- {
+		req := &s3.PutObjectInput{
+			Bucket: aws.String(s3fs.bucket),
+			Key:    aws.String(missing[i] + "/"),
+			Body:   bytes.NewReader(nil),
+		}
+
+		wo.applyPutObject(req)
+
+		if _, err := s3fs.s3client.PutObject(ctx, req); err != nil {
+			return pathError("mkdir", missing[i], err)
+		}
+	}
+
+	return nil
+}
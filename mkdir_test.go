@@ -0,0 +1,106 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_MkdirAll(t *testing.T) {
+	t.Run("creates a marker for each missing level", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "a/file.txt", []byte("data"))
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.MkdirAll("a/b/c", 0o755)
+		assert.NoError(err)
+
+		// a already exists as a prefix so has no marker
+		assert.Equal([]string{"a/b/", "a/b/c/", "a/file.txt"}, backend.Keys("fooBucket"))
+		assert.Empty(backend.Get("fooBucket", "a/b/").Data)
+		assert.Equal(2, backend.Calls("PutObject"))
+
+		// every level exists so nothing is written
+		err = s3fs.MkdirAll("a/b", 0o755)
+		assert.NoError(err)
+		assert.Equal(2, backend.Calls("PutObject"))
+	})
+
+	t.Run("markers are empty directories", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		assert.NoError(s3fs.MkdirAll("empty/dir", 0o755))
+
+		info, err := s3fs.Stat("empty/dir")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+
+		entries, err := s3fs.ReadDir("empty/dir")
+		assert.NoError(err)
+		assert.Empty(entries)
+
+		entries, err = s3fs.ReadDir("empty")
+		assert.NoError(err)
+		assert.Len(entries, 1)
+		assert.Equal("dir", entries[0].Name())
+		assert.True(entries[0].IsDir())
+
+		listing, err := s3fs.ReadDirInfo("empty/dir")
+		assert.NoError(err)
+		assert.Empty(listing.Entries)
+	})
+
+	t.Run("root and invalid names", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		assert.NoError(s3fs.MkdirAll(".", 0o755))
+		assert.ErrorIs(s3fs.MkdirAll("/a", 0o755), fs.ErrInvalid)
+		assert.ErrorIs(s3fs.MkdirAll("a/../b", 0o755), fs.ErrInvalid)
+		assert.Equal(0, backend.Calls("PutObject"))
+	})
+
+	t.Run("file in the path", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "a/file.txt", []byte("data"))
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.MkdirAll("a/file.txt/b", 0o755)
+		assert.ErrorIs(err, ErrNotDirectory)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("mkdir", pathErr.Op)
+		assert.Equal(0, backend.Calls("PutObject"))
+	})
+
+	t.Run("put failure", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "PutObject" {
+				return errors.New("put failed")
+			}
+			return nil
+		}
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.MkdirAll("a/b", 0o755)
+		assert.ErrorContains(err, "put failed")
+		assert.Empty(backend.Keys("fooBucket"))
+	})
+}
@@ -0,0 +1,298 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	defaultMultipartThreshold = 100 * mebibyte
+	defaultUploadConcurrency  = 4
+
+	// maxUploadParts is the largest number of parts s3 accepts in a multipart upload.
+	maxUploadParts = 10000
+)
+
+// WithMultipartThreshold sets the size in bytes above which WriteFile uses a multipart upload rather
+// than a single PutObject, this defaults to 100MiB.
+func WithMultipartThreshold(n int64) Option {
+	return func(fo *fsOptions) {
+		if n > 0 {
+			fo.multipartThreshold = n
+		}
+	}
+}
+
+// WithUploadConcurrency sets the number of parts of a multipart upload which are sent at the same
+// time, this defaults to 4.
+//
+// Streamed uploads, such as WriteReader, hold a buffer for each part in flight, so their memory use
+// is bounded by the concurrency multiplied by the part size.
+func WithUploadConcurrency(n int) Option {
+	return func(fo *fsOptions) {
+		if n > 0 {
+			fo.uploadConcurrency = n
+		}
+	}
+}
+
+// uploadPartSize returns the part size used to upload an object of the given size, this is
+// DefaultPartSize unless the object needs larger parts to stay within the limit on parts.
+func uploadPartSize(size int64) int64 {
+	return fitPartSize(size, DefaultPartSize)
+}
+
+// fitPartSize returns partSize, or the smallest whole number of mebibytes which allows an object of
+// the given size to stay within the limit on parts.
+func fitPartSize(size, partSize int64) int64 {
+	if parts := (size + partSize - 1) / partSize; parts > maxUploadParts {
+		partSize = (size + maxUploadParts - 1) / maxUploadParts
+		// round up to a whole mebibyte
+		partSize = (partSize + mebibyte - 1) / mebibyte * mebibyte
+	}
+
+	return partSize
+}
+
+// multipartUpload uploads the data with a multipart upload, sending the parts concurrently and
+// aborting the upload on failure.
+func (s3fs *S3FS) multipartUpload(ctx context.Context, name string, data []byte, wo *writeOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	u, err := s3fs.newPartUploader(ctx, name, wo)
+	if err != nil {
+		return nil, err
+	}
+	defer u.cancel()
+
+	size := int64(len(data))
+	partSize := uploadPartSize(size)
+	sem := make(chan struct{}, s3fs.opts.uploadConcurrency)
+
+	for offset, partNumber := int64(0), int32(1); offset < size; offset, partNumber = offset+partSize, partNumber+1 {
+		sem <- struct{}{}
+
+		// stop sending parts once one has failed
+		if u.ctx.Err() != nil {
+			break
+		}
+
+		u.start(partNumber, data[offset:min(offset+partSize, size)], func() { <-sem })
+	}
+
+	return u.complete(-1)
+}
+
+// multipartUploadFrom uploads the first part followed by the rest of r in parts of partSize, sending
+// the parts concurrently and aborting the upload on failure. When size is known r must contain
+// exactly size bytes.
+//
+// A buffer is held for each part in flight, so r is read no faster than the parts are sent and
+// isn't read any further once a part has failed.
+func (s3fs *S3FS) multipartUploadFrom(ctx context.Context, name string, first []byte, r io.Reader, size, partSize int64, wo *writeOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	u, err := s3fs.newPartUploader(ctx, name, wo)
+	if err != nil {
+		return nil, err
+	}
+	defer u.cancel()
+
+	concurrency := s3fs.opts.uploadConcurrency
+
+	// the first buffer is allocated by the caller
+	pool := make(chan []byte, concurrency)
+	allocated := 1
+
+	nextBuffer := func() []byte {
+		select {
+		case buf := <-pool:
+			return buf
+		default:
+		}
+
+		if allocated < concurrency {
+			allocated++
+			return make([]byte, partSize)
+		}
+
+		return <-pool
+	}
+
+	buf := first
+
+	for partNumber := int32(1); len(buf) > 0; partNumber++ {
+		part := buf
+		u.start(partNumber, part, func() { pool <- part[:cap(part)] })
+
+		if int64(len(part)) < partSize {
+			break
+		}
+
+		next := nextBuffer()
+
+		// stop reading once a part has failed
+		if u.ctx.Err() != nil {
+			break
+		}
+
+		buf, err = readPart(r, next[:partSize])
+		if err != nil {
+			u.fail(err)
+			break
+		}
+	}
+
+	return u.complete(size)
+}
+
+// partUploader sends the parts of a multipart upload concurrently, recording the first failure and
+// cancelling the parts in flight.
+type partUploader struct {
+	s3fs     *S3FS
+	ctx      context.Context
+	cancel   context.CancelFunc
+	name     string
+	uploadID *string
+
+	checksumAlgorithm types.ChecksumAlgorithm
+	ifNoneMatch       bool
+	clientOptions     []func(*s3.Options)
+
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	parts []types.CompletedPart
+	total int64
+	err   error
+}
+
+func (s3fs *S3FS) newPartUploader(ctx context.Context, name string, wo *writeOptions) (*partUploader, error) {
+	req := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(name),
+	}
+
+	wo.applyCreateMultipartUpload(req)
+
+	createRes, err := s3fs.s3client.CreateMultipartUpload(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &partUploader{
+		s3fs:     s3fs,
+		ctx:      ctx,
+		cancel:   cancel,
+		name:     name,
+		uploadID: createRes.UploadId,
+
+		checksumAlgorithm: wo.checksumAlgorithm,
+		ifNoneMatch:       wo.ifNoneMatch,
+		clientOptions:     wo.clientOptions(),
+	}, nil
+}
+
+// start sends the part in the background, done is called once the part is no longer in use.
+func (u *partUploader) start(partNumber int32, part []byte, done func()) {
+	u.wg.Add(1)
+
+	go func() {
+		defer u.wg.Done()
+		defer done()
+
+		partRes, err := u.s3fs.s3client.UploadPart(u.ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(u.s3fs.bucket),
+			Key:           aws.String(u.name),
+			UploadId:      u.uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(part),
+			ContentLength: aws.Int64(int64(len(part))),
+
+			ChecksumAlgorithm: u.checksumAlgorithm,
+		})
+		if err != nil {
+			u.fail(fmt.Errorf("upload part %d: %w", partNumber, err))
+			return
+		}
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		u.parts = append(u.parts, completedPart(partNumber, partRes))
+		u.total += int64(len(part))
+	}()
+}
+
+// fail records the error if it is the first, and cancels the parts in flight.
+func (u *partUploader) fail(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.err == nil {
+		u.err = err
+		u.cancel()
+	}
+}
+
+// complete waits for the parts in flight then completes the upload, or aborts it if a part failed.
+// A size of -1 skips the check of the number of bytes sent.
+func (u *partUploader) complete(size int64) (*s3.CompleteMultipartUploadOutput, error) {
+	u.wg.Wait()
+
+	err := u.err
+	if err == nil {
+		// the context of the caller was cancelled before all of the parts were sent
+		err = u.ctx.Err()
+	}
+	if err == nil && size >= 0 && u.total != size {
+		err = fmt.Errorf("read %d of %d bytes: %w", u.total, size, io.ErrUnexpectedEOF)
+	}
+
+	if err != nil {
+		u.s3fs.abortUpload(u.name, u.uploadID)
+		return nil, err
+	}
+
+	// parts finish in any order, s3 requires them in ascending order
+	slices.SortFunc(u.parts, func(a, b types.CompletedPart) int {
+		return int(aws.ToInt32(a.PartNumber) - aws.ToInt32(b.PartNumber))
+	})
+
+	req := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.s3fs.bucket),
+		Key:             aws.String(u.name),
+		UploadId:        u.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: u.parts},
+	}
+	if u.ifNoneMatch {
+		req.IfNoneMatch = aws.String("*")
+	}
+
+	completeRes, err := u.s3fs.s3client.CompleteMultipartUpload(u.ctx, req, u.clientOptions...)
+	if err != nil {
+		u.s3fs.abortUpload(u.name, u.uploadID)
+		return nil, err
+	}
+
+	return completeRes, nil
+}
+
+// readPart fills buf from r, returning a shorter slice at the end of r.
+func readPart(r io.Reader, buf []byte) ([]byte, error) {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return buf[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
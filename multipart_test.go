@@ -0,0 +1,260 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_WriteFileMultipart(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 12*mebibyte/16)
+
+	t.Run("large data is uploaded in parts", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(mebibyte), WithUploadConcurrency(2))
+
+		res, err := s3fs.WriteFileResult("large.bin", data, 0o644, WithAttrs(map[string]string{"owner": "test"}))
+		assert.NoError(err)
+		assert.True(strings.HasSuffix(res.ETag, `-3"`))
+
+		assert.Equal(1, backend.Calls("CreateMultipartUpload"))
+		assert.Equal(3, backend.Calls("UploadPart"))
+		assert.Equal(0, backend.Calls("PutObject"))
+
+		obj := backend.Get("fooBucket", "large.bin")
+		assert.Equal(data, obj.Data)
+		assert.Equal("test", obj.Metadata["owner"])
+
+		etag, err := ComputeETag(bytes.NewReader(data), int64(len(data)), DefaultPartSize)
+		assert.NoError(err)
+		assert.Equal(`"`+etag+`"`, res.ETag)
+	})
+
+	t.Run("small data is uploaded with a single request", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(mebibyte))
+
+		err := s3fs.WriteFile("small.bin", data[:mebibyte], 0o644)
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("PutObject"))
+		assert.Equal(0, backend.Calls("UploadPart"))
+	})
+
+	t.Run("failed part aborts the upload", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if op == "UploadPart" && aws.ToInt32(input.(*s3.UploadPartInput).PartNumber) == 2 {
+				return errors.New("connection reset")
+			}
+			return nil
+		}
+
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(mebibyte))
+
+		err := s3fs.WriteFile("large.bin", data, 0o644)
+		assert.ErrorContains(err, "upload part 2: connection reset")
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("write", pathErr.Op)
+
+		assert.Equal(1, backend.Calls("AbortMultipartUpload"))
+		assert.Equal(0, backend.Uploads())
+		assert.Nil(backend.Get("fooBucket", "large.bin"))
+	})
+}
+
+func Test_uploadPartSize(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(int64(DefaultPartSize), uploadPartSize(100*mebibyte))
+	assert.Equal(int64(DefaultPartSize), uploadPartSize(maxUploadParts*DefaultPartSize))
+	assert.Equal(int64(6*mebibyte), uploadPartSize(maxUploadParts*DefaultPartSize+1))
+}
+
+// countingReader records how much of the stream was read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestS3FS_WriteReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 12*mebibyte/16)
+
+	t.Run("known size uses a single request", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.WriteReader("small.txt", iotest.OneByteReader(strings.NewReader("hello world")), 11)
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("PutObject"))
+		assert.Equal("hello world", string(backend.Get("fooBucket", "small.txt").Data))
+	})
+
+	t.Run("unknown size which fits in a part uses a single request", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.WriteReader("small.txt", io.MultiReader(strings.NewReader("hello "), strings.NewReader("world")), -1)
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("PutObject"))
+		assert.Equal(0, backend.Calls("CreateMultipartUpload"))
+		assert.Equal("hello world", string(backend.Get("fooBucket", "small.txt").Data))
+	})
+
+	t.Run("unknown size is streamed in parts", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.WriteReader("large.bin", io.MultiReader(bytes.NewReader(data)), -1)
+		assert.NoError(err)
+		assert.Equal(3, backend.Calls("UploadPart"))
+		assert.Equal(data, backend.Get("fooBucket", "large.bin").Data)
+	})
+
+	t.Run("known size above the threshold is streamed in parts", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(mebibyte))
+
+		// the reader has more data than the size, only size bytes are stored
+		err := s3fs.WriteReader("large.bin", bytes.NewReader(append(data, "extra"...)), int64(len(data)))
+		assert.NoError(err)
+		assert.Equal(3, backend.Calls("UploadPart"))
+		assert.Equal(data, backend.Get("fooBucket", "large.bin").Data)
+	})
+
+	t.Run("parts are sent concurrently", func(t *testing.T) {
+		assert := require.New(t)
+
+		var (
+			mu                sync.Mutex
+			inFlight, maxSeen int
+		)
+
+		backend := fakes3.New("fooBucket")
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op != "UploadPart" {
+				return nil
+			}
+
+			mu.Lock()
+			inFlight++
+			maxSeen = max(maxSeen, inFlight)
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+
+			return nil
+		}
+
+		s3fs := NewWithClient("fooBucket", backend, WithUploadConcurrency(2))
+
+		err := s3fs.WriteReader("large.bin", io.MultiReader(bytes.NewReader(data)), -1)
+		assert.NoError(err)
+		assert.Equal(2, maxSeen)
+		assert.Equal(data, backend.Get("fooBucket", "large.bin").Data)
+	})
+
+	t.Run("reader error aborts the upload", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		readErr := errors.New("connection reset")
+		r := io.MultiReader(bytes.NewReader(data[:7*mebibyte]), iotest.ErrReader(readErr))
+
+		err := s3fs.WriteReader("large.bin", r, -1)
+		assert.ErrorIs(err, readErr)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+
+		assert.Equal(1, backend.Calls("UploadPart"))
+		assert.Equal(1, backend.Calls("AbortMultipartUpload"))
+		assert.Equal(0, backend.Uploads())
+		assert.Nil(backend.Get("fooBucket", "large.bin"))
+	})
+
+	t.Run("failed part stops reading", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "UploadPart" {
+				return errors.New("slow down")
+			}
+			return nil
+		}
+		s3fs := NewWithClient("fooBucket", backend, WithUploadConcurrency(1))
+
+		r := &countingReader{r: bytes.NewReader(data)}
+
+		err := s3fs.WriteReader("large.bin", r, -1)
+		assert.ErrorContains(err, "upload part 1: slow down")
+		assert.Equal(int64(DefaultPartSize), r.n)
+		assert.Equal(0, backend.Uploads())
+	})
+
+	t.Run("short reader", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(mebibyte))
+
+		err := s3fs.WriteReader("small.txt", strings.NewReader("hello"), 11)
+		assert.ErrorIs(err, io.ErrUnexpectedEOF)
+
+		err = s3fs.WriteReader("large.bin", bytes.NewReader(data[:7*mebibyte]), int64(len(data)))
+		assert.ErrorIs(err, io.ErrUnexpectedEOF)
+		assert.Equal(0, backend.Uploads())
+		assert.Nil(backend.Get("fooBucket", "large.bin"))
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs := NewWithClient("fooBucket", fakes3.New("fooBucket"))
+
+		for _, name := range []string{".", "", "/abs", "a/../b"} {
+			err := s3fs.WriteReader(name, strings.NewReader("data"), 4)
+			assert.ErrorIs(err, fs.ErrInvalid)
+		}
+	})
+}
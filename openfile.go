@@ -0,0 +1,176 @@
+package s3iofs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+var _ fs.File = (*writeFile)(nil)
+
+// FlagError is returned by OpenFile for flags which can't be supported by s3, it matches
+// errors.ErrUnsupported.
+type FlagError struct {
+	Flag int
+}
+
+func (e *FlagError) Error() string {
+	return fmt.Sprintf("unsupported open flag %#x", e.Flag)
+}
+
+func (e *FlagError) Unwrap() error {
+	return errors.ErrUnsupported
+}
+
+// OpenFile opens the named file with the flags used by os.OpenFile, files opened for writing
+// implement io.Writer and upload the data written when they are closed.
+//
+// Note:
+//   - os.O_RDONLY without other flags is the same as Open.
+//   - os.O_WRONLY returns a write handle, without os.O_CREATE the file must already exist.
+//   - os.O_TRUNC is implied as objects in s3 are replaced by an upload.
+//   - os.O_EXCL with os.O_CREATE fails with fs.ErrExist if the file exists, this is checked with
+//     a HeadObject when opened and again by s3 when the file is closed, see WithIfNoneMatch.
+//   - os.O_RDWR and os.O_APPEND return a FlagError, as objects can't be modified in place.
+//   - The provided mode is unused by this implementation.
+func (s3fs *S3FS) OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	const writeFlags = os.O_CREATE | os.O_EXCL | os.O_TRUNC
+
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		if flag&(writeFlags|os.O_APPEND) != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: &FlagError{Flag: flag}}
+		}
+		return s3fs.Open(name)
+	case os.O_WRONLY:
+		if flag&os.O_APPEND != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: &FlagError{Flag: flag}}
+		}
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: &FlagError{Flag: flag}}
+	}
+
+	if name == "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if flag&os.O_EXCL != 0 || flag&os.O_CREATE == 0 {
+		_, err := headObject(s3fs.context(), s3fs.s3client, s3fs.bucket, "open", name)
+		switch {
+		case err == nil && flag&os.O_EXCL != 0 && flag&os.O_CREATE != 0:
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	var opts []WriteOption
+	if flag&os.O_EXCL != 0 && flag&os.O_CREATE != 0 {
+		opts = append(opts, WithIfNoneMatch())
+	}
+
+	wo, err := s3fs.newWriteOptions(opts)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return s3fs.newWriteFile(name, wo), nil
+}
+
+// Create creates or truncates the named file, returning a write handle which uploads the data
+// written when it is closed, this is the same as OpenFile with os.O_WRONLY|os.O_CREATE|os.O_TRUNC
+// but also applies the write options to the upload.
+//
+// Note:
+//   - The options are checked before the handle is returned, so invalid metadata fails early.
+func (s3fs *S3FS) Create(name string, opts ...WriteOption) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	wo, err := s3fs.newWriteOptions(opts)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return s3fs.newWriteFile(name, wo), nil
+}
+
+func (s3fs *S3FS) newWriteFile(name string, wo *writeOptions) *writeFile {
+	return &writeFile{
+		s3fs:  s3fs,
+		name:  name,
+		wo:    wo,
+		spool: newSpool(s3fs.opts.spoolDir, s3fs.opts.spoolThreshold),
+	}
+}
+
+// writeFile is a write handle returned by OpenFile, the data written is spooled and uploaded
+// when the file is closed.
+type writeFile struct {
+	s3fs *S3FS
+	name string
+	wo   *writeOptions
+
+	mu     sync.Mutex
+	spool  *spool
+	closed bool
+}
+
+// Write appends p to the data uploaded when the file is closed.
+func (w *writeFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrClosed}
+	}
+
+	n, err := w.spool.Write(p)
+	if err != nil {
+		return n, &fs.PathError{Op: "write", Path: w.name, Err: err}
+	}
+
+	return n, nil
+}
+
+// Read returns an error as the file is only open for writing.
+func (w *writeFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: opRead, Path: w.name, Err: fs.ErrInvalid}
+}
+
+// Stat returns a FileInfo with the size of the data written so far.
+func (w *writeFile) Stat() (fs.FileInfo, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return &s3File{
+		name:   w.name,
+		bucket: w.s3fs.bucket,
+		size:   w.spool.Size(),
+	}, nil
+}
+
+// Close uploads the data written to the file, using a multipart upload if it is larger than the
+// multipart threshold. If the upload fails the data is discarded.
+func (w *writeFile) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrClosed}
+	}
+	w.closed = true
+
+	defer w.spool.Close()
+
+	return w.s3fs.writeReader(w.s3fs.context(), w.name, w.spool.Reader(), w.spool.Size(), w.wo)
+}
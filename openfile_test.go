@@ -0,0 +1,154 @@
+package s3iofs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_OpenFile(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "existing.txt", []byte("existing"))
+
+	s3fs := NewWithClient("fooBucket", backend, WithSpoolMemoryThreshold(4))
+
+	t.Run("read only", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenFile("existing.txt", os.O_RDONLY, 0)
+		assert.NoError(err)
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal("existing", string(data))
+	})
+
+	t.Run("create uploads on close", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.OpenFile("created.txt", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		assert.NoError(err)
+
+		w := f.(io.Writer)
+		_, err = w.Write([]byte("hello "))
+		assert.NoError(err)
+		_, err = w.Write([]byte("world"))
+		assert.NoError(err)
+
+		info, err := f.Stat()
+		assert.NoError(err)
+		assert.Equal(int64(11), info.Size())
+
+		assert.Nil(backend.Get("fooBucket", "created.txt"))
+
+		assert.NoError(f.Close())
+		assert.Equal("hello world", string(backend.Get("fooBucket", "created.txt").Data))
+
+		_, err = w.Write([]byte("more"))
+		assert.ErrorIs(err, fs.ErrClosed)
+		assert.ErrorIs(f.Close(), fs.ErrClosed)
+
+		_, err = f.Read(make([]byte, 1))
+		assert.ErrorIs(err, fs.ErrInvalid)
+	})
+
+	t.Run("exclusive", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.OpenFile("existing.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		assert.ErrorIs(err, fs.ErrExist)
+
+		f, err := s3fs.OpenFile("exclusive.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		assert.NoError(err)
+		assert.NoError(f.Close())
+		assert.NotNil(backend.Get("fooBucket", "exclusive.txt"))
+	})
+
+	t.Run("write without create", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.OpenFile("missing.txt", os.O_WRONLY, 0)
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		f, err := s3fs.OpenFile("existing.txt", os.O_WRONLY, 0)
+		assert.NoError(err)
+		_, err = f.(io.Writer).Write([]byte("replaced"))
+		assert.NoError(err)
+		assert.NoError(f.Close())
+		assert.Equal("replaced", string(backend.Get("fooBucket", "existing.txt").Data))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		assert := require.New(t)
+
+		for _, flag := range []int{os.O_RDWR, os.O_WRONLY | os.O_APPEND, os.O_RDONLY | os.O_CREATE} {
+			_, err := s3fs.OpenFile("file.txt", flag, 0)
+			assert.ErrorIs(err, errors.ErrUnsupported)
+
+			var flagErr *FlagError
+			assert.ErrorAs(err, &flagErr)
+			assert.Equal(flag, flagErr.Flag)
+		}
+	})
+}
+
+func TestS3FS_CreateMetadata(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+
+	s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(DefaultPartSize))
+
+	t.Run("create", func(t *testing.T) {
+		assert := require.New(t)
+
+		w, err := s3fs.Create("created.txt", WithMetadata(map[string]string{"Producer-ID": "abc"}))
+		assert.NoError(err)
+
+		_, err = w.Write([]byte("hello"))
+		assert.NoError(err)
+		assert.NoError(w.Close())
+
+		f, err := s3fs.OpenObject("created.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		assert.Equal(map[string]string{"producer-id": "abc"}, f.Metadata())
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		assert := require.New(t)
+
+		data := make([]byte, DefaultPartSize+1)
+
+		err := s3fs.WriteReader("large.bin", bytes.NewReader(data), -1,
+			WithMetadata(map[string]string{"source-sha256": "abc"}))
+		assert.NoError(err)
+
+		info, err := s3fs.StatObject("large.bin")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"source-sha256": "abc"}, info.(File).Metadata())
+	})
+
+	t.Run("invalid metadata fails before any request", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		_, err := s3fs.Create("invalid.txt", WithMetadata(map[string]string{"has space": "abc"}))
+		assert.ErrorIs(err, ErrInvalidAttr)
+
+		_, err = s3fs.WriteFileResult("invalid.txt", []byte("data"), 0o644,
+			WithMetadata(map[string]string{"large": strings.Repeat("a", 2048)}))
+		assert.ErrorIs(err, ErrAttrsTooLarge)
+
+		assert.Zero(backend.Calls("PutObject"))
+		assert.Zero(backend.Calls("CreateMultipartUpload"))
+	})
+}
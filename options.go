@@ -0,0 +1,109 @@
+package s3iofs
+
+import (
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultSpoolThreshold is the size up to which streamed writes are buffered in memory.
+const defaultSpoolThreshold = 16 * mebibyte
+
+// Option configures an S3FS when it is created with New or NewWithClient.
+type Option func(*fsOptions)
+
+// fsOptions holds the settings collected from the Option values passed to New or NewWithClient.
+type fsOptions struct {
+	spoolDir           string
+	spoolThreshold     int64
+	multipartThreshold int64
+	uploadConcurrency  int
+	copyThreshold      int64
+	copyPartSize       int64
+	strictRemove       bool
+	dir                dirOptions
+	writeDefaults      []WriteOption
+	sseCustomerKey     *sseCustomerKey
+	interceptors       []Interceptor
+	clientOptions      []func(*s3.Options)
+	statCacheTTL       time.Duration
+	statCacheEntries   int
+	download           downloadOptions
+	readAhead          readAheadOptions
+	blockSize          int64
+	blockCacheBytes    int64
+	minReadSize        int64
+	readRetries        int
+	unpinnedReads      bool
+}
+
+func newFSOptions(opts []Option) fsOptions {
+	fo := fsOptions{
+		spoolThreshold:     defaultSpoolThreshold,
+		multipartThreshold: defaultMultipartThreshold,
+		uploadConcurrency:  defaultUploadConcurrency,
+		copyThreshold:      maxCopyObjectSize,
+		copyPartSize:       defaultCopyPartSize,
+		readRetries:        defaultReadRetries,
+	}
+	for _, opt := range opts {
+		opt(&fo)
+	}
+	return fo
+}
+
+// WithDirectoryModTime makes directories report the ModTime of their newest child, rather than the
+// zero time, s3 has no directories so they have no time of their own.
+//
+// Note:
+//   - Only the objects directly in the directory are considered, and only those in the first page
+//     of the listing, so very large directories may report an older time.
+//   - Stat of a directory, and Info of a directory entry returned by ReadDir, list a page of the
+//     directory to find the time, reading an open directory updates it from each page listed.
+func WithDirectoryModTime() Option {
+	return func(fo *fsOptions) {
+		fo.dir.modTime = true
+	}
+}
+
+// WithSpoolDir sets the directory used for the temporary files which hold streamed writes larger
+// than the spool memory threshold, this defaults to os.TempDir.
+func WithSpoolDir(dir string) Option {
+	return func(fo *fsOptions) {
+		fo.spoolDir = dir
+	}
+}
+
+// WithSpoolMemoryThreshold sets the size in bytes up to which streamed writes are buffered in memory
+// before they are spooled to a temporary file, this defaults to 16MiB. A threshold of zero always
+// uses a temporary file.
+func WithSpoolMemoryThreshold(n int64) Option {
+	return func(fo *fsOptions) {
+		if n >= 0 {
+			fo.spoolThreshold = n
+		}
+	}
+}
+
+// wrapClient applies the options which decorate the s3 client, client options and customer provided
+// keys are applied to every call as they may also be supplied per call with a context.
+//
+// The customer provided key is added inside the interceptors so they never see it, while a missing
+// bucket is translated to ErrBucketNotFound outside them. The stat cache, if any, is the innermost
+// interceptor so it sees the calls as they are made to s3.
+func (fo fsOptions) wrapClient(client S3API, cache *statCache) S3API {
+	client = &optionsClient{inner: client, clientOptions: fo.clientOptions}
+	client = &sseCustomerClient{inner: client, key: fo.sseCustomerKey}
+
+	interceptors := fo.interceptors
+	if cache != nil {
+		interceptors = append(slices.Clip(interceptors), cache.interceptor)
+	}
+
+	if len(interceptors) > 0 {
+		client = &interceptedClient{inner: client, interceptors: interceptors}
+	}
+
+	return &bucketErrorClient{inner: client}
+}
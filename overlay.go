@@ -0,0 +1,272 @@
+package s3iofs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	_ fs.FS        = (*Overlay)(nil)
+	_ fs.StatFS    = (*Overlay)(nil)
+	_ fs.ReadDirFS = (*Overlay)(nil)
+	_ RemoveFS     = (*Overlay)(nil)
+	_ WriteFileFS  = (*Overlay)(nil)
+)
+
+// Overlay is a filesystem which serves files from a local upper layer when present and falls through
+// to a read only S3FS base otherwise, all writes go to the upper layer so the bucket is never modified.
+type Overlay struct {
+	base  *S3FS
+	upper fs.FS
+	union *unionFS
+
+	mu        sync.RWMutex
+	whiteouts map[string]bool
+}
+
+// OverlayDiff lists the paths which differ between the upper layer of an overlay and its base.
+type OverlayDiff struct {
+	// Added are files which only exist in the upper layer.
+	Added []string
+	// Modified are files in the upper layer which shadow a file in the base.
+	Modified []string
+	// Deleted are files in the base which were removed through the overlay.
+	Deleted []string
+}
+
+// NewOverlay returns a filesystem which layers upper over the base, such as an os.DirFS over a bucket.
+//
+// Note:
+//   - Writes require the upper layer to implement WriteFileFS, otherwise they fail with fs.ErrPermission.
+//   - Removing a file records a whiteout which hides it in the base, the file is also removed from
+//     the upper layer if it implements RemoveFS. Whiteouts are held in memory.
+//   - Only files can be removed, directories disappear once all their files are removed, they
+//     are omitted by ReadDir and Open and Stat return fs.ErrNotExist.
+func NewOverlay(base *S3FS, upper fs.FS) *Overlay {
+	return &Overlay{
+		base:      base,
+		upper:     upper,
+		union:     &unionFS{layers: []fs.FS{upper, base}},
+		whiteouts: map[string]bool{},
+	}
+}
+
+// Open opens the named file from the upper layer if present, otherwise from the base.
+func (o *Overlay) Open(name string) (fs.File, error) {
+	if o.hidden(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	f, err := o.union.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir, ok := f.(*unionDir); ok {
+		dir.entries = o.filter(name, dir.entries)
+	}
+
+	return f, nil
+}
+
+// Stat returns the FileInfo for the named file from the upper layer if present, otherwise from the base.
+func (o *Overlay) Stat(name string) (fs.FileInfo, error) {
+	if o.hidden(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return o.union.Stat(name)
+}
+
+// ReadDir returns the entries of the named directory merged from both layers, entries in the
+// upper layer shadow those in the base and removed files are omitted.
+func (o *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	if o.hidden(name) {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries, err := o.union.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.filter(name, entries), nil
+}
+
+// WriteFile writes the data to the named file in the upper layer.
+func (o *Overlay) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	wfs, ok := o.upper.(WriteFileFS)
+	if !ok {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+	}
+
+	if err := wfs.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	delete(o.whiteouts, name)
+	o.mu.Unlock()
+
+	return nil
+}
+
+// Remove hides the named file, the base is not modified.
+func (o *Overlay) Remove(name string) error {
+	info, err := o.Stat(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: unwrapPathError(err)}
+	}
+
+	if info.IsDir() {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if rfs, ok := o.upper.(RemoveFS); ok {
+		err := rfs.Remove(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	o.mu.Lock()
+	o.whiteouts[name] = true
+	o.mu.Unlock()
+
+	return nil
+}
+
+// Diff returns the files which were added, modified or deleted through the overlay, each list is sorted.
+func (o *Overlay) Diff() (*OverlayDiff, error) {
+	diff := &OverlayDiff{}
+
+	err := fs.WalkDir(o.upper, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || o.whitedOut(name) {
+			return nil
+		}
+
+		info, err := o.base.Stat(name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			diff.Added = append(diff.Added, name)
+		case err != nil:
+			return err
+		case info.IsDir():
+			diff.Added = append(diff.Added, name)
+		default:
+			diff.Modified = append(diff.Modified, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.RLock()
+	whiteouts := make([]string, 0, len(o.whiteouts))
+	for name := range o.whiteouts {
+		whiteouts = append(whiteouts, name)
+	}
+	o.mu.RUnlock()
+
+	// files which were only ever in the upper layer have nothing to delete in the base
+	for _, name := range whiteouts {
+		_, err := o.base.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		diff.Deleted = append(diff.Deleted, name)
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Modified)
+	sort.Strings(diff.Deleted)
+
+	return diff, nil
+}
+
+func (o *Overlay) whitedOut(name string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.whiteouts[name]
+}
+
+// hidden reports whether the named file was removed through the overlay, or is a directory with
+// removed files and nothing left in either layer.
+func (o *Overlay) hidden(name string) bool {
+	if o.whitedOut(name) {
+		return true
+	}
+	if !o.whiteoutsUnder(name) {
+		return false
+	}
+
+	entries, err := o.union.ReadDir(name)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if !o.hidden(path.Join(name, entry.Name())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// whiteoutsUnder reports whether any file below the named directory was removed, the root is never hidden.
+func (o *Overlay) whiteoutsUnder(dir string) bool {
+	if dir == "." {
+		return false
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for name := range o.whiteouts {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filter removes the entries of the directory which were removed through the overlay.
+func (o *Overlay) filter(dir string, entries []fs.DirEntry) []fs.DirEntry {
+	res := entries[:0]
+	for _, entry := range entries {
+		if o.hidden(path.Join(dir, entry.Name())) {
+			continue
+		}
+		res = append(res, entry)
+	}
+	return res
+}
+
+// unwrapPathError returns the underlying error so it can be wrapped with a new operation.
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
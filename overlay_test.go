@@ -0,0 +1,190 @@
+package s3iofs
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// memFS is a writable in memory filesystem used as the upper layer in tests.
+type memFS struct {
+	fstest.MapFS
+}
+
+func (m memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func (m memFS) Remove(name string) error {
+	if _, ok := m.MapFS[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.MapFS, name)
+	return nil
+}
+
+func TestOverlay(t *testing.T) {
+	newOverlay := func() (*Overlay, *fakes3.Backend) {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "docs/readme.md", []byte("base readme"))
+		backend.Put("fooBucket", "docs/guide.md", []byte("base guide"))
+		backend.Put("fooBucket", "docs/old.md", []byte("old"))
+		backend.Put("fooBucket", "main.go", []byte("package main"))
+
+		upper := memFS{MapFS: fstest.MapFS{
+			"docs/readme.md": {Data: []byte("edited readme")},
+		}}
+
+		return NewOverlay(NewWithClient("fooBucket", backend), upper), backend
+	}
+
+	t.Run("upper shadows base", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay, _ := newOverlay()
+
+		data, err := fs.ReadFile(overlay, "docs/readme.md")
+		assert.NoError(err)
+		assert.Equal("edited readme", string(data))
+
+		data, err = fs.ReadFile(overlay, "docs/guide.md")
+		assert.NoError(err)
+		assert.Equal("base guide", string(data))
+	})
+
+	t.Run("writes go to the upper layer", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay, backend := newOverlay()
+
+		err := overlay.WriteFile("docs/new.md", []byte("new"), 0644)
+		assert.NoError(err)
+
+		data, err := fs.ReadFile(overlay, "docs/new.md")
+		assert.NoError(err)
+		assert.Equal("new", string(data))
+
+		assert.Nil(backend.Get("fooBucket", "docs/new.md"))
+	})
+
+	t.Run("whiteouts hide base files", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay, backend := newOverlay()
+
+		err := overlay.Remove("docs/old.md")
+		assert.NoError(err)
+
+		_, err = overlay.Open("docs/old.md")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = fs.Stat(overlay, "docs/old.md")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		assert.NotNil(backend.Get("fooBucket", "docs/old.md"))
+
+		// writing the file again removes the whiteout
+		err = overlay.WriteFile("docs/old.md", []byte("restored"), 0644)
+		assert.NoError(err)
+
+		data, err := fs.ReadFile(overlay, "docs/old.md")
+		assert.NoError(err)
+		assert.Equal("restored", string(data))
+	})
+
+	t.Run("remove errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay, _ := newOverlay()
+
+		err := overlay.Remove("missing.md")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		err = overlay.Remove("docs")
+		assert.ErrorIs(err, fs.ErrInvalid)
+	})
+
+	t.Run("listings are merged", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay, _ := newOverlay()
+
+		assert.NoError(overlay.WriteFile("docs/new.md", []byte("new"), 0644))
+		assert.NoError(overlay.Remove("docs/old.md"))
+
+		entries, err := fs.ReadDir(overlay, "docs")
+		assert.NoError(err)
+		assert.Equal([]string{"guide.md", "new.md", "readme.md"}, entryNames(entries))
+
+		f, err := overlay.Open("docs")
+		assert.NoError(err)
+
+		entries, err = f.(fs.ReadDirFile).ReadDir(-1)
+		assert.NoError(err)
+		assert.Equal([]string{"guide.md", "new.md", "readme.md"}, entryNames(entries))
+
+		entries, err = fs.ReadDir(overlay, ".")
+		assert.NoError(err)
+		assert.Equal([]string{"docs", "main.go"}, entryNames(entries))
+	})
+
+	t.Run("directories disappear once empty", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay, _ := newOverlay()
+
+		for _, name := range []string{"docs/readme.md", "docs/guide.md", "docs/old.md"} {
+			assert.NoError(overlay.Remove(name))
+		}
+
+		entries, err := fs.ReadDir(overlay, ".")
+		assert.NoError(err)
+		assert.Equal([]string{"main.go"}, entryNames(entries))
+
+		_, err = overlay.Stat("docs")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = fs.ReadDir(overlay, "docs")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		// a new file brings the directory back
+		assert.NoError(overlay.WriteFile("docs/new.md", []byte("new"), 0644))
+
+		entries, err = fs.ReadDir(overlay, ".")
+		assert.NoError(err)
+		assert.Equal([]string{"docs", "main.go"}, entryNames(entries))
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay, _ := newOverlay()
+
+		assert.NoError(overlay.WriteFile("docs/new.md", []byte("new"), 0644))
+		assert.NoError(overlay.Remove("docs/old.md"))
+		assert.NoError(overlay.WriteFile("scratch.txt", []byte("tmp"), 0644))
+		assert.NoError(overlay.Remove("scratch.txt"))
+
+		diff, err := overlay.Diff()
+		assert.NoError(err)
+		assert.Equal(&OverlayDiff{
+			Added:    []string{"docs/new.md"},
+			Modified: []string{"docs/readme.md"},
+			Deleted:  []string{"docs/old.md"},
+		}, diff)
+	})
+
+	t.Run("read only upper", func(t *testing.T) {
+		assert := require.New(t)
+
+		overlay := NewOverlay(NewWithClient("fooBucket", fakes3.New("fooBucket")), fstest.MapFS{})
+
+		err := overlay.WriteFile("a.txt", []byte("a"), 0644)
+		assert.ErrorIs(err, fs.ErrPermission)
+	})
+}
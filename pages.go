@@ -0,0 +1,128 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"iter"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// StopPaging is returned by a ReadDirPages callback to stop listing without ReadDirPages returning an error.
+var StopPaging = errors.New("stop paging")
+
+// ReadDirPagesFunc is called with each page of entries listed by ReadDirPages, lastPage is true for the
+// final page of the directory.
+type ReadDirPagesFunc func(entries []fs.DirEntry, lastPage bool) error
+
+// ReadDirPages lists the named directory one ListObjectsV2 page at a time, calling fn with the entries
+// of each page before the next page is requested.
+//
+// Note:
+//   - Entries are sorted by name within a page, directories and files are not ordered across pages.
+//   - A pageSize of zero or less uses the s3 default of 1000 keys.
+//   - Listing stops when fn returns an error, which is returned, or StopPaging, in which case nil is returned.
+func (s3fs *S3FS) ReadDirPages(ctx context.Context, name string, pageSize int32, fn ReadDirPagesFunc) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: opRead, Path: name, Err: fs.ErrInvalid}
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:     aws.String(s3fs.bucket),
+		Prefix:     aws.String(dirPrefix(name)),
+		Delimiter:  aws.String("/"),
+		FetchOwner: s3fs.opts.dir.fetchOwner(),
+	}
+
+	input.MaxKeys = s3fs.opts.dir.maxKeys(pageSize)
+
+	for first := true; ; first = false {
+		listRes, err := s3fs.s3client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return pathError(opRead, name, err)
+		}
+
+		// s3 has no directories, an empty first page means there is nothing under the prefix
+		if first && name != "." && len(listRes.Contents) == 0 && len(listRes.CommonPrefixes) == 0 {
+			return &fs.PathError{Op: opRead, Path: name, Err: fs.ErrNotExist}
+		}
+
+		entries, err := listResToEntries(s3fs.bucket, s3fs.s3client, aws.ToString(input.Prefix), s3fs.opts.dir, listRes)
+		if err != nil {
+			return pathError(opRead, name, err)
+		}
+
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+		lastPage := !aws.ToBool(listRes.IsTruncated)
+
+		if err := fn(entries, lastPage); err != nil {
+			if errors.Is(err, StopPaging) {
+				return nil
+			}
+			return err
+		}
+
+		if lastPage {
+			return nil
+		}
+
+		input.ContinuationToken = listRes.NextContinuationToken
+	}
+}
+
+// ReadDirFunc calls fn for each entry of the named directory, listing it a ListObjectsV2 page at a
+// time so only one page of entries is held in memory, however large the directory.
+//
+// Note:
+//   - The entries are built the same way as ReadDir, but are only sorted by name within a page.
+//   - Listing stops when fn returns an error, which is returned, no more pages are requested.
+//     fs.SkipAll stops the listing without an error.
+func (s3fs *S3FS) ReadDirFunc(name string, fn func(fs.DirEntry) error) error {
+	err := s3fs.ReadDirPages(s3fs.context(), name, 0, func(entries []fs.DirEntry, _ bool) error {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+
+	return err
+}
+
+// Entries returns an iterator over the entries of the named directory, listing it a ListObjectsV2
+// page at a time as the iteration proceeds, rather than building the whole directory in memory.
+//
+// Note:
+//   - The entries are built the same way as ReadDir, but are only sorted by name within a page.
+//   - Breaking out of the loop stops the listing, no more pages are requested.
+//   - An error, such as fs.ErrNotExist for a directory which doesn't exist, stops the iteration
+//     after it is yielded.
+func (s3fs *S3FS) Entries(name string) iter.Seq2[fs.DirEntry, error] {
+	return s3fs.EntriesContext(s3fs.context(), name)
+}
+
+// EntriesContext returns an iterator over the entries of the named directory, using the context for
+// the requests made to s3.
+func (s3fs *S3FS) EntriesContext(ctx context.Context, name string) iter.Seq2[fs.DirEntry, error] {
+	return func(yield func(fs.DirEntry, error) bool) {
+		err := s3fs.ReadDirPages(ctx, name, 0, func(entries []fs.DirEntry, _ bool) error {
+			for _, entry := range entries {
+				if !yield(entry, nil) {
+					return StopPaging
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
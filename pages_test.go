@@ -0,0 +1,237 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_ReadDirPages(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	for i := 0; i < 5; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("dir/file%d.txt", i), []byte("data"))
+	}
+	backend.Put("fooBucket", "dir/sub/nested.txt", []byte("data"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("pages", func(t *testing.T) {
+		assert := require.New(t)
+
+		var (
+			pages    [][]string
+			lastPage []bool
+		)
+
+		err := s3fs.ReadDirPages(context.Background(), "dir", 2, func(entries []fs.DirEntry, last bool) error {
+			pages = append(pages, entryNames(entries))
+			lastPage = append(lastPage, last)
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([][]string{
+			{"file0.txt", "file1.txt"},
+			{"file2.txt", "file3.txt"},
+			{"file4.txt", "sub"},
+		}, pages)
+		assert.Equal([]bool{false, false, true}, lastPage)
+		assert.Equal(3, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("stop paging", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		pages := 0
+		err := s3fs.ReadDirPages(context.Background(), "dir", 2, func(entries []fs.DirEntry, last bool) error {
+			pages++
+			return StopPaging
+		})
+		assert.NoError(err)
+		assert.Equal(1, pages)
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		assert := require.New(t)
+
+		errDownstream := errors.New("downstream failed")
+
+		pages := 0
+		err := s3fs.ReadDirPages(context.Background(), "dir", 2, func(entries []fs.DirEntry, last bool) error {
+			pages++
+			if pages == 2 {
+				return errDownstream
+			}
+			return nil
+		})
+		assert.ErrorIs(err, errDownstream)
+		assert.Equal(2, pages)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := s3fs.ReadDirPages(context.Background(), "missing", 2, func(entries []fs.DirEntry, last bool) error {
+			return nil
+		})
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+}
+
+func TestS3FS_Entries(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	for i := 0; i < 2500; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("dir/file%04d.txt", i), []byte("data"))
+	}
+	backend.Put("fooBucket", "dir/sub/nested.txt", []byte("data"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("every entry", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		var names []string
+		for entry, err := range s3fs.Entries("dir") {
+			assert.NoError(err)
+			names = append(names, entry.Name())
+		}
+		assert.Len(names, 2501)
+		assert.Equal("file0000.txt", names[0])
+		assert.Equal("sub", names[2500])
+		assert.Equal(3, backend.Calls("ListObjectsV2"))
+
+		// the entries match those of ReadDir
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Equal(entryNames(entries), names)
+	})
+
+	t.Run("break stops listing", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		seen := 0
+		for _, err := range s3fs.Entries("dir") {
+			assert.NoError(err)
+			seen++
+			if seen == 10 {
+				break
+			}
+		}
+		assert.Equal(10, seen)
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("errors stop the iteration", func(t *testing.T) {
+		assert := require.New(t)
+
+		var errs []error
+		for entry, err := range s3fs.Entries("missing") {
+			assert.Nil(entry)
+			errs = append(errs, err)
+		}
+		assert.Len(errs, 1)
+		assert.ErrorIs(errs[0], fs.ErrNotExist)
+
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			return errors.New("list failed")
+		}
+		defer func() { backend.OnCall = nil }()
+
+		errs = nil
+		for _, err := range s3fs.Entries("dir") {
+			errs = append(errs, err)
+		}
+		assert.Len(errs, 1)
+		assert.ErrorContains(errs[0], "list failed")
+	})
+}
+
+func TestS3FS_ReadDirFunc(t *testing.T) {
+	isList := func(token string) any {
+		return mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir/" && aws.ToString(params.ContinuationToken) == token
+		})
+	}
+
+	newClient := func() *mockS3Client {
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, isList(""), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes:        []types.CommonPrefix{{Prefix: aws.String("dir/m/")}},
+			Contents:              []types.Object{{Key: aws.String("dir/b.txt")}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("page2"),
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isList("page2"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents:              []types.Object{{Key: aws.String("dir/c.txt")}, {Key: aws.String("dir/d.txt")}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("page3"),
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isList("page3"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/e.txt")}},
+		}, nil).Maybe()
+		return mockClient
+	}
+
+	t.Run("every entry", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		var names []string
+		err := s3fs.ReadDirFunc("dir", func(entry fs.DirEntry) error {
+			names = append(names, entry.Name())
+			return nil
+		})
+		assert.NoError(err)
+		// sorted within each page
+		assert.Equal([]string{"b.txt", "m", "c.txt", "d.txt", "e.txt"}, names)
+
+		mockClient.AssertNumberOfCalls(t, "ListObjectsV2", 3)
+	})
+
+	t.Run("error stops listing", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		errStop := errors.New("stop")
+
+		var names []string
+		err := s3fs.ReadDirFunc("dir", func(entry fs.DirEntry) error {
+			names = append(names, entry.Name())
+			if entry.Name() == "c.txt" {
+				return errStop
+			}
+			return nil
+		})
+		assert.ErrorIs(err, errStop)
+		assert.Equal([]string{"b.txt", "m", "c.txt"}, names)
+
+		mockClient.AssertNumberOfCalls(t, "ListObjectsV2", 2)
+
+		mockClient = newClient()
+		err = NewWithClient("fooBucket", mockClient).ReadDirFunc("dir", func(fs.DirEntry) error {
+			return fs.SkipAll
+		})
+		assert.NoError(err)
+
+		mockClient.AssertNumberOfCalls(t, "ListObjectsV2", 1)
+	})
+}
@@ -0,0 +1,49 @@
+package s3iofs
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// WithoutETagPinning makes the ranged reads of open files, made by ReadAt, Read after a Seek, read
+// ahead, the block cache and parallel downloads, request the object without the ETag it was opened
+// with, for s3 compatible services which don't support IfMatch on a ranged GetObject.
+//
+// Note:
+//   - By default each ranged read is made with the ETag as IfMatch, and in a versioned bucket with
+//     the version id returned by the open, see ErrObjectChanged. Without pinning the reads return
+//     the data of whichever version is current.
+//   - Files opened with OpenVersion are always read from their version.
+//   - ResumeDownload always uses the ETag held in the DownloadState.
+func WithoutETagPinning() Option {
+	return func(fo *fsOptions) {
+		fo.unpinnedReads = true
+	}
+}
+
+// pinnedETag returns the ETag sent as IfMatch by the ranged reads of the file, the ETag seen when it
+// was opened, this is empty if the object has no ETag or WithoutETagPinning is set.
+func (s3f *s3File) pinnedETag() string {
+	if s3f.unpinned {
+		return ""
+	}
+	return s3f.openETag
+}
+
+// rangeRequest returns a GetObject of the range of the file, a length of -1 reads to the end of the
+// object. The request is made with the version of the file and its pinned ETag.
+func (s3f *s3File) rangeRequest(offset, length int64) *s3.GetObjectInput {
+	req := &s3.GetObjectInput{
+		Bucket: aws.String(s3f.bucket),
+		Key:    aws.String(s3f.name),
+		Range:  buildRange(offset, length),
+	}
+	if s3f.versionID != "" {
+		req.VersionId = aws.String(s3f.versionID)
+	}
+	if etag := s3f.pinnedETag(); etag != "" {
+		req.IfMatch = aws.String(etag)
+	}
+
+	return req
+}
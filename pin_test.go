@@ -0,0 +1,139 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3File_ETagPinning(t *testing.T) {
+	oldData := bytes.Repeat([]byte("a"), 1000)
+	newData := bytes.Repeat([]byte("b"), 1000)
+
+	t.Run("a ranged read after the object is replaced", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return params.Range == nil
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(oldData)),
+			ContentLength: aws.Int64(int64(len(oldData))),
+			ETag:          aws.String(`"v1"`),
+		}, nil).Once()
+		mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return aws.ToString(params.Range) == "bytes=0-99" && aws.ToString(params.IfMatch) == `"v1"`
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(oldData[:100])),
+			ETag: aws.String(`"v1"`),
+		}, nil).Once()
+		mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return aws.ToString(params.Range) == "bytes=100-199" && aws.ToString(params.IfMatch) == `"v1"`
+		}), mock.Anything).Return((*s3.GetObjectOutput)(nil), &smithy.GenericAPIError{
+			Code:    "PreconditionFailed",
+			Message: "At least one of the pre-conditions you specified did not hold",
+		}).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.OpenObject("file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		buf := make([]byte, 100)
+
+		_, err = f.ReadAt(buf, 0)
+		assert.NoError(err)
+		assert.Equal(oldData[:100], buf)
+
+		_, err = f.ReadAt(buf, 100)
+		assert.ErrorIs(err, ErrObjectChanged)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("file.txt", pathErr.Path)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("read after a seek", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "file.txt", oldData)
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		f, err := s3fs.OpenObject("file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.Put("fooBucket", "file.txt", newData)
+
+		_, err = f.Seek(500, io.SeekStart)
+		assert.NoError(err)
+
+		_, err = f.Read(make([]byte, 10))
+		assert.ErrorIs(err, ErrObjectChanged)
+	})
+
+	t.Run("refresh doesn't move the pin", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "file.txt", oldData)
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		f, err := s3fs.OpenObject("file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.Put("fooBucket", "file.txt", newData)
+
+		// the metadata is of the new object, the reads still expect the one which was opened
+		assert.NoError(f.Refresh(context.Background()))
+
+		_, err = f.ReadAt(make([]byte, 100), 100)
+		assert.ErrorIs(err, ErrObjectChanged)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "file.txt", oldData)
+
+		var ifMatch []string
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if params, ok := input.(*s3.GetObjectInput); ok {
+				ifMatch = append(ifMatch, aws.ToString(params.IfMatch))
+			}
+			return nil
+		}
+
+		s3fs := NewWithClient("fooBucket", backend, WithoutETagPinning())
+
+		f, err := s3fs.OpenObject("file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		backend.Put("fooBucket", "file.txt", newData)
+
+		buf := make([]byte, 100)
+		_, err = f.ReadAt(buf, 100)
+		assert.NoError(err)
+		assert.Equal(newData[:100], buf)
+
+		assert.Equal([]string{"", ""}, ifMatch)
+	})
+}
@@ -0,0 +1,241 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// WithReadAhead makes Read fetch files in chunks of bufferSize, with up to depth chunks fetched in
+// the background ahead of the one being read, so sequential reads in small pieces, such as parsing a
+// CSV file, rarely wait on s3. This is disabled by default.
+//
+// Note:
+//   - Memory use of each open file is bounded by depth plus one, the chunk being read, multiplied by
+//     the buffer size.
+//   - Fetching stops at the end of the file, and the chunks in flight are cancelled by Close.
+//   - A Seek to another offset, a ReadAt or a WriteTo discards the chunks fetched ahead, the next
+//     Read starts fetching again from its offset.
+//   - An error fetching a chunk is returned by the Read which needs its bytes.
+//   - The chunks are pinned to the object which was opened, see ErrObjectChanged.
+func WithReadAhead(bufferSize int64, depth int) Option {
+	return func(fo *fsOptions) {
+		if bufferSize <= 0 || depth <= 0 {
+			return
+		}
+		fo.readAhead = readAheadOptions{bufferSize: bufferSize, depth: depth}
+	}
+}
+
+// readAheadOptions holds the settings of read ahead, which is disabled when depth is zero.
+type readAheadOptions struct {
+	bufferSize int64
+	depth      int
+}
+
+func (ra readAheadOptions) enabled() bool {
+	return ra.depth > 0
+}
+
+// prefetcher fetches the chunks of a file in order ahead of the reads, each in its own goroutine.
+type prefetcher struct {
+	s3f    *s3File
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// first is the body the file was opened with, which is used for the first chunk
+	first     io.ReadCloser
+	firstUsed bool
+	size      int64
+	next      int64 // offset of the next chunk to fetch
+	// eof is set once a chunk shorter than requested has been read, no more chunks are fetched
+	eof    bool
+	chunks []*chunk // the chunk being read followed by those fetched ahead of it
+	pool   [][]byte
+}
+
+// chunk is a range of the file, the data and error are set once ready is closed.
+type chunk struct {
+	offset int64
+	length int64
+	data   []byte
+	err    error
+	ready  chan struct{}
+}
+
+// newPrefetcher returns a prefetcher starting at the offset of the file, body is positioned at the
+// offset, or nil if the file has no open body.
+func newPrefetcher(s3f *s3File, size int64, body io.ReadCloser) *prefetcher {
+	ctx, cancel := context.WithCancel(s3f.context())
+
+	return &prefetcher{
+		s3f:    s3f,
+		ctx:    ctx,
+		cancel: cancel,
+		first:  body,
+		size:   size,
+		next:   s3f.offset,
+	}
+}
+
+// read copies the data at the offset from the chunk being read, waiting for it to be fetched, the
+// chunks ahead of it are started first.
+func (pf *prefetcher) read(p []byte, offset int64) (int, error) {
+	if pf.eof && len(pf.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	pf.fill()
+
+	if len(pf.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	c := pf.chunks[0]
+	<-c.ready
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	pos := offset - c.offset
+	n := copy(p, c.data[pos:])
+
+	if pos+int64(n) == int64(len(c.data)) {
+		pf.chunks = pf.chunks[1:]
+		pf.pool = append(pf.pool, c.data[:cap(c.data)])
+
+		// a short chunk is the end of a file of unknown size, or of one which has shrunk, any chunks
+		// fetched after it are empty
+		if int64(len(c.data)) < c.length {
+			pf.eof = true
+			pf.chunks = nil
+		}
+	}
+
+	if n == 0 {
+		return 0, io.EOF
+	}
+
+	return n, nil
+}
+
+// fill starts fetching chunks until depth chunks are in flight ahead of the one being read, or the
+// end of the file is reached.
+func (pf *prefetcher) fill() {
+	bufferSize := pf.s3f.readAhead.bufferSize
+
+	for !pf.eof && len(pf.chunks) <= pf.s3f.readAhead.depth {
+		length := bufferSize
+		if pf.size != sizeUnknown {
+			if pf.next >= pf.size {
+				return
+			}
+			length = min(bufferSize, pf.size-pf.next)
+		}
+
+		var buf []byte
+		if n := len(pf.pool); n > 0 {
+			buf, pf.pool = pf.pool[n-1], pf.pool[:n-1]
+		} else {
+			buf = make([]byte, bufferSize)
+		}
+
+		c := &chunk{offset: pf.next, length: length, ready: make(chan struct{})}
+
+		var body io.ReadCloser
+		if !pf.firstUsed {
+			body = pf.first
+			pf.firstUsed = true
+		}
+
+		pf.wg.Add(1)
+		go func() {
+			defer pf.wg.Done()
+			defer close(c.ready)
+
+			c.data, c.err = pf.fetch(body, buf[:length], c.offset)
+		}()
+
+		pf.chunks = append(pf.chunks, c)
+		pf.next += length
+	}
+}
+
+// fetch fills buf from the offset, reading from body if it isn't nil, otherwise with a ranged
+// GetObject pinned to the file. When the size of the file is unknown the data is shorter than buf at
+// the end of the file, when it is known a body which ends early has dropped, so the rest of the
+// chunk is requested again up to the read retries of the file.
+func (pf *prefetcher) fetch(body io.ReadCloser, buf []byte, offset int64) ([]byte, error) {
+	s3f := pf.s3f
+
+	if body == nil {
+		var err error
+		body, err = pf.open(offset, int64(len(buf)))
+		if err != nil {
+			// the offset is past the end of the object, its size is unknown or has changed
+			if isInvalidRange(err) {
+				return buf[:0], nil
+			}
+			return nil, err
+		}
+	}
+
+	filled := 0
+
+	for retries := 0; ; retries++ {
+		n, err := io.ReadFull(body, buf[filled:])
+		body.Close()
+		filled += n
+
+		if err == nil {
+			return buf, nil
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			if pf.size == sizeUnknown {
+				return buf[:filled], nil
+			}
+			err = io.ErrUnexpectedEOF
+		}
+
+		if retries >= s3f.readRetries || pf.ctx.Err() != nil || !s3f.resumable(err) {
+			return nil, pathError(opRead, s3f.name, err)
+		}
+
+		body, err = pf.open(offset+int64(filled), int64(len(buf)-filled))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// open returns the body of a ranged GetObject pinned to the file.
+func (pf *prefetcher) open(offset, length int64) (io.ReadCloser, error) {
+	s3f := pf.s3f
+
+	res, err := s3f.s3client.GetObject(pf.ctx, s3f.rangeRequest(offset, length))
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return nil, &fs.PathError{Op: opRead, Path: s3f.name, Err: ErrObjectChanged}
+		}
+		return nil, pathError(opRead, s3f.name, err)
+	}
+
+	return res.Body, nil
+}
+
+// close cancels the chunks in flight and waits for them to stop.
+func (pf *prefetcher) close() {
+	pf.cancel()
+
+	// the body of the open isn't bound to the context, closing it stops a read in progress
+	if pf.first != nil {
+		pf.first.Close()
+	}
+
+	pf.wg.Wait()
+}
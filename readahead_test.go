@@ -0,0 +1,304 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+	"go.uber.org/goleak"
+)
+
+func TestS3File_ReadAhead(t *testing.T) {
+	const bufferSize = 256 * 1024
+
+	data := make([]byte, 1024*1024+123)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	newFS := func() (*fakes3.Backend, *S3FS) {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "large.bin", data)
+		return backend, NewWithClient("fooBucket", backend, WithReadAhead(bufferSize, 2))
+	}
+
+	// readChunks reads n bytes from f in 4KiB reads, as a parser reading a stream would
+	readChunks := func(f io.Reader, n int) ([]byte, error) {
+		var out bytes.Buffer
+		buf := make([]byte, 4096)
+		for out.Len() < n {
+			m, err := f.Read(buf[:min(len(buf), n-out.Len())])
+			out.Write(buf[:m])
+			if err != nil {
+				return out.Bytes(), err
+			}
+		}
+		return out.Bytes(), nil
+	}
+
+	t.Run("sequential reads are served from chunks", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		backend, s3fs := newFS()
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+
+		got, err := readChunks(f, len(data)+1)
+		assert.ErrorIs(err, io.EOF)
+		assert.Equal(data, got)
+
+		// the first chunk is read from the body of the open, then one request for each chunk
+		assert.Equal(5, backend.Calls("GetObject"))
+
+		_, err = f.Read(make([]byte, 10))
+		assert.ErrorIs(err, io.EOF)
+
+		assert.NoError(f.Close())
+	})
+
+	t.Run("seek discards the chunks", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		_, s3fs := newFS()
+
+		f, err := s3fs.OpenObject("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := readChunks(f, 10000)
+		assert.NoError(err)
+		assert.Equal(data[:10000], got)
+
+		_, err = f.Seek(700*1024, io.SeekStart)
+		assert.NoError(err)
+
+		got, err = io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(data[700*1024:], got)
+
+		_, err = f.Seek(5, io.SeekStart)
+		assert.NoError(err)
+
+		got, err = readChunks(f, 10)
+		assert.NoError(err)
+		assert.Equal(data[5:15], got)
+	})
+
+	t.Run("read at discards the chunks", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		backend, s3fs := newFS()
+
+		f, err := s3fs.OpenObject("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := readChunks(f, 300*1024)
+		assert.NoError(err)
+		assert.Equal(data[:300*1024], got)
+
+		buf := make([]byte, 100)
+		_, err = f.ReadAt(buf, 1000)
+		assert.NoError(err)
+		assert.Equal(data[1000:1100], buf)
+
+		backend.ResetCalls()
+
+		// the read continues from its own offset, fetching the chunks again
+		got, err = readChunks(f, 10)
+		assert.NoError(err)
+		assert.Equal(data[300*1024:300*1024+10], got)
+		assert.Positive(backend.Calls("GetObject"))
+	})
+
+	t.Run("read at doesn't hold the file while the chunks stop", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		backend, s3fs := newFS()
+
+		started, stopping, release := make(chan struct{}, 2), make(chan struct{}, 2), make(chan struct{})
+		backend.OnCall = func(ctx context.Context, op string, input any) error {
+			if params, ok := input.(*s3.GetObjectInput); ok && params.Range != nil {
+				select {
+				case <-release:
+					return nil
+				default:
+				}
+
+				// the chunks are slow to stop, as a request which has to time out would be
+				started <- struct{}{}
+				<-ctx.Done()
+				stopping <- struct{}{}
+				<-release
+				return ctx.Err()
+			}
+			return nil
+		}
+
+		f, err := s3fs.OpenObject("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		_, err = readChunks(f, 4096)
+		assert.NoError(err)
+
+		<-started
+		<-started
+
+		readAtErr := make(chan error, 1)
+		go func() {
+			buf := make([]byte, 100)
+			_, err := f.ReadAt(buf, 1000)
+			readAtErr <- err
+		}()
+
+		// the read at is waiting for the chunks, the file is still usable
+		<-stopping
+
+		seeked := make(chan error, 1)
+		go func() {
+			_, err := f.Seek(0, io.SeekCurrent)
+			seeked <- err
+		}()
+
+		select {
+		case err := <-seeked:
+			assert.NoError(err)
+		case <-time.After(5 * time.Second):
+			close(release)
+			t.Fatal("seek blocked by the read at")
+		}
+
+		close(release)
+		assert.NoError(<-readAtErr)
+	})
+
+	t.Run("errors are returned by the read which needs the chunk", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		backend, s3fs := newFS()
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if params, ok := input.(*s3.GetObjectInput); ok && strings.HasPrefix(aws.ToString(params.Range), "bytes=262144-") {
+				return errors.New("connection reset")
+			}
+			return nil
+		}
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := readChunks(f, len(data))
+		assert.ErrorContains(err, "connection reset")
+		assert.Equal(data[:bufferSize], got)
+	})
+
+	t.Run("a body which drops mid chunk is resumed", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		backend, _ := newFS()
+		client := &droppingClient{Backend: backend, after: 5}
+		s3fs := NewWithClient("fooBucket", client, WithReadAhead(bufferSize, 2))
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(data, got)
+
+		// the rest of the first chunk is requested from where the body dropped
+		assert.Contains(client.ranges, "bytes=5-262143")
+	})
+
+	t.Run("a body which drops mid chunk without retries", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		backend, _ := newFS()
+		client := &droppingClient{Backend: backend, after: 5}
+		s3fs := NewWithClient("fooBucket", client, WithReadAhead(bufferSize, 2), WithReadRetries(0))
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := io.ReadAll(f)
+		assert.ErrorIs(err, io.ErrUnexpectedEOF)
+		assert.Empty(got)
+	})
+
+	t.Run("close stops the chunks in flight", func(t *testing.T) {
+		defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+		assert := require.New(t)
+
+		backend, s3fs := newFS()
+
+		started := make(chan struct{}, 2)
+		backend.OnCall = func(ctx context.Context, op string, input any) error {
+			if params, ok := input.(*s3.GetObjectInput); ok && params.Range != nil {
+				started <- struct{}{}
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+
+		got, err := readChunks(f, 4096)
+		assert.NoError(err)
+		assert.Equal(data[:4096], got)
+
+		<-started
+		<-started
+
+		assert.NoError(f.Close())
+	})
+}
+
+// droppingClient returns a body for the open of an object which ends cleanly after a few bytes, as
+// a connection closed part way through would, the ranged requests are recorded.
+type droppingClient struct {
+	*fakes3.Backend
+	after int64
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (c *droppingClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	res, err := c.Backend.GetObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Range == nil {
+		res.Body = io.NopCloser(io.LimitReader(res.Body, c.after))
+		return res, nil
+	}
+
+	c.mu.Lock()
+	c.ranges = append(c.ranges, aws.ToString(params.Range))
+	c.mu.Unlock()
+
+	return res, nil
+}
@@ -0,0 +1,261 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ErrTooManyEntries is returned by ReadDirRecursive when the directory contains more entries than
+// the WithMaxEntries cap.
+var ErrTooManyEntries = errors.New("too many entries")
+
+// ReadDirRecursive returns every file below the named directory, the Name of each entry is its path
+// relative to the directory, and entries are sorted in the order fs.WalkDir visits them.
+//
+// Note:
+//   - The directory is listed without a delimiter, so this uses one ListObjectsV2 call per 1000 keys
+//     regardless of how deeply the keys are nested.
+//   - Directories are only returned for directory markers, unless WithIntermediateDirs is set.
+//   - If WithMaxEntries is set and the directory has more entries, ErrTooManyEntries is returned
+//     rather than a partial result.
+func (s3fs *S3FS) ReadDirRecursive(name string, opts ...ListOption) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: fs.ErrInvalid}
+	}
+
+	lo := newListOptions(opts)
+	prefix := dirPrefix(name)
+
+	var (
+		entries []fs.DirEntry
+		dirs    = map[string]bool{}
+		found   bool
+	)
+
+	addDir := func(key, rel string) {
+		if dirs[rel] {
+			return
+		}
+		dirs[rel] = true
+		entries = append(entries, &s3File{
+			s3client: s3fs.s3client,
+			name:     strings.TrimSuffix(key, "/"),
+			bucket:   s3fs.bucket,
+			mode:     fs.ModeDir,
+			relName:  rel,
+		})
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:     aws.String(s3fs.bucket),
+		Prefix:     aws.String(prefix),
+		MaxKeys:    s3fs.opts.dir.maxKeys(0),
+		FetchOwner: s3fs.opts.dir.fetchOwner(),
+	}
+
+	for {
+		listRes, err := s3fs.s3client.ListObjectsV2(s3fs.context(), input)
+		if err != nil {
+			return nil, pathError(opRead, name, err)
+		}
+
+		for _, obj := range listRes.Contents {
+			key := aws.ToString(obj.Key)
+			rel := strings.TrimPrefix(key, prefix)
+			found = true
+
+			if rel == "" {
+				// the marker of the directory itself
+				continue
+			}
+
+			if lo.dirs {
+				parents := strings.TrimSuffix(rel, "/")
+				for i := range len(parents) {
+					if parents[i] == '/' {
+						addDir(prefix+parents[:i], parents[:i])
+					}
+				}
+			}
+
+			if strings.HasSuffix(rel, "/") {
+				addDir(key, strings.TrimSuffix(rel, "/"))
+				continue
+			}
+
+			if s3fs.opts.dir.isHidden(key) {
+				continue
+			}
+
+			entries = append(entries, &s3File{
+				s3client: s3fs.s3client,
+				name:     key,
+				bucket:   s3fs.bucket,
+				size:     objectSize(obj.Size),
+				modTime:  aws.ToTime(obj.LastModified),
+				listed:   true,
+				relName:  rel,
+
+				etag:         aws.ToString(obj.ETag),
+				storageClass: string(obj.StorageClass),
+				owner:        ownerID(obj.Owner),
+			})
+		}
+
+		if lo.maxEntries > 0 && len(entries) > int(lo.maxEntries) {
+			return nil, &fs.PathError{Op: opRead, Path: name, Err: ErrTooManyEntries}
+		}
+
+		if !aws.ToBool(listRes.IsTruncated) {
+			break
+		}
+
+		input.ContinuationToken = listRes.NextContinuationToken
+	}
+
+	// s3 has no directories, an empty listing means there is nothing under the prefix
+	if !found && name != "." {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: fs.ErrNotExist}
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return comparePaths(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+// WalkObjectsFunc is called by WalkObjects for each object, key is the full key of the object. If
+// the listing fails it is called once with the root and the error.
+type WalkObjectsFunc func(key string, info fs.FileInfo, err error) error
+
+// WalkObjects calls fn for every object below root, in the lexical order of the keys.
+//
+// Note:
+//   - The keys are listed without a delimiter, so this uses one ListObjectsV2 call per 1000 keys
+//     rather than one per directory, as fs.WalkDir does.
+//   - The FileInfo is filled in from the listing, there are no extra requests for each object.
+//   - Directory markers are skipped, only the objects within directories are walked.
+//   - If fn returns fs.SkipDir the remaining keys in the directory of the key are skipped, the
+//     listing resumes after them rather than paging through them, fs.SkipAll stops the walk and
+//     any other error stops the walk and is returned.
+//   - A root which doesn't exist is passed to fn with fs.ErrNotExist.
+func (s3fs *S3FS) WalkObjects(ctx context.Context, root string, fn WalkObjectsFunc) error {
+	if !fs.ValidPath(root) {
+		return &fs.PathError{Op: opRead, Path: root, Err: fs.ErrInvalid}
+	}
+
+	prefix := dirPrefix(root)
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:     aws.String(s3fs.bucket),
+		Prefix:     aws.String(prefix),
+		MaxKeys:    s3fs.opts.dir.maxKeys(0),
+		FetchOwner: s3fs.opts.dir.fetchOwner(),
+	}
+
+	var (
+		found bool
+		skip  string // the prefix of the directory being skipped
+	)
+
+	for {
+		listRes, err := s3fs.s3client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return walkObjectsError(fn(root, nil, pathError(opRead, root, err)))
+		}
+
+		var key string
+		for _, obj := range listRes.Contents {
+			key = aws.ToString(obj.Key)
+			found = true
+
+			if strings.HasSuffix(key, "/") || s3fs.opts.dir.isHidden(key) || (skip != "" && strings.HasPrefix(key, skip)) {
+				continue
+			}
+
+			err := fn(key, &s3File{
+				s3client: s3fs.s3client,
+				name:     key,
+				bucket:   s3fs.bucket,
+				size:     objectSize(obj.Size),
+				modTime:  aws.ToTime(obj.LastModified),
+				listed:   true,
+
+				etag:         aws.ToString(obj.ETag),
+				storageClass: string(obj.StorageClass),
+				owner:        ownerID(obj.Owner),
+			}, nil)
+			if errors.Is(err, fs.SkipDir) {
+				skip = path.Dir(key) + "/"
+				if skip == prefix || skip == "./" {
+					return nil
+				}
+				continue
+			}
+			if err != nil {
+				return walkObjectsError(err)
+			}
+		}
+
+		if !aws.ToBool(listRes.IsTruncated) {
+			break
+		}
+
+		// resume after the skipped directory rather than paging through the rest of it
+		if skip != "" && strings.HasPrefix(key, skip) {
+			input.ContinuationToken = nil
+			input.StartAfter = aws.String(skip + string(utf8.MaxRune))
+			continue
+		}
+
+		input.ContinuationToken = listRes.NextContinuationToken
+	}
+
+	// s3 has no directories, an empty listing means there is nothing under the prefix
+	if !found && root != "." {
+		return walkObjectsError(fn(root, nil, &fs.PathError{Op: opRead, Path: root, Err: fs.ErrNotExist}))
+	}
+
+	return nil
+}
+
+// walkObjectsError returns the error which stops a walk, fs.SkipDir and fs.SkipAll aren't errors.
+func walkObjectsError(err error) error {
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// comparePaths orders slash separated paths an element at a time, so a directory is followed by
+// its contents before any siblings which sort after it, matching the order of fs.WalkDir.
+func comparePaths(a, b string) int {
+	for {
+		aElem, aRest, aMore := strings.Cut(a, "/")
+		bElem, bRest, bMore := strings.Cut(b, "/")
+
+		if c := strings.Compare(aElem, bElem); c != 0 {
+			return c
+		}
+
+		switch {
+		case !aMore && !bMore:
+			return 0
+		case !aMore:
+			return -1
+		case !bMore:
+			return 1
+		}
+
+		a, b = aRest, bRest
+	}
+}
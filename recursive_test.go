@@ -0,0 +1,219 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_ReadDirRecursive(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "root/a.txt", []byte("a"))
+	backend.Put("fooBucket", "root/a/b/c.txt", []byte("c"))
+	backend.Put("fooBucket", "root/a/b.txt", []byte("b"))
+	backend.Put("fooBucket", "root/empty/", nil)
+	backend.Put("fooBucket", "root/z.txt", []byte("z"))
+	backend.Put("fooBucket", "rootless.txt", []byte("outside"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("files", func(t *testing.T) {
+		assert := require.New(t)
+
+		entries, err := s3fs.ReadDirRecursive("root")
+		assert.NoError(err)
+		assert.Equal([]string{"a/b/c.txt", "a/b.txt", "a.txt", "empty", "z.txt"}, entryNames(entries))
+
+		assert.True(entries[3].IsDir())
+
+		info, err := entries[0].Info()
+		assert.NoError(err)
+		assert.Equal("a/b/c.txt", info.Name())
+		assert.Equal(int64(1), info.Size())
+		assert.Equal("root/a/b/c.txt", entries[0].(File).Key())
+	})
+
+	t.Run("intermediate directories", func(t *testing.T) {
+		assert := require.New(t)
+
+		entries, err := s3fs.ReadDirRecursive("root", WithIntermediateDirs())
+		assert.NoError(err)
+		assert.Equal([]string{"a", "a/b", "a/b/c.txt", "a/b.txt", "a.txt", "empty", "z.txt"}, entryNames(entries))
+		assert.True(entries[0].IsDir())
+		assert.Equal("root/a/", entries[0].(File).Key())
+	})
+
+	t.Run("matches walk dir", func(t *testing.T) {
+		assert := require.New(t)
+
+		mapFS := fstest.MapFS{}
+		for _, key := range []string{"a/b/c.txt", "a/b.txt", "a.txt", "a-b/d.txt", "z.txt"} {
+			mapFS[key] = &fstest.MapFile{Data: []byte("data")}
+		}
+
+		var walked []string
+		err := fs.WalkDir(mapFS, ".", func(p string, d fs.DirEntry, err error) error {
+			if p != "." {
+				walked = append(walked, p)
+			}
+			return err
+		})
+		assert.NoError(err)
+
+		other := fakes3.New("fooBucket")
+		for key := range mapFS {
+			other.Put("fooBucket", "dir/"+key, []byte("data"))
+		}
+
+		entries, err := NewWithClient("fooBucket", other).ReadDirRecursive("dir", WithIntermediateDirs())
+		assert.NoError(err)
+		assert.Equal(walked, entryNames(entries))
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		assert := require.New(t)
+
+		other := fakes3.New("fooBucket")
+		for i := 0; i < 2500; i++ {
+			other.Put("fooBucket", fmt.Sprintf("big/%02d/%04d.txt", i%25, i), []byte("data"))
+		}
+
+		entries, err := NewWithClient("fooBucket", other).ReadDirRecursive("big", WithIntermediateDirs())
+		assert.NoError(err)
+		assert.Len(entries, 2525)
+		assert.Equal(3, other.Calls("ListObjectsV2"))
+
+		names := entryNames(entries)
+		assert.Equal("00", names[0])
+		assert.Equal("00/0000.txt", names[1])
+		assert.Equal("01", names[101])
+		assert.True(fs.ValidPath(names[len(names)-1]))
+	})
+
+	t.Run("max entries", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.ReadDirRecursive("root", WithMaxEntries(5))
+		assert.NoError(err)
+
+		_, err = s3fs.ReadDirRecursive("root", WithMaxEntries(4))
+		assert.ErrorIs(err, ErrTooManyEntries)
+
+		_, err = s3fs.ReadDirRecursive("root", WithMaxEntries(5), WithIntermediateDirs())
+		assert.ErrorIs(err, ErrTooManyEntries)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.ReadDirRecursive("missing")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = s3fs.ReadDirRecursive("root/a.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = s3fs.ReadDirRecursive("/root")
+		assert.ErrorIs(err, fs.ErrInvalid)
+
+		entries, err := s3fs.ReadDirRecursive(".")
+		assert.NoError(err)
+		assert.Len(entries, 6)
+	})
+}
+
+func TestS3FS_WalkObjects(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	// 2500 keys spread across 250 directories
+	for i := 0; i < 250; i++ {
+		for j := 0; j < 10; j++ {
+			backend.Put("fooBucket", fmt.Sprintf("tree/d%03d/f%d.txt", i, j), []byte("data"))
+		}
+	}
+	backend.Put("fooBucket", "tree/d000/", nil)
+	backend.Put("fooBucket", "treeless.txt", []byte("outside"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("visits every object", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		var keys []string
+		err := s3fs.WalkObjects(context.Background(), "tree", func(key string, info fs.FileInfo, err error) error {
+			assert.NoError(err)
+			assert.False(info.IsDir())
+			assert.NotZero(info.Size())
+			assert.False(info.ModTime().IsZero())
+			keys = append(keys, key)
+			return nil
+		})
+		assert.NoError(err)
+		assert.Len(keys, 2500)
+		assert.Equal("tree/d000/f0.txt", keys[0])
+		assert.Equal("tree/d249/f9.txt", keys[2499])
+
+		// one list per 1000 keys, rather than one per directory
+		assert.Equal(3, backend.Calls("ListObjectsV2"))
+		assert.Equal(0, backend.Calls("HeadObject"))
+	})
+
+	t.Run("skip dir", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		var keys []string
+		err := s3fs.WalkObjects(context.Background(), "tree", func(key string, info fs.FileInfo, err error) error {
+			keys = append(keys, key)
+			// skip all but the first key of each directory
+			return fs.SkipDir
+		})
+		assert.NoError(err)
+		assert.Len(keys, 250)
+		assert.Equal("tree/d001/f0.txt", keys[1])
+	})
+
+	t.Run("skip all and errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		visited := 0
+		err := s3fs.WalkObjects(context.Background(), "tree", func(key string, info fs.FileInfo, err error) error {
+			visited++
+			return fs.SkipAll
+		})
+		assert.NoError(err)
+		assert.Equal(1, visited)
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+
+		errStop := errors.New("stop")
+		err = s3fs.WalkObjects(context.Background(), "tree", func(key string, info fs.FileInfo, err error) error {
+			return errStop
+		})
+		assert.ErrorIs(err, errStop)
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		assert := require.New(t)
+
+		var walkErr error
+		err := s3fs.WalkObjects(context.Background(), "missing", func(key string, info fs.FileInfo, err error) error {
+			assert.Equal("missing", key)
+			walkErr = err
+			return err
+		})
+		assert.ErrorIs(err, fs.ErrNotExist)
+		assert.ErrorIs(walkErr, fs.ErrNotExist)
+
+		err = s3fs.WalkObjects(context.Background(), "../tree", func(string, fs.FileInfo, error) error { return nil })
+		assert.ErrorIs(err, fs.ErrInvalid)
+	})
+}
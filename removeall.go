@@ -0,0 +1,168 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// RemoveAll removes the named file or directory and everything it contains.
+//
+// Note:
+//   - Like os.RemoveAll, a path which doesn't exist isn't an error.
+//   - The keys are listed a page at a time and removed with DeleteObjects batches of up to 1000
+//     keys, rather than a request for each key.
+//   - The directory marker, if there is one, is removed along with the contents.
+//   - Keys which can't be deleted don't stop the removal, once every page is processed they are
+//     reported with a *BatchError which lists the failed keys. A DeleteObjects request which fails
+//     as a whole, such as with access denied, stops the removal and its error is returned.
+func (s3fs *S3FS) RemoveAll(name string) error {
+	return s3fs.RemoveAllContext(s3fs.context(), name)
+}
+
+// RemoveAllContext removes the named file or directory and everything it contains, using the
+// context for the list and delete requests.
+//
+// Note:
+//   - WithBulkProgress is called as each DeleteObjects batch completes, and WithBulkConcurrency
+//     limits the batches in flight.
+//   - If the context is cancelled the batches in flight are finished and the removal stops before
+//     the next page, the error wraps a *CancelledError which counts the keys removed and lists the
+//     keys which were listed but not removed.
+func (s3fs *S3FS) RemoveAllContext(ctx context.Context, name string, opts ...BulkOption) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &fs.PathError{Op: "removeall", Path: name, Err: err}
+	}
+
+	bo := newBulkOptions(opts)
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s3fs.bucket),
+		Prefix:  aws.String(dirPrefix(name)),
+		MaxKeys: s3fs.opts.dir.maxKeys(0),
+	}
+
+	var (
+		pending []string
+		failed  []KeyError
+	)
+
+	// the named file is removed along with the first batch, it is checked first so a name which is
+	// only a directory isn't counted, if the check fails the name is deleted anyway
+	if _, err := headObject(ctx, s3fs.s3client, s3fs.bucket, "removeall", name); !errors.Is(err, fs.ErrNotExist) {
+		pending = append(pending, name)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return removeAllCancelled(name, bo.cancelled(err), pending, failed)
+		}
+
+		listRes, err := s3fs.s3client.ListObjectsV2(ctx, input)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return removeAllCancelled(name, bo.cancelled(ctxErr), pending, failed)
+			}
+			return pathError("removeall", name, err)
+		}
+
+		pending = append(pending, keysOf(listRes.Contents)...)
+
+		done := !aws.ToBool(listRes.IsTruncated)
+
+		// keys are carried over to the next page so each batch is full
+		n := len(pending)
+		if !done {
+			n -= n % maxDeleteBatch
+		}
+
+		// in flight batches are finished even if the context is cancelled
+		batch, batchFailed := pending[:n], 0
+		if err := s3fs.deleteKeys(context.WithoutCancel(ctx), batch, bo); err != nil {
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) {
+				return pathError("removeall", name, err)
+			}
+
+			// a request which failed as a whole, such as when access is denied, fails the rest too
+			for _, keyErr := range batchErr.failed {
+				if keyErr.Err != nil {
+					return pathError("removeall", name, keyErr.Err)
+				}
+			}
+
+			failed = append(failed, batchErr.failed...)
+			batchFailed = len(batchErr.failed)
+		}
+
+		if n > 0 {
+			bo.completed(n-batchFailed, batchFailed, batch[n-1])
+		}
+
+		pending = pending[n:]
+
+		if done {
+			break
+		}
+
+		input.ContinuationToken = listRes.NextContinuationToken
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Key < failed[j].Key })
+
+	return &fs.PathError{Op: "removeall", Path: name, Err: &BatchError{op: "remove", failed: failed}}
+}
+
+// removeAllCancelled returns the error of a RemoveAll stopped by its context, listing the keys
+// which were listed but not removed along with any keys which failed.
+func removeAllCancelled(name string, cancelErr *CancelledError, pending []string, failed []KeyError) error {
+	cancelErr.Remaining = slices.Clone(pending)
+	sort.Strings(cancelErr.Remaining)
+
+	return &fs.PathError{Op: "removeall", Path: name, Err: cancelledWithFailures("remove", cancelErr, failed)}
+}
+
+// RemoveMany removes the named files using DeleteObjects batches of up to 1000 keys, rather than a
+// request for each file.
+//
+// Note:
+//   - Every name is checked before any file is removed, an invalid name fails with fs.ErrInvalid.
+//   - Like Remove, a file which doesn't exist isn't an error.
+//   - Files which can't be removed are reported with a *BatchError, which lists the failed keys
+//     along with the error code and message returned by s3, each failure also matches an
+//     *fs.PathError for the file with errors.As.
+func (s3fs *S3FS) RemoveMany(names []string) error {
+	return s3fs.RemoveManyContext(s3fs.context(), names)
+}
+
+// RemoveManyContext removes the named files, using the context for the delete requests.
+func (s3fs *S3FS) RemoveManyContext(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if !fs.ValidPath(name) || name == "." {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &fs.PathError{Op: "remove", Path: names[0], Err: err}
+	}
+
+	return s3fs.deleteKeys(ctx, names, newBulkOptions(nil))
+}
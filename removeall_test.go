@@ -0,0 +1,303 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_RemoveAll(t *testing.T) {
+	setup := func() *fakes3.Backend {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "dir/", nil)
+		for i := 0; i < 1500; i++ {
+			backend.Put("fooBucket", fmt.Sprintf("dir/sub/file%04d.txt", i), []byte("data"))
+		}
+		backend.Put("fooBucket", "dir.txt", []byte("sibling"))
+		backend.Put("fooBucket", "dirother/file.txt", []byte("sibling"))
+		return backend
+	}
+
+	t.Run("removes every key in full batches", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.RemoveAll("dir")
+		assert.NoError(err)
+
+		assert.Equal([]string{"dir.txt", "dirother/file.txt"}, backend.Keys("fooBucket"))
+		assert.Equal(2, backend.Calls("ListObjectsV2"))
+		// the 1501 keys under the prefix and the named file
+		assert.Equal(2, backend.Calls("DeleteObjects"))
+	})
+
+	t.Run("reports progress for each batch", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		s3fs := NewWithClient("fooBucket", backend)
+
+		var reports []int64
+		err := s3fs.RemoveAllContext(context.Background(), "dir", WithBulkProgress(func(done, failed int64, currentKey string) {
+			assert.Zero(failed)
+			reports = append(reports, done)
+		}))
+		assert.NoError(err)
+
+		// the 1501 keys under the prefix, dir isn't counted as it doesn't exist
+		assert.Equal([]int64{1000, 1501}, reports)
+	})
+
+	t.Run("a failed request stops the removal", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "DeleteObjects" {
+				return &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+			}
+			return nil
+		}
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.RemoveAll("dir")
+
+		var apiErr smithy.APIError
+		assert.ErrorAs(err, &apiErr)
+		assert.Equal("AccessDenied", apiErr.ErrorCode())
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("removeall", pathErr.Op)
+		assert.Equal("dir", pathErr.Path)
+
+		// the second page isn't listed once the first batch fails
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+		assert.Equal(1, backend.Calls("DeleteObjects"))
+	})
+
+	t.Run("removes a file", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.RemoveAll("dir.txt")
+		assert.NoError(err)
+		assert.Nil(backend.Get("fooBucket", "dir.txt"))
+		assert.NotNil(backend.Get("fooBucket", "dir/"))
+	})
+
+	t.Run("missing path and invalid names", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs := NewWithClient("fooBucket", setup())
+
+		assert.NoError(s3fs.RemoveAll("missing"))
+
+		assert.ErrorIs(s3fs.RemoveAll("."), fs.ErrInvalid)
+		assert.ErrorIs(s3fs.RemoveAll("/dir"), fs.ErrInvalid)
+	})
+
+	t.Run("reports the keys which failed", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.Protect("fooBucket", "dir/sub/file0001.txt")
+		backend.Protect("fooBucket", "dir/sub/file1200.txt")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.RemoveAll("dir")
+
+		var batchErr *BatchError
+		assert.True(errors.As(err, &batchErr))
+		assert.Equal([]string{"dir/sub/file0001.txt", "dir/sub/file1200.txt"}, batchErr.Keys())
+
+		// the other keys are removed
+		assert.Equal([]string{"dir.txt", "dir/sub/file0001.txt", "dir/sub/file1200.txt", "dirother/file.txt"}, backend.Keys("fooBucket"))
+	})
+
+	t.Run("list failure", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "ListObjectsV2" {
+				return errors.New("list failed")
+			}
+			return nil
+		}
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.RemoveAll("dir")
+		assert.ErrorContains(err, "list failed")
+		assert.Equal(0, backend.Calls("DeleteObjects"))
+	})
+}
+
+func TestS3FS_RemoveMany(t *testing.T) {
+	setup := func(n int) (*fakes3.Backend, []string) {
+		backend := fakes3.New("fooBucket")
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("manifest/file%04d.txt", i)
+			backend.Put("fooBucket", names[i], []byte("data"))
+		}
+		backend.Put("fooBucket", "keep.txt", []byte("keep"))
+		return backend, names
+	}
+
+	for _, tc := range []struct {
+		keys  int
+		calls int
+	}{
+		{keys: 1, calls: 1},
+		{keys: 1000, calls: 1},
+		{keys: 1001, calls: 2},
+	} {
+		t.Run(fmt.Sprintf("%d keys", tc.keys), func(t *testing.T) {
+			assert := require.New(t)
+
+			backend, names := setup(tc.keys)
+			s3fs := NewWithClient("fooBucket", backend)
+
+			err := s3fs.RemoveMany(names)
+			assert.NoError(err)
+			assert.Equal(tc.calls, backend.Calls("DeleteObjects"))
+			assert.Equal([]string{"keep.txt"}, backend.Keys("fooBucket"))
+		})
+	}
+
+	t.Run("missing files and no files", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, _ := setup(0)
+		s3fs := NewWithClient("fooBucket", backend)
+
+		assert.NoError(s3fs.RemoveMany([]string{"missing.txt", "keep.txt"}))
+		assert.Empty(backend.Keys("fooBucket"))
+
+		assert.NoError(s3fs.RemoveMany(nil))
+		assert.Equal(1, backend.Calls("DeleteObjects"))
+	})
+
+	t.Run("invalid names remove nothing", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, names := setup(3)
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.RemoveMany(append(names, "../escape.txt"))
+		assert.ErrorIs(err, fs.ErrInvalid)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("../escape.txt", pathErr.Path)
+		assert.Equal(0, backend.Calls("DeleteObjects"))
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, names := setup(3)
+		s3fs := NewWithClient("fooBucket", backend)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := s3fs.RemoveManyContext(ctx, names)
+		assert.ErrorIs(err, context.Canceled)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("remove", pathErr.Op)
+		assert.Equal(names[0], pathErr.Path)
+		assert.Equal(0, backend.Calls("DeleteObjects"))
+	})
+
+	t.Run("partial failures", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("DeleteObjects", mock.Anything, mock.MatchedBy(func(params *s3.DeleteObjectsInput) bool {
+			return len(params.Delete.Objects) == 3
+		}), mock.Anything).Return(&s3.DeleteObjectsOutput{
+			Errors: []types.Error{
+				{Key: aws.String("b.txt"), Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")},
+			},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.RemoveMany([]string{"a.txt", "b.txt", "c.txt"})
+
+		var batchErr *BatchError
+		assert.ErrorAs(err, &batchErr)
+		assert.Equal([]KeyError{{Key: "b.txt", Code: "AccessDenied", Message: "Access Denied"}}, batchErr.Failed())
+
+		// the failure is reported for the file as it would be by Remove
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("remove", pathErr.Op)
+		assert.Equal("b.txt", pathErr.Path)
+
+		var keyErr KeyError
+		assert.ErrorAs(err, &keyErr)
+		assert.Equal("AccessDenied", keyErr.Code)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestS3FS_RemoveAllCancelled(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	for i := 0; i < 2500; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("dir/file%04d.txt", i), []byte("data"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// pages of 700 keys, so the first batch is removed from the second page and keys are carried over
+	s3fs := NewWithClient("fooBucket", backend, WithListPageSize(700))
+
+	// cancelled as the first batch completes, so the removal stops before the third page
+	err := s3fs.RemoveAllContext(ctx, "dir", WithBulkProgress(func(done, failed int64, currentKey string) {
+		cancel()
+	}))
+	assert.ErrorIs(err, ErrCancelled)
+	assert.ErrorIs(err, context.Canceled)
+
+	var cancelledErr *CancelledError
+	assert.True(errors.As(err, &cancelledErr))
+	assert.Zero(cancelledErr.Failed)
+	assert.Equal(2, backend.Calls("ListObjectsV2"))
+	assert.Equal(1, backend.Calls("DeleteObjects"))
+
+	remaining := backend.Keys("fooBucket")
+
+	// every key is either counted as done or still in the bucket
+	assert.Equal(int64(1000), cancelledErr.Done)
+	assert.Equal(2500, int(cancelledErr.Done)+len(remaining))
+
+	// the keys listed but not removed come first, the unlisted keys follow them
+	assert.Len(cancelledErr.Remaining, 400)
+	assert.Equal(remaining[:400], cancelledErr.Remaining)
+	assert.Equal("dir/file1000.txt", cancelledErr.Remaining[0])
+}
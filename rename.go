@@ -0,0 +1,250 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrSourceNotRemoved is matched by the error returned when Rename copied the object to the new
+// path but couldn't remove the source, both objects exist.
+var ErrSourceNotRemoved = errors.New("copied but the source was not removed")
+
+// RenameError records the state of the keys after a RenameAll which failed part way through,
+// this is used to decide how to resume the move.
+type RenameError struct {
+	OldPrefix string
+	NewPrefix string
+	// CopiedNotDeleted are source keys which were copied to the destination, but still exist at the source.
+	CopiedNotDeleted []string
+	// Untouched are source keys which were not copied to the destination.
+	Untouched []string
+	Err       error
+}
+
+func (e *RenameError) Error() string {
+	return fmt.Sprintf("rename %s %s: %d keys copied but not deleted, %d keys untouched: %v",
+		e.OldPrefix, e.NewPrefix, len(e.CopiedNotDeleted), len(e.Untouched), e.Err)
+}
+
+func (e *RenameError) Unwrap() error {
+	return e.Err
+}
+
+// RenameAll moves every object under the oldPrefix directory to the same relative path under
+// the newPrefix directory using server side copies, then deletes the sources.
+//
+// Note:
+//   - RenameAll refuses to run if newPrefix already contains keys, unless WithOverwrite is set.
+//   - Keys are moved in batches, each copy is verified before its source is deleted.
+//   - Failures are reported with a *RenameError, if the context is cancelled the in flight batch
+//     is finished and the *RenameError wraps a *CancelledError.
+func (s3fs *S3FS) RenameAll(ctx context.Context, oldPrefix, newPrefix string, opts ...BulkOption) error {
+	if !fs.ValidPath(oldPrefix) || oldPrefix == "." {
+		return &fs.PathError{Op: "rename", Path: oldPrefix, Err: fs.ErrInvalid}
+	}
+	if !fs.ValidPath(newPrefix) || newPrefix == "." {
+		return &fs.PathError{Op: "rename", Path: newPrefix, Err: fs.ErrInvalid}
+	}
+
+	srcPrefix, dstPrefix := dirPrefix(oldPrefix), dirPrefix(newPrefix)
+
+	// moving a directory into itself, or over a parent, would list the keys it writes
+	if strings.HasPrefix(srcPrefix, dstPrefix) || strings.HasPrefix(dstPrefix, srcPrefix) {
+		return &fs.PathError{Op: "rename", Path: newPrefix, Err: fs.ErrInvalid}
+	}
+
+	bo := newBulkOptions(opts)
+
+	objects, err := s3fs.listObjects(ctx, srcPrefix)
+	if err != nil {
+		return pathError("rename", oldPrefix, err)
+	}
+
+	if len(objects) == 0 {
+		return &fs.PathError{Op: "rename", Path: oldPrefix, Err: fs.ErrNotExist}
+	}
+
+	if !bo.overwrite {
+		exists, err := s3fs.hasKeys(ctx, dstPrefix)
+		if err != nil {
+			return pathError("rename", newPrefix, err)
+		}
+		if exists {
+			return &fs.PathError{Op: "rename", Path: newPrefix, Err: fs.ErrExist}
+		}
+	}
+
+	var (
+		untouched  = keysOf(objects)
+		notDeleted []string
+		errs       []error
+	)
+
+	// each batch is copied then deleted before starting the next, a cancelled context
+	// stops the move between batches so every key is either moved or untouched
+	for _, batch := range batches(objects, maxDeleteBatch) {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, bo.cancelled(err))
+			break
+		}
+
+		untouched = untouched[len(batch):]
+
+		// in flight batches are finished even if the context is cancelled
+		batchUntouched, batchNotDeleted, err := s3fs.renameBatch(context.WithoutCancel(ctx), batch, srcPrefix, dstPrefix, bo)
+
+		untouched = append(untouched, batchUntouched...)
+		notDeleted = append(notDeleted, batchNotDeleted...)
+
+		bo.completed(len(batch)-len(batchUntouched)-len(batchNotDeleted), len(batchUntouched)+len(batchNotDeleted), aws.ToString(batch[len(batch)-1].Key))
+
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.Strings(untouched)
+
+	return &RenameError{
+		OldPrefix:        oldPrefix,
+		NewPrefix:        newPrefix,
+		CopiedNotDeleted: notDeleted,
+		Untouched:        untouched,
+		Err:              errors.Join(errs...),
+	}
+}
+
+// Rename moves the named file to newpath with a server side copy followed by a delete of oldpath,
+// the data isn't transferred through this process.
+//
+// Note:
+//   - Errors are returned as a *os.LinkError, as they are by os.Rename.
+//   - A missing oldpath fails with fs.ErrNotExist, an existing newpath is replaced.
+//   - The metadata, Content-Type and tags of the object are copied to newpath.
+//   - The rename isn't atomic, if oldpath can't be removed after the copy the error wraps
+//     ErrSourceNotRemoved and the object exists at both paths.
+//   - Directories aren't renamed, see RenameAll.
+func (s3fs *S3FS) Rename(oldpath, newpath string) error {
+	if !fs.ValidPath(oldpath) || oldpath == "." || !fs.ValidPath(newpath) || newpath == "." {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrInvalid}
+	}
+
+	ctx := s3fs.context()
+
+	headRes, err := s3fs.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(oldpath),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+		}
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: withResponseInfo(err)}
+	}
+
+	if oldpath == newpath {
+		return nil
+	}
+
+	src := types.Object{
+		Key:  aws.String(oldpath),
+		Size: headRes.ContentLength,
+		ETag: headRes.ETag,
+	}
+
+	if err := s3fs.copyObject(ctx, src, newpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: withResponseInfo(err)}
+	}
+
+	_, err = s3fs.s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(oldpath),
+	})
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fmt.Errorf("%w: %w", ErrSourceNotRemoved, withResponseInfo(err))}
+	}
+
+	return nil
+}
+
+// renameBatch copies the batch of objects to the destination prefix then deletes the sources which
+// were copied, returning the keys which were not copied and the keys which were copied but not deleted.
+func (s3fs *S3FS) renameBatch(ctx context.Context, batch []types.Object, srcPrefix, dstPrefix string, bo *bulkOptions) ([]string, []string, error) {
+	copyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		copied   = make([]bool, len(batch))
+		copyErrs []error
+	)
+
+	runConcurrently(bo.concurrency, len(batch), func(i int) {
+		if copyCtx.Err() != nil {
+			return
+		}
+
+		src := batch[i]
+		dstKey := dstPrefix + strings.TrimPrefix(aws.ToString(src.Key), srcPrefix)
+
+		err := s3fs.copyObject(copyCtx, src, dstKey)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			// stop scheduling further copies, the keys which were copied are still moved
+			copyErrs = append(copyErrs, fmt.Errorf("copy %s: %w", aws.ToString(src.Key), err))
+			cancel()
+			return
+		}
+
+		copied[i] = true
+	})
+
+	var srcKeys, untouched []string
+
+	for i, obj := range batch {
+		if copied[i] {
+			srcKeys = append(srcKeys, aws.ToString(obj.Key))
+			continue
+		}
+		untouched = append(untouched, aws.ToString(obj.Key))
+	}
+
+	var notDeleted []string
+
+	if err := s3fs.deleteKeys(ctx, srcKeys, bo); err != nil {
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			notDeleted = batchErr.Keys()
+		}
+		copyErrs = append(copyErrs, err)
+	}
+
+	return untouched, notDeleted, errors.Join(copyErrs...)
+}
+
+// keysOf returns the keys of the objects.
+func keysOf(objects []types.Object) []string {
+	keys := make([]string, len(objects))
+	for i, obj := range objects {
+		keys[i] = aws.ToString(obj.Key)
+	}
+	return keys
+}
@@ -0,0 +1,250 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_RenameAll(t *testing.T) {
+	setup := func() *fakes3.Backend {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "src/a.txt", []byte("a"))
+		backend.Put("fooBucket", "src/b/c.txt", []byte("c"))
+		backend.Put("fooBucket", "src/b/d.txt", []byte("d"))
+		backend.Put("fooBucket", "srcother.txt", []byte("other"))
+		return backend
+	}
+
+	t.Run("moves every key preserving relative paths", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		sysfs := NewWithClient("fooBucket", backend)
+
+		err := sysfs.RenameAll(context.Background(), "src", "dst/moved")
+		assert.NoError(err)
+
+		assert.Equal([]string{"dst/moved/a.txt", "dst/moved/b/c.txt", "dst/moved/b/d.txt", "srcother.txt"}, backend.Keys("fooBucket"))
+		assert.Equal([]byte("c"), backend.Get("fooBucket", "dst/moved/b/c.txt").Data)
+		assert.Equal(0, backend.Calls("HeadObject"), "ETag verified copies should not need a HeadObject")
+	})
+
+	t.Run("refuses to merge into a destination with keys", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.Put("fooBucket", "dst/existing.txt", []byte("e"))
+		sysfs := NewWithClient("fooBucket", backend)
+
+		err := sysfs.RenameAll(context.Background(), "src", "dst")
+		assert.ErrorIs(err, fs.ErrExist)
+		assert.Equal(0, backend.Calls("CopyObject"))
+
+		err = sysfs.RenameAll(context.Background(), "src", "dst", WithOverwrite())
+		assert.NoError(err)
+		assert.Equal([]string{"dst/a.txt", "dst/b/c.txt", "dst/b/d.txt", "dst/existing.txt", "srcother.txt"}, backend.Keys("fooBucket"))
+	})
+
+	t.Run("missing source and invalid prefixes", func(t *testing.T) {
+		assert := require.New(t)
+
+		sysfs := NewWithClient("fooBucket", setup())
+
+		assert.ErrorIs(sysfs.RenameAll(context.Background(), "missing", "dst"), fs.ErrNotExist)
+		assert.ErrorIs(sysfs.RenameAll(context.Background(), ".", "dst"), fs.ErrInvalid)
+		assert.ErrorIs(sysfs.RenameAll(context.Background(), "src", "src/nested"), fs.ErrInvalid)
+	})
+
+	t.Run("copy failure reports untouched keys", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if op == "CopyObject" && aws.ToString(input.(*s3.CopyObjectInput).Key) == "dst/b/c.txt" {
+				return errors.New("copy failed")
+			}
+			return nil
+		}
+		sysfs := NewWithClient("fooBucket", backend)
+
+		err := sysfs.RenameAll(context.Background(), "src", "dst", WithBulkConcurrency(1))
+
+		var renameErr *RenameError
+		assert.ErrorAs(err, &renameErr)
+		assert.Empty(renameErr.CopiedNotDeleted)
+		assert.Equal([]string{"src/b/c.txt", "src/b/d.txt"}, renameErr.Untouched)
+		assert.Equal([]string{"dst/a.txt", "src/b/c.txt", "src/b/d.txt", "srcother.txt"}, backend.Keys("fooBucket"))
+	})
+
+	t.Run("delete failure reports copied but not deleted keys", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := setup()
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "DeleteObjects" {
+				return errors.New("delete failed")
+			}
+			return nil
+		}
+		sysfs := NewWithClient("fooBucket", backend)
+
+		err := sysfs.RenameAll(context.Background(), "src", "dst")
+
+		var renameErr *RenameError
+		assert.ErrorAs(err, &renameErr)
+		assert.ElementsMatch([]string{"src/a.txt", "src/b/c.txt", "src/b/d.txt"}, renameErr.CopiedNotDeleted)
+		assert.Empty(renameErr.Untouched)
+	})
+}
+
+func TestS3FS_multipartCopy(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "big.bin", []byte("0123456789"))
+
+	sysfs := NewWithClient("fooBucket", backend)
+
+	etag, err := sysfs.multipartCopy(context.Background(), "big.bin", "copy.bin", "", 10, 4, nil)
+	assert.NoError(err)
+	assert.Equal(3, backend.Calls("UploadPartCopy"))
+	assert.Equal([]byte("0123456789"), backend.Get("fooBucket", "copy.bin").Data)
+	assert.Equal(etag, backend.Get("fooBucket", "copy.bin").ETag)
+	assert.Equal(0, backend.Uploads())
+}
+
+func TestS3FS_RenameAllCancelled(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	for i := 0; i < 2500; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("src/%04d.txt", i), []byte("data"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reports []int64
+
+	sysfs := NewWithClient("fooBucket", backend)
+
+	err := sysfs.RenameAll(ctx, "src", "dst", WithBulkProgress(func(done, failed int64, currentKey string) {
+		reports = append(reports, done)
+		assert.Equal(int64(0), failed)
+		assert.Equal("src/0999.txt", currentKey)
+		cancel()
+	}))
+	assert.ErrorIs(err, ErrCancelled)
+	assert.ErrorIs(err, context.Canceled)
+	assert.Equal([]int64{1000}, reports)
+
+	var cancelledErr *CancelledError
+	assert.ErrorAs(err, &cancelledErr)
+	assert.Equal(int64(1000), cancelledErr.Done)
+
+	var renameErr *RenameError
+	assert.ErrorAs(err, &renameErr)
+	assert.Empty(renameErr.CopiedNotDeleted)
+
+	var remaining []string
+	for _, key := range backend.Keys("fooBucket") {
+		if strings.HasPrefix(key, "src/") {
+			remaining = append(remaining, key)
+		}
+	}
+	assert.Len(remaining, 1500)
+	assert.Equal(remaining, renameErr.Untouched)
+}
+
+func TestS3FS_Rename(t *testing.T) {
+	setup := func() (*fakes3.Backend, *S3FS) {
+		backend := fakes3.New("fooBucket")
+		s3fs := NewWithClient("fooBucket", backend)
+
+		_, err := s3fs.WriteFileResult("report.csv", []byte("a,b\n1,2\n"), 0o644,
+			WithMetadata(map[string]string{"producer": "report"}),
+			WithTags(map[string]string{"retention": "90d"}),
+		)
+		require.NoError(t, err)
+
+		return backend, s3fs
+	}
+
+	t.Run("copies the object then removes the source", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+		src := backend.Get("fooBucket", "report.csv")
+
+		err := s3fs.Rename("report.csv", "archive/report.csv")
+		assert.NoError(err)
+
+		assert.Equal([]string{"archive/report.csv"}, backend.Keys("fooBucket"))
+
+		dst := backend.Get("fooBucket", "archive/report.csv")
+		assert.Equal(src.Data, dst.Data)
+		assert.Equal(src.ContentType, dst.ContentType)
+		assert.Equal(map[string]string{"producer": "report"}, dst.Metadata)
+		assert.Equal(map[string]string{"retention": "90d"}, dst.Tags)
+		assert.Equal(0, backend.Calls("GetObject"))
+	})
+
+	t.Run("replaces an existing destination", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+		backend.Put("fooBucket", "old.csv", []byte("old"))
+
+		err := s3fs.Rename("report.csv", "old.csv")
+		assert.NoError(err)
+		assert.Equal("a,b\n1,2\n", string(backend.Get("fooBucket", "old.csv").Data))
+	})
+
+	t.Run("missing source and invalid paths", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+
+		err := s3fs.Rename("missing.csv", "dst.csv")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		var linkErr *os.LinkError
+		assert.ErrorAs(err, &linkErr)
+		assert.Equal("rename", linkErr.Op)
+		assert.Equal("missing.csv", linkErr.Old)
+		assert.Equal("dst.csv", linkErr.New)
+
+		assert.ErrorIs(s3fs.Rename("report.csv", "."), fs.ErrInvalid)
+		assert.ErrorIs(s3fs.Rename("/report.csv", "dst.csv"), fs.ErrInvalid)
+		assert.Equal(0, backend.Calls("CopyObject"))
+
+		// renaming a file to itself leaves it in place
+		assert.NoError(s3fs.Rename("report.csv", "report.csv"))
+		assert.NotNil(backend.Get("fooBucket", "report.csv"))
+	})
+
+	t.Run("source which can't be removed", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := setup()
+		backend.Protect("fooBucket", "report.csv")
+
+		err := s3fs.Rename("report.csv", "archive/report.csv")
+		assert.ErrorIs(err, ErrSourceNotRemoved)
+
+		var linkErr *os.LinkError
+		assert.ErrorAs(err, &linkErr)
+
+		assert.Equal([]string{"archive/report.csv", "report.csv"}, backend.Keys("fooBucket"))
+	})
+}
@@ -0,0 +1,114 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// defaultReadRetries is the number of times a body is opened again after a network error.
+const defaultReadRetries = 3
+
+// WithReadRetries sets the number of times Read and WriteTo open the body of a file again from the
+// offset after the connection fails part way through, such as with a connection reset or an
+// unexpected EOF, so long reads of large objects continue rather than return the error. This
+// defaults to 3, zero disables it.
+//
+// Note:
+//   - The retries are counted from the last read which returned data, so a long read may be resumed
+//     many times as long as each attempt makes progress.
+//   - The body is opened again pinned to the object which was opened, see ErrObjectChanged.
+//   - Errors returned by s3, and the cancellation of the context, aren't retried.
+func WithReadRetries(n int) Option {
+	return func(fo *fsOptions) {
+		if n >= 0 {
+			fo.readRetries = n
+		}
+	}
+}
+
+// readBody reads from the open body and moves the offset, after a network error the body is opened
+// again from the offset, up to the read retries of the file. The mutex must be held.
+func (s3f *s3File) readBody(p []byte) (int, error) {
+	for retries := 0; ; retries++ {
+		n, err := s3f.body.Read(p)
+		s3f.offset += int64(n)
+
+		if retries >= s3f.readRetries || !s3f.resumable(err) {
+			return n, err
+		}
+
+		if err := s3f.resume(); err != nil {
+			return n, err
+		}
+
+		// the next read continues from the new body
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resumable reports whether the error returned by the body is a network error which is worth
+// opening the body again for.
+func (s3f *s3File) resumable(err error) bool {
+	if err == nil || errors.Is(err, io.EOF) || s3f.context().Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// resume replaces the body with one opened from the offset, pinned to the file. At the
+// end of the object the body is left closed and io.EOF is returned. The mutex must be held.
+func (s3f *s3File) resume() error {
+	s3f.body.Close()
+	s3f.body = nil
+
+	res, err := s3f.s3client.GetObject(s3f.context(), s3f.rangeRequest(s3f.offset, -1))
+	if err != nil {
+		if isInvalidRange(err) {
+			return io.EOF
+		}
+		if isPreconditionFailed(err) {
+			return &fs.PathError{Op: opRead, Path: s3f.name, Err: ErrObjectChanged}
+		}
+		return pathError(opRead, s3f.name, err)
+	}
+
+	// not every store supports conditional reads, so the ETag of the response is checked as well
+	if etag, got := s3f.pinnedETag(), aws.ToString(res.ETag); etag != "" && got != "" && got != etag {
+		res.Body.Close()
+		return &fs.PathError{Op: opRead, Path: s3f.name, Err: ErrObjectChanged}
+	}
+
+	s3f.body = res.Body
+
+	return nil
+}
+
+// bodyReader reads the body of the file with readBody, so a copy of the body is resumed after a
+// network error. The mutex must be held while it is used.
+type bodyReader struct {
+	s3f *s3File
+}
+
+func (br bodyReader) Read(p []byte) (int, error) {
+	if br.s3f.body == nil {
+		return 0, io.EOF
+	}
+	return br.s3f.readBody(p)
+}
@@ -0,0 +1,216 @@
+package s3iofs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// failingBody returns the data then fails with err, as a connection which drops part way through.
+type failingBody struct {
+	r   io.Reader
+	err error
+}
+
+func (fb *failingBody) Read(p []byte) (int, error) {
+	n, err := fb.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, fb.err
+	}
+	return n, err
+}
+
+func (fb *failingBody) Close() error {
+	return nil
+}
+
+func TestS3File_ReadRetries(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	rangeIs := func(r string) any {
+		return mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return aws.ToString(params.Range) == r
+		})
+	}
+
+	// newClient returns a client which opens the object with a body which fails at 3000 bytes
+	newClient := func() *mockS3Client {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, rangeIs(""), mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          &failingBody{r: bytes.NewReader(data[:3000]), err: syscall.ECONNRESET},
+			ContentLength: aws.Int64(int64(len(data))),
+			ETag:          aws.String(`"v1"`),
+		}, nil).Once()
+		return mockClient
+	}
+
+	ranges := func(mockClient *mockS3Client) []string {
+		var got []string
+		for _, call := range mockClient.Calls {
+			got = append(got, aws.ToString(call.Arguments.Get(1).(*s3.GetObjectInput).Range))
+		}
+		return got
+	}
+
+	t.Run("read resumes from the offset", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		mockClient.On("GetObject", mock.Anything, rangeIs("bytes=3000-"), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: &failingBody{r: bytes.NewReader(data[3000:5000]), err: io.ErrUnexpectedEOF},
+			ETag: aws.String(`"v1"`),
+		}, nil).Once()
+		mockClient.On("GetObject", mock.Anything, rangeIs("bytes=5000-"), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(data[5000:])),
+			ETag: aws.String(`"v1"`),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(data, got)
+
+		assert.Equal([]string{"", "bytes=3000-", "bytes=5000-"}, ranges(mockClient))
+		for _, call := range mockClient.Calls[1:] {
+			assert.Equal(`"v1"`, aws.ToString(call.Arguments.Get(1).(*s3.GetObjectInput).IfMatch))
+		}
+	})
+
+	t.Run("write to resumes from the offset", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		mockClient.On("GetObject", mock.Anything, rangeIs("bytes=3000-"), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(data[3000:])),
+			ETag: aws.String(`"v1"`),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.OpenObject("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		var buf bytes.Buffer
+		n, err := f.WriteTo(&buf)
+		assert.NoError(err)
+		assert.Equal(int64(len(data)), n)
+		assert.Equal(data, buf.Bytes())
+
+		assert.Equal([]string{"", "bytes=3000-"}, ranges(mockClient))
+	})
+
+	t.Run("a changed object is not spliced", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		mockClient.On("GetObject", mock.Anything, rangeIs("bytes=3000-"), mock.Anything).Return((*s3.GetObjectOutput)(nil), &smithy.GenericAPIError{
+			Code:    "PreconditionFailed",
+			Message: "At least one of the pre-conditions you specified did not hold",
+		}).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := io.ReadAll(f)
+		assert.ErrorIs(err, ErrObjectChanged)
+		assert.Equal(data[:3000], got)
+	})
+
+	t.Run("a changed etag is not spliced", func(t *testing.T) {
+		assert := require.New(t)
+
+		// a store which ignores IfMatch returns the new version
+		mockClient := newClient()
+		mockClient.On("GetObject", mock.Anything, rangeIs("bytes=3000-"), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(data[3000:])),
+			ETag: aws.String(`"v2"`),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		_, err = io.ReadAll(f)
+		assert.ErrorIs(err, ErrObjectChanged)
+	})
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		mockClient.On("GetObject", mock.Anything, rangeIs("bytes=3000-"), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: &failingBody{r: bytes.NewReader(nil), err: syscall.ECONNRESET},
+			ETag: aws.String(`"v1"`),
+		}, nil).Twice()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithReadRetries(2))
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		got, err := io.ReadAll(f)
+		assert.ErrorIs(err, syscall.ECONNRESET)
+		assert.Equal(data[:3000], got)
+
+		assert.Equal([]string{"", "bytes=3000-", "bytes=3000-"}, ranges(mockClient))
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, rangeIs(""), mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          &failingBody{r: bytes.NewReader(data[:3000]), err: errors.New("checksum mismatch")},
+			ContentLength: aws.Int64(int64(len(data))),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		_, err = io.ReadAll(f)
+		assert.ErrorContains(err, "checksum mismatch")
+		assert.Len(mockClient.Calls, 1)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithReadRetries(0))
+
+		f, err := s3fs.Open("large.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		_, err = io.ReadAll(f)
+		assert.ErrorIs(err, syscall.ECONNRESET)
+		assert.Len(mockClient.Calls, 1)
+	})
+}
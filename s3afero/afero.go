@@ -0,0 +1,293 @@
+// Package s3afero provides an afero.Fs backed by s3iofs, this lives in a separate module so the
+// afero dependency is only pulled in by programs which use it.
+package s3afero
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/wolfeidau/s3iofs"
+)
+
+var _ afero.Fs = (*Fs)(nil)
+
+// Fs implements afero.Fs using a S3FS.
+//
+// Note:
+//   - Files are either opened for reading, or for writing in which case the object is replaced
+//     when the file is closed, O_RDWR and O_APPEND are not supported.
+//   - Directories are represented by zero byte marker objects with a trailing slash.
+//   - Chmod, Chown and Chtimes are not supported as s3 has no equivalent, they return syscall.EPERM.
+type Fs struct {
+	fsys *s3iofs.S3FS
+}
+
+// NewAferoFs returns an afero.Fs which reads and writes objects using the provided S3FS.
+func NewAferoFs(fsys *s3iofs.S3FS) afero.Fs {
+	return &Fs{fsys: fsys}
+}
+
+// Name returns the name of this filesystem.
+func (a *Fs) Name() string {
+	return "S3FS"
+}
+
+// Create creates or truncates the named file, the object is uploaded when the file is closed.
+func (a *Fs) Create(name string) (afero.File, error) {
+	return a.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+// Open opens the named file or directory for reading.
+func (a *Fs) Open(name string) (afero.File, error) {
+	return a.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file, flags requesting write access return a file which replaces
+// the object when it is closed.
+func (a *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	key := cleanName(name)
+
+	if flag&(os.O_RDWR|os.O_APPEND) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+	}
+
+	if flag&os.O_WRONLY == 0 {
+		f, err := a.fsys.Open(key)
+		if err != nil {
+			return nil, err
+		}
+		return &readFile{fsys: a.fsys, name: name, key: key, file: f.(s3iofs.File)}, nil
+	}
+
+	if key == "." {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+
+	info, err := a.fsys.Stat(key)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	return newWriteFile(a.fsys, name, key), nil
+}
+
+// Mkdir creates the named directory by writing a directory marker object.
+func (a *Fs) Mkdir(name string, perm os.FileMode) error {
+	key := cleanName(name)
+
+	if _, err := a.fsys.Stat(key); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	if parent := path.Dir(key); parent != "." {
+		info, err := a.fsys.Stat(parent)
+		if err != nil {
+			return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+		}
+		if !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+
+	return a.mkdir(name, key)
+}
+
+// MkdirAll creates the named directory by writing a directory marker object, parent directories
+// are implied by the marker so are not created.
+func (a *Fs) MkdirAll(name string, perm os.FileMode) error {
+	key := cleanName(name)
+	if key == "." {
+		return nil
+	}
+
+	info, err := a.fsys.Stat(key)
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+
+	// a file can't be the parent of a directory
+	for parent := path.Dir(key); parent != "."; parent = path.Dir(parent) {
+		info, err := a.fsys.Stat(parent)
+		if err == nil && !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+
+	return a.mkdir(name, key)
+}
+
+func (a *Fs) mkdir(name, key string) error {
+	if key == "." {
+		return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	if err := a.fsys.WriteFile(key+"/", nil, 0o755); err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: unwrapPathError(err)}
+	}
+
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (a *Fs) Remove(name string) error {
+	key := cleanName(name)
+	if key == "." {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := a.fsys.Stat(key)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if !info.IsDir() {
+		return a.fsys.Remove(key)
+	}
+
+	entries, err := fs.ReadDir(a.fsys, key)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+
+	return a.fsys.Remove(key + "/")
+}
+
+// RemoveAll removes the named file or directory and everything it contains, it returns nil
+// if the path doesn't exist.
+func (a *Fs) RemoveAll(name string) error {
+	key := cleanName(name)
+	if key == "." {
+		return &os.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := a.fsys.Stat(key)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if !info.IsDir() {
+		return a.fsys.Remove(key)
+	}
+
+	var dirs []string
+
+	err = fs.WalkDir(a.fsys, key, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			dirs = append(dirs, name)
+			return nil
+		}
+
+		return a.fsys.Remove(name)
+	})
+	if err != nil {
+		return err
+	}
+
+	// remove the directory markers, deleting a marker which doesn't exist is a no-op in s3
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := a.fsys.Remove(dirs[i] + "/"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rename moves the named file or directory with server side copies, directories are moved using
+// RenameAll and files using Rename, which keeps the content type, metadata and tags of the object.
+func (a *Fs) Rename(oldname, newname string) error {
+	oldKey, newKey := cleanName(oldname), cleanName(newname)
+
+	info, err := a.fsys.Stat(oldKey)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+
+	if info.IsDir() {
+		if err := a.fsys.RenameAll(context.Background(), oldKey, newKey); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+
+		// RenameAll moves the marker along with the contents, an empty directory only has a marker
+		return nil
+	}
+
+	if err := a.fsys.Rename(oldKey, newKey); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: unwrapLinkError(err)}
+	}
+
+	return nil
+}
+
+// Stat returns a FileInfo describing the named file or directory.
+func (a *Fs) Stat(name string) (os.FileInfo, error) {
+	return a.fsys.Stat(cleanName(name))
+}
+
+// Chmod is not supported.
+func (a *Fs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+}
+
+// Chown is not supported.
+func (a *Fs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+}
+
+// Chtimes is not supported.
+func (a *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: syscall.EPERM}
+}
+
+// cleanName converts an afero path, which may be absolute or use the os separator, to a fs.FS name.
+func cleanName(name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+func unwrapLinkError(err error) error {
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Err
+	}
+	return err
+}
+
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package s3afero
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs"
+)
+
+func newFs(t *testing.T) (*fakeS3, afero.Fs) {
+	t.Helper()
+
+	backend := newFakeS3()
+	return backend, NewAferoFs(s3iofs.NewWithClient("fooBucket", backend))
+}
+
+func TestFs_CreateAndRead(t *testing.T) {
+	assert := require.New(t)
+
+	backend, afs := newFs(t)
+
+	f, err := afs.Create("/dir/file.txt")
+	assert.NoError(err)
+
+	_, err = f.WriteString("hello ")
+	assert.NoError(err)
+	_, err = f.Write([]byte("world"))
+	assert.NoError(err)
+
+	info, err := f.Stat()
+	assert.NoError(err)
+	assert.Equal(int64(11), info.Size())
+
+	// the object is uploaded on close
+	assert.Nil(backend.Get("dir/file.txt"))
+
+	err = f.Close()
+	assert.NoError(err)
+	assert.ErrorIs(f.Close(), fs.ErrClosed)
+
+	data, err := afero.ReadFile(afs, "dir/file.txt")
+	assert.NoError(err)
+	assert.Equal("hello world", string(data))
+
+	rf, err := afs.Open("/dir/file.txt")
+	assert.NoError(err)
+	defer rf.Close()
+
+	_, err = rf.Seek(6, io.SeekStart)
+	assert.NoError(err)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(rf, buf)
+	assert.NoError(err)
+	assert.Equal("world", string(buf))
+
+	_, err = rf.Write([]byte("data"))
+	assert.ErrorIs(err, syscall.EBADF)
+}
+
+func TestFs_OpenFile(t *testing.T) {
+	assert := require.New(t)
+
+	backend, afs := newFs(t)
+	backend.Put("file.txt", []byte("data"))
+
+	_, err := afs.OpenFile("file.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	assert.ErrorIs(err, fs.ErrExist)
+
+	_, err = afs.OpenFile("missing.txt", os.O_WRONLY, 0o644)
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	_, err = afs.OpenFile("file.txt", os.O_RDWR, 0o644)
+	assert.ErrorIs(err, fs.ErrPermission)
+
+	_, err = afs.OpenFile("file.txt", os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.ErrorIs(err, fs.ErrPermission)
+
+	err = afero.WriteFile(afs, "file.txt", []byte("replaced"), 0o644)
+	assert.NoError(err)
+	assert.Equal("replaced", string(backend.Get("file.txt").Data))
+}
+
+func TestFs_Mkdir(t *testing.T) {
+	assert := require.New(t)
+
+	backend, afs := newFs(t)
+
+	err := afs.Mkdir("missing/dir", 0o755)
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	err = afs.MkdirAll("a/b/c", 0o755)
+	assert.NoError(err)
+	assert.NotNil(backend.Get("a/b/c/"))
+
+	err = afs.Mkdir("a/b/c", 0o755)
+	assert.ErrorIs(err, fs.ErrExist)
+
+	err = afs.MkdirAll("a/b/c", 0o755)
+	assert.NoError(err)
+
+	info, err := afs.Stat("/a/b/c")
+	assert.NoError(err)
+	assert.True(info.IsDir())
+
+	// an empty directory lists no children
+	names, err := readDirNames(afs, "a/b/c")
+	assert.NoError(err)
+	assert.Empty(names)
+
+	backend.Put("file.txt", []byte("data"))
+
+	err = afs.MkdirAll("file.txt/dir", 0o755)
+	assert.ErrorIs(err, syscall.ENOTDIR)
+}
+
+func TestFs_Remove(t *testing.T) {
+	assert := require.New(t)
+
+	backend, afs := newFs(t)
+	backend.Put("dir/file.txt", []byte("data"))
+	backend.Put("dir/nested/other.txt", []byte("data"))
+	backend.Put("empty/", nil)
+
+	err := afs.Remove("missing.txt")
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	err = afs.Remove("dir")
+	assert.ErrorIs(err, syscall.ENOTEMPTY)
+
+	err = afs.Remove("empty")
+	assert.NoError(err)
+	assert.Nil(backend.Get("empty/"))
+
+	err = afs.RemoveAll("dir")
+	assert.NoError(err)
+	assert.Empty(backend.Keys())
+
+	err = afs.RemoveAll("dir")
+	assert.NoError(err)
+}
+
+func TestFs_Rename(t *testing.T) {
+	assert := require.New(t)
+
+	backend, afs := newFs(t)
+	backend.Put("file.txt", []byte("data"))
+	backend.Put("dir/file.txt", []byte("nested"))
+
+	backend.Get("file.txt").ContentType = "application/x-custom"
+	backend.Get("file.txt").Metadata = map[string]string{"owner": "team"}
+
+	err := afs.Rename("file.txt", "renamed.txt")
+	assert.NoError(err)
+	assert.Nil(backend.Get("file.txt"))
+
+	// the object is copied on the server so the headers and metadata are kept
+	renamed := backend.Get("renamed.txt")
+	assert.Equal("data", string(renamed.Data))
+	assert.Equal("application/x-custom", renamed.ContentType)
+	assert.Equal(map[string]string{"owner": "team"}, renamed.Metadata)
+
+	err = afs.Rename("dir", "moved")
+	assert.NoError(err)
+	assert.Equal([]string{"moved/file.txt", "renamed.txt"}, backend.Keys())
+
+	err = afs.Rename("missing.txt", "other.txt")
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
+
+func TestFs_Unsupported(t *testing.T) {
+	assert := require.New(t)
+
+	_, afs := newFs(t)
+
+	assert.ErrorIs(afs.Chmod("file.txt", 0o600), syscall.EPERM)
+	assert.ErrorIs(afs.Chown("file.txt", 1, 1), syscall.EPERM)
+	assert.ErrorIs(afs.Chtimes("file.txt", time.Time{}, time.Time{}), syscall.EPERM)
+}
+
+func TestFs_Walk(t *testing.T) {
+	assert := require.New(t)
+
+	backend, afs := newFs(t)
+	backend.Put("a.txt", []byte("a"))
+	backend.Put("dir/b.txt", []byte("b"))
+	backend.Put("dir/nested/c.txt", []byte("c"))
+
+	var files []string
+	err := afero.Walk(afs, "/", func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"/a.txt", "/dir/b.txt", "/dir/nested/c.txt"}, files)
+}
+
+func readDirNames(afs afero.Fs, name string) ([]string, error) {
+	f, err := afs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Readdirnames(-1)
+}
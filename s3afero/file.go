@@ -0,0 +1,242 @@
+package s3afero
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/wolfeidau/s3iofs"
+)
+
+var (
+	_ afero.File = (*readFile)(nil)
+	_ afero.File = (*writeFile)(nil)
+)
+
+// readFile is a file or directory opened for reading.
+type readFile struct {
+	fsys *s3iofs.S3FS
+	name string
+	key  string
+	file s3iofs.File
+	done bool
+}
+
+func (f *readFile) Name() string {
+	return f.name
+}
+
+func (f *readFile) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+func (f *readFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *readFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+// Readdir follows the os.File.Readdir contract, a count less than or equal to zero returns
+// every entry in the directory.
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	var (
+		entries []fs.DirEntry
+		err     error
+	)
+
+	if count > 0 {
+		entries, err = f.file.ReadDir(count)
+	} else if !f.done {
+		f.done = true
+		entries, err = fs.ReadDir(f.fsys, f.key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (f *readFile) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+
+	return names, nil
+}
+
+func (f *readFile) Sync() error {
+	return nil
+}
+
+func (f *readFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *readFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *readFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *readFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EBADF}
+}
+
+// writeFile streams writes to WriteFrom, which spools them then uploads the object on Close.
+type writeFile struct {
+	name    string
+	pw      *io.PipeWriter
+	result  chan error
+	size    int64
+	modTime time.Time
+	closed  bool
+}
+
+func newWriteFile(fsys *s3iofs.S3FS, name, key string) *writeFile {
+	pr, pw := io.Pipe()
+
+	f := &writeFile{
+		name:    name,
+		pw:      pw,
+		result:  make(chan error, 1),
+		modTime: time.Now(),
+	}
+
+	go func() {
+		_, err := fsys.WriteFrom(key, pr)
+		// unblock any writes if the upload failed before reading everything
+		pr.CloseWithError(err)
+		f.result <- err
+	}()
+
+	return f
+}
+
+func (f *writeFile) Name() string {
+	return f.name
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	n, err := f.pw.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+
+	return n, nil
+}
+
+func (f *writeFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *writeFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.ESPIPE}
+}
+
+// Seek only supports reporting the current offset as the object is written sequentially.
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.size, nil
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.ESPIPE}
+}
+
+// Truncate only supports truncating to the current size as written data can't be discarded.
+func (f *writeFile) Truncate(size int64) error {
+	if size == f.size {
+		return nil
+	}
+	return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EPERM}
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *writeFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *writeFile) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+// Stat describes the data written so far, the object isn't visible in s3 until the file is closed.
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	return &writeInfo{name: path.Base(f.name), size: f.size, modTime: f.modTime}, nil
+}
+
+// Sync is a no-op as the object is uploaded on Close.
+func (f *writeFile) Sync() error {
+	return nil
+}
+
+// Close completes the upload, returning any error from s3.
+func (f *writeFile) Close() error {
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+
+	_ = f.pw.Close()
+
+	if err := <-f.result; err != nil {
+		return &os.PathError{Op: "close", Path: f.name, Err: unwrapPathError(err)}
+	}
+
+	return nil
+}
+
+type writeInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *writeInfo) Name() string       { return i.name }
+func (i *writeInfo) Size() int64        { return i.size }
+func (i *writeInfo) Mode() fs.FileMode  { return 0o644 }
+func (i *writeInfo) ModTime() time.Time { return i.modTime }
+func (i *writeInfo) IsDir() bool        { return false }
+func (i *writeInfo) Sys() any           { return nil }
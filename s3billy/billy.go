@@ -0,0 +1,468 @@
+// Package s3billy provides a billy.Filesystem backed by s3iofs, this lives in a separate module so
+// the go-billy dependency is only pulled in by programs which use it.
+package s3billy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/chroot"
+	"github.com/wolfeidau/s3iofs"
+)
+
+var (
+	_ billy.Filesystem = (*Fs)(nil)
+	_ billy.Capable    = (*Fs)(nil)
+)
+
+const (
+	defaultScratchPrefix = ".tmp"
+
+	// symlinkMetadata is the user metadata key holding the target of a symlink.
+	symlinkMetadata = "s3billy-symlink"
+
+	// maxSymlinks is the number of symlinks followed to resolve a path before failing with ELOOP.
+	maxSymlinks = 40
+)
+
+// Option configures the billy filesystem.
+type Option func(*Fs)
+
+// WithScratchPrefix sets the directory used by TempFile when no directory is given, this defaults to ".tmp".
+func WithScratchPrefix(prefix string) Option {
+	return func(b *Fs) {
+		b.scratchPrefix = cleanName(prefix)
+	}
+}
+
+// WithMetadataSymlinks enables Symlink and Readlink, a symlink is stored as an empty object with
+// the target held in its user metadata.
+//
+// Note:
+//   - Stat, Open, OpenFile and ReadDir follow a symlink in the last element of the path, which
+//     costs a HeadObject for each, symlinks in the parent directories aren't followed.
+//   - Lstat, Remove and Rename act on the symlink itself.
+//   - The entries returned by ReadDir aren't checked, so symlinks are listed as empty files.
+//   - Targets are limited to printable US-ASCII, as they are stored as s3 metadata.
+func WithMetadataSymlinks() Option {
+	return func(b *Fs) {
+		b.symlinks = true
+	}
+}
+
+// Fs implements billy.Filesystem using a S3FS.
+//
+// Note:
+//   - Files are either opened for reading, or for writing in which case the object is replaced
+//     when the file is closed, O_RDWR and O_APPEND are not supported.
+//   - Directories are represented by zero byte marker objects with a trailing slash.
+//   - File locks and truncation are not supported, they return billy.ErrNotSupported, as do
+//     symlinks unless WithMetadataSymlinks is set.
+type Fs struct {
+	fsys          *s3iofs.S3FS
+	scratchPrefix string
+	symlinks      bool
+}
+
+// NewBillyFs returns a billy.Filesystem which reads and writes objects using the provided S3FS.
+func NewBillyFs(fsys *s3iofs.S3FS, opts ...Option) billy.Filesystem {
+	b := &Fs{fsys: fsys, scratchPrefix: defaultScratchPrefix}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Capabilities reports the file operations which are supported.
+func (b *Fs) Capabilities() billy.Capability {
+	return billy.ReadCapability | billy.WriteCapability | billy.SeekCapability
+}
+
+// Create creates or truncates the named file, the object is uploaded when the file is closed.
+func (b *Fs) Create(filename string) (billy.File, error) {
+	return b.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+}
+
+// Open opens the named file for reading.
+func (b *Fs) Open(filename string) (billy.File, error) {
+	return b.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file, flags requesting write access return a file which replaces
+// the object when it is closed.
+func (b *Fs) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if flag&(os.O_RDWR|os.O_APPEND) != 0 {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: billy.ErrNotSupported}
+	}
+
+	key := cleanName(filename)
+
+	if flag&os.O_WRONLY == 0 {
+		if b.symlinks {
+			var err error
+			if key, _, err = b.follow("open", filename); err != nil {
+				return nil, err
+			}
+		}
+
+		f, err := b.fsys.OpenObject(key)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &os.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &readFile{name: cleanName(filename), file: f}, nil
+	}
+
+	if key == "." {
+		return nil, &os.PathError{Op: "open", Path: filename, Err: syscall.EISDIR}
+	}
+
+	key, info, err := b.follow("open", filename)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, &os.PathError{Op: "open", Path: filename, Err: syscall.EISDIR}
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: filename, Err: fs.ErrExist}
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	return newWriteFile(b.fsys, cleanName(filename), key), nil
+}
+
+// Stat returns a FileInfo describing the named file or directory, following a symlink.
+func (b *Fs) Stat(filename string) (os.FileInfo, error) {
+	key, info, err := b.follow("stat", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// the info of the target is reported with the name of the link
+	if key != cleanName(filename) {
+		return &linkedInfo{FileInfo: info, name: path.Base(cleanName(filename))}, nil
+	}
+
+	return info, nil
+}
+
+// Lstat returns a FileInfo describing the named file or directory, a symlink isn't followed.
+func (b *Fs) Lstat(filename string) (os.FileInfo, error) {
+	info, err := b.fsys.Stat(cleanName(filename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &os.PathError{Op: "lstat", Path: filename, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := b.symlinkTarget(info); ok {
+		return &symlinkInfo{FileInfo: info}, nil
+	}
+
+	return info, nil
+}
+
+// Rename moves the named file or directory with server side copies, directories are moved using
+// RenameAll and files using Rename, which keeps the content type, metadata and tags of the object.
+func (b *Fs) Rename(oldpath, newpath string) error {
+	oldKey, newKey := cleanName(oldpath), cleanName(newpath)
+
+	info, err := b.fsys.Stat(oldKey)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+
+	if info.IsDir() {
+		if err := b.fsys.RenameAll(context.Background(), oldKey, newKey); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+		}
+		return nil
+	}
+
+	if err := b.fsys.Rename(oldKey, newKey); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: unwrapLinkError(err)}
+	}
+
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (b *Fs) Remove(filename string) error {
+	key := cleanName(filename)
+	if key == "." {
+		return &os.PathError{Op: "remove", Path: filename, Err: fs.ErrInvalid}
+	}
+
+	info, err := b.fsys.Stat(key)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: filename, Err: fs.ErrNotExist}
+	}
+
+	if !info.IsDir() {
+		return b.fsys.Remove(key)
+	}
+
+	infos, err := b.ReadDir(key)
+	if err != nil {
+		return err
+	}
+
+	if len(infos) > 0 {
+		return &os.PathError{Op: "remove", Path: filename, Err: syscall.ENOTEMPTY}
+	}
+
+	return b.fsys.Remove(key + "/")
+}
+
+// Join joins the path elements using slashes, as used by s3 keys.
+func (b *Fs) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// TempFile creates a new file with a random name starting with prefix in dir, or in the scratch
+// prefix when dir is empty. The object is uploaded when the file is closed.
+func (b *Fs) TempFile(dir, prefix string) (billy.File, error) {
+	if dir == "" {
+		dir = b.scratchPrefix
+	}
+
+	for i := 0; i < 10; i++ {
+		name := path.Join(dir, fmt.Sprintf("%s%d", prefix, rand.Uint32()))
+
+		f, err := b.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, err
+	}
+
+	return nil, &os.PathError{Op: "createtemp", Path: path.Join(dir, prefix+"*"), Err: fs.ErrExist}
+}
+
+// ReadDir returns the files and directories in the named directory sorted by name.
+func (b *Fs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	key := cleanName(dirname)
+
+	if b.symlinks {
+		var err error
+		if key, _, err = b.follow("readdir", dirname); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := b.fsys.ReadDir(key)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	return infos, nil
+}
+
+// MkdirAll creates the named directory by writing a directory marker object, parent directories
+// are implied by the marker so are not created.
+func (b *Fs) MkdirAll(filename string, perm os.FileMode) error {
+	key := cleanName(filename)
+	if key == "." {
+		return nil
+	}
+
+	info, err := b.fsys.Stat(key)
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: filename, Err: syscall.ENOTDIR}
+	}
+
+	// a file can't be the parent of a directory
+	for parent := path.Dir(key); parent != "."; parent = path.Dir(parent) {
+		info, err := b.fsys.Stat(parent)
+		if err == nil && !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: filename, Err: syscall.ENOTDIR}
+		}
+	}
+
+	if err := b.fsys.WriteFile(key+"/", nil, perm); err != nil {
+		return &os.PathError{Op: "mkdir", Path: filename, Err: unwrapPathError(err)}
+	}
+
+	return nil
+}
+
+// Symlink creates link as a symlink to target, this returns billy.ErrNotSupported unless
+// WithMetadataSymlinks is set.
+func (b *Fs) Symlink(target, link string) error {
+	if !b.symlinks {
+		return &os.LinkError{Op: "symlink", Old: target, New: link, Err: billy.ErrNotSupported}
+	}
+
+	key := cleanName(link)
+
+	_, err := b.fsys.Stat(key)
+	switch {
+	case err == nil:
+		return &os.LinkError{Op: "symlink", Old: target, New: link, Err: fs.ErrExist}
+	case !errors.Is(err, fs.ErrNotExist):
+		return &os.LinkError{Op: "symlink", Old: target, New: link, Err: unwrapPathError(err)}
+	}
+
+	_, err = b.fsys.WriteFrom(key, strings.NewReader(""), s3iofs.WithMetadata(map[string]string{
+		symlinkMetadata: filepath.ToSlash(target),
+	}))
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: target, New: link, Err: unwrapPathError(err)}
+	}
+
+	return nil
+}
+
+// Readlink returns the target of the named symlink, this returns billy.ErrNotSupported unless
+// WithMetadataSymlinks is set.
+func (b *Fs) Readlink(link string) (string, error) {
+	if !b.symlinks {
+		return "", &os.PathError{Op: "readlink", Path: link, Err: billy.ErrNotSupported}
+	}
+
+	info, err := b.fsys.Stat(cleanName(link))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", &os.PathError{Op: "readlink", Path: link, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	target, ok := b.symlinkTarget(info)
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: link, Err: syscall.EINVAL}
+	}
+
+	return target, nil
+}
+
+// follow stats the named file, following symlinks when they are enabled, it returns the key which
+// was reached along with its FileInfo. If the file doesn't exist the key is returned with the error,
+// so it can be created.
+func (b *Fs) follow(op, name string) (string, os.FileInfo, error) {
+	key := cleanName(name)
+
+	for i := 0; ; i++ {
+		info, err := b.fsys.Stat(key)
+		if err != nil {
+			// a link to a missing file is reported against the link, as a *os.PathError which
+			// matches os.IsNotExist
+			if errors.Is(err, fs.ErrNotExist) {
+				return key, nil, &os.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			return key, nil, err
+		}
+
+		target, ok := b.symlinkTarget(info)
+		if !ok {
+			return key, info, nil
+		}
+
+		if i == maxSymlinks {
+			return key, nil, &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+
+		if path.IsAbs(target) {
+			key = cleanName(target)
+		} else {
+			key = cleanName(path.Join(path.Dir(key), target))
+		}
+	}
+}
+
+// symlinkTarget returns the target of the file if it is a symlink and symlinks are enabled.
+func (b *Fs) symlinkTarget(info os.FileInfo) (string, bool) {
+	if !b.symlinks || info.IsDir() {
+		return "", false
+	}
+
+	f, ok := info.(s3iofs.File)
+	if !ok {
+		return "", false
+	}
+
+	target, ok := f.Metadata()[symlinkMetadata]
+	return target, ok
+}
+
+// Chroot returns a filesystem rooted at the named directory.
+func (b *Fs) Chroot(dir string) (billy.Filesystem, error) {
+	return chroot.New(b, cleanName(dir)), nil
+}
+
+// Root returns the root of the filesystem.
+func (b *Fs) Root() string {
+	return "/"
+}
+
+// cleanName converts a billy path, which may be absolute or use the os separator, to a fs.FS name.
+func cleanName(name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+// linkedInfo is the FileInfo of the target of a symlink, named after the link.
+type linkedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi *linkedInfo) Name() string {
+	return fi.name
+}
+
+// symlinkInfo is the FileInfo of a symlink returned by Lstat.
+type symlinkInfo struct {
+	os.FileInfo
+}
+
+func (fi *symlinkInfo) Mode() fs.FileMode {
+	return fs.ModeSymlink | 0o777
+}
+
+func unwrapLinkError(err error) error {
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Err
+	}
+	return err
+}
+
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
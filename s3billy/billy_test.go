@@ -0,0 +1,279 @@
+package s3billy
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs"
+)
+
+func newFs(t *testing.T, opts ...Option) (*fakeS3, *s3iofs.S3FS, billy.Filesystem) {
+	t.Helper()
+
+	backend := newFakeS3()
+	s3fs := s3iofs.NewWithClient("fooBucket", backend)
+
+	return backend, s3fs, NewBillyFs(s3fs, opts...)
+}
+
+func TestFs_Capabilities(t *testing.T) {
+	assert := require.New(t)
+
+	_, _, bfs := newFs(t)
+
+	assert.True(billy.CapabilityCheck(bfs, billy.ReadCapability|billy.WriteCapability|billy.SeekCapability))
+	assert.False(billy.CapabilityCheck(bfs, billy.ReadAndWriteCapability))
+	assert.False(billy.CapabilityCheck(bfs, billy.TruncateCapability))
+	assert.False(billy.CapabilityCheck(bfs, billy.LockCapability))
+}
+
+func TestFs_CreateAndRead(t *testing.T) {
+	assert := require.New(t)
+
+	backend, _, bfs := newFs(t)
+
+	err := util.WriteFile(bfs, "/dir/file.txt", []byte("hello world"), 0o644)
+	assert.NoError(err)
+	assert.Equal("hello world", string(backend.Get("dir/file.txt").Data))
+
+	f, err := bfs.Open(bfs.Join("dir", "file.txt"))
+	assert.NoError(err)
+	defer f.Close()
+
+	buf := make([]byte, 5)
+	_, err = f.ReadAt(buf, 6)
+	assert.NoError(err)
+	assert.Equal("world", string(buf))
+
+	_, err = f.Write([]byte("data"))
+	assert.Error(err)
+
+	assert.ErrorIs(f.Lock(), billy.ErrNotSupported)
+
+	_, err = bfs.OpenFile("dir/file.txt", os.O_RDWR, 0o644)
+	assert.ErrorIs(err, billy.ErrNotSupported)
+
+	_, err = bfs.OpenFile("dir/file.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	assert.ErrorIs(err, fs.ErrExist)
+}
+
+func TestFs_TempFile(t *testing.T) {
+	t.Run("scratch prefix", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, _, bfs := newFs(t, WithScratchPrefix("/scratch"))
+
+		f, err := bfs.TempFile("", "upload-")
+		assert.NoError(err)
+		assert.True(strings.HasPrefix(f.Name(), "scratch/upload-"), f.Name())
+
+		_, err = f.Write([]byte("data"))
+		assert.NoError(err)
+		assert.NoError(f.Close())
+
+		assert.Equal([]string{f.Name()}, backend.Keys())
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, _, bfs := newFs(t)
+
+		f, err := bfs.TempFile("dir", "upload-")
+		assert.NoError(err)
+		assert.True(strings.HasPrefix(f.Name(), "dir/upload-"), f.Name())
+		assert.NoError(f.Close())
+	})
+}
+
+func TestFs_Dirs(t *testing.T) {
+	assert := require.New(t)
+
+	backend, _, bfs := newFs(t)
+	backend.Put("dir/b.txt", []byte("b"))
+	backend.Put("dir/a.txt", []byte("a"))
+
+	err := bfs.MkdirAll("dir/nested", 0o755)
+	assert.NoError(err)
+
+	infos, err := bfs.ReadDir("dir")
+	assert.NoError(err)
+	assert.Equal([]string{"a.txt", "b.txt", "nested"}, names(infos))
+
+	infos, err = bfs.ReadDir("dir/nested")
+	assert.NoError(err)
+	assert.Empty(infos)
+
+	_, err = bfs.ReadDir("missing")
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	err = bfs.Remove("dir")
+	assert.Error(err)
+
+	err = bfs.Remove("dir/nested")
+	assert.NoError(err)
+	assert.Nil(backend.Get("dir/nested/"))
+
+	backend.Get("dir/a.txt").Metadata = map[string]string{"owner": "team"}
+
+	// the object is copied on the server so the metadata is kept
+	err = bfs.Rename("dir/a.txt", "dir/c.txt")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"owner": "team"}, backend.Get("dir/c.txt").Metadata)
+
+	err = bfs.Rename("dir", "moved")
+	assert.NoError(err)
+	assert.Equal([]string{"moved/b.txt", "moved/c.txt"}, backend.Keys())
+}
+
+func TestFs_Symlink(t *testing.T) {
+	t.Run("not supported by default", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, _, bfs := newFs(t)
+
+		assert.ErrorIs(bfs.Symlink("target", "link"), billy.ErrNotSupported)
+
+		_, err := bfs.Readlink("link")
+		assert.ErrorIs(err, billy.ErrNotSupported)
+	})
+
+	t.Run("stored in metadata", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, _, bfs := newFs(t, WithMetadataSymlinks())
+		backend.Put("dir/file.txt", []byte("data"))
+
+		err := bfs.(billy.Symlink).Symlink("file.txt", "dir/link")
+		assert.NoError(err)
+		assert.Equal(map[string]string{symlinkMetadata: "file.txt"}, backend.Get("dir/link").Metadata)
+
+		target, err := bfs.Readlink("dir/link")
+		assert.NoError(err)
+		assert.Equal("file.txt", target)
+
+		info, err := bfs.Lstat("dir/link")
+		assert.NoError(err)
+		assert.Equal(fs.ModeSymlink, info.Mode()&fs.ModeSymlink)
+
+		info, err = bfs.Stat("dir/link")
+		assert.NoError(err)
+		assert.Equal("link", info.Name())
+		assert.Equal(int64(4), info.Size())
+
+		data, err := util.ReadFile(bfs, "dir/link")
+		assert.NoError(err)
+		assert.Equal("data", string(data))
+
+		assert.ErrorIs(bfs.Symlink("other.txt", "dir/link"), fs.ErrExist)
+
+		_, err = bfs.Readlink("dir/file.txt")
+		assert.Error(err)
+	})
+
+	t.Run("loops are detected", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, _, bfs := newFs(t, WithMetadataSymlinks())
+
+		assert.NoError(bfs.Symlink("b", "a"))
+		assert.NoError(bfs.Symlink("/a", "b"))
+
+		_, err := bfs.Stat("a")
+		assert.ErrorIs(err, syscall.ELOOP)
+	})
+}
+
+func TestFs_Chroot(t *testing.T) {
+	assert := require.New(t)
+
+	backend, _, bfs := newFs(t)
+	backend.Put("base/dir/file.txt", []byte("data"))
+
+	sub, err := bfs.Chroot("base")
+	assert.NoError(err)
+
+	data, err := util.ReadFile(sub, "dir/file.txt")
+	assert.NoError(err)
+	assert.Equal("data", string(data))
+
+	err = util.WriteFile(sub, "other.txt", []byte("other"), 0o644)
+	assert.NoError(err)
+	assert.NotNil(backend.Get("base/other.txt"))
+
+	_, err = sub.Open("../escape.txt")
+	assert.ErrorIs(err, billy.ErrCrossedBoundary)
+}
+
+func TestFs_GitClone(t *testing.T) {
+	assert := require.New(t)
+
+	// build a repository on disk then copy the git directory into the bucket
+	dir := t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(err)
+
+	err = os.WriteFile(filepath.Join(dir, "README.md"), []byte("# hello"), 0o600)
+	assert.NoError(err)
+
+	wt, err := repo.Worktree()
+	assert.NoError(err)
+
+	_, err = wt.Add("README.md")
+	assert.NoError(err)
+
+	hash, err := wt.Commit("initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(err)
+
+	_, s3fs, bfs := newFs(t)
+
+	err = s3fs.CopyFS(context.Background(), "repo.git", os.DirFS(filepath.Join(dir, ".git")))
+	assert.NoError(err)
+
+	client.InstallProtocol("s3", server.NewClient(server.NewFilesystemLoader(bfs)))
+
+	clone, err := git.Clone(memory.NewStorage(), memfs.New(), &git.CloneOptions{URL: "s3://fooBucket/repo.git"})
+	assert.NoError(err)
+
+	head, err := clone.Head()
+	assert.NoError(err)
+	assert.Equal(hash, head.Hash())
+
+	cloneWt, err := clone.Worktree()
+	assert.NoError(err)
+
+	f, err := cloneWt.Filesystem.Open("README.md")
+	assert.NoError(err)
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	assert.NoError(err)
+	assert.Equal("# hello", string(data))
+}
+
+func names(infos []os.FileInfo) []string {
+	res := make([]string, len(infos))
+	for i, info := range infos {
+		res[i] = info.Name()
+	}
+	return res
+}
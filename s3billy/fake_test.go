@@ -0,0 +1,290 @@
+package s3billy
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/wolfeidau/s3iofs"
+)
+
+// fakeObject is an object stored in a fakeS3.
+type fakeObject struct {
+	Data         []byte
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+	Metadata     map[string]string
+}
+
+// fakeS3 is an in-memory bucket implementing the s3 calls made by the billy adapter, calls it
+// doesn't implement panic through the nil embedded S3API.
+type fakeS3 struct {
+	s3iofs.S3API
+
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string]*fakeObject{}}
+}
+
+// Put stores the data as the object with the given key.
+func (f *fakeS3) Put(key string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.put(key, &fakeObject{Data: data})
+}
+
+// Get returns the object with the given key, or nil if it doesn't exist.
+func (f *fakeS3) Get(key string) *fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.objects[key]
+}
+
+// Keys returns the sorted keys of every object.
+func (f *fakeS3) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.sortedKeys()
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	obj := f.objects[aws.ToString(params.Key)]
+	if obj == nil {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	if params.IfMatch != nil && aws.ToString(params.IfMatch) != obj.ETag {
+		return nil, preconditionFailed()
+	}
+
+	data := obj.Data
+	if params.Range != nil {
+		start, end, err := parseRange(aws.ToString(params.Range), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		data = data[start : end+1]
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          aws.String(obj.ETag),
+		LastModified:  aws.Time(obj.LastModified),
+		ContentType:   aws.String(obj.ContentType),
+		Metadata:      obj.Metadata,
+	}, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	obj := f.objects[aws.ToString(params.Key)]
+	if obj == nil {
+		return nil, &types.NotFound{Message: aws.String("Not Found")}
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(obj.Data))),
+		ETag:          aws.String(obj.ETag),
+		LastModified:  aws.Time(obj.LastModified),
+		ContentType:   aws.String(obj.ContentType),
+		Metadata:      obj.Metadata,
+	}, nil
+}
+
+// ListObjectsV2 lists every matching key in a single page, honouring Prefix, Delimiter and StartAfter.
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := aws.ToString(params.Prefix)
+	delimiter := aws.ToString(params.Delimiter)
+
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+
+	var last string
+
+	for _, key := range f.sortedKeys() {
+		if !strings.HasPrefix(key, prefix) || key <= aws.ToString(params.StartAfter) {
+			continue
+		}
+
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				if commonPrefix := key[:len(prefix)+idx+len(delimiter)]; commonPrefix != last {
+					out.CommonPrefixes = append(out.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+					last = commonPrefix
+				}
+				continue
+			}
+		}
+
+		obj := f.objects[key]
+		out.Contents = append(out.Contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(obj.Data))),
+			ETag:         aws.String(obj.ETag),
+			LastModified: aws.Time(obj.LastModified),
+		})
+	}
+
+	out.KeyCount = aws.Int32(int32(len(out.Contents) + len(out.CommonPrefixes)))
+
+	return out, nil
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	var data []byte
+	if params.Body != nil {
+		var err error
+		data, err = io.ReadAll(params.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if aws.ToString(params.IfNoneMatch) == "*" && f.objects[aws.ToString(params.Key)] != nil {
+		return nil, preconditionFailed()
+	}
+
+	obj := f.put(aws.ToString(params.Key), &fakeObject{
+		Data:        data,
+		ContentType: aws.ToString(params.ContentType),
+		Metadata:    params.Metadata,
+	})
+
+	return &s3.PutObjectOutput{ETag: aws.String(obj.ETag)}, nil
+}
+
+func (f *fakeS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	source, err := url.PathUnescape(aws.ToString(params.CopySource))
+	if err != nil {
+		return nil, &smithy.GenericAPIError{Code: "InvalidArgument", Message: err.Error()}
+	}
+
+	// the source is the bucket and key, the bucket is ignored as there is only one
+	_, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	src := f.objects[srcKey]
+	if src == nil {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+
+	if params.CopySourceIfMatch != nil && aws.ToString(params.CopySourceIfMatch) != src.ETag {
+		return nil, preconditionFailed()
+	}
+
+	obj := &fakeObject{Data: src.Data, ContentType: src.ContentType, Metadata: src.Metadata}
+	if params.MetadataDirective == types.MetadataDirectiveReplace {
+		obj.ContentType = aws.ToString(params.ContentType)
+		obj.Metadata = params.Metadata
+	}
+
+	obj = f.put(aws.ToString(params.Key), obj)
+
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{
+			ETag:         aws.String(obj.ETag),
+			LastModified: aws.Time(obj.LastModified),
+		},
+	}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.objects, aws.ToString(params.Key))
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &s3.DeleteObjectsOutput{}
+	for _, obj := range params.Delete.Objects {
+		delete(f.objects, aws.ToString(obj.Key))
+		out.Deleted = append(out.Deleted, types.DeletedObject{Key: obj.Key})
+	}
+
+	return out, nil
+}
+
+// put stores the object, setting its ETag and modification time. The mutex must be held.
+func (f *fakeS3) put(key string, obj *fakeObject) *fakeObject {
+	sum := md5.Sum(obj.Data)
+	obj.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+	obj.LastModified = time.Now()
+
+	f.objects[key] = obj
+
+	return obj
+}
+
+// sortedKeys returns the keys in the order s3 lists them. The mutex must be held.
+func (f *fakeS3) sortedKeys() []string {
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func parseRange(rng string, size int64) (int64, int64, error) {
+	invalid := &smithy.GenericAPIError{Code: "InvalidRange", Message: "The requested range is not satisfiable"}
+
+	startStr, endStr, _ := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, invalid
+	}
+
+	end := size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+			return 0, 0, invalid
+		}
+		end = min(end, size-1)
+	}
+
+	return start, end, nil
+}
+
+func preconditionFailed() error {
+	return &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+}
@@ -0,0 +1,148 @@
+package s3billy
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/wolfeidau/s3iofs"
+)
+
+var (
+	_ billy.File = (*readFile)(nil)
+	_ billy.File = (*writeFile)(nil)
+)
+
+// readFile is a file opened for reading.
+type readFile struct {
+	name string
+	file s3iofs.File
+}
+
+func (f *readFile) Name() string {
+	return f.name
+}
+
+func (f *readFile) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+func (f *readFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *readFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *readFile) Lock() error {
+	return billy.ErrNotSupported
+}
+
+func (f *readFile) Unlock() error {
+	return billy.ErrNotSupported
+}
+
+func (f *readFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: billy.ErrNotSupported}
+}
+
+// writeFile streams writes to WriteFrom, which spools them then uploads the object on Close.
+type writeFile struct {
+	name   string
+	pw     *io.PipeWriter
+	result chan error
+	size   int64
+	closed bool
+}
+
+func newWriteFile(fsys *s3iofs.S3FS, name, key string) *writeFile {
+	pr, pw := io.Pipe()
+
+	f := &writeFile{
+		name:   name,
+		pw:     pw,
+		result: make(chan error, 1),
+	}
+
+	go func() {
+		_, err := fsys.WriteFrom(key, pr)
+		// unblock any writes if the upload failed before reading everything
+		pr.CloseWithError(err)
+		f.result <- err
+	}()
+
+	return f
+}
+
+func (f *writeFile) Name() string {
+	return f.name
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	n, err := f.pw.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, &os.PathError{Op: "write", Path: f.name, Err: err}
+	}
+
+	return n, nil
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *writeFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+}
+
+// Seek only supports reporting the current offset as the object is written sequentially.
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.size, nil
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.ESPIPE}
+}
+
+func (f *writeFile) Lock() error {
+	return billy.ErrNotSupported
+}
+
+func (f *writeFile) Unlock() error {
+	return billy.ErrNotSupported
+}
+
+func (f *writeFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: billy.ErrNotSupported}
+}
+
+// Close completes the upload, returning any error from s3.
+func (f *writeFile) Close() error {
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+
+	_ = f.pw.Close()
+
+	if err := <-f.result; err != nil {
+		return &os.PathError{Op: "close", Path: f.name, Err: unwrapPathError(err)}
+	}
+
+	return nil
+}
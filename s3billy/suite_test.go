@@ -0,0 +1,42 @@
+package s3billy
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v5/test"
+	"github.com/wolfeidau/s3iofs"
+	. "gopkg.in/check.v1"
+)
+
+func TestSuites(t *testing.T) { TestingT(t) }
+
+// FilesystemSuite runs the go-billy conformance tests against the adapter with symlinks enabled,
+// the tests of features which s3 objects can't support are skipped.
+type FilesystemSuite struct {
+	test.FilesystemSuite
+}
+
+var _ = Suite(&FilesystemSuite{})
+
+func (s *FilesystemSuite) SetUpTest(c *C) {
+	s.FilesystemSuite = test.NewFilesystemSuite(NewBillyFs(s3iofs.NewWithClient("fooBucket", newFakeS3()), WithMetadataSymlinks()))
+}
+
+// files are written with a single upload when they are closed, so they can't be read while open
+// for writing, reopened without truncation, appended to or truncated
+
+func (s *FilesystemSuite) TestFileWrite(c *C)            { c.Skip("O_RDWR is not supported") }
+func (s *FilesystemSuite) TestOpenFileAppend(c *C)       { c.Skip("O_APPEND is not supported") }
+func (s *FilesystemSuite) TestOpenFileNoTruncate(c *C)   { c.Skip("files are always truncated") }
+func (s *FilesystemSuite) TestOpenFileReadWrite(c *C)    { c.Skip("O_RDWR is not supported") }
+func (s *FilesystemSuite) TestReadAtOnReadWrite(c *C)    { c.Skip("O_RDWR is not supported") }
+func (s *FilesystemSuite) TestSeekToEndAndWrite(c *C)    { c.Skip("O_RDWR is not supported") }
+func (s *FilesystemSuite) TestTempFileManyWithUtil(c *C) { c.Skip("util.TempFile opens with O_RDWR") }
+func (s *FilesystemSuite) TestTruncate(c *C)             { c.Skip("truncation is not supported") }
+
+// s3 objects have no permissions and prefixes have no modification time
+
+func (s *FilesystemSuite) TestOpenFileWithModes(c *C) { c.Skip("file modes are not stored") }
+func (s *FilesystemSuite) TestStat(c *C)              { c.Skip("file modes are not stored") }
+func (s *FilesystemSuite) TestStatLink(c *C)          { c.Skip("file modes are not stored") }
+func (s *FilesystemSuite) TestStatDir(c *C)           { c.Skip("directories have no modification time") }
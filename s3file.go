@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"path"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 var (
@@ -19,6 +22,7 @@ var (
 	_ fs.DirEntry    = (*s3File)(nil)
 	_ io.ReaderAt    = (*s3File)(nil)
 	_ io.Seeker      = (*s3File)(nil)
+	_ io.WriterTo    = (*s3File)(nil)
 	_ fs.ReadDirFile = (*s3File)(nil)
 )
 
@@ -27,100 +31,507 @@ const (
 	opSeek = "seek"
 )
 
+// s3File is a file or directory in the bucket, it is safe for concurrent use.
+//
+// The identity of the file is immutable after construction, the read state is guarded by mutex, and
+// the object metadata, which is updated by Info and Refresh, is guarded by meta.
+//
+// Read, WriteTo and Seek share the offset and the open body, ReadAt uses neither so it can be mixed
+// with them in any order, as io.ReaderAt requires.
 type s3File struct {
-	s3client     S3API
-	name         string
-	bucket       string
-	size         int64
-	mode         fs.FileMode
-	modTime      time.Time // zero value for directories
-	offset       int64
-	lastDirEntry string
-	mutex        sync.Mutex
-	body         io.ReadCloser
+	// immutable after construction
+	s3client S3API
+	ctx      context.Context // used for requests made by the file, this is nil for listed entries
+	name     string
+	bucket   string
+	mode     fs.FileMode
+	listed   bool // listed entries only carry the fields returned by ListObjectsV2
+	relName  string
+	// versionID is the version of the object read by the file, this is empty if the bucket isn't
+	// versioned, for listed entries and with WithoutETagPinning unless opened with OpenVersion
+	versionID string
+	// openETag is the ETag of the object when the file was opened, which the ranged reads are pinned
+	// to, unlike the ETag of the metadata it isn't changed by Refresh
+	openETag string
+
+	// dir holds the listing settings of the filesystem for directories
+	dir dirOptions
+	// download holds the settings of parallel downloads for files
+	download downloadOptions
+	// readAhead holds the settings of the chunks fetched ahead of Read for files
+	readAhead readAheadOptions
+	// blocks is the cache of the filesystem used by ReadAt, this is nil unless WithBlockCache is set
+	blocks *blockCache
+	// minRead is the least number of bytes fetched by ReadAt, with WithMinReadSize
+	minRead int64
+	// readRetries is the number of times the body is opened again after a network error
+	readRetries int
+	// unpinned is set by WithoutETagPinning, ranged reads are made without the ETag of the file
+	unpinned bool
+
+	// read state, guarded by mutex
+	mutex    sync.Mutex
+	offset   int64
+	body     io.ReadCloser
+	prefetch *prefetcher // the chunks fetched ahead of Read, with WithReadAhead
+	dirToken *string     // continuation token of the directory listing
+	dirDone  bool        // the directory listing has been read to the end
+	closed   bool
+
+	// the bytes of the last fetch of ReadAt, with WithMinReadSize, this has its own lock
+	readBuf readBuffer
+
+	// object metadata, guarded by meta
+	meta                 sync.RWMutex
+	size                 int64
+	modTime              time.Time // zero value for directories, unless WithDirectoryModTime is set
+	headLoaded           bool
+	etag                 string
+	contentType          string
+	metadata             map[string]string
+	serverSideEncryption string
+	sseKMSKeyID          string
+	bucketKeyEnabled     bool
+	expiration           string
+	storageClass         string
+	owner                string // only set for entries listed with WithFetchOwner
+}
+
+// context returns the context the file was opened with.
+func (s3f *s3File) context() context.Context {
+	if s3f.ctx != nil {
+		return s3f.ctx
+	}
+	return context.Background()
 }
 
 func (s3f *s3File) Stat() (fs.FileInfo, error) {
+	if s3f.IsDir() && s3f.dir.modTime {
+		return s3f.Info()
+	}
+
+	// a file opened without a length asks for it again
+	if !s3f.IsDir() && s3f.s3client != nil {
+		if _, err := s3f.loadSize(s3f.context()); err != nil {
+			return nil, err
+		}
+	}
+
 	return s3f, nil
 }
 
+// Info returns the FileInfo for the entry, for files returned by a directory listing
+// this issues a HeadObject to load the metadata which isn't included in the listing.
+//
+// With WithDirectoryModTime, directories list a page of their children to load the ModTime.
 func (s3f *s3File) Info() (fs.FileInfo, error) {
+	if s3f.s3client == nil || (!s3f.listed && !s3f.dir.modTime) {
+		return s3f, nil
+	}
+
+	s3f.meta.RLock()
+	headLoaded := s3f.headLoaded
+	s3f.meta.RUnlock()
+
+	if headLoaded {
+		return s3f, nil
+	}
+
+	if s3f.IsDir() {
+		if !s3f.dir.modTime {
+			return s3f, nil
+		}
+		if err := s3f.loadDirModTime(s3f.context()); err != nil {
+			return nil, err
+		}
+		return s3f, nil
+	}
+
+	res, err := headObjectVersion(s3f.context(), s3f.s3client, s3f.bucket, "stat", s3f.name, s3f.versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s3f.applyHead(res)
+
 	return s3f, nil
 }
 
+// loadDirModTime sets the ModTime of the directory to that of the newest object in the first page
+// of its listing.
+func (s3f *s3File) loadDirModTime(ctx context.Context) error {
+	listRes, err := s3f.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s3f.bucket),
+		Prefix:    aws.String(s3f.Key()),
+		Delimiter: aws.String("/"),
+		MaxKeys:   s3f.dir.maxKeys(0),
+	})
+	if err != nil {
+		return pathError("stat", s3f.name, err)
+	}
+
+	s3f.applyDirModTime(listRes.Contents)
+
+	s3f.meta.Lock()
+	s3f.headLoaded = true
+	s3f.meta.Unlock()
+
+	return nil
+}
+
+// applyDirModTime moves the ModTime of the directory forward to the newest of the listed objects.
+func (s3f *s3File) applyDirModTime(objects []types.Object) {
+	s3f.meta.Lock()
+	defer s3f.meta.Unlock()
+
+	for _, obj := range objects {
+		if modTime := aws.ToTime(obj.LastModified); modTime.After(s3f.modTime) {
+			s3f.modTime = modTime
+		}
+	}
+}
+
+// Refresh reloads the size, modification time, ETag and other metadata of the file with a
+// HeadObject, this is used to check entries returned by an earlier listing are current.
+//
+// Note:
+//   - If the object has been removed, Refresh returns fs.ErrNotExist and the file is unchanged.
+//   - Directories have no metadata, so Refresh is a no-op.
+//   - This is intended for entries returned by ReadDir, refreshing an open file doesn't change
+//     the data returned by reads which are in progress.
+func (s3f *s3File) Refresh(ctx context.Context) error {
+	if s3f.IsDir() {
+		return nil
+	}
+
+	res, err := headObjectVersion(ctx, s3f.s3client, s3f.bucket, "stat", s3f.name, s3f.versionID)
+	if err != nil {
+		return err
+	}
+
+	s3f.applyHead(res)
+
+	return nil
+}
+
+// headObject issues a HeadObject for the key, translating a missing key to fs.ErrNotExist.
+func headObject(ctx context.Context, client S3API, bucket, op, name string) (*s3.HeadObjectOutput, error) {
+	return headObjectVersion(ctx, client, bucket, op, name, "")
+}
+
+// headObjectVersion issues a HeadObject for the version of the key, or the current version if the
+// version id is empty, translating a missing key or version to fs.ErrNotExist.
+func headObjectVersion(ctx context.Context, client S3API, bucket, op, name, versionID string) (*s3.HeadObjectOutput, error) {
+	req := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(name),
+	}
+	if versionID != "" {
+		req.VersionId = aws.String(versionID)
+	}
+
+	res, err := client.HeadObject(ctx, req)
+	if err != nil {
+		if isNotFound(err) || isNoSuchVersion(err) {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, pathError(op, name, err)
+	}
+
+	return res, nil
+}
+
+// applyHead updates the file info with the metadata returned by HeadObject.
+func (s3f *s3File) applyHead(res *s3.HeadObjectOutput) {
+	s3f.meta.Lock()
+	defer s3f.meta.Unlock()
+
+	// the best known values are kept when a store leaves them out of the response
+	if res.ContentLength != nil {
+		s3f.size = aws.ToInt64(res.ContentLength)
+	}
+	if res.LastModified != nil {
+		s3f.modTime = aws.ToTime(res.LastModified)
+	}
+	s3f.etag = aws.ToString(res.ETag)
+	s3f.contentType = aws.ToString(res.ContentType)
+	s3f.metadata = lowerMetadata(res.Metadata)
+	s3f.serverSideEncryption = string(res.ServerSideEncryption)
+	s3f.sseKMSKeyID = aws.ToString(res.SSEKMSKeyId)
+	s3f.bucketKeyEnabled = aws.ToBool(res.BucketKeyEnabled)
+	s3f.expiration = aws.ToString(res.Expiration)
+	s3f.storageClass = string(res.StorageClass)
+	s3f.headLoaded = true
+
+	// s3 omits the header for the default storage class
+	if s3f.storageClass == "" {
+		s3f.storageClass = string(types.StorageClassStandard)
+	}
+}
+
+// applyListed fills in the size and modification time of the file which are unknown from the
+// listed file info.
+func (s3f *s3File) applyListed(info fs.FileInfo) {
+	s3f.meta.Lock()
+	defer s3f.meta.Unlock()
+
+	if s3f.size == sizeUnknown {
+		s3f.size = info.Size()
+	}
+	if s3f.modTime.IsZero() {
+		s3f.modTime = info.ModTime()
+	}
+}
+
+// sizeUnknown is the size of a file when s3 didn't return its length, reads continue until the
+// end of the data rather than stopping at the size.
+const sizeUnknown = -1
+
+// objectSize returns the size of an object, or sizeUnknown if the response left it out.
+func objectSize(size *int64) int64 {
+	if size == nil {
+		return sizeUnknown
+	}
+	return *size
+}
+
+// loadSize issues a HeadObject to find the size of a file opened without one, the size remains
+// unknown if the head doesn't include it either.
+func (s3f *s3File) loadSize(ctx context.Context) (int64, error) {
+	if size := s3f.Size(); size != sizeUnknown {
+		return size, nil
+	}
+
+	res, err := headObjectVersion(ctx, s3f.s3client, s3f.bucket, "stat", s3f.name, s3f.versionID)
+	if err != nil {
+		return 0, err
+	}
+
+	s3f.applyHead(res)
+
+	return s3f.Size(), nil
+}
+
+// Read reads from the offset of the file, using the body opened at that offset, the offset is only
+// moved by Read, WriteTo and Seek. The body is opened again from the offset after a network error,
+// see WithReadRetries.
 func (s3f *s3File) Read(p []byte) (int, error) {
 	if s3f.IsDir() {
 		return 0, &fs.PathError{Op: opRead, Path: s3f.name, Err: errors.New("is a directory")}
 	}
 
-	if s3f.offset >= s3f.size {
+	s3f.mutex.Lock()
+	defer s3f.mutex.Unlock()
+
+	if s3f.closed {
+		return 0, &fs.PathError{Op: opRead, Path: s3f.name, Err: fs.ErrClosed}
+	}
+
+	size := s3f.Size()
+
+	if size != sizeUnknown && s3f.offset >= size {
 		return 0, io.EOF
 	}
 
-	s3f.mutex.Lock()
-	defer s3f.mutex.Unlock()
-	if s3f.body != nil {
-		n, err := s3f.body.Read(p)
-		s3f.offset += int64(n) // update the current offset
-		return n, err
+	if len(p) == 0 {
+		return 0, nil
 	}
 
-	// random access to S3 object is currently being used to read the file
-	n, err := s3f.ReadAt(p, s3f.offset)
-	s3f.offset += int64(n) // update the current offset
-	if err != nil {
-		// if we get an unexpected EOF, and we are at the end of the underlying file, return EOF as that is
-		// the expected behavior
-		if errors.Is(err, io.ErrUnexpectedEOF) {
-			// if we are at the end of the underlying file, return EOF as that is the expected behavior
-			if s3f.offset == s3f.size {
-				return n, io.EOF
-			}
+	if s3f.readAhead.enabled() {
+		if s3f.prefetch == nil {
+			s3f.prefetch = newPrefetcher(s3f, size, s3f.body)
+			s3f.body = nil
 		}
 
+		n, err := s3f.prefetch.read(p, s3f.offset)
+		s3f.offset += int64(n)
 		return n, err
 	}
 
-	return n, nil
+	if s3f.body == nil && s3f.minRead > 0 {
+		if n := s3f.readBuf.read(p, s3f.offset); n > 0 {
+			s3f.offset += int64(n)
+			return n, nil
+		}
+	}
+
+	if s3f.body == nil {
+		// after a Seek the body is opened again from the offset and kept for the reads which follow,
+		// rather than making a ranged request the size of each read
+		body, err := s3f.readerAt(s3f.context(), s3f.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		s3f.body = body
+	}
+
+	return s3f.readBody(p)
 }
 
+// ReadAt reads len(p) bytes from the offset with a ranged GetObject, it never uses the body or changes
+// the offset used by Read, so reads which follow continue from where the last Read stopped, and
+// concurrent calls are independent. With WithBlockCache the read is served from the cached blocks.
 func (s3f *s3File) ReadAt(p []byte, offset int64) (n int, err error) {
-	ctx := context.Background()
+	s3f.mutex.Lock()
+	closed := s3f.closed
+	// random access ends a sequential read, so the chunks fetched ahead are unlikely to be used, they
+	// are stopped once the mutex is released as waiting for a chunk in flight can take a request
+	prefetch := s3f.prefetch
+	s3f.prefetch = nil
+	s3f.mutex.Unlock()
+
+	if prefetch != nil {
+		prefetch.close()
+	}
+
+	if closed {
+		return 0, &fs.PathError{Op: opRead, Path: s3f.name, Err: fs.ErrClosed}
+	}
 
-	r, err := s3f.readerAt(ctx, offset, int64(len(p)))
+	if offset < 0 {
+		return 0, &fs.PathError{Op: opRead, Path: s3f.name, Err: fs.ErrInvalid}
+	}
+
+	size := s3f.Size()
+
+	if s3f.blocks != nil && size != sizeUnknown && int64(len(p)) <= s3f.blocks.maxBytes {
+		if offset >= size {
+			return 0, io.EOF
+		}
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return s3f.readBlocks(p, offset, size)
+	}
+
+	if s3f.minRead > 0 && size != sizeUnknown {
+		return s3f.readAtLeast(p, offset, size)
+	}
+
+	return s3f.readAt(p, offset, size)
+}
+
+// readAt reads from the offset of an object of the given size, following the contract of
+// io.ReaderAt, a read which reaches the end of the object returns io.EOF with the bytes read. When the
+// size is known the range requested is clamped to the object, and a read from the end or beyond
+// makes no request, when it is unknown the end is found by reading.
+func (s3f *s3File) readAt(p []byte, offset, size int64) (int, error) {
+	if size != sizeUnknown {
+		if offset >= size {
+			return 0, io.EOF
+		}
+
+		if remaining := size - offset; int64(len(p)) > remaining {
+			n, err := s3f.readAt(p[:remaining], offset, size)
+			if err == nil {
+				err = io.EOF
+			}
+			return n, err
+		}
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r, err := s3f.readerAt(s3f.context(), offset, int64(len(p)))
 	if err != nil {
 		return 0, err
 	}
 
 	// ensure the buffer is read, or EOF is reached for this read of this "chunk"
 	// given we are using offsets to read this block it is constrained by size of `p`
-	size, err := io.ReadFull(r, p)
+	n, err := io.ReadFull(r, p)
 	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return size, err
-		}
-		// check if we are at the end of the underlying file
-		if offset+int64(size) > s3f.size {
-			return size, err
+		r.Close()
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// the end of an object of unknown size, a known size means the object is shorter than it
+		if size == sizeUnknown {
+			return n, io.EOF
 		}
+		return n, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return n, err
 	}
 
-	return size, r.Close()
+	return n, r.Close()
 }
 
-func (s3f *s3File) Seek(offset int64, whence int) (int64, error) {
-	// given the body stream doesn't support seek we will need to re-open the stream
-	// using read at the new offset
+// WriteTo writes the remainder of the file from the current offset to w, the open body is
+// used if present, otherwise a single ranged GetObject streams the rest of the object. With
+// WithDownloadConcurrency a large remainder is fetched as concurrent ranges.
+//
+// The body is opened again from the offset after a network error, see WithReadRetries.
+func (s3f *s3File) WriteTo(w io.Writer) (int64, error) {
+	if s3f.IsDir() {
+		return 0, &fs.PathError{Op: opRead, Path: s3f.name, Err: errors.New("is a directory")}
+	}
+
 	s3f.mutex.Lock()
 	defer s3f.mutex.Unlock()
-	if s3f.body != nil {
-		err := s3f.body.Close()
+
+	if s3f.closed {
+		return 0, &fs.PathError{Op: opRead, Path: s3f.name, Err: fs.ErrClosed}
+	}
+
+	s3f.discardPrefetch()
+
+	size := s3f.Size()
+	if size != sizeUnknown && s3f.offset >= size {
+		return 0, nil
+	}
+
+	if size != sizeUnknown && s3f.download.parallel(size-s3f.offset) {
+		n, err := s3f.downloadParts(w, size)
+		s3f.offset += n
+		return n, err
+	}
+
+	if s3f.body == nil {
+		r, err := s3f.readerAt(s3f.context(), s3f.offset, -1)
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
 		if err != nil {
 			return 0, err
 		}
+		s3f.body = r
+	}
+
+	// the offset is moved by each read of the body, which is opened again after a network error
+	n, err := io.Copy(w, bodyReader{s3f: s3f})
+
+	// the body is consumed, a subsequent read opens it again from the offset
+	var closeErr error
+	if s3f.body != nil {
+		closeErr = s3f.body.Close()
 		s3f.body = nil
 	}
 
+	if err != nil {
+		return n, err
+	}
+
+	return n, closeErr
+}
+
+// Seek sets the offset of the next Read, the body doesn't support seeking so it is closed when the
+// offset changes and the next Read opens it again from the new offset.
+func (s3f *s3File) Seek(offset int64, whence int) (int64, error) {
+	s3f.mutex.Lock()
+	defer s3f.mutex.Unlock()
+
+	if s3f.closed {
+		return 0, &fs.PathError{Op: opSeek, Path: s3f.name, Err: fs.ErrClosed}
+	}
+
+	size, err := s3f.loadSize(s3f.context())
+	if err != nil {
+		return 0, err
+	}
+
 	switch whence {
 	default:
 		return 0, &fs.PathError{Op: opSeek, Path: s3f.name, Err: fs.ErrInvalid}
@@ -129,11 +540,27 @@ func (s3f *s3File) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekCurrent:
 		offset += s3f.offset
 	case io.SeekEnd:
-		offset += s3f.size
+		if size == sizeUnknown {
+			return 0, &fs.PathError{Op: opSeek, Path: s3f.name, Err: fs.ErrInvalid}
+		}
+		offset += size
 	}
-	if offset < 0 || offset > s3f.size {
+	if offset < 0 || (size != sizeUnknown && offset > size) {
 		return 0, &fs.PathError{Op: opSeek, Path: s3f.name, Err: fs.ErrInvalid}
 	}
+
+	// a seek to the current offset, such as Seek(0, io.SeekCurrent), keeps reading the body
+	if offset != s3f.offset {
+		s3f.discardPrefetch()
+
+		if s3f.body != nil {
+			err := s3f.body.Close()
+			s3f.body = nil
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
 	s3f.offset = offset
 
 	return offset, nil
@@ -144,70 +571,128 @@ func (s3f *s3File) ReadDir(n int) ([]fs.DirEntry, error) {
 		return nil, &fs.PathError{Op: opRead, Path: s3f.Name(), Err: fs.ErrNotExist}
 	}
 
-	prefix := s3f.name
+	s3f.mutex.Lock()
+	defer s3f.mutex.Unlock()
 
-	if s3f.name == "." {
-		prefix = ""
+	if s3f.closed {
+		return nil, &fs.PathError{Op: opRead, Path: s3f.name, Err: fs.ErrClosed}
 	}
 
-	params := &s3.ListObjectsV2Input{
-		Bucket:    aws.String(s3f.bucket),
-		Prefix:    aws.String(prefix),
-		Delimiter: aws.String("/"),
+	if s3f.dirDone {
+		if n > 0 {
+			return nil, io.EOF
+		}
+		return []fs.DirEntry{}, nil
 	}
 
-	if n > 0 {
-		params.MaxKeys = aws.Int32(int32(n))
-	}
+	prefix := s3f.Key()
 
-	if s3f.lastDirEntry != "" {
-		params.StartAfter = aws.String(s3f.lastDirEntry)
+	params := &s3.ListObjectsV2Input{
+		Bucket:     aws.String(s3f.bucket),
+		Prefix:     aws.String(prefix),
+		Delimiter:  aws.String("/"),
+		FetchOwner: s3f.dir.fetchOwner(),
 	}
 
-	listRes, err := s3f.s3client.ListObjectsV2(context.Background(), params)
-	if err != nil {
-		return nil, err
-	}
+	params.ContinuationToken = s3f.dirToken
 
-	entries, err := listResToEntries(s3f.bucket, s3f.s3client, listRes)
-	if err != nil {
-		return nil, err
+	entries := []fs.DirEntry{}
+
+	// a read of the whole directory follows the continuation token to the last page, the paging
+	// state is the token of the previous response so prefixes are never repeated or skipped
+	for {
+		// s3 returns at most 1000 keys a page, so larger reads take several pages
+		var want int32
+		if n > 0 {
+			want = int32(min(n-len(entries), maxListKeys))
+		}
+		params.MaxKeys = s3f.dir.maxKeys(want)
+
+		listRes, err := s3f.s3client.ListObjectsV2(s3f.context(), params)
+		if err != nil {
+			return nil, pathError(opRead, s3f.name, err)
+		}
+
+		page, err := listResToEntries(s3f.bucket, s3f.s3client, prefix, s3f.dir, listRes)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+
+		if s3f.dir.modTime {
+			s3f.applyDirModTime(listRes.Contents)
+		}
+
+		s3f.dirToken = listRes.NextContinuationToken
+
+		if !aws.ToBool(listRes.IsTruncated) {
+			s3f.dirDone = true
+			break
+		}
+
+		// a page may be short, such as when it holds the marker of the directory, so keep going
+		// until there are n entries
+		if n > 0 && len(entries) >= n {
+			break
+		}
+
+		params.ContinuationToken = s3f.dirToken
 	}
 
-	if len(entries) == 0 {
-		return nil, io.EOF
+	// the whole directory is sorted by name, as fs.ReadDir does, pages are returned in listing order
+	if n <= 0 {
+		sortEntries(entries)
 	}
 
-	if n > 0 && len(entries) == n {
-		des3f, ok := entries[n-1].(*s3File)
-		if ok {
-			s3f.lastDirEntry = des3f.name
-		}
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
 	}
 
 	return entries, nil
 }
 
-func (s3f *s3File) readerAt(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
-	byteRange := buildRange(offset, length)
-
-	req := &s3.GetObjectInput{
-		Bucket: aws.String(s3f.bucket),
-		Key:    aws.String(s3f.name),
-		Range:  byteRange,
+// discardPrefetch stops the chunks fetched ahead of Read, the next Read fetches them again from its
+// offset. The mutex must be held.
+func (s3f *s3File) discardPrefetch() {
+	if s3f.prefetch != nil {
+		s3f.prefetch.close()
+		s3f.prefetch = nil
 	}
+}
 
-	res, err := s3f.s3client.GetObject(ctx, req)
+// readerAt returns the body of a ranged GetObject from the offset, a length of -1 reads to the end
+// of the object. A range which starts past the end of the object, which s3 rejects with a 416
+// InvalidRange, returns io.EOF so a stale or unknown size reads as the end of the file.
+//
+// The request is pinned to the file, so if the object has been replaced since it was opened
+// ErrObjectChanged is returned, see WithoutETagPinning and OpenVersion.
+func (s3f *s3File) readerAt(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	res, err := s3f.s3client.GetObject(ctx, s3f.rangeRequest(offset, length))
 	if err != nil {
-		return nil, &fs.PathError{Op: opRead, Path: s3f.name, Err: err}
+		if isInvalidRange(err) {
+			return nil, io.EOF
+		}
+		if isPreconditionFailed(err) {
+			return nil, &fs.PathError{Op: opRead, Path: s3f.name, Err: ErrObjectChanged}
+		}
+		return nil, pathError(opRead, s3f.name, err)
 	}
 
 	return res.Body, nil
 }
 
+// Close releases the open body, reads after Close return fs.ErrClosed.
 func (s3f *s3File) Close() error {
 	s3f.mutex.Lock()
 	defer s3f.mutex.Unlock()
+
+	if s3f.closed {
+		return &fs.PathError{Op: "close", Path: s3f.name, Err: fs.ErrClosed}
+	}
+	s3f.closed = true
+
+	s3f.discardPrefetch()
+
 	if s3f.body != nil {
 		err := s3f.body.Close()
 		if err != nil {
@@ -221,11 +706,17 @@ func (s3f *s3File) Close() error {
 
 // Name returns the name of the file (or subdirectory) described by the entry.
 func (s3f *s3File) Name() string {
+	if s3f.relName != "" {
+		return s3f.relName
+	}
 	return path.Base(s3f.name)
 }
 
-// Size length in bytes for regular files; system-dependent for others.
+// Size length in bytes for regular files; system-dependent for others. This is -1 if the store
+// didn't return the length of the object.
 func (s3f *s3File) Size() int64 {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
 	return s3f.size
 }
 
@@ -241,6 +732,8 @@ func (s3f *s3File) Type() fs.FileMode {
 
 // modification time.
 func (s3f *s3File) ModTime() time.Time {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
 	return s3f.modTime
 }
 
@@ -249,6 +742,81 @@ func (s3f *s3File) IsDir() bool {
 	return s3f.Mode().IsDir()
 }
 
+// ETag returns the entity tag of the object, this is empty for directories.
+func (s3f *s3File) ETag() string {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return s3f.etag
+}
+
+// VersionID returns the version of the object the file reads, this is empty if the bucket isn't
+// versioned, for directories and for entries returned by a listing.
+func (s3f *s3File) VersionID() string {
+	return s3f.versionID
+}
+
+// ContentType returns the MIME type of the object, this is empty for directories.
+func (s3f *s3File) ContentType() string {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return s3f.contentType
+}
+
+// Metadata returns the user metadata of the object with lowercase keys, the result is a copy so may
+// be modified by the caller.
+func (s3f *s3File) Metadata() map[string]string {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return maps.Clone(s3f.metadata)
+}
+
+// lowerMetadata returns the user metadata with lowercase keys, the sdk preserves the case of the
+// headers returned by some s3 compatible services.
+func lowerMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	lowered := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		lowered[strings.ToLower(k)] = v
+	}
+
+	return lowered
+}
+
+// StorageClass returns the storage class of the object, such as STANDARD or GLACIER, this is empty
+// for directories.
+func (s3f *s3File) StorageClass() string {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return s3f.storageClass
+}
+
+// Owner returns the canonical user id of the owner of the object, this is only set for entries
+// listed by a filesystem created with WithFetchOwner, and is empty for directories.
+func (s3f *s3File) Owner() string {
+	s3f.meta.RLock()
+	defer s3f.meta.RUnlock()
+	return s3f.owner
+}
+
+// ownerID returns the canonical user id of the owner, or an empty string if there is none.
+func ownerID(owner *types.Owner) string {
+	if owner == nil {
+		return ""
+	}
+	return aws.ToString(owner.ID)
+}
+
+// Key returns the s3 key of the object, for directories this is the prefix of the keys within it.
+func (s3f *s3File) Key() string {
+	if s3f.IsDir() && !strings.HasSuffix(s3f.name, "/") {
+		return dirPrefix(s3f.name)
+	}
+	return s3f.name
+}
+
 // underlying data source (can return nil).
 func (s3f *s3File) Sys() interface{} {
 	return nil
@@ -3,17 +3,23 @@ package s3iofs
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
-	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
 )
 
 const twoMegabytes = 1024 * 1024 * 2
@@ -47,132 +53,97 @@ func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput,
 	return args.Get(0).(*s3.PutObjectOutput), args.Error(1)
 }
 
+func (m *mockS3Client) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.CopyObjectOutput), args.Error(1)
+}
+
+func (m *mockS3Client) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.DeleteObjectsOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.CreateMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.UploadPartOutput), args.Error(1)
+}
+
+func (m *mockS3Client) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.UploadPartCopyOutput), args.Error(1)
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.CompleteMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.AbortMultipartUploadOutput), args.Error(1)
+}
+
+func (m *mockS3Client) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.ListObjectVersionsOutput), args.Error(1)
+}
+
+func (m *mockS3Client) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.GetObjectTaggingOutput), args.Error(1)
+}
+
+func (m *mockS3Client) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.PutObjectTaggingOutput), args.Error(1)
+}
+
+func (m *mockS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	return args.Get(0).(*s3.HeadBucketOutput), args.Error(1)
+}
+
 func TestReadFile(t *testing.T) {
-	type args struct {
-		bucket string
-		key    string
-	}
-	cases := []struct {
-		client         func(t *testing.T) S3API
-		args           args
-		expectData     []byte
-		expectedLength int
-	}{
-		{
-			client: func(t *testing.T) S3API {
-				t.Helper()
-				mockClient := new(mockS3Client)
-
-				mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
-					Bucket: aws.String("fooBucket"),
-					Key:    aws.String("barKey"),
-				}, mock.Anything).Return(&s3.GetObjectOutput{
-					Body:          io.NopCloser(bytes.NewReader(bytes.Repeat([]byte("a"), twoMegabytes))),
-					ContentLength: aws.Int64(twoMegabytes),
-				}, nil).Once()
+	assert := require.New(t)
 
-				return mockClient
-			},
-			args: args{
-				bucket: "fooBucket",
-				key:    "barKey",
-			},
-			expectData:     bytes.Repeat([]byte("a"), twoMegabytes),
-			expectedLength: twoMegabytes,
-		},
-	}
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "barKey", bytes.Repeat([]byte("a"), twoMegabytes))
 
-	for i, tt := range cases {
-		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			assert := require.New(t)
+	srv, client := fakes3.NewServer(backend)
+	defer srv.Close()
 
-			sysfs := NewWithClient(tt.args.bucket, tt.client(t))
+	sysfs := NewWithClient("fooBucket", client)
 
-			data, err := fs.ReadFile(sysfs, tt.args.key)
-			assert.NoError(err)
-			assert.Equal(tt.expectData, data)
-		})
-	}
+	data, err := fs.ReadFile(sysfs, "barKey")
+	assert.NoError(err)
+	assert.Equal(bytes.Repeat([]byte("a"), twoMegabytes), data)
+	assert.Equal(1, backend.Calls("GetObject"))
 }
 
 func TestReadAt(t *testing.T) {
 	type args struct {
-		bucket string
-		key    string
+		size   int
 		offset int64
 	}
 
 	cases := []struct {
 		name           string
-		client         func(t *testing.T) S3API
 		args           args
-		expectData     []byte
 		expectedLength int
 	}{
 		{
-			name: "ReadAt 1024 bytes from a 1024 byte file",
-			client: func(t *testing.T) S3API {
-				t.Helper()
-
-				mockClient := new(mockS3Client)
-
-				mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
-					Bucket: aws.String("fooBucket"),
-					Key:    aws.String("barKey"),
-				}, mock.Anything).Return(&s3.GetObjectOutput{
-					Body:          io.NopCloser(bytes.NewReader(bytes.Repeat([]byte("a"), 1024))),
-					ContentLength: aws.Int64(1024),
-				}, nil).Once()
-
-				mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
-					Bucket: aws.String("fooBucket"),
-					Key:    aws.String("barKey"),
-					Range:  aws.String("bytes=0-1023"),
-				}, mock.Anything).Return(&s3.GetObjectOutput{
-					Body: io.NopCloser(bytes.NewReader(bytes.Repeat([]byte("a"), 1024))),
-				}, nil).Once()
-
-				return mockClient
-			},
-			args: args{
-				bucket: "fooBucket",
-				key:    "barKey",
-				offset: 0,
-			},
-			expectData:     bytes.Repeat([]byte("a"), 1024),
+			name:           "ReadAt 1024 bytes from a 1024 byte file",
+			args:           args{size: 1024, offset: 0},
 			expectedLength: 1024,
 		},
 		{
-			name: "ReadAt 1024 bytes from a 2048 byte file",
-			client: func(t *testing.T) S3API {
-				t.Helper()
-
-				mockClient := new(mockS3Client)
-
-				mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
-					Bucket: aws.String("fooBucket"),
-					Key:    aws.String("barKey"),
-				}, mock.Anything).Return(&s3.GetObjectOutput{
-					ContentLength: aws.Int64(2048),
-					Body:          io.NopCloser(bytes.NewReader(bytes.Repeat([]byte("a"), 1024))),
-				}, nil).Once()
-
-				mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
-					Bucket: aws.String("fooBucket"),
-					Key:    aws.String("barKey"),
-					Range:  aws.String("bytes=1024-2047"),
-				}, mock.Anything).Return(&s3.GetObjectOutput{
-					Body: io.NopCloser(bytes.NewReader(bytes.Repeat([]byte("a"), 1024))),
-				}, nil).Once()
-
-				return mockClient
-			},
-			args: args{
-				bucket: "fooBucket",
-				key:    "barKey",
-				offset: 1024,
-			},
-			expectData:     bytes.Repeat([]byte("a"), 1024),
+			name:           "ReadAt 1024 bytes from a 2048 byte file",
+			args:           args{size: 2048, offset: 1024},
 			expectedLength: 1024,
 		},
 	}
@@ -181,20 +152,28 @@ func TestReadAt(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			assert := require.New(t)
 
-			sysfs := NewWithClient(tt.args.bucket, tt.client(t))
+			content := make([]byte, tt.args.size)
+			for i := range content {
+				content[i] = byte(i)
+			}
+
+			backend := fakes3.New("fooBucket")
+			backend.Put("fooBucket", "barKey", content)
+
+			srv, client := fakes3.NewServer(backend)
+			defer srv.Close()
 
-			f, err := sysfs.Open(tt.args.key)
+			sysfs := NewWithClient("fooBucket", client)
+
+			f, err := sysfs.Open("barKey")
 			assert.NoError(err)
 
 			data := make([]byte, tt.expectedLength)
 
-			if rc, ok := f.(io.ReaderAt); ok {
-
-				n, err := rc.ReadAt(data, tt.args.offset)
-				assert.NoError(err)
-				assert.Equal(tt.expectedLength, n)
-				assert.Equal(tt.expectData, data)
-			}
+			n, err := f.(io.ReaderAt).ReadAt(data, tt.args.offset)
+			assert.NoError(err)
+			assert.Equal(tt.expectedLength, n)
+			assert.Equal(content[tt.args.offset:tt.args.offset+int64(tt.expectedLength)], data)
 		})
 	}
 }
@@ -279,3 +258,534 @@ func TestReadAtInt(t *testing.T) {
 	assert.NoError(err) // assertion fails because we get back io.EOF
 	assert.Equal(1024, n)
 }
+
+// TestS3File_Concurrent mixes operations on shared handles, run with -race to check the handle
+// state is guarded.
+func TestS3File_Concurrent(t *testing.T) {
+	assert := require.New(t)
+
+	content := bytes.Repeat([]byte("0123456789"), 10*1024)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "dir/file.txt", content)
+	for i := 0; i < 20; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("dir/sub/%02d.txt", i), []byte("data"))
+	}
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	f, err := s3fs.OpenObject("dir/file.txt")
+	assert.NoError(err)
+
+	dir, err := s3fs.OpenObject("dir/sub")
+	assert.NoError(err)
+
+	var wg sync.WaitGroup
+
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				fn(i)
+			}
+		}()
+	}
+
+	run(func(i int) {
+		buf := make([]byte, 100)
+		_, _ = f.Read(buf)
+	})
+	run(func(i int) {
+		buf := make([]byte, 10)
+		n, err := f.ReadAt(buf, int64(i*10))
+		if err == nil {
+			assert.Equal(content[i*10:i*10+n], buf[:n])
+		}
+	})
+	run(func(i int) {
+		_, _ = f.Seek(int64(i), io.SeekStart)
+	})
+	run(func(i int) {
+		_ = f.Refresh(context.Background())
+		_ = f.ETag()
+		if info, err := f.Stat(); err == nil {
+			_ = info.Size()
+		}
+	})
+	run(func(i int) {
+		_, _ = dir.ReadDir(5)
+	})
+
+	wg.Wait()
+
+	// close while reads are in progress
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 10)
+		for i := 0; i < 50; i++ {
+			_, _ = f.ReadAt(buf, 0)
+			_, _ = f.Read(buf)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		_ = f.Close()
+		_ = dir.Close()
+	}()
+	wg.Wait()
+
+	_, err = f.Read(make([]byte, 10))
+	assert.ErrorIs(err, fs.ErrClosed)
+
+	_, err = f.ReadAt(make([]byte, 10), 0)
+	assert.ErrorIs(err, fs.ErrClosed)
+
+	_, err = f.Seek(0, io.SeekStart)
+	assert.ErrorIs(err, fs.ErrClosed)
+
+	_, err = dir.ReadDir(-1)
+	assert.ErrorIs(err, fs.ErrClosed)
+
+	assert.ErrorIs(f.Close(), fs.ErrClosed)
+}
+
+func TestS3File_UnknownSize(t *testing.T) {
+	content := []byte("hello world")
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	hasRange := func(prefix string) any {
+		return mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return strings.HasPrefix(aws.ToString(params.Range), prefix)
+		})
+	}
+
+	t.Run("reads until the body ends", func(t *testing.T) {
+		assert := require.New(t)
+
+		// the store leaves the length out of every response
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return params.Range == nil
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(content)),
+		}, nil).Once()
+		mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return params.Range == nil
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(content)),
+		}, nil).Once()
+		mockClient.On("GetObject", mock.Anything, hasRange("bytes=3-"), mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(content[3:])),
+		}, nil).Once()
+		mockClient.On("GetObject", mock.Anything, hasRange("bytes=100-"), mock.Anything).Return((*s3.GetObjectOutput)(nil),
+			&smithy.GenericAPIError{Code: "InvalidRange"}).Once()
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{}, nil)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("file.txt")
+		assert.NoError(err)
+
+		data, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(content, data)
+
+		info, err := f.Stat()
+		assert.NoError(err)
+		assert.Equal(int64(-1), info.Size())
+
+		// the body is opened again from the offset of the seek and read until it ends
+		_, err = f.(io.Seeker).Seek(0, io.SeekStart)
+		assert.NoError(err)
+
+		data, err = io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(content, data)
+
+		_, err = f.(io.Seeker).Seek(3, io.SeekStart)
+		assert.NoError(err)
+
+		data, err = io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(content[3:], data)
+
+		_, err = f.(io.Seeker).Seek(0, io.SeekEnd)
+		assert.ErrorIs(err, fs.ErrInvalid)
+
+		n, err := f.(io.ReaderAt).ReadAt(make([]byte, 4), 100)
+		assert.ErrorIs(err, io.EOF)
+		assert.Zero(n)
+
+		assert.NoError(f.Close())
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("head fills in the size", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(content)),
+		}, nil).Once()
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(int64(len(content))),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("file.txt")
+		assert.NoError(err)
+
+		info, err := f.Stat()
+		assert.NoError(err)
+		assert.Equal(int64(len(content)), info.Size())
+
+		data, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(content, data)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("stat falls back to the listing", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{
+			ETag: aws.String(`"abc123"`),
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("file.txt"), Size: aws.Int64(11), LastModified: aws.Time(modTime)}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		info, err := s3fs.Stat("file.txt")
+		assert.NoError(err)
+		assert.Equal(int64(11), info.Size())
+		assert.Equal(modTime, info.ModTime())
+		assert.Equal(`"abc123"`, info.(File).ETag())
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("listed entries without a size", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir"
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+		}, nil)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir/"
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/file.txt")}},
+		}, nil)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Len(entries, 1)
+		assert.Equal(int64(-1), entries[0].(fs.FileInfo).Size())
+	})
+}
+
+func TestS3File_SeekStreams(t *testing.T) {
+	assert := require.New(t)
+
+	content := make([]byte, twoMegabytes)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "file.bin", content)
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	f, err := s3fs.OpenObject("file.bin")
+	assert.NoError(err)
+	defer f.Close()
+
+	_, err = f.Seek(1024, io.SeekStart)
+	assert.NoError(err)
+
+	backend.ResetCalls()
+
+	// the body is opened once at the offset of the seek and kept for the sequential reads
+	buf := make([]byte, 4096)
+	for offset := 1024; offset < 1024+1024*1024; offset += len(buf) {
+		_, err := io.ReadFull(f, buf)
+		assert.NoError(err)
+		assert.Equal(content[offset:offset+len(buf)], buf)
+	}
+	assert.Equal(1, backend.Calls("GetObject"))
+
+	// a seek to the current offset keeps the body
+	pos, err := f.Seek(0, io.SeekCurrent)
+	assert.NoError(err)
+	assert.Equal(int64(1024+1024*1024), pos)
+
+	_, err = io.ReadFull(f, buf)
+	assert.NoError(err)
+	assert.Equal(content[pos:pos+int64(len(buf))], buf)
+	assert.Equal(1, backend.Calls("GetObject"))
+
+	// ReadAt makes its own ranged requests and doesn't move the offset of the body
+	n, err := f.ReadAt(buf[:10], 0)
+	assert.NoError(err)
+	assert.Equal(10, n)
+	assert.Equal(content[:10], buf[:10])
+	assert.Equal(2, backend.Calls("GetObject"))
+
+	_, err = io.ReadFull(f, buf)
+	assert.NoError(err)
+	assert.Equal(content[pos+4096:pos+8192], buf)
+	assert.Equal(2, backend.Calls("GetObject"))
+
+	// seeking back opens the body again from the new offset
+	_, err = f.Seek(-10, io.SeekEnd)
+	assert.NoError(err)
+
+	data, err := io.ReadAll(f)
+	assert.NoError(err)
+	assert.Equal(content[len(content)-10:], data)
+	assert.Equal(3, backend.Calls("GetObject"))
+}
+
+func TestS3File_ReadAtAndRead(t *testing.T) {
+	content := make([]byte, twoMegabytes)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	// newClient returns a client for the object which expects the eager GetObject of Open followed by
+	// a ranged GetObject for each of the offsets read with ReadAt
+	newClient := func(readAt ...int64) *mockS3Client {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return params.Range == nil
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(content)),
+			ContentLength: aws.Int64(int64(len(content))),
+		}, nil).Once()
+
+		for _, offset := range readAt {
+			mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+				return aws.ToString(params.Range) == fmt.Sprintf("bytes=%d-%d", offset, offset+1023)
+			}), mock.Anything).Return(&s3.GetObjectOutput{
+				Body: io.NopCloser(bytes.NewReader(content[offset : offset+1024])),
+			}, nil).Once()
+		}
+
+		return mockClient
+	}
+
+	readAt := func(assert *require.Assertions, f fs.File, offset int64) {
+		buf := make([]byte, 1024)
+		n, err := f.(io.ReaderAt).ReadAt(buf, offset)
+		assert.NoError(err)
+		assert.Equal(1024, n)
+		assert.Equal(content[offset:offset+1024], buf)
+	}
+
+	read := func(assert *require.Assertions, f fs.File, offset int64) {
+		buf := make([]byte, 4096)
+		_, err := io.ReadFull(f, buf)
+		assert.NoError(err)
+		assert.Equal(content[offset:offset+4096], buf)
+	}
+
+	t.Run("read at then read", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient(1024*1024, 512)
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		readAt(assert, f, 1024*1024)
+		read(assert, f, 0)
+		readAt(assert, f, 512)
+		read(assert, f, 4096)
+
+		pos, err := f.(io.Seeker).Seek(0, io.SeekCurrent)
+		assert.NoError(err)
+		assert.Equal(int64(8192), pos)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("read then read at", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient(twoMegabytes-1024, 0)
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		read(assert, f, 0)
+		readAt(assert, f, twoMegabytes-1024)
+		read(assert, f, 4096)
+		readAt(assert, f, 0)
+
+		// the rest of the file follows on from the last read
+		data, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal(content[8192:], data)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestS3File_ReadAtEOF(t *testing.T) {
+	const size = twoMegabytes
+
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	tests := []struct {
+		name    string
+		offset  int64
+		length  int
+		want    int
+		wantErr error
+		// request is the range requested, empty when no request is made
+		request string
+	}{
+		{name: "interior", offset: 1024, length: 1024, want: 1024, request: "bytes=1024-2047"},
+		{name: "ends at EOF", offset: size - 1024, length: 1024, want: 1024, request: fmt.Sprintf("bytes=%d-%d", size-1024, size-1)},
+		{name: "straddles EOF", offset: size - 100, length: 1024, want: 100, wantErr: io.EOF, request: fmt.Sprintf("bytes=%d-%d", size-100, size-1)},
+		{name: "one byte before EOF", offset: size - 1, length: 1024, want: 1, wantErr: io.EOF, request: fmt.Sprintf("bytes=%d-%d", size-1, size-1)},
+		{name: "exactly at EOF", offset: size, length: 1024, wantErr: io.EOF},
+		{name: "far past EOF", offset: size * 10, length: 1024, wantErr: io.EOF},
+		{name: "empty interior read", offset: 1024, length: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			mockClient := new(mockS3Client)
+			mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+				return params.Range == nil
+			}), mock.Anything).Return(&s3.GetObjectOutput{
+				Body:          io.NopCloser(bytes.NewReader(content)),
+				ContentLength: aws.Int64(size),
+			}, nil).Once()
+
+			if tt.request != "" {
+				start := tt.offset
+				mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+					return aws.ToString(params.Range) == tt.request
+				}), mock.Anything).Return(&s3.GetObjectOutput{
+					Body: io.NopCloser(bytes.NewReader(content[start : start+int64(tt.want)])),
+				}, nil).Once()
+			}
+
+			s3fs := NewWithClient("fooBucket", mockClient)
+
+			f, err := s3fs.OpenObject("file.bin")
+			assert.NoError(err)
+			defer f.Close()
+
+			buf := make([]byte, tt.length)
+			n, err := f.ReadAt(buf, tt.offset)
+			if tt.wantErr != nil {
+				assert.ErrorIs(err, tt.wantErr)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(tt.want, n)
+			if n > 0 {
+				assert.Equal(content[tt.offset:tt.offset+int64(n)], buf[:n])
+			}
+
+			// only the open, and the ranged read if one is expected, are made
+			mockClient.AssertExpectations(t)
+			mockClient.AssertNumberOfCalls(t, "GetObject", len(mockClient.ExpectedCalls))
+		})
+	}
+
+	t.Run("object shorter than its size", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return params.Range == nil
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(bytes.NewReader(content)),
+			ContentLength: aws.Int64(size),
+		}, nil).Once()
+		mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader(content[:10])),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.OpenObject("file.bin")
+		assert.NoError(err)
+		defer f.Close()
+
+		n, err := f.ReadAt(make([]byte, 1024), 0)
+		assert.ErrorIs(err, io.ErrUnexpectedEOF)
+		assert.Equal(10, n)
+	})
+}
+
+func TestS3File_InvalidRange(t *testing.T) {
+	assert := require.New(t)
+
+	content := bytes.Repeat([]byte("a"), 1000)
+
+	// the size of the open is stale, the object has since been truncated so every range is rejected
+	mockClient := new(mockS3Client)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+		return params.Range == nil
+	}), mock.Anything).Return(&s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		ContentLength: aws.Int64(int64(len(content))),
+	}, nil).Once()
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+		return params.Range != nil
+	}), mock.Anything).Return((*s3.GetObjectOutput)(nil), &smithy.GenericAPIError{
+		Code:    "InvalidRange",
+		Message: "The requested range is not satisfiable",
+	})
+
+	s3fs := NewWithClient("fooBucket", mockClient)
+
+	f, err := s3fs.OpenObject("file.txt")
+	assert.NoError(err)
+	defer f.Close()
+
+	n, err := f.ReadAt(make([]byte, 100), 500)
+	assert.Equal(io.EOF, err)
+	assert.Zero(n)
+
+	n, err = io.NewSectionReader(f, 500, 100).Read(make([]byte, 100))
+	assert.Equal(io.EOF, err)
+	assert.Zero(n)
+
+	_, err = f.Seek(500, io.SeekStart)
+	assert.NoError(err)
+
+	n, err = f.Read(make([]byte, 100))
+	assert.Equal(io.EOF, err)
+	assert.Zero(n)
+
+	written, err := f.WriteTo(io.Discard)
+	assert.NoError(err)
+	assert.Zero(written)
+}
@@ -6,21 +6,33 @@ import (
 	"io/fs"
 	"net/url"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"golang.org/x/net/context"
 )
 
 var (
-	_ fs.FS        = (*S3FS)(nil)
-	_ fs.StatFS    = (*S3FS)(nil)
-	_ fs.ReadDirFS = (*S3FS)(nil)
-	_ RemoveFS     = (*S3FS)(nil)
-	_ WriteFileFS  = (*S3FS)(nil)
+	_ fs.FS         = (*S3FS)(nil)
+	_ fs.StatFS     = (*S3FS)(nil)
+	_ fs.ReadDirFS  = (*S3FS)(nil)
+	_ fs.ReadFileFS = (*S3FS)(nil)
+	_ RemoveFS      = (*S3FS)(nil)
+	_ WriteFileFS   = (*S3FS)(nil)
+	_ OpenFileFS    = (*S3FS)(nil)
+	_ RemoveAllFS   = (*S3FS)(nil)
+	_ MkdirAllFS    = (*S3FS)(nil)
+
+	_ RemoveContextFS    = (*S3FS)(nil)
+	_ WriteFileContextFS = (*S3FS)(nil)
 )
 
+// ErrDirectoryNotEmpty is matched by the error returned when Remove is called on a directory which
+// has keys under it.
+var ErrDirectoryNotEmpty = errors.New("directory not empty")
+
 // RemoveFS extend the fs.FS interface to add the Remove method.
 type RemoveFS interface {
 	fs.FS
@@ -33,44 +45,123 @@ type WriteFileFS interface {
 	WriteFile(name string, data []byte, perm os.FileMode) error
 }
 
+// OpenFileFS extend the fs.FS interface to add the OpenFile method.
+type OpenFileFS interface {
+	fs.FS
+	OpenFile(name string, flag int, perm fs.FileMode) (fs.File, error)
+}
+
+// RemoveAllFS extend the fs.FS interface to add the RemoveAll method.
+type RemoveAllFS interface {
+	fs.FS
+	RemoveAll(name string) error
+}
+
+// MkdirAllFS extend the fs.FS interface to add the MkdirAll method.
+type MkdirAllFS interface {
+	fs.FS
+	MkdirAll(path string, perm fs.FileMode) error
+}
+
+// RemoveContextFS extend the RemoveFS interface to add the RemoveContext method, which uses the
+// provided context for the requests made by the remove.
+type RemoveContextFS interface {
+	RemoveFS
+	RemoveContext(ctx context.Context, name string) error
+}
+
+// WriteFileContextFS extend the WriteFileFS interface to add the WriteFileContext method, which uses
+// the provided context for the requests made by the write.
+type WriteFileContextFS interface {
+	WriteFileFS
+	WriteFileContext(ctx context.Context, name string, data []byte, perm os.FileMode) error
+}
+
 // S3FS is a filesystem implementation using S3.
 type S3FS struct {
 	bucket   string
 	s3client S3API
+	opts     fsOptions
+	// ctx is the context bound with WithContext, this is nil unless the filesystem is a view.
+	ctx context.Context
+	// statCache holds the results of Stat, this is nil unless WithStatCache is set.
+	statCache *statCache
+	// blockCache holds the blocks read by ReadAt, this is nil unless WithBlockCache is set.
+	blockCache *blockCache
 }
 
 // New returns a new filesystem which provides access to the specified s3 bucket.
-func New(bucket string, awscfg aws.Config) *S3FS {
+func New(bucket string, awscfg aws.Config, opts ...Option) *S3FS {
 	// Create an Amazon S3 service client
 	client := s3.NewFromConfig(awscfg)
 
-	return &S3FS{
-		s3client: client,
-		bucket:   bucket,
-	}
+	return NewWithClient(bucket, client, opts...)
 }
 
 // NewWithClient returns a new filesystem which provides access to the specified s3 bucket.
-func NewWithClient(bucket string, client S3API) *S3FS {
+func NewWithClient(bucket string, client S3API, opts ...Option) *S3FS {
+	fo := newFSOptions(opts)
+
+	var cache *statCache
+	if fo.statCacheTTL > 0 {
+		cache = newStatCache(fo.statCacheTTL, fo.statCacheEntries)
+	}
+
+	var blocks *blockCache
+	if fo.blockCacheBytes > 0 {
+		blocks = newBlockCache(fo.blockSize, fo.blockCacheBytes)
+	}
+
 	return &S3FS{
-		s3client: client,
-		bucket:   bucket,
+		s3client:   fo.wrapClient(client, cache),
+		bucket:     bucket,
+		opts:       fo,
+		statCache:  cache,
+		blockCache: blocks,
+	}
+}
+
+// WithContext returns a view of the filesystem which uses the context for the requests made by
+// methods without a context parameter, such as those of fs.FS used by fs.WalkDir and fs.ReadFile.
+//
+// Note:
+//   - The view shares the client, bucket and options of the filesystem, so it is cheap to create per request.
+//   - Files opened through the view also use the context for later reads, so it must outlive them.
+func (s3fs *S3FS) WithContext(ctx context.Context) *S3FS {
+	view := *s3fs
+	view.ctx = ctx
+	return &view
+}
+
+func (s3fs *S3FS) context() context.Context {
+	if s3fs.ctx != nil {
+		return s3fs.ctx
 	}
+	return context.Background()
 }
 
-// Open opens the named file.
+// Open opens the named file, the returned fs.File implements File.
 func (s3fs *S3FS) Open(name string) (fs.File, error) {
+	return s3fs.OpenContext(s3fs.context(), name)
+}
+
+// OpenContext opens the named file using the context for the requests made by the open, and by
+// the reads and directory listings of the returned file.
+//
+// Note cancelling the context also cancels reads from the returned file, so the context must outlive it.
+func (s3fs *S3FS) OpenContext(ctx context.Context, name string) (fs.File, error) {
 	if !fs.ValidPath(name) {
 		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrInvalid}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
 	if name == "." {
-		return &s3File{
-			s3client: s3fs.s3client,
-			name:     name,
-			bucket:   s3fs.bucket,
-			mode:     fs.ModeDir,
-		}, nil
+		dir := s3fs.newDirectory(name)
+		dir.ctx = ctx
+		return dir, nil
 	}
 
 	req := &s3.GetObjectInput{
@@ -81,50 +172,234 @@ func (s3fs *S3FS) Open(name string) (fs.File, error) {
 	// optimistic GetObject, with the body setup as the default stream used for reading
 	// the goal here is to avoid subsequent get object calls triggered by small reads as observed
 	// when testing with files larger than 3-5 kilobytes
-	res, err := s3fs.s3client.GetObject(context.TODO(), req)
+	res, err := s3fs.s3client.GetObject(ctx, req)
 	if err != nil {
-		var nfe *types.NotFound
-		if errors.As(err, &nfe) {
+		if isNotFound(err) {
 			// fall back directory list
-			return s3fs.openDirectory(name)
+			return s3fs.openDirectory(ctx, name)
 		}
-		return nil, err
+		return nil, pathError("open", name, err)
+	}
+
+	// the version seen by the open is used by the reads which follow, so they can't drift to a newer one
+	var versionID string
+	if !s3fs.opts.unpinnedReads {
+		versionID = aws.ToString(res.VersionId)
 	}
 
+	return s3fs.newFile(ctx, name, versionID, res), nil
+}
+
+// newFile returns the file opened by the GetObject, with the response body used for reading.
+func (s3fs *S3FS) newFile(ctx context.Context, name, versionID string, res *s3.GetObjectOutput) *s3File {
 	return &s3File{
-		s3client: s3fs.s3client,
-		name:     name,
-		bucket:   s3fs.bucket,
-		size:     aws.ToInt64(res.ContentLength),
-		modTime:  aws.ToTime(res.LastModified),
-		body:     res.Body,
-	}, nil
+		s3client:    s3fs.s3client,
+		ctx:         ctx,
+		name:        name,
+		bucket:      s3fs.bucket,
+		versionID:   versionID,
+		openETag:    aws.ToString(res.ETag),
+		size:        objectSize(res.ContentLength),
+		modTime:     aws.ToTime(res.LastModified),
+		body:        res.Body,
+		download:    s3fs.opts.download,
+		readAhead:   s3fs.opts.readAhead,
+		blocks:      s3fs.blockCache,
+		minRead:     s3fs.opts.minReadSize,
+		readRetries: s3fs.opts.readRetries,
+		unpinned:    s3fs.opts.unpinnedReads,
+
+		etag:                 aws.ToString(res.ETag),
+		contentType:          aws.ToString(res.ContentType),
+		metadata:             lowerMetadata(res.Metadata),
+		serverSideEncryption: string(res.ServerSideEncryption),
+		sseKMSKeyID:          aws.ToString(res.SSEKMSKeyId),
+		bucketKeyEnabled:     aws.ToBool(res.BucketKeyEnabled),
+		expiration:           aws.ToString(res.Expiration),
+	}
 }
 
 // Stat returns a FileInfo describing the file.
 func (s3fs *S3FS) Stat(name string) (fs.FileInfo, error) {
-	f, err := s3fs.stat(name)
+	return s3fs.StatContext(s3fs.context(), name)
+}
+
+// StatContext returns a FileInfo describing the file, using the context for the requests made to s3.
+//
+// Note:
+//   - A HeadObject is tried first, so the FileInfo of a file also carries the ETag, content type and
+//     other metadata of the object.
+//   - When there is no object with the key, the prefix is listed to check for a directory.
+func (s3fs *S3FS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	if info, ok := s3fs.statCache.get(name); ok {
+		return info, nil
+	}
+
+	generation := s3fs.statCache.generation()
+
+	info, err := s3fs.statContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s3fs.statCache.put(name, info, generation)
+
+	return info, nil
+}
+
+// statContext returns the FileInfo of the name from s3, a file is found with a HeadObject and a
+// directory by listing.
+func (s3fs *S3FS) statContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	// a HeadObject finds a file with a single request and carries its metadata, only a missing key
+	// needs the listing to check for a directory
+	if name != "." {
+		res, err := headObject(ctx, s3fs.s3client, s3fs.bucket, "stat", name)
+		if err == nil {
+			f := &s3File{
+				s3client: s3fs.s3client,
+				name:     name,
+				bucket:   s3fs.bucket,
+				size:     sizeUnknown,
+			}
+			f.applyHead(res)
+
+			// some s3 compatible stores leave fields out of the head, the listing may have them
+			if res.ContentLength == nil || res.LastModified == nil {
+				if listed, err := s3fs.stat(ctx, name); err == nil && !listed.IsDir() {
+					f.applyListed(listed)
+				}
+			}
+
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	f, err := s3fs.stat(ctx, name)
 	if err != nil {
-		return nil, &fs.PathError{
-			Op:   "stat",
-			Path: name,
-			Err:  err,
+		return nil, pathError("stat", name, err)
+	}
+
+	if dir, ok := f.(*s3File); ok && dir.IsDir() && dir.dir.modTime {
+		if err := dir.loadDirModTime(ctx); err != nil {
+			return nil, err
 		}
 	}
+
 	return f, nil
 }
 
-// ReadDir reads the named directory.
-func (s3fs *S3FS) ReadDir(name string) ([]fs.DirEntry, error) {
-	f, err := s3fs.stat(name)
+// Exists reports whether the named file or directory exists, without downloading the object.
+//
+// Note:
+//   - A file is checked with a HeadObject, if there is no object a directory is checked by listing
+//     a single key under the prefix.
+//   - A missing name returns false and a nil error, other failures such as denied access are returned.
+func (s3fs *S3FS) Exists(name string) (bool, error) {
+	return s3fs.ExistsContext(s3fs.context(), name)
+}
+
+// ExistsContext reports whether the named file or directory exists, using the context for the
+// requests made to s3.
+func (s3fs *S3FS) ExistsContext(ctx context.Context, name string) (bool, error) {
+	if !fs.ValidPath(name) {
+		return false, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return true, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	if _, ok := s3fs.statCache.get(name); ok {
+		return true, nil
+	}
+
+	_, err := headObject(ctx, s3fs.s3client, s3fs.bucket, "stat", name)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	listRes, err := s3fs.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s3fs.bucket),
+		Prefix:  aws.String(name + "/"),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return false, pathError("stat", name, err)
+	}
+
+	return len(listRes.Contents) > 0 || len(listRes.CommonPrefixes) > 0, nil
+}
+
+// StatObject returns a FileInfo describing the object with exactly the named key, unlike Stat
+// this never reports a prefix as a directory, it returns fs.ErrNotExist if the key is absent.
+//
+// This issues a single HeadObject, so the FileInfo also carries the ETag, content type and
+// encryption settings of the object.
+func (s3fs *S3FS) StatObject(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	res, err := headObject(s3fs.context(), s3fs.s3client, s3fs.bucket, "stat", name)
 	if err != nil {
 		return nil, err
 	}
 
-	if !f.IsDir() {
-		return nil, &fs.PathError{Op: opRead, Path: name, Err: fs.ErrNotExist}
+	f := &s3File{
+		s3client: s3fs.s3client,
+		name:     name,
+		bucket:   s3fs.bucket,
+		size:     sizeUnknown,
+	}
+	f.applyHead(res)
+
+	return f, nil
+}
+
+// ReadDir reads the named directory, returning the entries sorted by name.
+func (s3fs *S3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return s3fs.ReadDirContext(s3fs.context(), name)
+}
+
+// ReadDirContext reads the named directory, using the context for the requests made to s3.
+//
+// Note:
+//   - The directory is listed to the end before the entries are sorted, so this makes one
+//     ListObjectsV2 call per 1000 entries.
+//   - s3 allows a file such as "data" alongside keys under "data/", Stat and Open of the name return
+//     the file while ReadDir lists the keys under the prefix, and the parent lists an entry for each,
+//     so fs.WalkDir visits both the file and the tree below it.
+func (s3fs *S3FS) ReadDirContext(ctx context.Context, name string) ([]fs.DirEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: err}
+	}
+
+	// a cached directory is known to exist, so it doesn't need to be checked
+	f, ok := s3fs.statCache.get(name)
+	if !ok {
+		var err error
+		if f, err = s3fs.stat(ctx, name); err != nil {
+			return nil, err
+		}
 	}
 
+	// a file may share its name with a directory, which is only found by listing it
+	found := f.IsDir()
+
 	prefix, err := url.JoinPath(name, "/")
 	if err != nil {
 		return nil, err
@@ -134,149 +409,430 @@ func (s3fs *S3FS) ReadDir(name string) ([]fs.DirEntry, error) {
 		prefix = ""
 	}
 
-	listRes, err := s3fs.s3client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket:    aws.String(s3fs.bucket),
-		Prefix:    aws.String(prefix),
-		Delimiter: aws.String("/"),
-	})
-	if err != nil {
-		return nil, err
+	input := &s3.ListObjectsV2Input{
+		Bucket:     aws.String(s3fs.bucket),
+		Prefix:     aws.String(prefix),
+		Delimiter:  aws.String("/"),
+		MaxKeys:    s3fs.opts.dir.maxKeys(0),
+		FetchOwner: s3fs.opts.dir.fetchOwner(),
 	}
 
-	return listResToEntries(s3fs.bucket, s3fs.s3client, listRes)
+	// the whole directory is read so the entries can be sorted
+	entries := []fs.DirEntry{}
+
+	for {
+		listRes, err := s3fs.s3client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, pathError(opRead, name, err)
+		}
+
+		page, err := listResToEntries(s3fs.bucket, s3fs.s3client, aws.ToString(input.Prefix), s3fs.opts.dir, listRes)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+
+		// the marker of the directory counts, so an empty directory is found
+		if len(listRes.Contents) > 0 || len(listRes.CommonPrefixes) > 0 {
+			found = true
+		}
+
+		if !aws.ToBool(listRes.IsTruncated) || !found {
+			break
+		}
+
+		input.ContinuationToken = listRes.NextContinuationToken
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: fs.ErrNotExist}
+	}
+
+	sortEntries(entries)
+
+	return entries, nil
+}
+
+// WithStrictRemove makes Remove fail with fs.ErrNotExist when the file doesn't exist, as os.Remove
+// does, rather than returning nil. This costs a HeadObject before each delete.
+//
+// Note a file removed by another caller between the check and the delete is reported as removed.
+func WithStrictRemove() Option {
+	return func(fo *fsOptions) {
+		fo.strictRemove = true
+	}
 }
 
 // Remove removes the named file or directory.
 //
-// Note if the file doesn't exist in the s3 bucket, Remove returns nil.
+// Note:
+//   - If the file doesn't exist in the s3 bucket, Remove returns nil, unless the filesystem was
+//     created with WithStrictRemove.
+//   - A directory with keys under it isn't removed, as with os.Remove this fails with
+//     ErrDirectoryNotEmpty, see RemoveAll.
+//   - The marker object of an empty directory is removed.
 func (s3fs *S3FS) Remove(name string) error {
+	return s3fs.RemoveContext(s3fs.context(), name)
+}
+
+// RemoveContext removes the named file or directory, using the context for the DeleteObject.
+//
+// Note if the context is already done, RemoveContext returns its error without calling s3.
+func (s3fs *S3FS) RemoveContext(ctx context.Context, name string) error {
+	_, err := s3fs.removeResult(ctx, name)
+	return err
+}
+
+// RemoveInfo describes the outcome of a delete in s3.
+type RemoveInfo struct {
+	// DeleteMarkerCreated is true when the delete only added a delete marker to a versioned
+	// bucket, the previous versions of the object are still retained.
+	DeleteMarkerCreated bool
+	// VersionID is the version of the delete marker, or of the version which was removed.
+	VersionID string
+}
+
+// RemoveResult removes the named file and returns the details of the delete returned by s3.
+//
+// Note if the file doesn't exist in the s3 bucket, RemoveResult returns an empty RemoveInfo.
+func (s3fs *S3FS) RemoveResult(name string) (*RemoveInfo, error) {
+	return s3fs.removeResult(s3fs.context(), name)
+}
+
+func (s3fs *S3FS) removeResult(ctx context.Context, name string) (*RemoveInfo, error) {
 	if name == "." {
-		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+		return nil, &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
 	}
 	if name == "" {
-		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+		return nil, &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
 	}
 
-	_, err := s3fs.s3client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+	if err := ctx.Err(); err != nil {
+		return nil, &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	key, err := s3fs.removeKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if s3fs.opts.strictRemove && key == name {
+		if _, err := headObject(ctx, s3fs.s3client, s3fs.bucket, "remove", name); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := s3fs.s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s3fs.bucket),
-		Key:    aws.String(name),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, pathError("remove", name, err)
+	}
+
+	return &RemoveInfo{
+		DeleteMarkerCreated: aws.ToBool(res.DeleteMarker),
+		VersionID:           aws.ToString(res.VersionId),
+	}, nil
+}
+
+// removeKey returns the key deleted by a remove of the named file or directory, this is the marker
+// of an empty directory. A directory with keys under it fails with ErrDirectoryNotEmpty.
+func (s3fs *S3FS) removeKey(ctx context.Context, name string) (string, error) {
+	prefix := strings.TrimSuffix(name, "/") + "/"
+
+	// the marker of the directory is listed before its children, so two keys are needed to find one
+	listRes, err := s3fs.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s3fs.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(2),
 	})
 	if err != nil {
-		return &fs.PathError{Op: "remove", Path: name, Err: err}
+		return "", pathError("remove", name, err)
+	}
+
+	if len(listRes.CommonPrefixes) > 0 {
+		return "", &fs.PathError{Op: "remove", Path: name, Err: ErrDirectoryNotEmpty}
+	}
+
+	key := name
+	for _, obj := range listRes.Contents {
+		if aws.ToString(obj.Key) != prefix {
+			return "", &fs.PathError{Op: "remove", Path: name, Err: ErrDirectoryNotEmpty}
+		}
+		key = prefix
 	}
 
-	return nil
+	return key, nil
 }
 
 // WriteFile writes the data to the named file in s3.
 //
 // Note:
 //   - If the file exists, WriteFile overwrites it.
+//   - Data larger than the multipart threshold is uploaded in parts, see WithMultipartThreshold.
+//   - The Content-Type is detected from the extension of the name, or by sniffing the data, use
+//     WriteFileResult with WithContentType to set it.
 //   - The provided mode is unused by this implementation.
 func (s3fs *S3FS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return s3fs.WriteFileContext(s3fs.context(), name, data, perm)
+}
+
+// WriteFileContext writes the data to the named file in s3, using the context for the PutObject.
+//
+// Note:
+//   - If the file exists, WriteFileContext overwrites it.
+//   - If the context is already done, WriteFileContext returns its error without calling s3.
+//   - The provided mode is unused by this implementation.
+func (s3fs *S3FS) WriteFileContext(ctx context.Context, name string, data []byte, perm os.FileMode) error {
+	_, err := s3fs.writeFileResult(ctx, name, data, perm)
+	return err
+}
+
+// WriteFileResult writes the data to the named file in s3 and returns the metadata
+// of the stored object, this avoids a follow up Stat to discover the ETag or version.
+//
+// Note:
+//   - If the file exists, WriteFileResult overwrites it.
+//   - Data larger than the multipart threshold is uploaded in parts, see WithMultipartThreshold.
+//   - Without WithContentType the Content-Type is detected from the extension of the name, or by
+//     sniffing the first 512 bytes of the data, see WithoutContentTypeDetection.
+//   - The provided mode is unused by this implementation.
+func (s3fs *S3FS) WriteFileResult(name string, data []byte, perm fs.FileMode, opts ...WriteOption) (*UploadResult, error) {
+	return s3fs.writeFileResult(s3fs.context(), name, data, perm, opts...)
+}
+
+func (s3fs *S3FS) writeFileResult(ctx context.Context, name string, data []byte, perm fs.FileMode, opts ...WriteOption) (*UploadResult, error) {
 	if name == "." {
-		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+		return nil, &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
 	}
 	if name == "" {
-		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+		return nil, &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
 	}
 
-	_, err := s3fs.s3client.PutObject(context.TODO(), &s3.PutObjectInput{
+	wo, err := s3fs.newWriteOptions(opts)
+	if err != nil {
+		return nil, &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+
+	if _, err := wo.detectContentType(name, bytes.NewReader(data)); err != nil {
+		return nil, pathError("write", name, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+
+	if int64(len(data)) > s3fs.opts.multipartThreshold {
+		res, err := s3fs.multipartUpload(ctx, name, data, wo)
+		if err != nil {
+			return nil, wo.writeError(name, err)
+		}
+
+		return &UploadResult{
+			Key:       name,
+			ETag:      aws.ToString(res.ETag),
+			VersionID: aws.ToString(res.VersionId),
+		}, nil
+	}
+
+	req := &s3.PutObjectInput{
 		Bucket: aws.String(s3fs.bucket),
 		Key:    aws.String(name),
 		Body:   bytes.NewReader(data),
-	})
+	}
+
+	wo.applyPutObject(req)
 
+	res, err := s3fs.s3client.PutObject(ctx, req, wo.clientOptions()...)
 	if err != nil {
-		return &fs.PathError{Op: "write", Path: name, Err: err}
+		return nil, wo.writeError(name, err)
 	}
 
-	return nil
+	return &UploadResult{
+		Key:       name,
+		ETag:      aws.ToString(res.ETag),
+		VersionID: aws.ToString(res.VersionId),
+	}, nil
 }
 
-func (s3fs *S3FS) stat(name string) (fs.FileInfo, error) {
+func (s3fs *S3FS) stat(ctx context.Context, name string) (fs.FileInfo, error) {
 	if name == "." {
-		return &s3File{
-			name:   name,
-			bucket: s3fs.bucket,
-			mode:   fs.ModeDir,
-		}, nil
+		return s3fs.newDirectory(name), nil
 	}
 
-	list, err := s3fs.s3client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+	list, err := s3fs.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
 		Bucket:    aws.String(s3fs.bucket),
 		Prefix:    aws.String(name),
 		Delimiter: aws.String("/"),
 		MaxKeys:   aws.Int32(1),
 	})
 	if err != nil {
-		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		return nil, statListError(ctx, name, err)
 	}
 
 	if len(list.CommonPrefixes) > 0 &&
 		aws.ToString(list.CommonPrefixes[0].Prefix) == name+"/" {
 
-		return &s3File{
-			name:   name,
-			bucket: s3fs.bucket,
-			mode:   fs.ModeDir,
-		}, nil
+		return s3fs.newDirectory(name), nil
+	}
+
+	// stores which don't roll the marker object of a directory up into a common prefix list it as a key
+	if len(list.Contents) > 0 &&
+		aws.ToString(list.Contents[0].Key) == name+"/" {
+
+		return s3fs.newDirectory(name), nil
 	}
 
 	if len(list.Contents) > 0 &&
 		aws.ToString(list.Contents[0].Key) == name {
 		return &s3File{
-			name:    name,
-			bucket:  s3fs.bucket,
-			size:    aws.ToInt64(list.Contents[0].Size),
-			modTime: aws.ToTime(list.Contents[0].LastModified),
+			s3client: s3fs.s3client,
+			name:     name,
+			bucket:   s3fs.bucket,
+			size:     objectSize(list.Contents[0].Size),
+			modTime:  aws.ToTime(list.Contents[0].LastModified),
 		}, nil
 	}
 
+	// siblings such as "name-other/" sort before "name/", so when the listing was cut short check
+	// for the directory directly
+	if aws.ToBool(list.IsTruncated) {
+		dirList, err := s3fs.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:    aws.String(s3fs.bucket),
+			Prefix:    aws.String(name + "/"),
+			Delimiter: aws.String("/"),
+			MaxKeys:   aws.Int32(1),
+		})
+		if err != nil {
+			return nil, statListError(ctx, name, err)
+		}
+
+		if len(dirList.Contents) > 0 || len(dirList.CommonPrefixes) > 0 {
+			return s3fs.newDirectory(name), nil
+		}
+	}
+
 	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 }
 
-func (s3fs *S3FS) openDirectory(name string) (fs.File, error) {
-	f, err := s3fs.stat(name)
+// statListError returns the error of a failed listing made by stat, a done context, denied access or
+// missing bucket is returned, while other failures are reported as the file not existing.
+func statListError(ctx context.Context, name string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return &fs.PathError{Op: "open", Path: name, Err: ctxErr}
+	}
+
+	if isAccessDenied(err) || errors.Is(err, ErrBucketNotFound) {
+		return pathError("open", name, err)
+	}
+
+	return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// newDirectory returns a directory with the client set, so it can be read with ReadDir.
+func (s3fs *S3FS) newDirectory(name string) *s3File {
+	return &s3File{
+		s3client: s3fs.s3client,
+		name:     name,
+		bucket:   s3fs.bucket,
+		mode:     fs.ModeDir,
+		dir:      s3fs.opts.dir,
+	}
+}
+
+func (s3fs *S3FS) openDirectory(ctx context.Context, name string) (fs.File, error) {
+	f, err := s3fs.stat(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
 	if f.IsDir() {
-		return f.(fs.File), nil
+		dir := f.(*s3File)
+		dir.ctx = ctx
+		return dir, nil
 	}
 
 	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 }
 
-func listResToEntries(bucket string, s3client S3API, listRes *s3.ListObjectsV2Output) ([]fs.DirEntry, error) {
-	entries := []fs.DirEntry{}
+// sortEntries sorts the entries by name, s3 lists keys in order but the common prefix "a/" follows
+// keys such as "a-b" which sort after the directory "a" by name. A file sorts before a directory
+// with the same name, as the key "a" does before "a/".
+func sortEntries(entries []fs.DirEntry) {
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		if c := strings.Compare(a.Name(), b.Name()); c != 0 {
+			return c
+		}
 
-	// common prefixes are directories
-	for _, commonPrefix := range listRes.CommonPrefixes {
+		switch {
+		case a.IsDir() == b.IsDir():
+			return 0
+		case a.IsDir():
+			return 1
+		default:
+			return -1
+		}
+	})
+}
 
-		prefix := aws.ToString(commonPrefix.Prefix)
+// listResToEntries converts a page of the listing of prefix to directory entries, the prefix is
+// passed in rather than read from the response as not every s3 compatible store returns it.
+func listResToEntries(bucket string, s3client S3API, prefix string, dir dirOptions, listRes *s3.ListObjectsV2Output) ([]fs.DirEntry, error) {
+	entries := []fs.DirEntry{}
+
+	// directories are only listed once, even if there is both a prefix and a marker object
+	dirs := map[string]bool{}
 
-		// dir := path.Base(prefix)
+	addDir := func(prefix string) {
+		// the name is the path of the directory, Key adds the trailing slash back
+		name := strings.TrimSuffix(prefix, "/")
+		if dirs[name] {
+			return
+		}
+		dirs[name] = true
 
 		entries = append(entries, &s3File{
 			s3client: s3client,
-			name:     prefix,
+			name:     name,
 			bucket:   bucket,
 			mode:     fs.ModeDir,
+			dir:      dir,
 		})
 	}
 
-	// contents are files
+	// common prefixes are directories
+	for _, commonPrefix := range listRes.CommonPrefixes {
+		addDir(aws.ToString(commonPrefix.Prefix))
+	}
+
+	// contents are files, apart from the zero byte markers written for directories
 	for _, obj := range listRes.Contents {
-		// _, file := path.Split(aws.ToString(obj.Key))
+		key := aws.ToString(obj.Key)
+		if strings.HasSuffix(key, "/") {
+			// the marker of the listed directory isn't an entry of it, on whichever page it appears
+			if key != prefix {
+				addDir(key)
+			}
+			continue
+		}
+
+		if dir.isHidden(key) {
+			continue
+		}
 
 		entries = append(entries, &s3File{
 			s3client: s3client,
-			name:     aws.ToString(obj.Key),
+			name:     key,
 			bucket:   bucket,
-			size:     aws.ToInt64(obj.Size),
+			size:     objectSize(obj.Size),
 			modTime:  aws.ToTime(obj.LastModified),
+			listed:   true,
+
+			etag:         aws.ToString(obj.ETag),
+			storageClass: string(obj.StorageClass),
+			owner:        ownerID(obj.Owner),
 		})
 	}
 
@@ -1,16 +1,24 @@
 package s3iofs
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"path"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
 )
 
 func TestS3FS_Stat(t *testing.T) {
@@ -115,3 +123,1442 @@ func TestS3FS_ReadDirTable(t *testing.T) {
 		})
 	}
 }
+
+func TestS3FS_WriteFileResult(t *testing.T) {
+	assert := require.New(t)
+
+	mockClient := new(mockS3Client)
+
+	mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+		return aws.ToString(params.Bucket) == "fooBucket" && aws.ToString(params.Key) == "barKey"
+	}), mock.Anything).Return(&s3.PutObjectOutput{
+		ETag:      aws.String(`"9a0364b9e99bb480dd25e1f0284c8555"`),
+		VersionId: aws.String("3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY"),
+	}, nil).Once()
+
+	sysfs := NewWithClient("fooBucket", mockClient)
+
+	res, err := sysfs.WriteFileResult("barKey", []byte("content"), 0644)
+	assert.NoError(err)
+	assert.Equal(&UploadResult{
+		Key:       "barKey",
+		ETag:      `"9a0364b9e99bb480dd25e1f0284c8555"`,
+		VersionID: "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY",
+	}, res)
+
+	_, err = sysfs.WriteFileResult("", []byte("content"), 0644)
+	assert.ErrorIs(err, fs.ErrInvalid)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestS3FS_WriteContentType(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+
+	srv, client := fakes3.NewServer(backend)
+	defer srv.Close()
+
+	s3fs := NewWithClient("fooBucket", client)
+
+	tests := []struct {
+		name  string
+		write func(name string, data []byte) error
+	}{
+		{
+			name: "WriteFileResult",
+			write: func(name string, data []byte) error {
+				_, err := s3fs.WriteFileResult(name, data, 0o644)
+				return err
+			},
+		},
+		{
+			name: "WriteFrom",
+			write: func(name string, data []byte) error {
+				// hide the seeker so the sniffed bytes are replayed
+				_, err := s3fs.WriteFrom(name, io.MultiReader(strings.NewReader(string(data))))
+				return err
+			},
+		},
+		{
+			name: "WriteReader",
+			write: func(name string, data []byte) error {
+				return s3fs.WriteReader(name, strings.NewReader(string(data)), int64(len(data)))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			err := tt.write(tt.name+"/style.css", []byte("body {}"))
+			assert.NoError(err)
+			assert.Equal("text/css; charset=utf-8", backend.Get("fooBucket", tt.name+"/style.css").ContentType)
+
+			// without an extension the content is sniffed, and remains intact
+			err = tt.write(tt.name+"/index", []byte("<html><body>hello</body></html>"))
+			assert.NoError(err)
+			obj := backend.Get("fooBucket", tt.name+"/index")
+			assert.Equal("text/html; charset=utf-8", obj.ContentType)
+			assert.Equal("<html><body>hello</body></html>", string(obj.Data))
+		})
+	}
+
+	t.Run("explicit type", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.WriteFileResult("explicit.css", []byte("body {}"), 0o644, WithContentType("text/plain"))
+		assert.NoError(err)
+
+		assert.Equal("text/plain", backend.Get("fooBucket", "explicit.css").ContentType)
+	})
+
+	t.Run("detection disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := s3fs.WriteReader("plain.css", strings.NewReader("body {}"), -1, WithoutContentTypeDetection())
+		assert.NoError(err)
+		// the type is left to s3
+		assert.Equal("application/octet-stream", backend.Get("fooBucket", "plain.css").ContentType)
+	})
+}
+
+func TestS3FS_RemoveResult(t *testing.T) {
+	assert := require.New(t)
+
+	mockClient := new(mockS3Client)
+
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+	mockClient.On("DeleteObject", mock.Anything, &s3.DeleteObjectInput{
+		Bucket: aws.String("fooBucket"),
+		Key:    aws.String("barKey"),
+	}, mock.Anything).Return(&s3.DeleteObjectOutput{
+		DeleteMarker: aws.Bool(true),
+		VersionId:    aws.String("UIORUnfndfiufdisojhr398493jfdkjFJjkndnqUifhnw89493jJFJ"),
+	}, nil).Once()
+
+	sysfs := NewWithClient("fooBucket", mockClient)
+
+	res, err := sysfs.RemoveResult("barKey")
+	assert.NoError(err)
+	assert.Equal(&RemoveInfo{
+		DeleteMarkerCreated: true,
+		VersionID:           "UIORUnfndfiufdisojhr398493jfdkjFJjkndnqUifhnw89493jJFJ",
+	}, res)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestS3FS_OpenDirectoryFallback(t *testing.T) {
+	// GetObject returns NoSuchKey for a missing key, while other implementations vary in the shape
+	// and code of the error
+	missing := map[string]error{
+		"no such key":         &types.NoSuchKey{},
+		"not found":           &types.NotFound{},
+		"generic no such key": operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NoSuchKey"}),
+		"generic not found":   operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NotFound"}),
+	}
+
+	for name, getErr := range missing {
+		t.Run(name, func(t *testing.T) {
+			assert := require.New(t)
+
+			mockClient := new(mockS3Client)
+			mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), getErr).Twice()
+			mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+				return aws.ToString(params.Prefix) == "dir"
+			}), mock.Anything).Return(&s3.ListObjectsV2Output{
+				CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+			}, nil).Once()
+			mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+				return aws.ToString(params.Prefix) == "missing"
+			}), mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+
+			s3fs := NewWithClient("fooBucket", mockClient)
+
+			f, err := s3fs.Open("dir")
+			assert.NoError(err)
+
+			info, err := f.Stat()
+			assert.NoError(err)
+			assert.True(info.IsDir())
+
+			_, err = s3fs.Open("missing")
+			assert.ErrorIs(err, fs.ErrNotExist)
+
+			mockClient.AssertExpectations(t)
+		})
+	}
+
+	t.Run("other errors are returned", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil),
+			operationError(403, "ABC123", &smithy.GenericAPIError{Code: "AccessDenied"})).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		_, err := s3fs.Open("dir")
+		assert.ErrorContains(err, "AccessDenied")
+		assert.NotErrorIs(err, fs.ErrNotExist)
+
+		mockClient.AssertNotCalled(t, "ListObjectsV2", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestS3FS_StrictRemove(t *testing.T) {
+	notFound := operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NotFound"})
+
+	t.Run("lenient remove of a missing file", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+		mockClient.On("DeleteObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		assert.NoError(s3fs.Remove("missing.txt"))
+
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "HeadObject", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("strict remove of a missing file", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadObjectOutput)(nil), notFound).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithStrictRemove())
+
+		err := s3fs.Remove("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("remove", pathErr.Op)
+		assert.Equal("missing.txt", pathErr.Path)
+
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("strict remove of an existing file", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(4)}, nil).Once()
+		mockClient.On("DeleteObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithStrictRemove())
+
+		assert.NoError(s3fs.Remove("exists.txt"))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("file removed between the check and the delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "racy.txt", []byte("data"))
+
+		var raced bool
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "DeleteObject" && !raced {
+				// another caller removes the file first
+				raced = true
+				_, err := backend.DeleteObject(context.Background(), &s3.DeleteObjectInput{Bucket: aws.String("fooBucket"), Key: aws.String("racy.txt")})
+				assert.NoError(err)
+			}
+			return nil
+		}
+
+		for _, opts := range [][]Option{nil, {WithStrictRemove()}} {
+			backend.Put("fooBucket", "racy.txt", []byte("data"))
+			raced = false
+
+			s3fs := NewWithClient("fooBucket", backend, opts...)
+			assert.NoError(s3fs.Remove("racy.txt"))
+			assert.Nil(backend.Get("fooBucket", "racy.txt"))
+		}
+	})
+}
+
+func TestS3FS_RemoveDirectory(t *testing.T) {
+	listPrefix := func(prefix string) any {
+		return mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == prefix && aws.ToString(params.Delimiter) == "/"
+		})
+	}
+
+	deleteKey := func(key string) any {
+		return mock.MatchedBy(func(params *s3.DeleteObjectInput) bool {
+			return aws.ToString(params.Key) == key
+		})
+	}
+
+	t.Run("plain object", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, listPrefix("file.txt/"), mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+		mockClient.On("DeleteObject", mock.Anything, deleteKey("file.txt"), mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		assert.NoError(s3fs.Remove("file.txt"))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("empty directory marker", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, listPrefix("dir/"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/"), Size: aws.Int64(0)}},
+		}, nil).Twice()
+		mockClient.On("DeleteObject", mock.Anything, deleteKey("dir/"), mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Twice()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		assert.NoError(s3fs.Remove("dir"))
+		assert.NoError(s3fs.Remove("dir/"))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("non-empty directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, listPrefix("dir/"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/")}, {Key: aws.String("dir/file.txt")}},
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, listPrefix("implied/"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("implied/sub/")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		for _, name := range []string{"dir", "implied"} {
+			err := s3fs.Remove(name)
+			assert.ErrorIs(err, ErrDirectoryNotEmpty)
+
+			var pathErr *fs.PathError
+			assert.ErrorAs(err, &pathErr)
+			assert.Equal(name, pathErr.Path)
+		}
+
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestS3FS_StatObject(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "exists.txt", []byte("content"))
+	backend.Put("fooBucket", "prefix/child.txt", []byte("child"))
+
+	sysfs := NewWithClient("fooBucket", backend)
+
+	t.Run("key exists", func(t *testing.T) {
+		assert := require.New(t)
+
+		info, err := sysfs.StatObject("exists.txt")
+		assert.NoError(err)
+		assert.Equal("exists.txt", info.Name())
+		assert.Equal(int64(7), info.Size())
+		assert.False(info.IsDir())
+		assert.Equal(backend.Get("fooBucket", "exists.txt").ETag, info.(*s3File).ETag())
+		assert.Equal("binary/octet-stream", info.(*s3File).ContentType())
+	})
+
+	t.Run("only prefix exists", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := sysfs.StatObject("prefix")
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("neither exists", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := sysfs.StatObject("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	require.Equal(t, 0, backend.Calls("ListObjectsV2"))
+	require.Equal(t, 3, backend.Calls("HeadObject"))
+}
+
+type testContextKey struct{}
+
+func TestS3FS_OpenContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), testContextKey{}, "open")
+
+	hasContext := mock.MatchedBy(func(c context.Context) bool {
+		return c.Value(testContextKey{}) == "open"
+	})
+
+	t.Run("context is used by the file", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", hasContext, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return params.Range == nil
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(strings.NewReader("hello world")),
+			ContentLength: aws.Int64(11),
+		}, nil).Once()
+		mockClient.On("GetObject", hasContext, mock.MatchedBy(func(params *s3.GetObjectInput) bool {
+			return aws.ToString(params.Range) == "bytes=6-10"
+		}), mock.Anything).Return(&s3.GetObjectOutput{
+			Body:          io.NopCloser(strings.NewReader("world")),
+			ContentLength: aws.Int64(5),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.OpenContext(ctx, "file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		buf := make([]byte, 5)
+		_, err = f.(io.ReaderAt).ReadAt(buf, 6)
+		assert.NoError(err)
+		assert.Equal("world", string(buf))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("context is used by directories", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", hasContext, mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{}, &types.NoSuchKey{})
+		mockClient.On("ListObjectsV2", hasContext, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", hasContext, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/file.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.OpenContext(ctx, "dir")
+		assert.NoError(err)
+
+		entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+		assert.NoError(err)
+		assert.Len(entries, 1)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := s3fs.OpenContext(cancelled, "file.txt")
+		assert.ErrorIs(err, context.Canceled)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("open", pathErr.Op)
+
+		mockClient.AssertNotCalled(t, "GetObject", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("cancelled while listing", func(t *testing.T) {
+		assert := require.New(t)
+
+		cancelled, cancel := context.WithCancel(ctx)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", hasContext, mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{}, &types.NoSuchKey{})
+		mockClient.On("ListObjectsV2", hasContext, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			cancel()
+		}).Return(&s3.ListObjectsV2Output{}, context.Canceled)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		_, err := s3fs.OpenContext(cancelled, "dir")
+		assert.ErrorIs(err, context.Canceled)
+		assert.NotErrorIs(err, fs.ErrNotExist)
+	})
+}
+
+func TestS3FS_Exists(t *testing.T) {
+	isDirList := mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+		return aws.ToString(params.Prefix) == "dir/" && aws.ToInt32(params.MaxKeys) == 1
+	})
+
+	t.Run("object", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.MatchedBy(func(params *s3.HeadObjectInput) bool {
+			return aws.ToString(params.Key) == "dir/file.txt"
+		}), mock.Anything).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(4)}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		exists, err := s3fs.Exists("dir/file.txt")
+		assert.NoError(err)
+		assert.True(exists)
+
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "GetObject", mock.Anything, mock.Anything, mock.Anything)
+		mockClient.AssertNotCalled(t, "ListObjectsV2", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadObjectOutput)(nil), &types.NotFound{}).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isDirList, mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/sub/file.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		exists, err := s3fs.Exists("dir")
+		assert.NoError(err)
+		assert.True(exists)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadObjectOutput)(nil),
+			operationError(404, "ABC123", &smithy.GenericAPIError{Code: "NotFound"})).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isDirList, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		exists, err := s3fs.Exists("dir")
+		assert.NoError(err)
+		assert.False(exists)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("permission denied", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadObjectOutput)(nil),
+			operationError(403, "ABC123", &smithy.GenericAPIError{Code: "Forbidden"})).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		exists, err := s3fs.Exists("dir/file.txt")
+		assert.ErrorIs(err, fs.ErrPermission)
+		assert.False(exists)
+
+		mockClient.AssertNotCalled(t, "ListObjectsV2", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs := NewWithClient("fooBucket", new(mockS3Client))
+
+		for _, name := range []string{"/dir", "dir/", "../dir", ""} {
+			exists, err := s3fs.Exists(name)
+			assert.ErrorIs(err, fs.ErrInvalid, name)
+			assert.False(exists)
+		}
+
+		exists, err := s3fs.Exists(".")
+		assert.NoError(err)
+		assert.True(exists)
+	})
+}
+
+func TestS3FS_StatHeadObject(t *testing.T) {
+	t.Run("file is a single head", func(t *testing.T) {
+		assert := require.New(t)
+
+		modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.MatchedBy(func(params *s3.HeadObjectInput) bool {
+			return aws.ToString(params.Key) == "dir/file.txt"
+		}), mock.Anything).Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(4),
+			LastModified:  aws.Time(modTime),
+			ETag:          aws.String(`"abc123"`),
+			ContentType:   aws.String("text/plain"),
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		info, err := s3fs.Stat("dir/file.txt")
+		assert.NoError(err)
+		assert.False(info.IsDir())
+		assert.Equal("file.txt", info.Name())
+		assert.Equal(int64(4), info.Size())
+		assert.Equal(modTime, info.ModTime())
+		assert.Equal(`"abc123"`, info.(File).ETag())
+		assert.Equal("text/plain", info.(File).ContentType())
+
+		mockClient.AssertNumberOfCalls(t, "HeadObject", 1)
+		mockClient.AssertNotCalled(t, "ListObjectsV2", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("missing key falls back to the listing", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{}, &types.NotFound{}).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		info, err := s3fs.Stat("dir")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("other errors are returned", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{}, errors.New("access denied")).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		_, err := s3fs.Stat("dir/file.txt")
+		assert.ErrorContains(err, "access denied")
+		assert.NotErrorIs(err, fs.ErrNotExist)
+
+		mockClient.AssertNotCalled(t, "ListObjectsV2", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestS3FS_StatReadDirContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), testContextKey{}, "list")
+
+	hasContext := mock.MatchedBy(func(c context.Context) bool {
+		return c.Value(testContextKey{}) == "list"
+	})
+
+	t.Run("context is used by stat and read dir", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", hasContext, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{}, &types.NotFound{}).Once()
+		mockClient.On("ListObjectsV2", hasContext, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToInt32(params.MaxKeys) == 1
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+		}, nil).Twice()
+		mockClient.On("ListObjectsV2", hasContext, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return params.MaxKeys == nil
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("dir/file.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		info, err := s3fs.StatContext(ctx, "dir")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+
+		entries, err := s3fs.ReadDirContext(ctx, "dir")
+		assert.NoError(err)
+		assert.Len(entries, 1)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", hasContext, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).Return(&s3.HeadObjectOutput{}, context.DeadlineExceeded)
+		mockClient.On("ListObjectsV2", hasContext, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).Return(&s3.ListObjectsV2Output{}, context.DeadlineExceeded)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, err := s3fs.StatContext(timeoutCtx, "dir")
+		assert.ErrorIs(err, context.DeadlineExceeded)
+		assert.NotErrorIs(err, fs.ErrNotExist)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+
+		_, err = s3fs.ReadDirContext(timeoutCtx, "dir")
+		assert.ErrorIs(err, context.DeadlineExceeded)
+		assert.ErrorAs(err, &pathErr)
+	})
+}
+
+func TestS3FS_RemoveWriteFileContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), testContextKey{}, "mutate")
+
+	hasContext := mock.MatchedBy(func(c context.Context) bool {
+		return c.Value(testContextKey{}) == "mutate"
+	})
+
+	t.Run("context is used by remove and write", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("PutObject", hasContext, mock.Anything, mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+		mockClient.On("ListObjectsV2", hasContext, mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil).Once()
+		mockClient.On("DeleteObject", hasContext, mock.Anything, mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+
+		var fsys fs.FS = NewWithClient("fooBucket", mockClient)
+
+		wfs, ok := fsys.(WriteFileContextFS)
+		assert.True(ok)
+		assert.NoError(wfs.WriteFileContext(ctx, "file.txt", []byte("data"), 0o644))
+
+		rfs, ok := fsys.(RemoveContextFS)
+		assert.True(ok)
+		assert.NoError(rfs.RemoveContext(ctx, "file.txt"))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := s3fs.WriteFileContext(cancelled, "file.txt", []byte("data"), 0o644)
+		assert.ErrorIs(err, context.Canceled)
+
+		err = s3fs.RemoveContext(cancelled, "file.txt")
+		assert.ErrorIs(err, context.Canceled)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("remove", pathErr.Op)
+
+		mockClient.AssertNotCalled(t, "PutObject", mock.Anything, mock.Anything, mock.Anything)
+		mockClient.AssertNotCalled(t, "DeleteObject", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestS3FS_WithContext(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	for i := 0; i < 10; i++ {
+		backend.Put("fooBucket", "dir"+strconv.Itoa(i)+"/file.txt", []byte("data"))
+	}
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("view uses the bound context", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx := context.WithValue(context.Background(), testContextKey{}, "view")
+
+		var seen []any
+		backend.OnCall = func(ctx context.Context, op string, input any) error {
+			seen = append(seen, ctx.Value(testContextKey{}))
+			return nil
+		}
+		defer func() { backend.OnCall = nil }()
+
+		view := s3fs.WithContext(ctx)
+
+		data, err := fs.ReadFile(view, "dir0/file.txt")
+		assert.NoError(err)
+		assert.Equal("data", string(data))
+
+		assert.NoError(view.WriteFile("written.txt", []byte("data"), 0o644))
+		assert.NoError(view.Remove("written.txt"))
+
+		assert.NotEmpty(seen)
+		for _, v := range seen {
+			assert.Equal("view", v)
+		}
+
+		// the original filesystem is unchanged, the stat of a directory is a head and a listing
+		seen = nil
+		_, err = s3fs.Stat("dir0")
+		assert.NoError(err)
+		assert.Equal([]any{nil, nil}, seen)
+	})
+
+	t.Run("cancel during walk", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		lists := 0
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			if op == "ListObjectsV2" {
+				lists++
+				if lists == 4 {
+					cancel()
+				}
+			}
+			return nil
+		}
+		defer func() { backend.OnCall = nil }()
+
+		var visited []string
+		err := fs.WalkDir(s3fs.WithContext(ctx), ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			visited = append(visited, path)
+			return nil
+		})
+		assert.ErrorIs(err, context.Canceled)
+		assert.NotContains(visited, "dir9/file.txt")
+	})
+}
+
+func TestS3FS_OpenDirectory(t *testing.T) {
+	isStat := mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+		return aws.ToString(params.Prefix) == "a/b" && aws.ToInt32(params.MaxKeys) == 1
+	})
+	isList := func(maxKeys int32, token string) any {
+		return mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "a/b/" &&
+				aws.ToInt32(params.MaxKeys) == maxKeys &&
+				aws.ToString(params.ContinuationToken) == token
+		})
+	}
+
+	newClient := func() *mockS3Client {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{}, &types.NoSuchKey{})
+		mockClient.On("ListObjectsV2", mock.Anything, isStat, mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("a/b/")}},
+		}, nil)
+		return mockClient
+	}
+
+	t.Run("read all", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		mockClient.On("ListObjectsV2", mock.Anything, isList(0, ""), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("a/b/c/")}},
+			Contents:       []types.Object{{Key: aws.String("a/b/file.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("a/b")
+		assert.NoError(err)
+		defer f.Close()
+
+		dir, ok := f.(fs.ReadDirFile)
+		assert.True(ok)
+
+		entries, err := dir.ReadDir(0)
+		assert.NoError(err)
+		assert.Equal([]string{"c", "file.txt"}, entryNames(entries))
+
+		entries, err = dir.ReadDir(0)
+		assert.NoError(err)
+		assert.Empty(entries)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("read all follows truncated pages", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		mockClient.On("ListObjectsV2", mock.Anything, isList(0, ""), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes:        []types.CommonPrefix{{Prefix: aws.String("a/b/d/")}},
+			Contents:              []types.Object{{Key: aws.String("a/b/file1.txt")}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("token"),
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isList(0, "token"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("a/b/c/")}},
+			Contents:       []types.Object{{Key: aws.String("a/b/file2.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("a/b")
+		assert.NoError(err)
+		defer f.Close()
+
+		entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+		assert.NoError(err)
+		// the prefixes and objects of both pages are merged in name order
+		assert.Equal([]string{"c", "d", "file1.txt", "file2.txt"}, entryNames(entries))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("page size one", func(t *testing.T) {
+		assert := require.New(t)
+
+		// the first page only holds the marker of the directory
+		mockClient := newClient()
+		mockClient.On("ListObjectsV2", mock.Anything, isList(1, ""), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents:              []types.Object{{Key: aws.String("a/b/")}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("token1"),
+		}, nil).Once()
+		for i, sub := range []string{"c", "d", "e"} {
+			out := &s3.ListObjectsV2Output{
+				CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("a/b/" + sub + "/")}},
+			}
+			if i < 2 {
+				out.IsTruncated = aws.Bool(true)
+				out.NextContinuationToken = aws.String(fmt.Sprintf("token%d", i+2))
+			}
+			mockClient.On("ListObjectsV2", mock.Anything, isList(1, fmt.Sprintf("token%d", i+1)), mock.Anything).Return(out, nil).Once()
+		}
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("a/b")
+		assert.NoError(err)
+		defer f.Close()
+
+		dir := f.(fs.ReadDirFile)
+
+		var names []string
+		for {
+			entries, err := dir.ReadDir(1)
+			if err == io.EOF {
+				assert.Empty(entries)
+				break
+			}
+			assert.NoError(err)
+			assert.Len(entries, 1)
+			names = append(names, entries[0].Name())
+		}
+		assert.Equal([]string{"c", "d", "e"}, names)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("read in pages", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		mockClient.On("ListObjectsV2", mock.Anything, isList(1, ""), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes:        []types.CommonPrefix{{Prefix: aws.String("a/b/c/")}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("token"),
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isList(1, "token"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("a/b/file.txt")}},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("a/b")
+		assert.NoError(err)
+		defer f.Close()
+
+		dir := f.(fs.ReadDirFile)
+
+		entries, err := dir.ReadDir(1)
+		assert.NoError(err)
+		assert.Equal([]string{"c"}, entryNames(entries))
+
+		entries, err = dir.ReadDir(1)
+		assert.NoError(err)
+		assert.Equal([]string{"file.txt"}, entryNames(entries))
+
+		_, err = dir.ReadDir(1)
+		assert.ErrorIs(err, io.EOF)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestS3FS_ReadDirTruncated(t *testing.T) {
+	assert := require.New(t)
+
+	isList := func(token string) any {
+		return mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir/" && aws.ToString(params.ContinuationToken) == token
+		})
+	}
+
+	// a full first page of 1000 entries, split between prefixes and objects
+	var (
+		firstPrefixes []types.CommonPrefix
+		firstContents []types.Object
+	)
+	for i := 0; i < 500; i++ {
+		firstPrefixes = append(firstPrefixes, types.CommonPrefix{Prefix: aws.String(fmt.Sprintf("dir/sub%04d/", i))})
+		firstContents = append(firstContents, types.Object{Key: aws.String(fmt.Sprintf("dir/file%04d.txt", i))})
+	}
+
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+		return aws.ToString(params.Prefix) == "dir"
+	}), mock.Anything).Return(&s3.ListObjectsV2Output{
+		CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+	}, nil).Once()
+	mockClient.On("ListObjectsV2", mock.Anything, isList(""), mock.Anything).Return(&s3.ListObjectsV2Output{
+		CommonPrefixes:        firstPrefixes,
+		Contents:              firstContents,
+		IsTruncated:           aws.Bool(true),
+		NextContinuationToken: aws.String("token"),
+	}, nil).Once()
+	mockClient.On("ListObjectsV2", mock.Anything, isList("token"), mock.Anything).Return(&s3.ListObjectsV2Output{
+		CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/sub0500/")}},
+		Contents:       []types.Object{{Key: aws.String("dir/file0500.txt")}},
+	}, nil).Once()
+
+	s3fs := NewWithClient("fooBucket", mockClient)
+
+	entries, err := s3fs.ReadDir("dir")
+	assert.NoError(err)
+	assert.Len(entries, 1002)
+
+	var dirs int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs++
+		}
+	}
+	assert.Equal(501, dirs)
+	assert.Equal("file0500.txt", entries[500].Name())
+	assert.Equal("sub0500", entries[1001].Name())
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestS3FS_ReadDirSorted(t *testing.T) {
+	assert := require.New(t)
+
+	mockClient := new(mockS3Client)
+	mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+		return aws.ToString(params.Prefix) == "dir"
+	}), mock.Anything).Return(&s3.ListObjectsV2Output{
+		CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+	}, nil).Once()
+	// s3 lists the common prefixes apart from the objects, so "zeta" comes before "alpha.txt"
+	mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+		return aws.ToString(params.Prefix) == "dir/"
+	}), mock.Anything).Return(&s3.ListObjectsV2Output{
+		CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/beta/")}, {Prefix: aws.String("dir/zeta/")}},
+		Contents:       []types.Object{{Key: aws.String("dir/alpha.txt")}, {Key: aws.String("dir/gamma.txt")}},
+	}, nil).Once()
+
+	s3fs := NewWithClient("fooBucket", mockClient)
+
+	entries, err := s3fs.ReadDir("dir")
+	assert.NoError(err)
+	assert.Equal([]string{"alpha.txt", "beta", "gamma.txt", "zeta"}, entryNames(entries))
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestS3FS_WalkDirEntryNames(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	for _, key := range []string{"a/b/c/deep.txt", "a/b/file.txt", "a/top.txt", "root.txt"} {
+		backend.Put("fooBucket", key, []byte("data"))
+	}
+	backend.Put("fooBucket", "a/empty/", nil)
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	var visited []string
+	err := fs.WalkDir(s3fs, ".", func(name string, d fs.DirEntry, err error) error {
+		assert.NoError(err)
+		visited = append(visited, name)
+
+		if name == "." {
+			return nil
+		}
+
+		assert.Equal(path.Base(name), d.Name())
+
+		f, err := s3fs.Open(name)
+		assert.NoError(err, name)
+		defer f.Close()
+
+		info, err := f.Stat()
+		assert.NoError(err)
+		assert.Equal(d.IsDir(), info.IsDir(), name)
+
+		entryInfo, err := d.Info()
+		assert.NoError(err)
+		assert.Equal(d.Name(), entryInfo.Name())
+
+		file, ok := d.(File)
+		assert.True(ok)
+		if d.IsDir() {
+			assert.Equal(name+"/", file.Key())
+			assert.Equal(name, d.(*s3File).name)
+		} else {
+			assert.Equal(name, file.Key())
+		}
+
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{
+		".", "a", "a/b", "a/b/c", "a/b/c/deep.txt", "a/b/file.txt", "a/empty", "a/top.txt", "root.txt",
+	}, visited)
+}
+
+func TestS3FS_DirectoryMarkers(t *testing.T) {
+	t.Run("markers in a listing are directories", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir"
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/")}},
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "dir/"
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Prefix:         aws.String("dir/"),
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("dir/sub/")}},
+			Contents: []types.Object{
+				{Key: aws.String("dir/"), Size: aws.Int64(0)},
+				{Key: aws.String("dir/bare/"), Size: aws.Int64(0)},
+				{Key: aws.String("dir/file.txt"), Size: aws.Int64(4)},
+				{Key: aws.String("dir/sub/"), Size: aws.Int64(0)},
+			},
+		}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Equal([]string{"bare", "file.txt", "sub"}, entryNames(entries))
+		assert.True(entries[0].IsDir())
+		assert.False(entries[1].IsDir())
+		assert.True(entries[2].IsDir())
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("marker only directory listed as a key", func(t *testing.T) {
+		assert := require.New(t)
+
+		// some stores list the marker "reports/" as a key rather than rolling it up into a prefix
+		mockClient := new(mockS3Client)
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{}, &types.NotFound{})
+		mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{}, &types.NoSuchKey{})
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "reports"
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("reports/"), Size: aws.Int64(0)}},
+		}, nil)
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "reports/"
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("reports/"), Size: aws.Int64(0)}},
+		}, nil)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		info, err := s3fs.Stat("reports")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+		assert.Equal(fs.ModeDir, info.Mode().Type())
+
+		f, err := s3fs.Open("reports")
+		assert.NoError(err)
+
+		entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+		assert.NoError(err)
+		assert.NotNil(entries)
+		assert.Empty(entries)
+		assert.NoError(f.Close())
+
+		entries, err = s3fs.ReadDir("reports")
+		assert.NoError(err)
+		assert.NotNil(entries)
+		assert.Empty(entries)
+	})
+
+	t.Run("walk sees each directory once", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "a/", nil)
+		backend.Put("fooBucket", "a/b/", nil)
+		backend.Put("fooBucket", "a/b/file.txt", []byte("data"))
+		backend.Put("fooBucket", "a/c/file.txt", []byte("data"))
+		backend.Put("fooBucket", "empty/", nil)
+		backend.Put("fooBucket", "file.txt", []byte("data"))
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		var dirs, files []string
+		err := fs.WalkDir(s3fs, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				dirs = append(dirs, name)
+			} else {
+				files = append(files, name)
+			}
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([]string{".", "a", "a/b", "a/c", "empty"}, dirs)
+		assert.Equal([]string{"a/b/file.txt", "a/c/file.txt", "file.txt"}, files)
+
+		for _, name := range []string{"a", "a/b", "empty"} {
+			info, err := s3fs.Stat(name)
+			assert.NoError(err)
+			assert.True(info.IsDir(), name)
+
+			f, err := s3fs.Open(name)
+			assert.NoError(err)
+
+			entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+			assert.NoError(err)
+			for _, entry := range entries {
+				assert.NotEmpty(entry.Name())
+			}
+			assert.NoError(f.Close())
+		}
+	})
+}
+
+func TestS3FS_ReadDirSkipsSelf(t *testing.T) {
+	isList := func(token string) any {
+		return mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "photos/" && aws.ToString(params.ContinuationToken) == token
+		})
+	}
+
+	// the response doesn't echo the prefix, and the marker is on the second page
+	newClient := func() *mockS3Client {
+		mockClient := new(mockS3Client)
+		mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), &types.NoSuchKey{}).Maybe()
+		mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(params *s3.ListObjectsV2Input) bool {
+			return aws.ToString(params.Prefix) == "photos"
+		}), mock.Anything).Return(&s3.ListObjectsV2Output{
+			CommonPrefixes: []types.CommonPrefix{{Prefix: aws.String("photos/")}},
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isList(""), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents:              []types.Object{{Key: aws.String("photos/a.jpg")}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("token"),
+		}, nil).Once()
+		mockClient.On("ListObjectsV2", mock.Anything, isList("token"), mock.Anything).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{{Key: aws.String("photos/")}, {Key: aws.String("photos/b.jpg")}},
+		}, nil).Once()
+		return mockClient
+	}
+
+	t.Run("read dir", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		entries, err := s3fs.ReadDir("photos")
+		assert.NoError(err)
+		assert.Equal([]string{"a.jpg", "b.jpg"}, entryNames(entries))
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("open directory", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := newClient()
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		f, err := s3fs.Open("photos")
+		assert.NoError(err)
+		defer f.Close()
+
+		entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+		assert.NoError(err)
+		assert.Equal([]string{"a.jpg", "b.jpg"}, entryNames(entries))
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestS3FS_ReadDirLargePages(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	for i := 0; i < 2500; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("dir/file%04d.txt", i), []byte("data"))
+	}
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	f, err := s3fs.Open("dir")
+	assert.NoError(err)
+	defer f.Close()
+
+	dir := f.(fs.ReadDirFile)
+
+	backend.ResetCalls()
+
+	entries, err := dir.ReadDir(2000)
+	assert.NoError(err)
+	assert.Len(entries, 2000)
+	assert.Equal("file1999.txt", entries[1999].Name())
+	// s3 returns at most 1000 keys a page
+	assert.Equal(2, backend.Calls("ListObjectsV2"))
+
+	entries, err = dir.ReadDir(2000)
+	assert.NoError(err)
+	assert.Len(entries, 500)
+	assert.Equal("file2000.txt", entries[0].Name())
+
+	entries, err = dir.ReadDir(2000)
+	assert.ErrorIs(err, io.EOF)
+	assert.Empty(entries)
+}
+
+func TestS3FS_DirectoryModTime(t *testing.T) {
+	oldest := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "root.txt", []byte("data")).LastModified = oldest
+	backend.Put("fooBucket", "dir/old.txt", []byte("data")).LastModified = oldest
+	backend.Put("fooBucket", "dir/new.txt", []byte("data")).LastModified = newest
+	// only the immediate children count
+	backend.Put("fooBucket", "dir/sub/nested.txt", []byte("data")).LastModified = newest.Add(time.Hour)
+
+	t.Run("newest child", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs := NewWithClient("fooBucket", backend, WithDirectoryModTime())
+
+		info, err := s3fs.Stat("dir")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+		assert.Equal(newest, info.ModTime())
+
+		info, err = s3fs.Stat(".")
+		assert.NoError(err)
+		assert.Equal(oldest, info.ModTime())
+
+		f, err := s3fs.Open(".")
+		assert.NoError(err)
+		defer f.Close()
+
+		info, err = f.Stat()
+		assert.NoError(err)
+		assert.Equal(oldest, info.ModTime())
+
+		entries, err := s3fs.ReadDir(".")
+		assert.NoError(err)
+		assert.Equal([]string{"dir", "root.txt"}, entryNames(entries))
+
+		backend.ResetCalls()
+
+		info, err = entries[0].Info()
+		assert.NoError(err)
+		assert.Equal(newest, info.ModTime())
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+
+		// the time is only loaded once
+		_, err = entries[0].Info()
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		info, err := s3fs.Stat("dir")
+		assert.NoError(err)
+		assert.True(info.ModTime().IsZero())
+
+		entries, err := s3fs.ReadDir(".")
+		assert.NoError(err)
+
+		info, err = entries[0].Info()
+		assert.NoError(err)
+		assert.True(info.ModTime().IsZero())
+	})
+}
+
+func TestS3FS_FileAndDirectorySameName(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "data", []byte("file"))
+	backend.Put("fooBucket", "data/a.txt", []byte("a"))
+	backend.Put("fooBucket", "data/sub/b.txt", []byte("b"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	info, err := s3fs.Stat("data")
+	assert.NoError(err)
+	assert.False(info.IsDir())
+	assert.Equal(int64(4), info.Size())
+
+	data, err := fs.ReadFile(s3fs, "data")
+	assert.NoError(err)
+	assert.Equal("file", string(data))
+
+	entries, err := s3fs.ReadDir("data")
+	assert.NoError(err)
+	assert.Equal([]string{"a.txt", "sub"}, entryNames(entries))
+
+	_, err = s3fs.ReadDir("data/a.txt")
+	assert.ErrorIs(err, fs.ErrNotExist)
+
+	var walked []string
+	err = fs.WalkDir(s3fs, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name += "/"
+		}
+		walked = append(walked, name)
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"./", "data", "data/", "data/a.txt", "data/sub/", "data/sub/b.txt"}, walked)
+}
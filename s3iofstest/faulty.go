@@ -0,0 +1,304 @@
+// Package s3iofstest provides helpers for testing code which uses s3iofs.
+package s3iofstest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/wolfeidau/s3iofs"
+)
+
+var (
+	_ s3iofs.S3API    = (*FaultyClient)(nil)
+	_ smithy.APIError = (*FaultError)(nil)
+)
+
+// Fault describes the faults injected into calls to an operation, rates are probabilities between 0 and 1.
+type Fault struct {
+	// ErrorRate is the rate at which calls fail with an InternalError.
+	ErrorRate float64
+	// SlowDownRate is the rate at which calls fail with a SlowDown error, as returned when s3 throttles requests.
+	SlowDownRate float64
+	// TruncateRate is the rate at which GetObject bodies end early with io.ErrUnexpectedEOF, it is
+	// ignored for other operations.
+	TruncateRate float64
+	// Latency is added to every call.
+	Latency time.Duration
+}
+
+// FaultPlan describes the faults injected by a FaultyClient.
+type FaultPlan struct {
+	// Seed seeds the random source used to decide which calls fail, a plan with the same seed
+	// injects the same faults given the same sequence of calls.
+	Seed int64
+	// Default is used for operations which don't have an entry in Operations.
+	Default Fault
+	// Operations holds the faults for each operation keyed by name, such as "GetObject".
+	Operations map[string]Fault
+}
+
+func (p FaultPlan) fault(op string) Fault {
+	if f, ok := p.Operations[op]; ok {
+		return f
+	}
+	return p.Default
+}
+
+// FaultError is returned by calls which fail due to an injected fault, it implements smithy.APIError
+// so it is handled the same way as an error returned by s3.
+type FaultError struct {
+	Op   string
+	Code string
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("%s: injected fault: %s", e.Op, e.Code)
+}
+
+// ErrorCode returns the s3 error code of the fault.
+func (e *FaultError) ErrorCode() string {
+	return e.Code
+}
+
+// ErrorMessage returns the message of the fault.
+func (e *FaultError) ErrorMessage() string {
+	return "injected fault"
+}
+
+// ErrorFault returns the party at fault, which is the server for injected faults.
+func (e *FaultError) ErrorFault() smithy.ErrorFault {
+	return smithy.FaultServer
+}
+
+// FaultyClient wraps an S3API and injects faults into the calls according to a FaultPlan, this is used
+// to test the behaviour of code using S3FS when s3 is unreliable.
+//
+// Note calls made concurrently draw from the random source in the order they arrive, so only
+// sequential use is fully deterministic.
+type FaultyClient struct {
+	inner s3iofs.S3API
+	plan  FaultPlan
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	injected map[string]int
+}
+
+// NewFaultyClient returns a client which calls inner, injecting faults as described by the plan.
+func NewFaultyClient(inner s3iofs.S3API, plan FaultPlan) *FaultyClient {
+	return &FaultyClient{
+		inner:    inner,
+		plan:     plan,
+		rnd:      rand.New(rand.NewSource(plan.Seed)),
+		injected: map[string]int{},
+	}
+}
+
+// Injected returns the number of faults injected into calls to the operation.
+func (c *FaultyClient) Injected(op string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.injected[op]
+}
+
+// roll reports whether an event with the given rate occurs, recording the fault if it does.
+func (c *FaultyClient) roll(op string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rnd.Float64() >= rate {
+		return false
+	}
+
+	c.injected[op]++
+
+	return true
+}
+
+// inject applies the latency then returns an error if the call should fail.
+func (c *FaultyClient) inject(ctx context.Context, op string) error {
+	fault := c.plan.fault(op)
+
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if c.roll(op, fault.SlowDownRate) {
+		return &FaultError{Op: op, Code: "SlowDown"}
+	}
+
+	if c.roll(op, fault.ErrorRate) {
+		return &FaultError{Op: op, Code: "InternalError"}
+	}
+
+	return nil
+}
+
+func (c *FaultyClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := c.inject(ctx, "GetObject"); err != nil {
+		return nil, err
+	}
+
+	res, err := c.inner.GetObject(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.roll("GetObject", c.plan.fault("GetObject").TruncateRate) {
+		c.mu.Lock()
+		n := c.rnd.Int63n(max(1, aws.ToInt64(res.ContentLength)))
+		c.mu.Unlock()
+
+		res.Body = &truncatedBody{body: res.Body, remaining: n}
+	}
+
+	return res, nil
+}
+
+func (c *FaultyClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if err := c.inject(ctx, "ListObjectsV2"); err != nil {
+		return nil, err
+	}
+	return c.inner.ListObjectsV2(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := c.inject(ctx, "HeadObject"); err != nil {
+		return nil, err
+	}
+	return c.inner.HeadObject(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := c.inject(ctx, "DeleteObject"); err != nil {
+		return nil, err
+	}
+	return c.inner.DeleteObject(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := c.inject(ctx, "PutObject"); err != nil {
+		return nil, err
+	}
+	return c.inner.PutObject(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if err := c.inject(ctx, "CopyObject"); err != nil {
+		return nil, err
+	}
+	return c.inner.CopyObject(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	if err := c.inject(ctx, "DeleteObjects"); err != nil {
+		return nil, err
+	}
+	return c.inner.DeleteObjects(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if err := c.inject(ctx, "CreateMultipartUpload"); err != nil {
+		return nil, err
+	}
+	return c.inner.CreateMultipartUpload(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if err := c.inject(ctx, "UploadPart"); err != nil {
+		return nil, err
+	}
+	return c.inner.UploadPart(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	if err := c.inject(ctx, "UploadPartCopy"); err != nil {
+		return nil, err
+	}
+	return c.inner.UploadPartCopy(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := c.inject(ctx, "CompleteMultipartUpload"); err != nil {
+		return nil, err
+	}
+	return c.inner.CompleteMultipartUpload(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if err := c.inject(ctx, "AbortMultipartUpload"); err != nil {
+		return nil, err
+	}
+	return c.inner.AbortMultipartUpload(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if err := c.inject(ctx, "ListObjectVersions"); err != nil {
+		return nil, err
+	}
+	return c.inner.ListObjectVersions(ctx, params, optFns...)
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF after remaining bytes, as happens when a connection drops.
+type truncatedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return b.body.Close()
+}
+
+func (c *FaultyClient) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	if err := c.inject(ctx, "GetObjectTagging"); err != nil {
+		return nil, err
+	}
+	return c.inner.GetObjectTagging(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	if err := c.inject(ctx, "PutObjectTagging"); err != nil {
+		return nil, err
+	}
+	return c.inner.PutObjectTagging(ctx, params, optFns...)
+}
+
+func (c *FaultyClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if err := c.inject(ctx, "HeadBucket"); err != nil {
+		return nil, err
+	}
+	return c.inner.HeadBucket(ctx, params, optFns...)
+}
@@ -0,0 +1,159 @@
+package s3iofstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestFaultyClient(t *testing.T) {
+	t.Run("faults are deterministic", func(t *testing.T) {
+		assert := require.New(t)
+
+		plan := FaultPlan{Seed: 42, Default: Fault{ErrorRate: 0.5}}
+
+		failures := func() []bool {
+			client := NewFaultyClient(fakes3.New("fooBucket"), plan)
+
+			var res []bool
+			for i := 0; i < 20; i++ {
+				_, err := client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{Bucket: aws.String("fooBucket")})
+				res = append(res, err != nil)
+			}
+			return res
+		}
+
+		first := failures()
+		assert.Equal(first, failures())
+		assert.Contains(first, true)
+		assert.Contains(first, false)
+	})
+
+	t.Run("slow down", func(t *testing.T) {
+		assert := require.New(t)
+
+		client := NewFaultyClient(fakes3.New("fooBucket"), FaultPlan{
+			Operations: map[string]Fault{"PutObject": {SlowDownRate: 1}},
+		})
+
+		s3fs := s3iofs.NewWithClient("fooBucket", client)
+
+		err := s3fs.WriteFile("file.txt", []byte("data"), 0644)
+
+		var apiErr smithy.APIError
+		assert.ErrorAs(err, &apiErr)
+		assert.Equal("SlowDown", apiErr.ErrorCode())
+		assert.Equal(1, client.Injected("PutObject"))
+
+		// other operations are unaffected
+		_, err = s3fs.ReadDir(".")
+		assert.NoError(err)
+	})
+
+	t.Run("truncated bodies", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "file.txt", make([]byte, 4096))
+
+		client := NewFaultyClient(backend, FaultPlan{
+			Operations: map[string]Fault{"GetObject": {TruncateRate: 1}},
+		})
+
+		s3fs := s3iofs.NewWithClient("fooBucket", client)
+
+		_, err := fs.ReadFile(s3fs, "file.txt")
+		assert.ErrorIs(err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("latency respects the context", func(t *testing.T) {
+		assert := require.New(t)
+
+		client := NewFaultyClient(fakes3.New("fooBucket"), FaultPlan{Default: Fault{Latency: time.Minute}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("fooBucket"), Key: aws.String("file.txt")})
+		assert.ErrorIs(err, context.DeadlineExceeded)
+	})
+}
+
+func TestRenameAllWithFaults(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			assert := require.New(t)
+
+			backend := fakes3.New("fooBucket")
+
+			var keys []string
+			for i := 0; i < 50; i++ {
+				key := fmt.Sprintf("%02d.txt", i)
+				keys = append(keys, key)
+				backend.Put("fooBucket", "src/"+key, []byte(key))
+			}
+
+			client := NewFaultyClient(backend, FaultPlan{
+				Seed: seed,
+				Operations: map[string]Fault{
+					"CopyObject":    {ErrorRate: 0.05},
+					"DeleteObjects": {ErrorRate: 0.2},
+				},
+			})
+
+			s3fs := s3iofs.NewWithClient("fooBucket", client)
+
+			err := s3fs.RenameAll(context.Background(), "src", "dst", s3iofs.WithBulkConcurrency(1))
+
+			var renameErr *s3iofs.RenameError
+			if err != nil {
+				assert.ErrorAs(err, &renameErr)
+			} else {
+				renameErr = &s3iofs.RenameError{}
+			}
+
+			untouched := map[string]bool{}
+			for _, key := range renameErr.Untouched {
+				untouched[key] = true
+			}
+
+			notDeleted := map[string]bool{}
+			for _, key := range renameErr.CopiedNotDeleted {
+				notDeleted[key] = true
+			}
+
+			// every key is reported in the state it was left in
+			for _, key := range keys {
+				src := backend.Get("fooBucket", "src/"+key)
+				dst := backend.Get("fooBucket", "dst/"+key)
+
+				switch {
+				case untouched["src/"+key]:
+					assert.NotNil(src, key)
+				case notDeleted["src/"+key]:
+					assert.NotNil(src, key)
+					assert.NotNil(dst, key)
+				default:
+					assert.Nil(src, key)
+					assert.NotNil(dst, key)
+				}
+			}
+
+			if err != nil {
+				var apiErr smithy.APIError
+				assert.True(errors.As(err, &apiErr))
+			}
+		})
+	}
+}
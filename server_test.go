@@ -0,0 +1,134 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// TestS3FS_Server exercises the filesystem through the aws sdk against the fakes3 http server, this
+// covers request serialisation and error handling which the in-memory backend skips.
+func TestS3FS_Server(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "file.txt", []byte("hello world"))
+	backend.Put("fooBucket", "protected.txt", []byte("data"))
+	backend.Protect("fooBucket", "protected.txt")
+	for i := 0; i < 5; i++ {
+		backend.Put("fooBucket", fmt.Sprintf("dir/file%d.txt", i), []byte("data"))
+	}
+	backend.Put("fooBucket", "dir/sub/nested.txt", []byte("data"))
+
+	srv, client := fakes3.NewServer(backend)
+	defer srv.Close()
+
+	s3fs := NewWithClient("fooBucket", client)
+
+	t.Run("seek and read", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.Open("file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		pos, err := f.(io.Seeker).Seek(6, io.SeekStart)
+		assert.NoError(err)
+		assert.Equal(int64(6), pos)
+
+		data, err := io.ReadAll(f)
+		assert.NoError(err)
+		assert.Equal("world", string(data))
+	})
+
+	t.Run("read at end of file", func(t *testing.T) {
+		assert := require.New(t)
+
+		f, err := s3fs.Open("file.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		buf := make([]byte, 16)
+		n, err := io.ReadFull(f, buf)
+		assert.ErrorIs(err, io.ErrUnexpectedEOF)
+		assert.Equal("hello world", string(buf[:n]))
+
+		n, err = f.Read(buf)
+		assert.ErrorIs(err, io.EOF)
+		assert.Equal(0, n)
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		assert := require.New(t)
+
+		info, err := s3fs.Stat("file.txt")
+		assert.NoError(err)
+		assert.Equal(int64(11), info.Size())
+		assert.False(info.IsDir())
+
+		info, err = s3fs.Stat("dir")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+
+		_, err = s3fs.Stat("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = s3fs.Open("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("paginate", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		var names []string
+		err := s3fs.ReadDirPages(context.Background(), "dir", 2, func(entries []fs.DirEntry, last bool) error {
+			names = append(names, entryNames(entries)...)
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([]string{"file0.txt", "file1.txt", "file2.txt", "file3.txt", "file4.txt", "sub"}, names)
+		assert.Equal(3, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("write and remove", func(t *testing.T) {
+		assert := require.New(t)
+
+		res, err := s3fs.WriteFileResult("written.txt", []byte("written"), 0o644)
+		assert.NoError(err)
+		assert.Equal(backend.Get("fooBucket", "written.txt").ETag, res.ETag)
+
+		data, err := fs.ReadFile(s3fs, "written.txt")
+		assert.NoError(err)
+		assert.Equal("written", string(data))
+
+		assert.NoError(s3fs.Remove("written.txt"))
+		assert.Nil(backend.Get("fooBucket", "written.txt"))
+	})
+
+	t.Run("access denied", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := s3fs.Remove("protected.txt")
+
+		var apiErr smithy.APIError
+		assert.True(errors.As(err, &apiErr))
+		assert.Equal("AccessDenied", apiErr.ErrorCode())
+		assert.NotNil(backend.Get("fooBucket", "protected.txt"))
+	})
+
+	t.Run("rename all", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := s3fs.RenameAll(context.Background(), "dir/sub", "moved")
+		assert.NoError(err)
+		assert.Nil(backend.Get("fooBucket", "dir/sub/nested.txt"))
+		assert.NotNil(backend.Get("fooBucket", "moved/nested.txt"))
+	})
+}
@@ -0,0 +1,163 @@
+package s3iofs
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// replayable returns a body for r which the sdk can rewind when a request is retried along with its
+// length, readers which implement io.Seeker are used as is from their current offset while other
+// readers are spooled. The returned body must be closed to remove any temporary file.
+func (s3fs *S3FS) replayable(r io.Reader) (io.ReadSeekCloser, int64, error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		size, err := remaining(rs)
+		if err != nil {
+			return nil, 0, err
+		}
+		return nopSeekCloser{rs}, size, nil
+	}
+
+	sp := newSpool(s3fs.opts.spoolDir, s3fs.opts.spoolThreshold)
+
+	if _, err := sp.ReadFrom(r); err != nil {
+		sp.Close()
+		return nil, 0, err
+	}
+
+	return spoolReader{ReadSeeker: sp.Reader(), spool: sp}, sp.Size(), nil
+}
+
+// remaining returns the number of bytes between the current offset of rs and the end.
+func remaining(rs io.Seeker) (int64, error) {
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return end - offset, nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+type spoolReader struct {
+	io.ReadSeeker
+	spool *spool
+}
+
+func (r spoolReader) Close() error {
+	return r.spool.Close()
+}
+
+// spool buffers a stream so it can be replayed, such as when the sdk retries a request, data is
+// held in memory up to the threshold and in a temporary file beyond it.
+type spool struct {
+	dir       string
+	threshold int64
+
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+func newSpool(dir string, threshold int64) *spool {
+	return &spool{dir: dir, threshold: threshold}
+}
+
+// ReadFrom reads r until EOF into the spool.
+func (s *spool) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.CopyN(&s.buf, r, s.threshold+1)
+	s.size += n
+	if err == io.EOF {
+		return n, nil
+	}
+	if err != nil {
+		return n, err
+	}
+
+	// the stream is larger than the threshold, move it to a temporary file
+	s.file, err = os.CreateTemp(s.dir, "s3iofs-spool-*")
+	if err != nil {
+		return n, err
+	}
+
+	if _, err := s.buf.WriteTo(s.file); err != nil {
+		return n, err
+	}
+
+	m, err := io.Copy(s.file, r)
+	s.size += m
+
+	return n + m, err
+}
+
+// Write appends p to the spool, moving the data to a temporary file once it exceeds the threshold.
+func (s *spool) Write(p []byte) (int, error) {
+	if s.file == nil && int64(s.buf.Len()+len(p)) > s.threshold {
+		file, err := os.CreateTemp(s.dir, "s3iofs-spool-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = file
+
+		if _, err := s.buf.WriteTo(s.file); err != nil {
+			return 0, err
+		}
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.buf.Write(p)
+	}
+	s.size += int64(n)
+
+	return n, err
+}
+
+// Size returns the number of bytes in the spool.
+func (s *spool) Size() int64 {
+	return s.size
+}
+
+// Reader returns a seekable reader over the spooled data, each call returns a new reader.
+func (s *spool) Reader() io.ReadSeeker {
+	if s.file != nil {
+		return io.NewSectionReader(s.file, 0, s.size)
+	}
+	return bytes.NewReader(s.buf.Bytes())
+}
+
+// Close removes the temporary file, if one was created.
+func (s *spool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	if removeErr := os.Remove(s.file.Name()); err == nil {
+		err = removeErr
+	}
+	s.file = nil
+
+	return err
+}
@@ -0,0 +1,107 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// retryingClient replays PutObject requests the way the sdk retryer does, the first attempt
+// reads part of the body then fails, the body is rewound and the request is sent again.
+type retryingClient struct {
+	*fakes3.Backend
+	attempts int
+}
+
+func (c *retryingClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.attempts++
+
+	body, ok := params.Body.(io.Seeker)
+	if !ok {
+		return nil, errors.New("request body not seekable")
+	}
+
+	// the connection drops part way through the first attempt
+	if _, err := io.CopyN(io.Discard, params.Body, 3); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	c.attempts++
+
+	return c.Backend.PutObject(ctx, params, optFns...)
+}
+
+func TestS3FS_WriteFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int64
+		data      []byte
+	}{
+		{name: "memory", threshold: 1024, data: []byte("small payload")},
+		{name: "temp file", threshold: 4, data: bytes.Repeat([]byte("large payload "), 100)},
+		{name: "empty", threshold: 4, data: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			spoolDir := t.TempDir()
+
+			client := &retryingClient{Backend: fakes3.New("fooBucket")}
+
+			s3fs := NewWithClient("fooBucket", client, WithSpoolDir(spoolDir), WithSpoolMemoryThreshold(tt.threshold))
+
+			// a reader which is not seekable, as is the case for network streams
+			res, err := s3fs.WriteFrom("dir/file.txt", iotest.OneByteReader(bytes.NewReader(tt.data)))
+			assert.NoError(err)
+			assert.Equal("dir/file.txt", res.Key)
+			assert.NotEmpty(res.ETag)
+			assert.Equal(2, client.attempts)
+
+			obj := client.Get("fooBucket", "dir/file.txt")
+			assert.NotNil(obj)
+			assert.Equal(tt.data, obj.Data)
+
+			// the temporary files are removed
+			files, err := os.ReadDir(spoolDir)
+			assert.NoError(err)
+			assert.Empty(files)
+		})
+	}
+
+	t.Run("reader error", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend, WithSpoolDir(t.TempDir()), WithSpoolMemoryThreshold(0))
+
+		errRead := errors.New("connection reset")
+
+		_, err := s3fs.WriteFrom("file.txt", iotest.ErrReader(errRead))
+		assert.ErrorIs(err, errRead)
+		assert.Equal(0, backend.Calls("PutObject"))
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs := NewWithClient("fooBucket", fakes3.New("fooBucket"))
+
+		_, err := s3fs.WriteFrom(".", bytes.NewReader(nil))
+		assert.ErrorIs(err, os.ErrInvalid)
+	})
+}
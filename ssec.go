@@ -0,0 +1,283 @@
+package s3iofs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+var _ S3API = (*sseCustomerClient)(nil)
+
+// sseCustomerAlgorithm is the only algorithm s3 supports for customer provided keys.
+const sseCustomerAlgorithm = "AES256"
+
+var (
+	// ErrSSECustomerKeyRequired is matched by the error returned when reading an object encrypted
+	// with a customer provided key without supplying the key, see WithSSECustomerKey.
+	ErrSSECustomerKeyRequired = errors.New("object is encrypted with a customer provided key")
+	// ErrInvalidSSECustomerKey is returned when a customer provided key isn't a 256 bit AES key.
+	ErrInvalidSSECustomerKey = errors.New("customer provided key must be 32 bytes")
+)
+
+type sseCustomerKeyKey struct{}
+
+// WithSSECustomerKey sets the customer provided key used to encrypt the objects written by the
+// filesystem, and decrypt those it reads, this is a 256 bit AES key.
+//
+// Note:
+//   - The key is sent with GetObject, HeadObject, PutObject, and the multipart upload and copy
+//     requests, s3 rejects reads of objects which aren't encrypted with the key.
+//   - The MD5 of the key, which s3 uses to check it wasn't corrupted, is computed by the filesystem.
+//   - The key is held privately, it isn't visible to interceptors and is redacted when formatted.
+//   - A key with the wrong length fails every request which would send it with ErrInvalidSSECustomerKey.
+func WithSSECustomerKey(key []byte) Option {
+	return func(fo *fsOptions) {
+		fo.sseCustomerKey = newSSECustomerKey(key)
+	}
+}
+
+// ContextWithSSECustomerKey returns a context which replaces the customer provided key of the
+// filesystem for the calls made using it, this is used with methods which accept a context, such as
+// OpenContext, to read an object encrypted with a different key.
+//
+// Files keep the context they were opened with, so later reads of the file also use the key.
+func ContextWithSSECustomerKey(ctx context.Context, key []byte) context.Context {
+	return context.WithValue(ctx, sseCustomerKeyKey{}, newSSECustomerKey(key))
+}
+
+// sseCustomerKey holds a customer provided key encoded as it is sent to s3.
+type sseCustomerKey struct {
+	key    string
+	keyMD5 string
+	err    error
+}
+
+func newSSECustomerKey(key []byte) *sseCustomerKey {
+	if len(key) != 32 {
+		return &sseCustomerKey{err: fmt.Errorf("%w, got %d bytes", ErrInvalidSSECustomerKey, len(key))}
+	}
+
+	sum := md5.Sum(key)
+
+	return &sseCustomerKey{
+		key:    base64.StdEncoding.EncodeToString(key),
+		keyMD5: base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+// String redacts the key so it isn't written to logs.
+func (k *sseCustomerKey) String() string {
+	return "[redacted]"
+}
+
+// GoString redacts the key so it isn't written to logs by %#v.
+func (k *sseCustomerKey) GoString() string {
+	return "[redacted]"
+}
+
+// sseCustomerClient adds the customer provided key to the requests which need it, the key of the
+// context replaces that of the filesystem.
+//
+// The requests are copied before the key is added, so the caller and interceptors never see it.
+type sseCustomerClient struct {
+	inner S3API
+	key   *sseCustomerKey
+}
+
+// customerKey returns the key for a call, or nil if there is no key.
+func (c *sseCustomerClient) customerKey(ctx context.Context) (*sseCustomerKey, error) {
+	key := c.key
+	if ctxKey, ok := ctx.Value(sseCustomerKeyKey{}).(*sseCustomerKey); ok {
+		key = ctxKey
+	}
+
+	if key != nil && key.err != nil {
+		return nil, key.err
+	}
+
+	return key, nil
+}
+
+func (c *sseCustomerClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	key, err := c.customerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		res, err := c.inner.GetObject(ctx, params, optFns...)
+		return res, keyRequiredError(err)
+	}
+
+	in := *params
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+
+	return c.inner.GetObject(ctx, &in, optFns...)
+}
+
+func (c *sseCustomerClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return c.inner.ListObjectsV2(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	key, err := c.customerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		res, err := c.inner.HeadObject(ctx, params, optFns...)
+		return res, keyRequiredError(err)
+	}
+
+	in := *params
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+
+	return c.inner.HeadObject(ctx, &in, optFns...)
+}
+
+func (c *sseCustomerClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return c.inner.DeleteObject(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	key, err := c.customerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return c.inner.PutObject(ctx, params, optFns...)
+	}
+
+	in := *params
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+
+	return c.inner.PutObject(ctx, &in, optFns...)
+}
+
+func (c *sseCustomerClient) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	key, err := c.customerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return c.inner.CopyObject(ctx, params, optFns...)
+	}
+
+	// the source and destination are both in the filesystem so share the key
+	in := *params
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+
+	return c.inner.CopyObject(ctx, &in, optFns...)
+}
+
+func (c *sseCustomerClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return c.inner.DeleteObjects(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	key, err := c.customerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return c.inner.CreateMultipartUpload(ctx, params, optFns...)
+	}
+
+	in := *params
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+
+	return c.inner.CreateMultipartUpload(ctx, &in, optFns...)
+}
+
+func (c *sseCustomerClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	key, err := c.customerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return c.inner.UploadPart(ctx, params, optFns...)
+	}
+
+	in := *params
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+
+	return c.inner.UploadPart(ctx, &in, optFns...)
+}
+
+func (c *sseCustomerClient) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	key, err := c.customerKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return c.inner.UploadPartCopy(ctx, params, optFns...)
+	}
+
+	in := *params
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = aws.String(sseCustomerAlgorithm), aws.String(key.key), aws.String(key.keyMD5)
+
+	return c.inner.UploadPartCopy(ctx, &in, optFns...)
+}
+
+func (c *sseCustomerClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return c.inner.CompleteMultipartUpload(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return c.inner.AbortMultipartUpload(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	return c.inner.ListObjectVersions(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return c.inner.GetObjectTagging(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	return c.inner.PutObjectTagging(ctx, params, optFns...)
+}
+
+func (c *sseCustomerClient) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return c.inner.HeadBucket(ctx, params, optFns...)
+}
+
+// keyRequiredError marks the error returned by a read without a key as ErrSSECustomerKeyRequired
+// when s3 rejected it because the object is encrypted with a customer provided key.
+//
+// GetObject returns an InvalidRequest which mentions the encryption, HeadObject responses have no
+// body so only the 400 status is available.
+func keyRequiredError(err error) error {
+	var respErr *awshttp.ResponseError
+	if err == nil || !errors.As(err, &respErr) || respErr.HTTPStatusCode() != http.StatusBadRequest {
+		return err
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidRequest":
+			if !strings.Contains(apiErr.ErrorMessage(), "Server Side Encryption") {
+				return err
+			}
+		case "BadRequest":
+		default:
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w: %w", ErrSSECustomerKeyRequired, err)
+}
@@ -0,0 +1,194 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_SSECustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	otherKey := bytes.Repeat([]byte("o"), 32)
+
+	keyMD5 := func(key []byte) string {
+		sum := md5.Sum(key)
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "existing.txt", []byte("existing"))
+
+	var (
+		mu   sync.Mutex
+		sent map[string]string // the key md5 sent with each operation
+	)
+
+	backend.OnCall = func(_ context.Context, op string, input any) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var sentMD5 *string
+		switch in := input.(type) {
+		case *s3.GetObjectInput:
+			sentMD5 = in.SSECustomerKeyMD5
+		case *s3.HeadObjectInput:
+			sentMD5 = in.SSECustomerKeyMD5
+		case *s3.PutObjectInput:
+			sentMD5 = in.SSECustomerKeyMD5
+		case *s3.CreateMultipartUploadInput:
+			sentMD5 = in.SSECustomerKeyMD5
+		case *s3.UploadPartInput:
+			sentMD5 = in.SSECustomerKeyMD5
+		default:
+			return nil
+		}
+		sent[op] = aws.ToString(sentMD5)
+
+		return nil
+	}
+
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = map[string]string{}
+	}
+
+	var intercepted []any
+	s3fs := NewWithClient("fooBucket", backend,
+		WithSSECustomerKey(key),
+		WithMultipartThreshold(DefaultPartSize),
+		WithInterceptor(func(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+			mu.Lock()
+			intercepted = append(intercepted, input)
+			mu.Unlock()
+			return next(ctx)
+		}),
+	)
+
+	t.Run("writes", func(t *testing.T) {
+		assert := require.New(t)
+
+		reset()
+
+		err := s3fs.WriteFile("small.txt", []byte("data"), 0o644)
+		assert.NoError(err)
+
+		err = s3fs.WriteReader("large.bin", bytes.NewReader(make([]byte, DefaultPartSize+1)), -1)
+		assert.NoError(err)
+
+		assert.Equal(map[string]string{
+			"PutObject":             keyMD5(key),
+			"CreateMultipartUpload": keyMD5(key),
+			"UploadPart":            keyMD5(key),
+		}, sent)
+	})
+
+	t.Run("reads", func(t *testing.T) {
+		assert := require.New(t)
+
+		reset()
+
+		_, err := s3fs.StatObject("small.txt")
+		assert.NoError(err)
+
+		data, err := fs.ReadFile(s3fs, "small.txt")
+		assert.NoError(err)
+		assert.Equal("data", string(data))
+
+		assert.Equal(map[string]string{
+			"HeadObject": keyMD5(key),
+			"GetObject":  keyMD5(key),
+		}, sent)
+	})
+
+	t.Run("context replaces the key for the open file", func(t *testing.T) {
+		assert := require.New(t)
+
+		reset()
+
+		f, err := s3fs.OpenContext(ContextWithSSECustomerKey(context.Background(), otherKey), "existing.txt")
+		assert.NoError(err)
+		defer f.Close()
+
+		_, err = f.(io.ReaderAt).ReadAt(make([]byte, 4), 2)
+		assert.NoError(err)
+
+		assert.Equal(map[string]string{"GetObject": keyMD5(otherKey)}, sent)
+	})
+
+	t.Run("interceptors don't see the key", func(t *testing.T) {
+		assert := require.New(t)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.NotEmpty(intercepted)
+		for _, input := range intercepted {
+			if in, ok := input.(*s3.GetObjectInput); ok {
+				assert.Nil(in.SSECustomerKey)
+			}
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := NewWithClient("fooBucket", backend, WithSSECustomerKey([]byte("short"))).Open("existing.txt")
+		assert.ErrorIs(err, ErrInvalidSSECustomerKey)
+	})
+
+	t.Run("key is redacted", func(t *testing.T) {
+		assert := require.New(t)
+
+		k := newSSECustomerKey(key)
+		formatted := fmt.Sprintf("%v %+v %#v %s", k, k, k, k)
+		assert.NotContains(formatted, base64.StdEncoding.EncodeToString(key))
+		assert.NotContains(formatted, keyMD5(key))
+	})
+}
+
+func TestS3FS_SSECustomerKeyRequired(t *testing.T) {
+	assert := require.New(t)
+
+	mockClient := new(mockS3Client)
+
+	mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil),
+		operationError(400, "ABC123", &smithy.GenericAPIError{
+			Code:    "InvalidRequest",
+			Message: "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.",
+		})).Once()
+
+	mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.HeadObjectOutput)(nil),
+		operationError(400, "ABC123", &smithy.GenericAPIError{Code: "BadRequest"})).Once()
+
+	s3fs := NewWithClient("fooBucket", mockClient)
+
+	_, err := s3fs.Open("encrypted.txt")
+	assert.ErrorIs(err, ErrSSECustomerKeyRequired)
+
+	_, err = s3fs.StatObject("encrypted.txt")
+	assert.ErrorIs(err, ErrSSECustomerKeyRequired)
+
+	// other bad requests are returned as is
+	mockClient.On("GetObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil),
+		operationError(400, "ABC123", &smithy.GenericAPIError{Code: "InvalidArgument"})).Once()
+
+	_, err = s3fs.Open("other.txt")
+	assert.Error(err)
+	assert.NotErrorIs(err, ErrSSECustomerKeyRequired)
+
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,183 @@
+package s3iofs
+
+import (
+	"container/list"
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultStatCacheEntries is the size of the stat cache when WithStatCache isn't given a size.
+const defaultStatCacheEntries = 10000
+
+// WithStatCache caches the results of Stat for the ttl, so walks which stat the same names
+// repeatedly don't list them again, at most maxEntries names are kept with the least recently used
+// removed first, zero or less uses a default of 10000.
+//
+// Note:
+//   - Only successful results are cached, a missing file is looked up again on each Stat.
+//   - Writes, removes, renames and copies made through the filesystem remove the names they change,
+//     along with their parent directories, from the cache. Changes made by other clients are only
+//     seen once the ttl expires.
+//   - ReadDir uses a cached directory rather than checking it exists, the entries are always listed.
+func WithStatCache(ttl time.Duration, maxEntries int) Option {
+	return func(fo *fsOptions) {
+		if ttl <= 0 {
+			return
+		}
+		if maxEntries <= 0 {
+			maxEntries = defaultStatCacheEntries
+		}
+		fo.statCacheTTL = ttl
+		fo.statCacheEntries = maxEntries
+	}
+}
+
+// statCache is a least recently used cache of file info by name, which is safe for concurrent use.
+type statCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List // most recently used at the front
+	entries map[string]*list.Element
+	// gen is incremented by each invalidation, so a Stat which started before a change doesn't
+	// cache the result it found before the change
+	gen uint64
+}
+
+type statCacheEntry struct {
+	name    string
+	info    fs.FileInfo
+	expires time.Time
+}
+
+func newStatCache(ttl time.Duration, maxEntries int) *statCache {
+	return &statCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+// get returns the cached info of the name, if it hasn't expired.
+func (c *statCache) get(name string) (fs.FileInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*statCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, name)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry.info, true
+}
+
+// generation returns the count of invalidations, which is passed to put with the result of a
+// Stat started after it was read.
+func (c *statCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// put caches the info of the name, removing the least recently used name when the cache is full,
+// the info isn't cached if there has been an invalidation since the generation was read.
+func (c *statCache) put(name string, info fs.FileInfo, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.gen {
+		return
+	}
+
+	expires := time.Now().Add(c.ttl)
+
+	if elem, ok := c.entries[name]; ok {
+		elem.Value = &statCacheEntry{name: name, info: info, expires: expires}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[name] = c.order.PushFront(&statCacheEntry{name: name, info: info, expires: expires})
+
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*statCacheEntry).name)
+	}
+}
+
+// invalidate removes the file or directory with the key from the cache, along with its parents as
+// a write or remove may create or remove them.
+func (c *statCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	for name := strings.TrimSuffix(key, "/"); name != "." && name != "/" && name != ""; name = path.Dir(name) {
+		if elem, ok := c.entries[name]; ok {
+			c.order.Remove(elem)
+			delete(c.entries, name)
+		}
+	}
+}
+
+// interceptor invalidates the keys changed by each call, whether or not it succeeded as a failed
+// call may still have changed the object.
+func (c *statCache) interceptor(ctx context.Context, op string, input any, next func(ctx context.Context) (any, error)) (any, error) {
+	res, err := next(ctx)
+
+	switch input := input.(type) {
+	case *s3.PutObjectInput:
+		c.invalidate(aws.ToString(input.Key))
+	case *s3.CopyObjectInput:
+		c.invalidate(aws.ToString(input.Key))
+	case *s3.CompleteMultipartUploadInput:
+		c.invalidate(aws.ToString(input.Key))
+	case *s3.DeleteObjectInput:
+		c.invalidate(aws.ToString(input.Key))
+	case *s3.DeleteObjectsInput:
+		if input.Delete != nil {
+			for _, obj := range input.Delete.Objects {
+				c.invalidate(aws.ToString(obj.Key))
+			}
+		}
+	}
+
+	return res, err
+}
@@ -0,0 +1,154 @@
+package s3iofs
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_StatCache(t *testing.T) {
+	newFS := func(opts ...Option) (*fakes3.Backend, *S3FS) {
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "dir/file.txt", []byte("data"))
+		return backend, NewWithClient("fooBucket", backend, opts...)
+	}
+
+	t.Run("repeated stats are cached", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithStatCache(time.Minute, 0))
+
+		for range 3 {
+			info, err := s3fs.Stat("dir/file.txt")
+			assert.NoError(err)
+			assert.Equal(int64(4), info.Size())
+
+			info, err = s3fs.Stat("dir")
+			assert.NoError(err)
+			assert.True(info.IsDir())
+		}
+
+		assert.Equal(2, backend.Calls("HeadObject"))
+		assert.Equal(1, backend.Calls("ListObjectsV2"))
+
+		// the cached directory isn't checked again before it is listed
+		entries, err := s3fs.ReadDir("dir")
+		assert.NoError(err)
+		assert.Len(entries, 1)
+		assert.Equal(2, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("missing files are not cached", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithStatCache(time.Minute, 0))
+
+		_, err := s3fs.Stat("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		backend.Put("fooBucket", "missing.txt", []byte("data"))
+
+		_, err = s3fs.Stat("missing.txt")
+		assert.NoError(err)
+	})
+
+	t.Run("writes invalidate the file and its parents", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithStatCache(time.Minute, 0))
+
+		_, err := s3fs.Stat("dir/file.txt")
+		assert.NoError(err)
+		_, err = s3fs.Stat("dir")
+		assert.NoError(err)
+
+		assert.NoError(s3fs.WriteFile("dir/file.txt", []byte("longer data"), 0o644))
+		backend.ResetCalls()
+
+		info, err := s3fs.Stat("dir/file.txt")
+		assert.NoError(err)
+		assert.Equal(int64(11), info.Size())
+		assert.Equal(1, backend.Calls("HeadObject"))
+
+		assert.NoError(s3fs.Remove("dir/file.txt"))
+
+		_, err = s3fs.Stat("dir/file.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = s3fs.Stat("dir")
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("renames invalidate both names", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, s3fs := newFS(WithStatCache(time.Minute, 0))
+
+		_, err := s3fs.Stat("dir/file.txt")
+		assert.NoError(err)
+		_, err = s3fs.Stat("other/file.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		assert.NoError(s3fs.Rename("dir/file.txt", "other/file.txt"))
+
+		_, err = s3fs.Stat("dir/file.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		info, err := s3fs.Stat("other/file.txt")
+		assert.NoError(err)
+		assert.Equal(int64(4), info.Size())
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithStatCache(10*time.Millisecond, 0))
+
+		_, err := s3fs.Stat("dir/file.txt")
+		assert.NoError(err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = s3fs.Stat("dir/file.txt")
+		assert.NoError(err)
+		assert.Equal(2, backend.Calls("HeadObject"))
+	})
+
+	t.Run("least recently used is removed", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS(WithStatCache(time.Minute, 2))
+		for i := range 3 {
+			backend.Put("fooBucket", fmt.Sprintf("file%d.txt", i), []byte("data"))
+		}
+
+		for _, name := range []string{"file0.txt", "file1.txt", "file0.txt", "file2.txt"} {
+			_, err := s3fs.Stat(name)
+			assert.NoError(err)
+		}
+		assert.Equal(3, backend.Calls("HeadObject"))
+
+		// file1.txt was the least recently used when file2.txt was added
+		for _, name := range []string{"file0.txt", "file2.txt", "file1.txt"} {
+			_, err := s3fs.Stat(name)
+			assert.NoError(err)
+		}
+		assert.Equal(4, backend.Calls("HeadObject"))
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs := newFS()
+
+		for range 2 {
+			_, err := s3fs.Stat("dir/file.txt")
+			assert.NoError(err)
+		}
+		assert.Equal(2, backend.Calls("HeadObject"))
+	})
+}
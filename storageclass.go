@@ -0,0 +1,44 @@
+package s3iofs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrInvalidStorageClass is returned when a write is given a storage class which isn't known to s3.
+var ErrInvalidStorageClass = errors.New("invalid storage class")
+
+// WithStorageClass sets the storage class of the stored object, such as STANDARD_IA or GLACIER_IR,
+// this replaces the default set with WithDefaultStorageClass.
+//
+// Note:
+//   - The class is checked against those known to the sdk before any request is made.
+//   - s3 compatible services may reject classes they don't support.
+func WithStorageClass(storageClass types.StorageClass) WriteOption {
+	return func(wo *writeOptions) {
+		wo.storageClass = storageClass
+	}
+}
+
+// WithDefaultStorageClass sets the storage class of every object written by the filesystem, unless
+// it is replaced by WithStorageClass, this defaults to the class chosen by s3 which is STANDARD.
+func WithDefaultStorageClass(storageClass types.StorageClass) Option {
+	return WithDefaultWriteOptions(WithStorageClass(storageClass))
+}
+
+// validateStorageClass checks the storage class is known to the sdk, an empty class is left to s3.
+func validateStorageClass(storageClass types.StorageClass) error {
+	if storageClass == "" {
+		return nil
+	}
+
+	valid := storageClass.Values()
+	if !slices.Contains(valid, storageClass) {
+		return fmt.Errorf("%w: %q must be one of %v", ErrInvalidStorageClass, storageClass, valid)
+	}
+
+	return nil
+}
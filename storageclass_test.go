@@ -0,0 +1,80 @@
+package s3iofs
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_WriteStorageClass(t *testing.T) {
+	t.Run("put object", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+			return aws.ToString(params.Key) == "archive.tar" && params.StorageClass == types.StorageClassGlacierIr
+		}), mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+			return aws.ToString(params.Key) == "default.tar" && params.StorageClass == types.StorageClassStandardIa
+		}), mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, WithDefaultStorageClass(types.StorageClassStandardIa))
+
+		_, err := s3fs.WriteFileResult("archive.tar", []byte("data"), 0o644, WithStorageClass(types.StorageClassGlacierIr))
+		assert.NoError(err)
+
+		err = s3fs.WriteFile("default.tar", []byte("data"), 0o644)
+		assert.NoError(err)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(DefaultPartSize))
+
+		err := s3fs.WriteReader("large.bin", bytes.NewReader(make([]byte, DefaultPartSize+1)), -1,
+			WithStorageClass(types.StorageClassStandardIa))
+		assert.NoError(err)
+
+		info, err := s3fs.StatObject("large.bin")
+		assert.NoError(err)
+		assert.Equal("STANDARD_IA", info.(File).StorageClass())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		_, err := s3fs.WriteFileResult("archive.tar", []byte("data"), 0o644, WithStorageClass("COLD"))
+		assert.ErrorIs(err, ErrInvalidStorageClass)
+		assert.ErrorContains(err, `"COLD" must be one of`)
+
+		// the default is checked when it is used
+		s3fs = NewWithClient("fooBucket", mockClient, WithDefaultStorageClass("COLD"))
+
+		err = s3fs.WriteFile("archive.tar", []byte("data"), 0o644)
+		assert.ErrorIs(err, ErrInvalidStorageClass)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("archive.tar", pathErr.Path)
+
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,157 @@
+package s3iofs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	_ fs.SubFS      = (*S3FS)(nil)
+	_ fs.FS         = (*subFS)(nil)
+	_ fs.StatFS     = (*subFS)(nil)
+	_ fs.ReadDirFS  = (*subFS)(nil)
+	_ fs.ReadFileFS = (*subFS)(nil)
+	_ fs.SubFS      = (*subFS)(nil)
+	_ RemoveFS      = (*subFS)(nil)
+	_ WriteFileFS   = (*subFS)(nil)
+)
+
+// Sub returns a filesystem rooted at the dir prefix of the bucket, names are joined to the prefix
+// before the requests are made to s3 so listings are scoped to the prefix.
+//
+// Note:
+//   - Sub of "." returns the filesystem itself.
+//   - The prefix isn't checked for existence, as with fs.Sub.
+//   - Paths in the errors returned by the filesystem are relative to the prefix.
+func (s3fs *S3FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+
+	if dir == "." {
+		return s3fs, nil
+	}
+
+	return &subFS{fsys: s3fs, dir: dir}, nil
+}
+
+// subFS is a S3FS rooted at a prefix of the bucket.
+type subFS struct {
+	fsys *S3FS
+	dir  string
+}
+
+// Open opens the named file relative to the prefix.
+func (s *subFS) Open(name string) (fs.File, error) {
+	full, err := s.fullName("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.fsys.Open(full)
+	return f, s.fixErr(err)
+}
+
+// Stat returns a FileInfo describing the named file relative to the prefix.
+func (s *subFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := s.fullName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.fsys.Stat(full)
+	return info, s.fixErr(err)
+}
+
+// ReadDir reads the named directory relative to the prefix.
+func (s *subFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := s.fullName(opRead, name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.fsys.ReadDir(full)
+	return entries, s.fixErr(err)
+}
+
+// Sub returns a filesystem rooted at the dir prefix within this prefix.
+func (s *subFS) Sub(dir string) (fs.FS, error) {
+	if dir == "." {
+		return s, nil
+	}
+
+	full, err := s.fullName("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &subFS{fsys: s.fsys, dir: full}, nil
+}
+
+// Remove removes the named file relative to the prefix.
+func (s *subFS) Remove(name string) error {
+	full, err := s.fullName("remove", name)
+	if err != nil {
+		return err
+	}
+
+	return s.fixErr(s.fsys.Remove(full))
+}
+
+// ReadFile reads the named file relative to the prefix.
+func (s *subFS) ReadFile(name string) ([]byte, error) {
+	full, err := s.fullName("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.fsys.ReadFile(full)
+	return data, s.fixErr(err)
+}
+
+// WriteFile writes the data to the named file relative to the prefix.
+func (s *subFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	full, err := s.fullName("write", name)
+	if err != nil {
+		return err
+	}
+
+	return s.fixErr(s.fsys.WriteFile(full, data, perm))
+}
+
+// fullName returns the key of the named file within the prefix.
+func (s *subFS) fullName(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return path.Join(s.dir, name), nil
+}
+
+// shorten returns the name relative to the prefix, or false if the name is outside of it.
+func (s *subFS) shorten(name string) (string, bool) {
+	if name == s.dir {
+		return ".", true
+	}
+
+	if rel, ok := strings.CutPrefix(name, s.dir+"/"); ok {
+		return rel, true
+	}
+
+	return "", false
+}
+
+// fixErr rewrites the paths of the errors returned by the filesystem to be relative to the prefix.
+func (s *subFS) fixErr(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		if short, ok := s.shorten(pathErr.Path); ok {
+			pathErr.Path = short
+		}
+	}
+
+	return err
+}
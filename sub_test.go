@@ -0,0 +1,128 @@
+package s3iofs
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_Sub(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "root.txt", []byte("root"))
+	backend.Put("fooBucket", "data/a.txt", []byte("a"))
+	backend.Put("fooBucket", "data/nested/b.txt", []byte("b"))
+	backend.Put("fooBucket", "data-other/c.txt", []byte("c"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("walk only lists within the prefix", func(t *testing.T) {
+		assert := require.New(t)
+
+		var prefixes []string
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if op == "ListObjectsV2" {
+				prefixes = append(prefixes, aws.ToString(input.(*s3.ListObjectsV2Input).Prefix))
+			}
+			return nil
+		}
+		defer func() { backend.OnCall = nil }()
+
+		sub, err := fs.Sub(s3fs, "data")
+		assert.NoError(err)
+
+		var paths []string
+		err = fs.WalkDir(sub, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal([]string{".", "a.txt", "nested", "nested/b.txt"}, paths)
+
+		assert.NotEmpty(prefixes)
+		for _, prefix := range prefixes {
+			assert.True(prefix == "data" || strings.HasPrefix(prefix, "data/"), prefix)
+		}
+	})
+
+	t.Run("read and stat", func(t *testing.T) {
+		assert := require.New(t)
+
+		sub, err := s3fs.Sub("data")
+		assert.NoError(err)
+
+		data, err := fs.ReadFile(sub, "nested/b.txt")
+		assert.NoError(err)
+		assert.Equal("b", string(data))
+
+		info, err := fs.Stat(sub, "nested")
+		assert.NoError(err)
+		assert.True(info.IsDir())
+
+		_, err = fs.Stat(sub, "root.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("root.txt", pathErr.Path)
+	})
+
+	t.Run("nested sub", func(t *testing.T) {
+		assert := require.New(t)
+
+		sub, err := fs.Sub(s3fs, "data")
+		assert.NoError(err)
+
+		nested, err := fs.Sub(sub, "nested")
+		assert.NoError(err)
+
+		entries, err := fs.ReadDir(nested, ".")
+		assert.NoError(err)
+		assert.Equal([]string{"b.txt"}, entryNames(entries))
+
+		same, err := fs.Sub(nested, ".")
+		assert.NoError(err)
+		assert.Same(nested, same)
+	})
+
+	t.Run("write and remove", func(t *testing.T) {
+		assert := require.New(t)
+
+		sub, err := s3fs.Sub("data")
+		assert.NoError(err)
+
+		assert.NoError(sub.(WriteFileFS).WriteFile("written.txt", []byte("w"), 0o644))
+		assert.NotNil(backend.Get("fooBucket", "data/written.txt"))
+
+		assert.NoError(sub.(RemoveFS).Remove("written.txt"))
+		assert.Nil(backend.Get("fooBucket", "data/written.txt"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert := require.New(t)
+
+		same, err := s3fs.Sub(".")
+		assert.NoError(err)
+		assert.Same(s3fs, same)
+
+		_, err = s3fs.Sub("../data")
+		assert.ErrorIs(err, fs.ErrInvalid)
+
+		_, err = s3fs.Sub("data/")
+		assert.ErrorIs(err, fs.ErrInvalid)
+
+		sub, err := s3fs.Sub("data")
+		assert.NoError(err)
+
+		_, err = sub.Open("/a.txt")
+		assert.ErrorIs(err, fs.ErrInvalid)
+	})
+}
@@ -0,0 +1,141 @@
+package s3iofs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// maxTags is the largest number of tags s3 allows on an object.
+	maxTags = 10
+	// maxTagKeyLength and maxTagValueLength are the limits s3 places on the characters of a tag.
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// ErrInvalidTag is returned when tags can't be stored by s3, for example when there are more than 10.
+var ErrInvalidTag = errors.New("invalid tag")
+
+// WithTags sets the tags of the stored object, these are used by lifecycle rules and cost allocation.
+//
+// Note:
+//   - An object has at most 10 tags, keys are up to 128 characters and values up to 256.
+//   - Keys can't be empty or use the reserved "aws:" prefix.
+//   - Multiple options are merged, with later values replacing earlier ones.
+func WithTags(tags map[string]string) WriteOption {
+	return func(wo *writeOptions) {
+		if wo.tags == nil {
+			wo.tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			wo.tags[k] = v
+		}
+	}
+}
+
+// GetTags returns the tags of the named file, these are read with a single GetObjectTagging.
+func (s3fs *S3FS) GetTags(name string) (map[string]string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "gettags", Path: name, Err: fs.ErrInvalid}
+	}
+
+	res, err := s3fs.s3client.GetObjectTagging(s3fs.context(), &s3.GetObjectTaggingInput{
+		Bucket: aws.String(s3fs.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, &fs.PathError{Op: "gettags", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, pathError("gettags", name, err)
+	}
+
+	tags := make(map[string]string, len(res.TagSet))
+	for _, tag := range res.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return tags, nil
+}
+
+// SetTags replaces the tags of the named file, an empty map removes all of the tags.
+//
+// Note:
+//   - Unlike SetAttr the object isn't copied, so this doesn't create a new version in a versioned bucket.
+//   - The tags are checked against the limits of s3 before any request is made.
+func (s3fs *S3FS) SetTags(name string, tags map[string]string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "settags", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if err := validateTags(tags); err != nil {
+		return &fs.PathError{Op: "settags", Path: name, Err: err}
+	}
+
+	tagSet := make([]types.Tag, 0, len(tags))
+	for _, k := range sortedTagKeys(tags) {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+
+	_, err := s3fs.s3client.PutObjectTagging(s3fs.context(), &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s3fs.bucket),
+		Key:     aws.String(name),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return &fs.PathError{Op: "settags", Path: name, Err: fs.ErrNotExist}
+		}
+		return pathError("settags", name, err)
+	}
+
+	return nil
+}
+
+// validateTags checks the tags are within the limits s3 places on the tags of an object.
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("%w: %d tags exceeds the limit of %d", ErrInvalidTag, len(tags), maxTags)
+	}
+
+	for _, k := range sortedTagKeys(tags) {
+		v := tags[k]
+
+		switch {
+		case k == "":
+			return fmt.Errorf("%w: key can't be empty", ErrInvalidTag)
+		case strings.HasPrefix(strings.ToLower(k), "aws:"):
+			return fmt.Errorf("%w: key %q uses the reserved aws: prefix", ErrInvalidTag, k)
+		case utf8.RuneCountInString(k) > maxTagKeyLength:
+			return fmt.Errorf("%w: key %q exceeds %d characters", ErrInvalidTag, k, maxTagKeyLength)
+		case utf8.RuneCountInString(v) > maxTagValueLength:
+			return fmt.Errorf("%w: value of %q exceeds %d characters", ErrInvalidTag, k, maxTagValueLength)
+		}
+	}
+
+	return nil
+}
+
+// encodeTags returns the tags in the url encoded form of the Tagging header.
+func encodeTags(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+
+	return values.Encode()
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	return slices.Sorted(maps.Keys(tags))
+}
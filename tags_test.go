@@ -0,0 +1,101 @@
+package s3iofs
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_Tags(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+
+	s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(DefaultPartSize))
+
+	t.Run("written with the object", func(t *testing.T) {
+		assert := require.New(t)
+
+		tags := map[string]string{"cost-centre": "data eng", "retention": "30d"}
+
+		_, err := s3fs.WriteFileResult("file.txt", []byte("data"), 0o644, WithTags(tags))
+		assert.NoError(err)
+
+		err = s3fs.WriteReader("large.bin", bytes.NewReader(make([]byte, DefaultPartSize+1)), -1, WithTags(tags))
+		assert.NoError(err)
+
+		for _, name := range []string{"file.txt", "large.bin"} {
+			got, err := s3fs.GetTags(name)
+			assert.NoError(err)
+			assert.Equal(tags, got)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := s3fs.SetTags("file.txt", map[string]string{"retention": "90d"})
+		assert.NoError(err)
+
+		got, err := s3fs.GetTags("file.txt")
+		assert.NoError(err)
+		assert.Equal(map[string]string{"retention": "90d"}, got)
+
+		// the object isn't rewritten
+		assert.Zero(backend.Calls("CopyObject"))
+
+		err = s3fs.SetTags("file.txt", nil)
+		assert.NoError(err)
+
+		got, err = s3fs.GetTags("file.txt")
+		assert.NoError(err)
+		assert.Empty(got)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := s3fs.GetTags("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		err = s3fs.SetTags("missing.txt", map[string]string{"a": "b"})
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("invalid tags fail before any request", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		tooMany := map[string]string{}
+		for i := 0; i <= maxTags; i++ {
+			tooMany[fmt.Sprint("tag", i)] = "v"
+		}
+
+		for _, tags := range []map[string]string{
+			tooMany,
+			{"": "v"},
+			{"aws:created": "v"},
+			{strings.Repeat("k", 129): "v"},
+			{"k": strings.Repeat("v", 257)},
+		} {
+			_, err := s3fs.WriteFileResult("invalid.txt", []byte("data"), 0o644, WithTags(tags))
+			assert.ErrorIs(err, ErrInvalidTag)
+
+			err = s3fs.SetTags("file.txt", tags)
+			assert.ErrorIs(err, ErrInvalidTag)
+		}
+
+		assert.Zero(backend.Calls("PutObject"))
+		assert.Zero(backend.Calls("PutObjectTagging"))
+	})
+}
+
+func Test_encodeTags(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("a=1&b=x+y&c=%26%3D", encodeTags(map[string]string{"c": "&=", "a": "1", "b": "x y"}))
+}
@@ -0,0 +1 @@
+console.log("s3iofs");
@@ -0,0 +1,217 @@
+package s3iofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+var (
+	_ fs.FS        = (*unionFS)(nil)
+	_ fs.StatFS    = (*unionFS)(nil)
+	_ fs.ReadDirFS = (*unionFS)(nil)
+	_ RemoveFS     = (*unionFS)(nil)
+	_ WriteFileFS  = (*unionFS)(nil)
+)
+
+type unionFS struct {
+	layers []fs.FS
+}
+
+// NewUnion returns a filesystem which merges the layers into a single view, typically the layers
+// are S3FS instances scoped to different prefixes or buckets.
+//
+// The semantics of the union are:
+//   - Open and Stat return the name from the first layer which contains it.
+//   - A directory is the merge of that directory in every layer which contains it as a directory,
+//     entries are de-duplicated by name with the first layer winning.
+//   - A name which exists in no layer returns an error matching fs.ErrNotExist, ReadDir of a name
+//     which is a file in the first layer containing it returns an error matching ErrNotDirectory.
+//   - WriteFile and Remove act on the first layer implementing WriteFileFS or RemoveFS, if no
+//     layer supports the operation an error matching fs.ErrPermission is returned.
+func NewUnion(layers ...fs.FS) fs.FS {
+	return &unionFS{layers: layers}
+}
+
+// Open opens the named file from the first layer which contains it.
+func (u *unionFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	for i, layer := range u.layers {
+		f, err := layer.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			return f, nil
+		}
+
+		f.Close()
+
+		entries, err := u.mergeDir(name, i)
+		if err != nil {
+			return nil, err
+		}
+
+		return &unionDir{info: info, entries: entries}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Stat returns the FileInfo from the first layer which contains the name.
+func (u *unionFS) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := u.find(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// ReadDir returns the merged entries of the named directory across all layers.
+func (u *unionFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	i, info, err := u.find(name)
+	if err != nil {
+		return nil, pathError(opRead, name, err)
+	}
+
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: opRead, Path: name, Err: ErrNotDirectory}
+	}
+
+	return u.mergeDir(name, i)
+}
+
+// WriteFile writes the data to the first writable layer.
+func (u *unionFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	for _, layer := range u.layers {
+		if wfs, ok := layer.(WriteFileFS); ok {
+			return wfs.WriteFile(name, data, perm)
+		}
+	}
+
+	return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+}
+
+// Remove removes the named file from the first layer which supports removal, the name
+// remains visible if it also exists in another layer.
+func (u *unionFS) Remove(name string) error {
+	for _, layer := range u.layers {
+		if rfs, ok := layer.(RemoveFS); ok {
+			return rfs.Remove(name)
+		}
+	}
+
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+}
+
+// find returns the index of the first layer containing the name and its FileInfo.
+func (u *unionFS) find(name string) (int, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return 0, nil, fs.ErrInvalid
+	}
+
+	for i, layer := range u.layers {
+		info, err := fs.Stat(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return i, info, nil
+	}
+
+	return 0, nil, fs.ErrNotExist
+}
+
+// mergeDir merges the entries of the directory from the layers starting at first, layers which
+// don't contain the directory, or contain a file with the same name, are skipped.
+func (u *unionFS) mergeDir(name string, first int) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	entries := []fs.DirEntry{}
+
+	for _, layer := range u.layers[first:] {
+		info, err := fs.Stat(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// a file in a lower layer is shadowed by the directory
+		if !info.IsDir() {
+			continue
+		}
+
+		layerEntries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range layerEntries {
+			if seen[entry.Name()] {
+				continue
+			}
+			seen[entry.Name()] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+// unionDir is a directory opened from a union, the entries are merged when it is opened.
+type unionDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *unionDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *unionDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: opRead, Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *unionDir) Close() error {
+	return nil
+}
+
+func (d *unionDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(remaining))
+	d.offset += n
+
+	return remaining[:n], nil
+}
@@ -0,0 +1,131 @@
+package s3iofs
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestUnion(t *testing.T) {
+	upper := fstest.MapFS{
+		"shared/a.txt":  {Data: []byte("upper a")},
+		"shared/up.txt": {Data: []byte("up")},
+		"clash":         {Data: []byte("file in upper")},
+		"only-upper":    {Data: []byte("upper")},
+	}
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "shared/a.txt", []byte("lower a"))
+	backend.Put("fooBucket", "shared/low.txt", []byte("low"))
+	backend.Put("fooBucket", "shared/sub/deep.txt", []byte("deep"))
+	backend.Put("fooBucket", "clash/child.txt", []byte("child"))
+	backend.Put("fooBucket", "only-lower.txt", []byte("lower"))
+
+	lower := NewWithClient("fooBucket", backend)
+
+	union := NewUnion(upper, lower)
+
+	t.Run("first layer wins on open", func(t *testing.T) {
+		assert := require.New(t)
+
+		data, err := fs.ReadFile(union, "shared/a.txt")
+		assert.NoError(err)
+		assert.Equal("upper a", string(data))
+
+		data, err = fs.ReadFile(union, "only-lower.txt")
+		assert.NoError(err)
+		assert.Equal("lower", string(data))
+	})
+
+	t.Run("directories are merged and de-duplicated", func(t *testing.T) {
+		assert := require.New(t)
+
+		entries, err := fs.ReadDir(union, "shared")
+		assert.NoError(err)
+		assert.Equal([]string{"a.txt", "low.txt", "sub", "up.txt"}, entryNames(entries))
+
+		f, err := union.Open("shared")
+		assert.NoError(err)
+
+		dir, ok := f.(fs.ReadDirFile)
+		assert.True(ok)
+
+		entries, err = dir.ReadDir(3)
+		assert.NoError(err)
+		assert.Equal([]string{"a.txt", "low.txt", "sub"}, entryNames(entries))
+
+		entries, err = dir.ReadDir(3)
+		assert.NoError(err)
+		assert.Equal([]string{"up.txt"}, entryNames(entries))
+
+		_, err = dir.ReadDir(3)
+		assert.Equal(io.EOF, err)
+	})
+
+	t.Run("root is merged", func(t *testing.T) {
+		assert := require.New(t)
+
+		entries, err := fs.ReadDir(union, ".")
+		assert.NoError(err)
+		assert.Equal([]string{"clash", "only-lower.txt", "only-upper", "shared"}, entryNames(entries))
+	})
+
+	t.Run("a file in the first layer shadows a directory below", func(t *testing.T) {
+		assert := require.New(t)
+
+		info, err := union.(fs.StatFS).Stat("clash")
+		assert.NoError(err)
+		assert.False(info.IsDir())
+
+		_, err = fs.ReadDir(union, "clash")
+		assert.ErrorIs(err, ErrNotDirectory)
+	})
+
+	t.Run("read dir of a file", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := fs.ReadDir(union, "shared/a.txt")
+		assert.ErrorIs(err, ErrNotDirectory)
+		assert.NotErrorIs(err, fs.ErrNotExist)
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("shared/a.txt", pathErr.Path)
+	})
+
+	t.Run("missing names", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := union.Open("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = union.(fs.StatFS).Stat("missing.txt")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = fs.ReadDir(union, "missing")
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("writes go to the first writable layer", func(t *testing.T) {
+		assert := require.New(t)
+
+		err := union.(WriteFileFS).WriteFile("written.txt", []byte("new"), 0644)
+		assert.NoError(err)
+		assert.Equal([]byte("new"), backend.Get("fooBucket", "written.txt").Data)
+
+		err = NewUnion(upper).(WriteFileFS).WriteFile("written.txt", []byte("new"), 0644)
+		assert.ErrorIs(err, fs.ErrPermission)
+	})
+}
+
+func entryNames(entries []fs.DirEntry) []string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
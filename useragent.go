@@ -0,0 +1,48 @@
+package s3iofs
+
+import (
+	"runtime/debug"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const modulePath = "github.com/wolfeidau/s3iofs"
+
+// WithAppName adds "s3iofs/<version> app/<name>" to the User-Agent of every request made by the
+// filesystem, so its traffic can be identified in server access logs.
+//
+// Note:
+//   - This is applied per call, so it also works with a client passed to NewWithClient.
+//   - The version is read from the build info of the binary, "devel" is used when it isn't available.
+func WithAppName(name string) Option {
+	return WithClientOptions(func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions,
+			awsmiddleware.AddUserAgentKeyValue("s3iofs", moduleVersion()),
+			awsmiddleware.AddUserAgentKeyValue("app", name),
+		)
+	})
+}
+
+// moduleVersion returns the version of this module linked into the binary.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+
+	if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil && dep.Replace.Version != "" {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+
+	return "devel"
+}
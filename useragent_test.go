@@ -0,0 +1,60 @@
+package s3iofs
+
+import (
+	"io/fs"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// recordingHTTPClient records the User-Agent of each request before sending it.
+type recordingHTTPClient struct {
+	mu         sync.Mutex
+	userAgents []string
+}
+
+func (c *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.userAgents = append(c.userAgents, req.Header.Get("User-Agent"))
+	c.mu.Unlock()
+
+	return http.DefaultClient.Do(req)
+}
+
+func TestS3FS_WithAppName(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "dir/file.txt", []byte("data"))
+
+	srv, client := fakes3.NewServer(backend)
+	defer srv.Close()
+
+	recorder := new(recordingHTTPClient)
+
+	s3fs := NewWithClient("fooBucket", client,
+		WithAppName("report-builder"),
+		WithClientOptions(func(o *s3.Options) {
+			o.HTTPClient = recorder
+		}),
+	)
+
+	_, err := fs.ReadFile(s3fs, "dir/file.txt")
+	assert.NoError(err)
+
+	_, err = s3fs.ReadDir("dir")
+	assert.NoError(err)
+
+	err = s3fs.WriteFile("dir/other.txt", []byte("data"), 0o644)
+	assert.NoError(err)
+
+	assert.NotEmpty(recorder.userAgents)
+	for _, ua := range recorder.userAgents {
+		assert.Contains(ua, "s3iofs/"+moduleVersion())
+		assert.Contains(ua, "app/report-builder")
+	}
+}
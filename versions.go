@@ -0,0 +1,419 @@
+package s3iofs
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrVersionNotFound is returned when the requested version of an object doesn't exist.
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrDeleteMarker is returned when a version to be restored is a delete marker, or when
+	// RollbackLatest is called on a key which is currently deleted.
+	ErrDeleteMarker = errors.New("version is a delete marker")
+	// ErrVersioningDisabled is returned when the bucket doesn't retain versions of the object.
+	ErrVersioningDisabled = errors.New("bucket versioning is not enabled")
+)
+
+// objectVersions holds the versions and delete markers of a single key, newest first.
+type objectVersions struct {
+	versions      []types.ObjectVersion
+	deleteMarkers []types.DeleteMarkerEntry
+}
+
+// RestoreVersion makes the given version of the named file the current version, this copies the
+// version over the object in s3 so the version history is retained, and returns the new version.
+//
+// Note:
+//   - The content type and metadata of the restored version are preserved.
+//   - A file which is currently deleted can be restored by passing one of its previous versions.
+//   - The object is copied with a single CopyObject so is limited to 5GiB.
+func (s3fs *S3FS) RestoreVersion(ctx context.Context, name, versionID string) (*UploadResult, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "restore", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ov, err := s3fs.objectVersions(ctx, name)
+	if err != nil {
+		return nil, pathError("restore", name, err)
+	}
+
+	for _, marker := range ov.deleteMarkers {
+		if aws.ToString(marker.VersionId) == versionID {
+			return nil, &fs.PathError{Op: "restore", Path: name, Err: ErrDeleteMarker}
+		}
+	}
+
+	for _, version := range ov.versions {
+		if aws.ToString(version.VersionId) == versionID {
+			return s3fs.restoreVersion(ctx, name, versionID)
+		}
+	}
+
+	return nil, &fs.PathError{Op: "restore", Path: name, Err: ErrVersionNotFound}
+}
+
+// RollbackLatest restores the version of the named file which preceded the current version, see
+// RestoreVersion.
+//
+// Files which are currently deleted return ErrDeleteMarker, use RestoreVersion to choose which
+// version to bring back.
+func (s3fs *S3FS) RollbackLatest(ctx context.Context, name string) (*UploadResult, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "rollback", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ov, err := s3fs.objectVersions(ctx, name)
+	if err != nil {
+		return nil, pathError("rollback", name, err)
+	}
+
+	for _, marker := range ov.deleteMarkers {
+		if aws.ToBool(marker.IsLatest) {
+			return nil, &fs.PathError{Op: "rollback", Path: name, Err: ErrDeleteMarker}
+		}
+	}
+
+	// versions are listed newest first, so the previous version follows the latest
+	for _, version := range ov.versions {
+		if !aws.ToBool(version.IsLatest) {
+			return s3fs.restoreVersion(ctx, name, aws.ToString(version.VersionId))
+		}
+	}
+
+	return nil, &fs.PathError{Op: "rollback", Path: name, Err: ErrVersionNotFound}
+}
+
+func (s3fs *S3FS) restoreVersion(ctx context.Context, name, versionID string) (*UploadResult, error) {
+	res, err := s3fs.s3client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s3fs.bucket),
+		Key:        aws.String(name),
+		CopySource: copySource(s3fs.bucket, name, versionID),
+	})
+	if err != nil {
+		return nil, pathError("restore", name, err)
+	}
+
+	result := &UploadResult{
+		Key:       name,
+		VersionID: aws.ToString(res.VersionId),
+	}
+	if res.CopyObjectResult != nil {
+		result.ETag = aws.ToString(res.CopyObjectResult.ETag)
+	}
+
+	return result, nil
+}
+
+// OpenVersion opens the given version of the named file, the reads of the returned file and its Stat
+// are made with the version id, so they see that version even once it has been replaced.
+//
+// Note:
+//   - An empty version id fails with fs.ErrInvalid, use Open for the current version.
+//   - A version which doesn't exist fails with ErrVersionNotFound, which also matches
+//     fs.ErrNotExist, and the version id of a delete marker fails with ErrDeleteMarker.
+//   - Directories have no versions, so a name which is only a directory fails with fs.ErrNotExist.
+func (s3fs *S3FS) OpenVersion(name, versionID string) (fs.File, error) {
+	return s3fs.OpenVersionContext(s3fs.context(), name, versionID)
+}
+
+// OpenVersionContext opens the given version of the named file using the context for the requests
+// made by the open, and by the reads of the returned file.
+func (s3fs *S3FS) OpenVersionContext(ctx context.Context, name, versionID string) (fs.File, error) {
+	if !fs.ValidPath(name) || name == "." || versionID == "" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	res, err := s3fs.s3client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(s3fs.bucket),
+		Key:       aws.String(name),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		if isDeleteMarkerVersion(err) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: ErrDeleteMarker}
+		}
+		if isNotFound(err) || isNoSuchVersion(err) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("%w: %w", ErrVersionNotFound, fs.ErrNotExist)}
+		}
+		return nil, pathError("open", name, err)
+	}
+
+	return s3fs.newFile(ctx, name, versionID, res), nil
+}
+
+// RemoveVersion permanently deletes the given version of the named file, unlike Remove this never
+// adds a delete marker, so it can be used to erase the history of a file in a versioned bucket.
+//
+// Note:
+//   - An empty version id fails with fs.ErrInvalid, as DeleteObject without a version id would only
+//     add a delete marker.
+//   - The version is checked with a HeadObject before it is deleted, s3 doesn't report deletes of
+//     versions which don't exist, a version which doesn't exist fails with fs.ErrNotExist.
+//   - Passing the version id of a delete marker removes the marker, which restores the file if the
+//     marker is the latest version.
+func (s3fs *S3FS) RemoveVersion(name, versionID string) error {
+	return s3fs.RemoveVersionContext(s3fs.context(), name, versionID)
+}
+
+// RemoveVersionContext permanently deletes the given version of the named file, using the context
+// for the requests made to s3.
+func (s3fs *S3FS) RemoveVersionContext(ctx context.Context, name, versionID string) error {
+	if !fs.ValidPath(name) || name == "." || versionID == "" {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	_, err := s3fs.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(s3fs.bucket),
+		Key:       aws.String(name),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil && !isDeleteMarkerVersion(err) {
+		if isNotFound(err) || isNoSuchVersion(err) {
+			return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("%w: %w", ErrVersionNotFound, fs.ErrNotExist)}
+		}
+		return pathError("remove", name, err)
+	}
+
+	_, err = s3fs.s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(s3fs.bucket),
+		Key:       aws.String(name),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		if isNoSuchVersion(err) {
+			return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("%w: %w", ErrVersionNotFound, fs.ErrNotExist)}
+		}
+		return pathError("remove", name, err)
+	}
+
+	return nil
+}
+
+// isNoSuchVersion reports whether s3 rejected a request because the version doesn't exist.
+func isNoSuchVersion(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchVersion"
+}
+
+// isDeleteMarkerVersion reports whether a HeadObject failed because the version is a delete marker,
+// which s3 refuses with a 405.
+func isDeleteMarkerVersion(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "MethodNotAllowed" {
+		return true
+	}
+
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusMethodNotAllowed
+}
+
+// objectVersions lists the versions and delete markers of the key, returning fs.ErrNotExist if it has
+// none and ErrVersioningDisabled if only the null version exists.
+func (s3fs *S3FS) objectVersions(ctx context.Context, key string) (*objectVersions, error) {
+	var (
+		ov            objectVersions
+		keyMarker     *string
+		versionMarker *string
+	)
+
+	for {
+		listRes, err := s3fs.s3client.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+			Bucket:          aws.String(s3fs.bucket),
+			Prefix:          aws.String(key),
+			KeyMarker:       keyMarker,
+			VersionIdMarker: versionMarker,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// the prefix also matches longer keys, such as backups with a suffix
+		for _, version := range listRes.Versions {
+			if aws.ToString(version.Key) == key {
+				ov.versions = append(ov.versions, version)
+			}
+		}
+		for _, marker := range listRes.DeleteMarkers {
+			if aws.ToString(marker.Key) == key {
+				ov.deleteMarkers = append(ov.deleteMarkers, marker)
+			}
+		}
+
+		// keys are listed in order so there is nothing more to find once past the key
+		if !aws.ToBool(listRes.IsTruncated) || aws.ToString(listRes.NextKeyMarker) > key {
+			break
+		}
+
+		keyMarker = listRes.NextKeyMarker
+		versionMarker = listRes.NextVersionIdMarker
+	}
+
+	if len(ov.versions) == 0 && len(ov.deleteMarkers) == 0 {
+		return nil, fs.ErrNotExist
+	}
+
+	for _, version := range ov.versions {
+		if id := aws.ToString(version.VersionId); id != "" && id != "null" {
+			return &ov, nil
+		}
+	}
+	for _, marker := range ov.deleteMarkers {
+		if id := aws.ToString(marker.VersionId); id != "" && id != "null" {
+			return &ov, nil
+		}
+	}
+
+	return nil, ErrVersioningDisabled
+}
+
+// ObjectVersion describes a version, or delete marker, of an object returned by IterateVersions.
+type ObjectVersion struct {
+	// Key is the key of the object in the bucket.
+	Key string
+	// VersionID identifies the version, this is "null" for objects written before versioning was enabled.
+	VersionID string
+	// IsLatest is true for the current version of the key.
+	IsLatest bool
+	// IsDeleteMarker is true if the key was deleted in this version, delete markers have no size or ETag.
+	IsDeleteMarker bool
+	// Size is the length of the version in bytes.
+	Size int64
+	// ModTime is when the version was created.
+	ModTime time.Time
+	// ETag is the entity tag of the version.
+	ETag string
+}
+
+// IterateVersions returns an iterator over every version and delete marker of the keys starting
+// with prefix, including those which are no longer current.
+//
+// Note:
+//   - The prefix is matched against keys as is, use a trailing slash to only match a directory.
+//     An empty prefix or "." iterates over the whole bucket.
+//   - Keys are in lexical order, and the versions of each key are newest first.
+//   - Versions are listed with ListObjectVersions a page at a time as the iteration proceeds, an
+//     error stops the iteration after it is yielded.
+func (s3fs *S3FS) IterateVersions(ctx context.Context, prefix string) iter.Seq2[ObjectVersion, error] {
+	if prefix == "." {
+		prefix = ""
+	}
+
+	return func(yield func(ObjectVersion, error) bool) {
+		input := &s3.ListObjectVersionsInput{
+			Bucket: aws.String(s3fs.bucket),
+			Prefix: aws.String(prefix),
+		}
+
+		for {
+			listRes, err := s3fs.s3client.ListObjectVersions(ctx, input)
+			if err != nil {
+				yield(ObjectVersion{}, pathError("versions", prefix, err))
+				return
+			}
+
+			for _, version := range pageVersions(listRes) {
+				if !yield(version, nil) {
+					return
+				}
+			}
+
+			if !aws.ToBool(listRes.IsTruncated) {
+				return
+			}
+
+			// both markers are needed to resume part way through the versions of a key
+			input.KeyMarker = listRes.NextKeyMarker
+			input.VersionIdMarker = listRes.NextVersionIdMarker
+		}
+	}
+}
+
+// WalkVersions calls fn for every version and delete marker of the keys starting with prefix, in
+// the order of IterateVersions.
+//
+// Note:
+//   - Walking stops when fn returns an error, which is returned, or fs.SkipAll, in which case nil is returned.
+func (s3fs *S3FS) WalkVersions(prefix string, fn func(version ObjectVersion) error) error {
+	for version, err := range s3fs.IterateVersions(s3fs.context(), prefix) {
+		if err != nil {
+			return err
+		}
+
+		if err := fn(version); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pageVersions merges the versions and delete markers of a page, which the sdk returns as separate
+// lists, back into the order s3 lists them.
+func pageVersions(listRes *s3.ListObjectVersionsOutput) []ObjectVersion {
+	versions := make([]ObjectVersion, 0, len(listRes.Versions)+len(listRes.DeleteMarkers))
+
+	for _, version := range listRes.Versions {
+		versions = append(versions, ObjectVersion{
+			Key:       aws.ToString(version.Key),
+			VersionID: aws.ToString(version.VersionId),
+			IsLatest:  aws.ToBool(version.IsLatest),
+			Size:      aws.ToInt64(version.Size),
+			ModTime:   aws.ToTime(version.LastModified),
+			ETag:      aws.ToString(version.ETag),
+		})
+	}
+
+	for _, marker := range listRes.DeleteMarkers {
+		versions = append(versions, ObjectVersion{
+			Key:            aws.ToString(marker.Key),
+			VersionID:      aws.ToString(marker.VersionId),
+			IsLatest:       aws.ToBool(marker.IsLatest),
+			IsDeleteMarker: true,
+			ModTime:        aws.ToTime(marker.LastModified),
+		})
+	}
+
+	// keys ascending, then newest first with the latest version breaking ties in modification time
+	slices.SortStableFunc(versions, func(a, b ObjectVersion) int {
+		if c := cmp.Compare(a.Key, b.Key); c != 0 {
+			return c
+		}
+		if c := b.ModTime.Compare(a.ModTime); c != 0 {
+			return c
+		}
+		switch {
+		case a.IsLatest && !b.IsLatest:
+			return -1
+		case b.IsLatest && !a.IsLatest:
+			return 1
+		}
+		return 0
+	})
+
+	return versions
+}
@@ -0,0 +1,525 @@
+package s3iofs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_RestoreVersion(t *testing.T) {
+	newFS := func(t *testing.T) (*fakes3.Backend, *S3FS, []*UploadResult) {
+		backend := fakes3.New("fooBucket")
+		backend.EnableVersioning("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		var versions []*UploadResult
+		for i := 1; i <= 3; i++ {
+			res, err := s3fs.WriteFileResult("config.json", []byte(fmt.Sprintf("v%d", i)), 0644,
+				WithContentType("application/json"), WithMetadata(map[string]string{"revision": fmt.Sprint(i)}))
+			require.NoError(t, err)
+			versions = append(versions, res)
+		}
+
+		return backend, s3fs, versions
+	}
+
+	t.Run("restore", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs, versions := newFS(t)
+
+		res, err := s3fs.RestoreVersion(context.Background(), "config.json", versions[0].VersionID)
+		assert.NoError(err)
+		assert.Equal("config.json", res.Key)
+		assert.NotEmpty(res.ETag)
+		assert.NotEqual(versions[2].VersionID, res.VersionID)
+
+		obj := backend.Get("fooBucket", "config.json")
+		assert.Equal("v1", string(obj.Data))
+		assert.Equal("application/json", obj.ContentType)
+		assert.Equal(map[string]string{"revision": "1"}, obj.Metadata)
+		assert.Equal(res.VersionID, obj.VersionID)
+	})
+
+	t.Run("restore a deleted file", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs, versions := newFS(t)
+
+		err := s3fs.Remove("config.json")
+		assert.NoError(err)
+
+		_, err = s3fs.RestoreVersion(context.Background(), "config.json", versions[2].VersionID)
+		assert.NoError(err)
+		assert.Equal("v3", string(backend.Get("fooBucket", "config.json").Data))
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs, _ := newFS(t)
+		backend.Put("fooBucket", "config.json.bak", []byte("backup"))
+
+		_, err := s3fs.RestoreVersion(context.Background(), "config.json", "missing")
+		assert.ErrorIs(err, ErrVersionNotFound)
+
+		_, err = s3fs.RestoreVersion(context.Background(), "other.json", "missing")
+		assert.ErrorIs(err, fs.ErrNotExist)
+		assert.Equal(0, backend.Calls("CopyObject"))
+	})
+
+	t.Run("delete marker", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, s3fs, _ := newFS(t)
+
+		removed, err := s3fs.RemoveResult("config.json")
+		assert.NoError(err)
+
+		_, err = s3fs.RestoreVersion(context.Background(), "config.json", removed.VersionID)
+		assert.ErrorIs(err, ErrDeleteMarker)
+	})
+
+	t.Run("versioning disabled", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.Put("fooBucket", "config.json", []byte("v1"))
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		_, err := s3fs.RestoreVersion(context.Background(), "config.json", "null")
+		assert.ErrorIs(err, ErrVersioningDisabled)
+
+		_, err = s3fs.RollbackLatest(context.Background(), "config.json")
+		assert.ErrorIs(err, ErrVersioningDisabled)
+	})
+}
+
+func TestS3FS_RollbackLatest(t *testing.T) {
+	t.Run("previous version", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.EnableVersioning("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		for i := 1; i <= 3; i++ {
+			_, err := s3fs.WriteFileResult("config.json", []byte(fmt.Sprintf("v%d", i)), 0644)
+			assert.NoError(err)
+		}
+
+		_, err := s3fs.RollbackLatest(context.Background(), "config.json")
+		assert.NoError(err)
+		assert.Equal("v2", string(backend.Get("fooBucket", "config.json").Data))
+
+		// rolling back again undoes the rollback
+		_, err = s3fs.RollbackLatest(context.Background(), "config.json")
+		assert.NoError(err)
+		assert.Equal("v3", string(backend.Get("fooBucket", "config.json").Data))
+	})
+
+	t.Run("delete marker is latest", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.EnableVersioning("fooBucket")
+		backend.Put("fooBucket", "config.json", []byte("v1"))
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		err := s3fs.Remove("config.json")
+		assert.NoError(err)
+
+		_, err = s3fs.RollbackLatest(context.Background(), "config.json")
+		assert.ErrorIs(err, ErrDeleteMarker)
+	})
+
+	t.Run("single version", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+		backend.EnableVersioning("fooBucket")
+		backend.Put("fooBucket", "config.json", []byte("v1"))
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		_, err := s3fs.RollbackLatest(context.Background(), "config.json")
+		assert.ErrorIs(err, ErrVersionNotFound)
+	})
+}
+
+func TestS3FS_IterateVersions(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	backend.EnableVersioning("fooBucket")
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend.Now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	put := func(key, data string) {
+		_, err := s3fs.WriteFileResult(key, []byte(data), 0o644)
+		require.NoError(t, err)
+	}
+	remove := func(key string) {
+		require.NoError(t, s3fs.Remove(key))
+	}
+
+	put("data/a.txt", "a1")
+	put("data/b.txt", "b1")
+	put("data/a.txt", "a22")
+	remove("data/a.txt")
+	remove("data/b.txt")
+	put("data/a.txt", "a333")
+	put("data/c/d.txt", "d1")
+	put("other.txt", "other")
+
+	// list three entries at a time so the versions of a key span pages
+	backend.OnCall = func(_ context.Context, op string, input any) error {
+		if params, ok := input.(*s3.ListObjectVersionsInput); ok {
+			params.MaxKeys = aws.Int32(3)
+		}
+		return nil
+	}
+
+	type entry struct {
+		Key            string
+		IsLatest       bool
+		IsDeleteMarker bool
+		Size           int64
+	}
+
+	t.Run("iterate", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		var (
+			entries []entry
+			seen    = map[string]bool{}
+			last    time.Time
+		)
+		for version, err := range s3fs.IterateVersions(context.Background(), "data/") {
+			assert.NoError(err)
+			entries = append(entries, entry{version.Key, version.IsLatest, version.IsDeleteMarker, version.Size})
+
+			assert.NotEmpty(version.VersionID)
+			assert.False(seen[version.VersionID])
+			seen[version.VersionID] = true
+
+			if len(entries) > 1 && entries[len(entries)-2].Key == version.Key {
+				assert.True(version.ModTime.Before(last))
+			}
+			last = version.ModTime
+		}
+
+		assert.Equal([]entry{
+			{"data/a.txt", true, false, 4},
+			{"data/a.txt", false, true, 0},
+			{"data/a.txt", false, false, 3},
+			{"data/a.txt", false, false, 2},
+			{"data/b.txt", true, true, 0},
+			{"data/b.txt", false, false, 2},
+			{"data/c/d.txt", true, false, 2},
+		}, entries)
+		assert.Equal(3, backend.Calls("ListObjectVersions"))
+	})
+
+	t.Run("whole bucket", func(t *testing.T) {
+		assert := require.New(t)
+
+		count := 0
+		for _, err := range s3fs.IterateVersions(context.Background(), ".") {
+			assert.NoError(err)
+			count++
+		}
+		assert.Equal(8, count)
+	})
+
+	t.Run("stop early", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		for version := range s3fs.IterateVersions(context.Background(), "data/") {
+			assert.Equal("data/a.txt", version.Key)
+			break
+		}
+		assert.Equal(1, backend.Calls("ListObjectVersions"))
+	})
+
+	t.Run("walk", func(t *testing.T) {
+		assert := require.New(t)
+
+		var etags []string
+		err := s3fs.WalkVersions("data/b", func(version ObjectVersion) error {
+			etags = append(etags, version.ETag)
+			return nil
+		})
+		assert.NoError(err)
+		assert.Len(etags, 2)
+		assert.Empty(etags[0])
+		assert.NotEmpty(etags[1])
+
+		visited := 0
+		err = s3fs.WalkVersions("data/", func(version ObjectVersion) error {
+			visited++
+			return fs.SkipAll
+		})
+		assert.NoError(err)
+		assert.Equal(1, visited)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.OnCall = func(_ context.Context, op string, _ any) error {
+			return &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+		}
+		defer func() { backend.OnCall = nil }()
+
+		err := s3fs.WalkVersions("data/", func(version ObjectVersion) error {
+			return nil
+		})
+		assert.ErrorContains(err, "AccessDenied")
+	})
+}
+
+func TestS3FS_RemoveVersion(t *testing.T) {
+	newFS := func(t *testing.T) (*fakes3.Backend, *S3FS, []*UploadResult) {
+		backend := fakes3.New("fooBucket")
+		backend.EnableVersioning("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		var versions []*UploadResult
+		for i := 1; i <= 2; i++ {
+			res, err := s3fs.WriteFileResult("config.json", []byte(fmt.Sprintf("v%d", i)), 0644)
+			require.NoError(t, err)
+			versions = append(versions, res)
+		}
+
+		return backend, s3fs, versions
+	}
+
+	t.Run("removes the version without a delete marker", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, s3fs, versions := newFS(t)
+
+		err := s3fs.RemoveVersion("config.json", versions[1].VersionID)
+		assert.NoError(err)
+
+		// the previous version is now the current one
+		data, err := fs.ReadFile(s3fs, "config.json")
+		assert.NoError(err)
+		assert.Equal("v1", string(data))
+
+		err = s3fs.RemoveVersion("config.json", versions[0].VersionID)
+		assert.NoError(err)
+
+		_, err = s3fs.Stat("config.json")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		var found int
+		for _, err := range s3fs.IterateVersions(context.Background(), "config.json") {
+			assert.NoError(err)
+			found++
+		}
+		assert.Equal(0, found)
+	})
+
+	t.Run("removing a delete marker restores the file", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, s3fs, _ := newFS(t)
+
+		res, err := s3fs.RemoveResult("config.json")
+		assert.NoError(err)
+		assert.True(res.DeleteMarkerCreated)
+
+		err = s3fs.RemoveVersion("config.json", res.VersionID)
+		assert.NoError(err)
+
+		data, err := fs.ReadFile(s3fs, "config.json")
+		assert.NoError(err)
+		assert.Equal("v2", string(data))
+	})
+
+	t.Run("unknown version and invalid arguments", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend, s3fs, _ := newFS(t)
+
+		err := s3fs.RemoveVersion("config.json", "12345")
+		assert.ErrorIs(err, fs.ErrNotExist)
+		assert.ErrorIs(err, ErrVersionNotFound)
+
+		err = s3fs.RemoveVersion("missing.json", "1")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		assert.ErrorIs(s3fs.RemoveVersion("config.json", ""), fs.ErrInvalid)
+		assert.ErrorIs(s3fs.RemoveVersion("/config.json", "1"), fs.ErrInvalid)
+
+		assert.Equal(0, backend.Calls("DeleteObject"))
+	})
+
+	t.Run("version id is sent with the delete", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("HeadObject", mock.Anything, mock.MatchedBy(func(params *s3.HeadObjectInput) bool {
+			return aws.ToString(params.Key) == "config.json" && aws.ToString(params.VersionId) == "v1"
+		}), mock.Anything).Return(&s3.HeadObjectOutput{VersionId: aws.String("v1")}, nil).Once()
+
+		mockClient.On("DeleteObject", mock.Anything, mock.MatchedBy(func(params *s3.DeleteObjectInput) bool {
+			return aws.ToString(params.Key) == "config.json" && aws.ToString(params.VersionId) == "v1"
+		}), mock.Anything).Return(&s3.DeleteObjectOutput{VersionId: aws.String("v1")}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.RemoveVersion("config.json", "v1")
+		assert.NoError(err)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("delete failure", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("HeadObject", mock.Anything, mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{}, nil).Once()
+		mockClient.On("DeleteObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.DeleteObjectOutput)(nil),
+			&smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.RemoveVersion("config.json", "v1")
+
+		var pathErr *fs.PathError
+		assert.ErrorAs(err, &pathErr)
+		assert.Equal("remove", pathErr.Op)
+		assert.ErrorContains(err, "AccessDenied")
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestS3FS_OpenVersion(t *testing.T) {
+	newFS := func(t *testing.T, opts ...Option) (*S3FS, []*UploadResult) {
+		backend := fakes3.New("fooBucket")
+		backend.EnableVersioning("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend, opts...)
+
+		var versions []*UploadResult
+		for _, data := range []string{"first version", "second"} {
+			res, err := s3fs.WriteFileResult("config.json", []byte(data), 0644)
+			require.NoError(t, err)
+			versions = append(versions, res)
+		}
+
+		return s3fs, versions
+	}
+
+	t.Run("reads each version by id", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs, versions := newFS(t)
+
+		for i, want := range []string{"first version", "second"} {
+			f, err := s3fs.OpenVersion("config.json", versions[i].VersionID)
+			assert.NoError(err)
+
+			data, err := io.ReadAll(f)
+			assert.NoError(err)
+			assert.Equal(want, string(data))
+
+			buf := make([]byte, 3)
+			_, err = f.(io.ReaderAt).ReadAt(buf, 3)
+			assert.NoError(err)
+			assert.Equal(want[3:6], string(buf))
+
+			info, err := f.Stat()
+			assert.NoError(err)
+			assert.Equal(int64(len(want)), info.Size())
+			assert.Equal(versions[i].VersionID, f.(File).VersionID())
+
+			// the head of the file is made for its version
+			assert.NoError(f.(File).Refresh(context.Background()))
+			assert.Equal(int64(len(want)), info.Size())
+			assert.Equal(versions[i].ETag, f.(File).ETag())
+
+			assert.NoError(f.Close())
+		}
+	})
+
+	t.Run("open pins the version it saw", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs, versions := newFS(t)
+
+		f, err := s3fs.OpenObject("config.json")
+		assert.NoError(err)
+		defer f.Close()
+
+		assert.Equal(versions[1].VersionID, f.VersionID())
+
+		_, err = s3fs.WriteFileResult("config.json", []byte("third version"), 0644)
+		assert.NoError(err)
+
+		buf := make([]byte, 3)
+		_, err = f.ReadAt(buf, 3)
+		assert.NoError(err)
+		assert.Equal("ond", string(buf))
+
+		assert.NoError(f.Refresh(context.Background()))
+		assert.Equal(int64(len("second")), f.(fs.FileInfo).Size())
+	})
+
+	t.Run("without pinning open reads the current version", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs, _ := newFS(t, WithoutETagPinning())
+
+		f, err := s3fs.OpenObject("config.json")
+		assert.NoError(err)
+		defer f.Close()
+
+		assert.Empty(f.VersionID())
+	})
+
+	t.Run("missing versions", func(t *testing.T) {
+		assert := require.New(t)
+
+		s3fs, _ := newFS(t)
+
+		_, err := s3fs.OpenVersion("config.json", "missing")
+		assert.ErrorIs(err, ErrVersionNotFound)
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, err = s3fs.OpenVersion("config.json", "")
+		assert.ErrorIs(err, fs.ErrInvalid)
+
+		_, err = s3fs.OpenVersion(".", "missing")
+		assert.ErrorIs(err, fs.ErrInvalid)
+	})
+}
@@ -0,0 +1,123 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// WalkDirParallel walks the tree rooted at root like fs.WalkDir, calling fn for each file or
+// directory, but lists the directories at each level of the tree concurrently.
+//
+// Note:
+//   - Directories are visited breadth first, a level at a time, the directories of a level are
+//     visited in the order they were found and the entries of each directory in name order.
+//   - At most concurrency directories are listed at once, zero or less uses the default of the
+//     bulk operations.
+//   - fn is never called concurrently, so it doesn't need to be safe for concurrent use.
+//   - If fn returns fs.SkipDir for a directory it isn't listed, for a file the remaining entries of
+//     its directory are skipped, fs.SkipAll stops the walk and any other error is returned.
+//   - Unlike fs.WalkDir, a failed listing isn't passed to fn, the lists still in flight are
+//     cancelled and the errors of the level are returned joined.
+func (s3fs *S3FS) WalkDirParallel(ctx context.Context, root string, concurrency int, fn fs.WalkDirFunc) error {
+	if !fs.ValidPath(root) {
+		return &fs.PathError{Op: opRead, Path: root, Err: fs.ErrInvalid}
+	}
+
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+
+	info, err := s3fs.StatContext(ctx, root)
+	if err != nil {
+		return walkObjectsError(fn(root, nil, err))
+	}
+
+	err = fn(root, fs.FileInfoToDirEntry(info), nil)
+	if err != nil || !info.IsDir() {
+		return walkObjectsError(err)
+	}
+
+	for level := []string{root}; len(level) > 0; {
+		entries, err := s3fs.readDirs(ctx, level, concurrency)
+		if err != nil {
+			return err
+		}
+
+		var next []string
+
+	dirs:
+		for i, dir := range level {
+			for _, entry := range entries[i] {
+				name := path.Join(dir, entry.Name())
+
+				err := fn(name, entry, nil)
+				switch {
+				case errors.Is(err, fs.SkipDir):
+					if !entry.IsDir() {
+						continue dirs
+					}
+				case err != nil:
+					return walkObjectsError(err)
+				case entry.IsDir():
+					next = append(next, name)
+				}
+			}
+		}
+
+		level = next
+	}
+
+	return nil
+}
+
+// readDirs lists the named directories concurrently, returning the sorted entries of each, the
+// first failure cancels the other lists.
+func (s3fs *S3FS) readDirs(ctx context.Context, dirs []string, concurrency int) ([][]fs.DirEntry, error) {
+	parent := ctx
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		errs    []error
+		entries = make([][]fs.DirEntry, len(dirs))
+	)
+
+	runConcurrently(concurrency, len(dirs), func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := s3fs.ReadDirPages(ctx, dirs[i], 0, func(page []fs.DirEntry, _ bool) error {
+			entries[i] = append(entries[i], page...)
+			return nil
+		})
+		if err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// lists cancelled because of another failure aren't errors of their own
+			if len(errs) == 0 || !errors.Is(err, context.Canceled) {
+				errs = append(errs, err)
+			}
+			cancel()
+			return
+		}
+
+		sortEntries(entries[i])
+	})
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,131 @@
+package s3iofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_WalkDirParallel(t *testing.T) {
+	backend := fakes3.New("fooBucket")
+	var want []string
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 2; k++ {
+				key := fmt.Sprintf("tree/a%d/b%d/c%d.txt", i, j, k)
+				backend.Put("fooBucket", key, []byte("data"))
+				want = append(want, key)
+			}
+			want = append(want, fmt.Sprintf("tree/a%d/b%d", i, j))
+		}
+		want = append(want, fmt.Sprintf("tree/a%d", i))
+	}
+	want = append(want, "tree")
+	sort.Strings(want)
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("visits every path once", func(t *testing.T) {
+		assert := require.New(t)
+
+		var (
+			inFn    bool
+			visited []string
+		)
+
+		err := s3fs.WalkDirParallel(context.Background(), "tree", 4, func(name string, d fs.DirEntry, err error) error {
+			assert.False(inFn, "fn called concurrently")
+			inFn = true
+			defer func() { inFn = false }()
+
+			assert.NoError(err)
+			visited = append(visited, name)
+			return nil
+		})
+		assert.NoError(err)
+
+		// breadth first
+		assert.Equal([]string{"tree", "tree/a0", "tree/a1", "tree/a2", "tree/a0/b0"}, visited[:5])
+
+		sort.Strings(visited)
+		assert.Equal(want, visited)
+	})
+
+	t.Run("skip dir prunes the subtree", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		var visited []string
+		err := s3fs.WalkDirParallel(context.Background(), "tree", 4, func(name string, d fs.DirEntry, err error) error {
+			assert.NoError(err)
+			visited = append(visited, name)
+			if name == "tree/a1" || name == "tree/a0/b0/c0.txt" {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		assert.NoError(err)
+		assert.NotContains(visited, "tree/a1/b0")
+		assert.NotContains(visited, "tree/a0/b0/c1.txt")
+		assert.Contains(visited, "tree/a2/b2/c1.txt")
+
+		// the stat of the root, then tree, a0, a2 and their six subdirectories
+		assert.Equal(10, backend.Calls("ListObjectsV2"))
+	})
+
+	t.Run("skip all and errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		visited := 0
+		err := s3fs.WalkDirParallel(context.Background(), "tree", 4, func(name string, d fs.DirEntry, err error) error {
+			visited++
+			if visited == 3 {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		assert.NoError(err)
+		assert.Equal(3, visited)
+
+		errStop := errors.New("stop")
+		err = s3fs.WalkDirParallel(context.Background(), "tree", 4, func(name string, d fs.DirEntry, err error) error {
+			if name == "tree/a1" {
+				return errStop
+			}
+			return nil
+		})
+		assert.ErrorIs(err, errStop)
+
+		err = s3fs.WalkDirParallel(context.Background(), "missing", 4, func(name string, d fs.DirEntry, err error) error {
+			return err
+		})
+		assert.ErrorIs(err, fs.ErrNotExist)
+	})
+
+	t.Run("list failures are joined", func(t *testing.T) {
+		assert := require.New(t)
+
+		errA0 := errors.New("a0 failed")
+		backend.OnCall = func(_ context.Context, op string, input any) error {
+			if in, ok := input.(*s3.ListObjectsV2Input); ok && aws.ToString(in.Prefix) == "tree/a0/" {
+				return errA0
+			}
+			return nil
+		}
+		defer func() { backend.OnCall = nil }()
+
+		err := s3fs.WalkDirParallel(context.Background(), "tree", 1, func(name string, d fs.DirEntry, err error) error {
+			return nil
+		})
+		assert.ErrorIs(err, errA0)
+	})
+}
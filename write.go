@@ -0,0 +1,514 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ErrPreconditionFailed is matched by the error returned when a write made with WithIfMatch finds
+// the object has changed, the caller should read the object again before retrying.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// WriteOption configures how an object is written to s3.
+type WriteOption func(*writeOptions)
+
+// writeOptions holds the settings collected from the WriteOption values passed to a write.
+type writeOptions struct {
+	contentType  string
+	noDetect     bool
+	metadata     map[string]string
+	tags         map[string]string
+	storageClass types.StorageClass
+
+	checksumAlgorithm types.ChecksumAlgorithm
+
+	cacheControl       string
+	contentDisposition string
+	contentEncoding    string
+	expires            time.Time
+
+	serverSideEncryption types.ServerSideEncryption
+	sseKMSKeyID          string
+
+	ifNoneMatch bool
+	ifMatch     string
+}
+
+// newWriteOptions applies the defaults of the filesystem followed by the options, returning an
+// error if the settings can't be stored.
+func (s3fs *S3FS) newWriteOptions(opts []WriteOption) (*writeOptions, error) {
+	wo := &writeOptions{}
+	for _, opt := range s3fs.opts.writeDefaults {
+		opt(wo)
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	metadata, err := normaliseAttrs(wo.metadata)
+	if err != nil {
+		return nil, err
+	}
+	wo.metadata = metadata
+
+	if err := validateStorageClass(wo.storageClass); err != nil {
+		return nil, err
+	}
+	if err := validateChecksumAlgorithm(wo.checksumAlgorithm); err != nil {
+		return nil, err
+	}
+	if err := validateTags(wo.tags); err != nil {
+		return nil, err
+	}
+
+	return wo, nil
+}
+
+// applyPutObject copies the write settings onto the PutObject request.
+func (wo *writeOptions) applyPutObject(req *s3.PutObjectInput) {
+	if wo.contentType != "" {
+		req.ContentType = aws.String(wo.contentType)
+	}
+	if len(wo.metadata) > 0 {
+		req.Metadata = wo.metadata
+	}
+	if len(wo.tags) > 0 {
+		req.Tagging = aws.String(encodeTags(wo.tags))
+	}
+	if wo.storageClass != "" {
+		req.StorageClass = wo.storageClass
+	}
+	if wo.serverSideEncryption != "" {
+		req.ServerSideEncryption = wo.serverSideEncryption
+	}
+	if wo.sseKMSKeyID != "" {
+		req.SSEKMSKeyId = aws.String(wo.sseKMSKeyID)
+	}
+	if wo.checksumAlgorithm != "" {
+		req.ChecksumAlgorithm = wo.checksumAlgorithm
+	}
+	if wo.cacheControl != "" {
+		req.CacheControl = aws.String(wo.cacheControl)
+	}
+	if wo.contentDisposition != "" {
+		req.ContentDisposition = aws.String(wo.contentDisposition)
+	}
+	if wo.contentEncoding != "" {
+		req.ContentEncoding = aws.String(wo.contentEncoding)
+	}
+	if !wo.expires.IsZero() {
+		req.Expires = aws.Time(wo.expires)
+	}
+	if wo.ifNoneMatch {
+		req.IfNoneMatch = aws.String("*")
+	}
+}
+
+// applyCreateMultipartUpload copies the write settings onto the CreateMultipartUpload request.
+func (wo *writeOptions) applyCreateMultipartUpload(req *s3.CreateMultipartUploadInput) {
+	if wo.contentType != "" {
+		req.ContentType = aws.String(wo.contentType)
+	}
+	if len(wo.metadata) > 0 {
+		req.Metadata = wo.metadata
+	}
+	if len(wo.tags) > 0 {
+		req.Tagging = aws.String(encodeTags(wo.tags))
+	}
+	if wo.storageClass != "" {
+		req.StorageClass = wo.storageClass
+	}
+	if wo.serverSideEncryption != "" {
+		req.ServerSideEncryption = wo.serverSideEncryption
+	}
+	if wo.sseKMSKeyID != "" {
+		req.SSEKMSKeyId = aws.String(wo.sseKMSKeyID)
+	}
+	if wo.checksumAlgorithm != "" {
+		req.ChecksumAlgorithm = wo.checksumAlgorithm
+	}
+	if wo.cacheControl != "" {
+		req.CacheControl = aws.String(wo.cacheControl)
+	}
+	if wo.contentDisposition != "" {
+		req.ContentDisposition = aws.String(wo.contentDisposition)
+	}
+	if wo.contentEncoding != "" {
+		req.ContentEncoding = aws.String(wo.contentEncoding)
+	}
+	if !wo.expires.IsZero() {
+		req.Expires = aws.Time(wo.expires)
+	}
+}
+
+// applyCopyObject copies the write settings onto the CopyObject request, which replaces the metadata
+// and tags of the source when they are set.
+func (wo *writeOptions) applyCopyObject(req *s3.CopyObjectInput) {
+	req.MetadataDirective = types.MetadataDirectiveReplace
+	req.TaggingDirective = types.TaggingDirectiveCopy
+
+	if wo.contentType != "" {
+		req.ContentType = aws.String(wo.contentType)
+	}
+	if len(wo.metadata) > 0 {
+		req.Metadata = wo.metadata
+	}
+	if len(wo.tags) > 0 {
+		req.TaggingDirective = types.TaggingDirectiveReplace
+		req.Tagging = aws.String(encodeTags(wo.tags))
+	}
+	if wo.storageClass != "" {
+		req.StorageClass = wo.storageClass
+	}
+	if wo.serverSideEncryption != "" {
+		req.ServerSideEncryption = wo.serverSideEncryption
+	}
+	if wo.sseKMSKeyID != "" {
+		req.SSEKMSKeyId = aws.String(wo.sseKMSKeyID)
+	}
+	if wo.checksumAlgorithm != "" {
+		req.ChecksumAlgorithm = wo.checksumAlgorithm
+	}
+	if wo.cacheControl != "" {
+		req.CacheControl = aws.String(wo.cacheControl)
+	}
+	if wo.contentDisposition != "" {
+		req.ContentDisposition = aws.String(wo.contentDisposition)
+	}
+	if wo.contentEncoding != "" {
+		req.ContentEncoding = aws.String(wo.contentEncoding)
+	}
+	if !wo.expires.IsZero() {
+		req.Expires = aws.Time(wo.expires)
+	}
+}
+
+// WithContentType sets the Content-Type of the stored object, this replaces the type detected from
+// the name or content of the file.
+func WithContentType(contentType string) WriteOption {
+	return func(wo *writeOptions) {
+		wo.contentType = contentType
+	}
+}
+
+// WithCacheControl sets the Cache-Control header returned when the object is read, such as
+// "public, max-age=3600" for objects served through a CDN.
+func WithCacheControl(cacheControl string) WriteOption {
+	return func(wo *writeOptions) {
+		wo.cacheControl = cacheControl
+	}
+}
+
+// WithContentDisposition sets the Content-Disposition header returned when the object is read, such
+// as `attachment; filename="report.csv"`.
+func WithContentDisposition(contentDisposition string) WriteOption {
+	return func(wo *writeOptions) {
+		wo.contentDisposition = contentDisposition
+	}
+}
+
+// WithContentEncoding sets the Content-Encoding header returned when the object is read, such as
+// "gzip" for data which is already compressed, the data is stored as is.
+func WithContentEncoding(contentEncoding string) WriteOption {
+	return func(wo *writeOptions) {
+		wo.contentEncoding = contentEncoding
+	}
+}
+
+// WithExpires sets the Expires header returned when the object is read, this is only used by caches
+// and doesn't remove the object, see ExpiresAt for the expiration set by a lifecycle rule.
+func WithExpires(expires time.Time) WriteOption {
+	return func(wo *writeOptions) {
+		wo.expires = expires
+	}
+}
+
+// WithIfNoneMatch only writes the object if it doesn't already exist, a write which finds an
+// existing object fails with fs.ErrExist.
+//
+// Note:
+//   - The condition is checked by s3 when the object is stored, so it guards against a concurrent
+//     writer of the same name.
+//   - Multipart uploads check the condition when the upload is completed, so the parts are still
+//     sent before an existing object is found.
+func WithIfNoneMatch() WriteOption {
+	return func(wo *writeOptions) {
+		wo.ifNoneMatch = true
+	}
+}
+
+// WithIfMatch only writes the object if its ETag is still etag, such as the ETag of a File or
+// UploadResult, a write which finds the object has changed fails with ErrPreconditionFailed.
+//
+// Note:
+//   - This allows a read, modify and write to be retried when another writer gets in first.
+//   - A write which finds the object has been removed fails with fs.ErrNotExist.
+//   - Multipart uploads check the condition when the upload is completed.
+func WithIfMatch(etag string) WriteOption {
+	return func(wo *writeOptions) {
+		wo.ifMatch = etag
+	}
+}
+
+// clientOptions returns the options of the requests which store the object, the version of the sdk
+// used doesn't model If-Match on these requests so the header is added directly.
+func (wo *writeOptions) clientOptions() []func(*s3.Options) {
+	if wo.ifMatch == "" {
+		return nil
+	}
+
+	return []func(*s3.Options){func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("If-Match", wo.ifMatch))
+	}}
+}
+
+// writeError returns the error for a failed write of the named object, a failed WithIfNoneMatch
+// condition is returned as fs.ErrExist and a failed WithIfMatch as ErrPreconditionFailed.
+func (wo *writeOptions) writeError(name string, err error) *fs.PathError {
+	switch {
+	case wo.ifNoneMatch && isPreconditionFailed(err):
+		return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("%w: %w", fs.ErrExist, withResponseInfo(err))}
+	case wo.ifMatch != "" && isPreconditionFailed(err):
+		return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("%w: %w", ErrPreconditionFailed, withResponseInfo(err))}
+	case wo.ifMatch != "" && isNotFound(err):
+		return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("%w: %w", fs.ErrNotExist, withResponseInfo(err))}
+	}
+
+	return pathError("write", name, err)
+}
+
+// WithDefaultWriteOptions sets the write options applied to every object written by the filesystem,
+// the options passed to a write are applied after these so replace them.
+func WithDefaultWriteOptions(opts ...WriteOption) Option {
+	return func(fo *fsOptions) {
+		fo.writeDefaults = append(fo.writeDefaults, opts...)
+	}
+}
+
+// WithoutContentTypeDetection disables the detection of the Content-Type of the stored object, so
+// objects written without WithContentType are given the default type of s3.
+func WithoutContentTypeDetection() WriteOption {
+	return func(wo *writeOptions) {
+		wo.noDetect = true
+	}
+}
+
+// detectContentType sets the Content-Type from the extension of the name, or by sniffing the start of
+// r, unless it was set by an option. The returned reader must be used in place of r.
+func (wo *writeOptions) detectContentType(name string, r io.Reader) (io.Reader, error) {
+	if wo.contentType != "" || wo.noDetect {
+		return r, nil
+	}
+
+	contentType, r, err := detectContentType(name, r)
+	if err != nil {
+		return nil, err
+	}
+	wo.contentType = contentType
+
+	return r, nil
+}
+
+// WithMetadata sets the user metadata of the stored object, these are sent as x-amz-meta-* headers
+// and read back with the Metadata method of File.
+//
+// Note:
+//   - s3 lowercases metadata keys, so keys are lowercased and those which only differ by case are rejected.
+//   - Keys must be valid http header names, so can't contain spaces, and values are limited to
+//     printable US-ASCII.
+//   - The total size of the keys and values is limited to 2KB, this is checked before any request is made.
+//   - Multiple options are merged, with later values replacing earlier ones.
+func WithMetadata(metadata map[string]string) WriteOption {
+	return func(wo *writeOptions) {
+		if wo.metadata == nil {
+			wo.metadata = make(map[string]string, len(metadata))
+		}
+		for k, v := range metadata {
+			wo.metadata[k] = v
+		}
+	}
+}
+
+// UploadResult describes the object stored in s3 by a write.
+type UploadResult struct {
+	// Key is the key of the object in the bucket.
+	Key string
+	// ETag is the entity tag returned by s3 for the stored object.
+	ETag string
+	// VersionID is the version of the stored object, this is empty if the bucket isn't versioned.
+	VersionID string
+}
+
+// WriteFrom writes the data read from r until EOF to the named file in s3 and returns the metadata
+// of the stored object.
+//
+// Note:
+//   - Readers which don't implement io.Seeker are spooled before the upload so the sdk can replay
+//     the body when a request is retried, see WithSpoolMemoryThreshold and WithSpoolDir.
+//   - The object is stored with a single PutObject so is limited to 5GiB.
+//   - If the file exists, WriteFrom overwrites it.
+func (s3fs *S3FS) WriteFrom(name string, r io.Reader, opts ...WriteOption) (*UploadResult, error) {
+	return s3fs.writeFrom(s3fs.context(), name, r, opts...)
+}
+
+// WriteReader writes size bytes read from r to the named file in s3, a size of -1 reads r until EOF.
+//
+// Note:
+//   - When size is known and within the multipart threshold the data is stored with a single
+//     PutObject, spooling r if it doesn't implement io.Seeker, see WithSpoolMemoryThreshold.
+//   - Otherwise r is streamed through a multipart upload one part at a time, so only a part is held
+//     in memory. A stream of unknown size which fits in a single part uses PutObject.
+//   - If reading r or uploading a part fails the multipart upload is aborted, so no partial object
+//     is left behind, and r isn't read any further.
+//   - If the file exists, WriteReader overwrites it.
+func (s3fs *S3FS) WriteReader(name string, r io.Reader, size int64, opts ...WriteOption) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	wo, err := s3fs.newWriteOptions(opts)
+	if err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+
+	return s3fs.writeReader(s3fs.context(), name, r, size, wo)
+}
+
+func (s3fs *S3FS) writeReader(ctx context.Context, name string, r io.Reader, size int64, wo *writeOptions) error {
+	r, err := wo.detectContentType(name, r)
+	if err != nil {
+		return pathError("write", name, err)
+	}
+
+	if size >= 0 && size <= s3fs.opts.multipartThreshold {
+		return s3fs.writeSized(ctx, name, limitReader(r, size), size, wo)
+	}
+
+	partSize := int64(DefaultPartSize)
+	if size >= 0 {
+		partSize = uploadPartSize(size)
+		r = io.LimitReader(r, size)
+	}
+
+	first, err := readPart(r, make([]byte, partSize))
+	if err != nil {
+		return pathError("write", name, err)
+	}
+
+	// a stream which fits in a single part doesn't need a multipart upload
+	if size < 0 && int64(len(first)) < partSize {
+		return s3fs.writeSized(ctx, name, bytes.NewReader(first), int64(len(first)), wo)
+	}
+
+	if _, err := s3fs.multipartUploadFrom(ctx, name, first, r, size, partSize, wo); err != nil {
+		return wo.writeError(name, err)
+	}
+
+	return nil
+}
+
+// limitReader returns a reader of the next n bytes of r, readers such as files and bytes.Reader
+// are returned as a section so they can be uploaded without spooling.
+func limitReader(r io.Reader, n int64) io.Reader {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return io.LimitReader(r, n)
+	}
+
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return io.LimitReader(r, n)
+	}
+
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return io.LimitReader(r, n)
+	}
+
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return io.LimitReader(r, n)
+	}
+
+	return io.NewSectionReader(ra, offset, min(n, end-offset))
+}
+
+// writeSized stores exactly size bytes from r with a single PutObject.
+func (s3fs *S3FS) writeSized(ctx context.Context, name string, r io.Reader, size int64, wo *writeOptions) error {
+	body, n, err := s3fs.replayable(r)
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	defer body.Close()
+
+	if n != size {
+		return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("read %d of %d bytes: %w", n, size, io.ErrUnexpectedEOF)}
+	}
+
+	req := &s3.PutObjectInput{
+		Bucket:        aws.String(s3fs.bucket),
+		Key:           aws.String(name),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	}
+
+	wo.applyPutObject(req)
+
+	if _, err := s3fs.s3client.PutObject(ctx, req, wo.clientOptions()...); err != nil {
+		return wo.writeError(name, err)
+	}
+
+	return nil
+}
+
+func (s3fs *S3FS) writeFrom(ctx context.Context, name string, r io.Reader, opts ...WriteOption) (*UploadResult, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	wo, err := s3fs.newWriteOptions(opts)
+	if err != nil {
+		return nil, &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+
+	r, err = wo.detectContentType(name, r)
+	if err != nil {
+		return nil, pathError("write", name, err)
+	}
+
+	body, size, err := s3fs.replayable(r)
+	if err != nil {
+		return nil, pathError("write", name, err)
+	}
+	defer body.Close()
+
+	req := &s3.PutObjectInput{
+		Bucket:        aws.String(s3fs.bucket),
+		Key:           aws.String(name),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	}
+
+	wo.applyPutObject(req)
+
+	res, err := s3fs.s3client.PutObject(ctx, req, wo.clientOptions()...)
+	if err != nil {
+		return nil, wo.writeError(name, err)
+	}
+
+	return &UploadResult{
+		Key:       name,
+		ETag:      aws.ToString(res.ETag),
+		VersionID: aws.ToString(res.VersionId),
+	}, nil
+}
@@ -0,0 +1,218 @@
+package s3iofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+func TestS3FS_WriteHeaders(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	defaults := WithDefaultWriteOptions(
+		WithCacheControl("public, max-age=60"),
+		WithContentEncoding("gzip"),
+		WithMetadata(map[string]string{"producer": "default", "team": "data"}),
+	)
+
+	t.Run("put object", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+			return aws.ToString(params.CacheControl) == "public, max-age=3600" &&
+				aws.ToString(params.ContentDisposition) == `attachment; filename="report.csv"` &&
+				aws.ToString(params.ContentEncoding) == "gzip" &&
+				aws.ToTime(params.Expires).Equal(expires) &&
+				aws.ToString(params.ContentType) == "text/csv; charset=utf-8" &&
+				params.Metadata["producer"] == "report" && params.Metadata["team"] == "data"
+		}), mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient, defaults)
+
+		_, err := s3fs.WriteFileResult("report.csv", []byte("a,b"), 0o644,
+			WithCacheControl("public, max-age=3600"),
+			WithContentDisposition(`attachment; filename="report.csv"`),
+			WithExpires(expires),
+			WithMetadata(map[string]string{"producer": "report"}),
+		)
+		assert.NoError(err)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend, defaults, WithMultipartThreshold(DefaultPartSize))
+
+		err := s3fs.WriteReader("large.bin", bytes.NewReader(make([]byte, DefaultPartSize+1)), -1,
+			WithContentDisposition("attachment"),
+			WithExpires(expires),
+		)
+		assert.NoError(err)
+
+		res, err := backend.HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("fooBucket"),
+			Key:    aws.String("large.bin"),
+		})
+		assert.NoError(err)
+		assert.Equal("public, max-age=60", aws.ToString(res.CacheControl))
+		assert.Equal("attachment", aws.ToString(res.ContentDisposition))
+		assert.Equal("gzip", aws.ToString(res.ContentEncoding))
+		assert.Equal(expires, aws.ToTime(res.Expires))
+		assert.Equal(map[string]string{"producer": "default", "team": "data"}, res.Metadata)
+	})
+}
+
+func TestS3FS_WriteIfNoneMatch(t *testing.T) {
+	t.Run("put object", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		ifNoneMatch := mock.MatchedBy(func(params *s3.PutObjectInput) bool {
+			return aws.ToString(params.IfNoneMatch) == "*"
+		})
+
+		mockClient.On("PutObject", mock.Anything, ifNoneMatch, mock.Anything).Return(&s3.PutObjectOutput{ETag: aws.String(`"abc"`)}, nil).Once()
+		mockClient.On("PutObject", mock.Anything, ifNoneMatch, mock.Anything).Return((*s3.PutObjectOutput)(nil),
+			operationError(412, "ABC123", &smithy.GenericAPIError{Code: "PreconditionFailed"})).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		res, err := s3fs.WriteFileResult("test.txt", []byte("data"), 0o644, WithIfNoneMatch())
+		assert.NoError(err)
+		assert.Equal(`"abc"`, res.ETag)
+
+		_, err = s3fs.WriteFileResult("test.txt", []byte("data"), 0o644, WithIfNoneMatch())
+		assert.ErrorIs(err, fs.ErrExist)
+
+		var pathErr *fs.PathError
+		assert.True(errors.As(err, &pathErr))
+		assert.Equal("write", pathErr.Op)
+		assert.Equal("test.txt", pathErr.Path)
+
+		var respErr *ResponseError
+		assert.True(errors.As(err, &respErr))
+		assert.Equal(412, respErr.StatusCode)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("precondition failures without the option", func(t *testing.T) {
+		assert := require.New(t)
+
+		mockClient := new(mockS3Client)
+
+		mockClient.On("PutObject", mock.Anything, mock.Anything, mock.Anything).Return((*s3.PutObjectOutput)(nil),
+			operationError(412, "ABC123", &smithy.GenericAPIError{Code: "PreconditionFailed"})).Once()
+
+		s3fs := NewWithClient("fooBucket", mockClient)
+
+		err := s3fs.WriteFile("test.txt", []byte("data"), 0o644)
+		assert.Error(err)
+		assert.NotErrorIs(err, fs.ErrExist)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("multipart upload", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend, WithMultipartThreshold(DefaultPartSize))
+
+		data := make([]byte, DefaultPartSize+1)
+
+		err := s3fs.WriteReader("large.bin", bytes.NewReader(data), -1, WithIfNoneMatch())
+		assert.NoError(err)
+
+		err = s3fs.WriteReader("large.bin", bytes.NewReader(data), -1, WithIfNoneMatch())
+		assert.ErrorIs(err, fs.ErrExist)
+		assert.Equal(2, backend.Calls("CompleteMultipartUpload"))
+		assert.Equal(1, backend.Calls("AbortMultipartUpload"))
+
+		// without the option the object is replaced
+		err = s3fs.WriteReader("large.bin", bytes.NewReader(data), -1)
+		assert.NoError(err)
+	})
+
+	t.Run("open file exclusive", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend := fakes3.New("fooBucket")
+
+		s3fs := NewWithClient("fooBucket", backend)
+
+		f, err := s3fs.OpenFile("exclusive.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		assert.NoError(err)
+
+		// another writer creates the file after it was opened
+		backend.Put("fooBucket", "exclusive.txt", []byte("other"))
+
+		_, err = f.(io.Writer).Write([]byte("data"))
+		assert.NoError(err)
+		assert.ErrorIs(f.Close(), fs.ErrExist)
+
+		assert.Equal("other", string(backend.Get("fooBucket", "exclusive.txt").Data))
+	})
+}
+
+func TestS3FS_WriteIfMatch(t *testing.T) {
+	assert := require.New(t)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "counter.txt", []byte("1"))
+
+	// the header is added to the request so this is checked by the server
+	srv, client := fakes3.NewServer(backend)
+	defer srv.Close()
+
+	s3fs := NewWithClient("fooBucket", client)
+
+	info, err := s3fs.StatObject("counter.txt")
+	assert.NoError(err)
+	etag := info.(File).ETag()
+
+	res, err := s3fs.WriteFileResult("counter.txt", []byte("2"), 0o644, WithIfMatch(etag))
+	assert.NoError(err)
+	assert.NotEqual(etag, res.ETag)
+
+	// the etag read before the last write is stale
+	_, err = s3fs.WriteFileResult("counter.txt", []byte("3"), 0o644, WithIfMatch(etag))
+	assert.ErrorIs(err, ErrPreconditionFailed)
+	assert.NotErrorIs(err, fs.ErrExist)
+
+	var pathErr *fs.PathError
+	assert.True(errors.As(err, &pathErr))
+	assert.Equal("counter.txt", pathErr.Path)
+
+	data, err := fs.ReadFile(s3fs, "counter.txt")
+	assert.NoError(err)
+	assert.Equal("2", string(data))
+
+	// retrying with the current etag succeeds
+	err = s3fs.WriteReader("counter.txt", strings.NewReader("3"), 1, WithIfMatch(res.ETag))
+	assert.NoError(err)
+
+	_, err = s3fs.WriteFileResult("missing.txt", []byte("1"), 0o644, WithIfMatch(etag))
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
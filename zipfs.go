@@ -0,0 +1,232 @@
+package s3iofs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// zipTailSize is the amount of the end of an archive which is prefetched, this matches the window
+	// archive/zip searches for the end of central directory record, which is followed by a comment
+	// of up to 64KiB.
+	zipTailSize = 65 * 1024
+	// zipReadAheadSize is the minimum size of the ranged reads used for member headers and data, so
+	// small members are read with a single request.
+	zipReadAheadSize = 1024 * 1024
+
+	eocdSignature        = 0x06054b50
+	eocdLen              = 22
+	zip64LocatorSig      = 0x07064b50
+	zip64LocatorLen      = 20
+	zip64EOCDSignature   = 0x06064b50
+	zip64EOCDFixedLength = 56
+)
+
+var _ io.ReaderAt = (*zipReaderAt)(nil)
+
+// OpenZipFS opens the named zip archive and returns its contents as a fs.FS, along with a closer
+// which releases the data cached while reading the archive.
+//
+// The end of the archive containing the central directory is fetched up front, usually with a
+// single ranged GetObject, members are then read with ranged requests of at least 1MiB. Reads are
+// pinned to the ETag of the archive when it was opened, so a replaced archive returns an error
+// rather than mixing data from two objects.
+func (s3fs *S3FS) OpenZipFS(name string) (fs.FS, io.Closer, error) {
+	info, err := s3fs.StatObject(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	ra := &zipReaderAt{
+		s3client: s3fs.s3client,
+		ctx:      s3fs.context(),
+		bucket:   s3fs.bucket,
+		key:      name,
+		etag:     info.(File).ETag(),
+		size:     info.Size(),
+	}
+
+	if err := ra.prefetchDirectory(ra.ctx); err != nil {
+		return nil, nil, err
+	}
+
+	zr, err := zip.NewReader(ra, ra.size)
+	if err != nil {
+		return nil, nil, pathError("open", name, err)
+	}
+
+	return zr, ra, nil
+}
+
+// zipReaderAt provides random access to an archive in s3, caching the end of the archive and the
+// most recent block read.
+type zipReaderAt struct {
+	s3client S3API
+	ctx      context.Context
+	bucket   string
+	key      string
+	etag     string
+	size     int64
+
+	mu       sync.Mutex
+	tail     []byte
+	tailOff  int64
+	block    []byte
+	blockOff int64
+	closed   bool
+}
+
+func (z *zipReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.closed {
+		return 0, &fs.PathError{Op: opRead, Path: z.key, Err: fs.ErrClosed}
+	}
+
+	if off < 0 {
+		return 0, &fs.PathError{Op: opRead, Path: z.key, Err: fs.ErrInvalid}
+	}
+
+	if off >= z.size {
+		return 0, io.EOF
+	}
+
+	end := min(off+int64(len(p)), z.size)
+
+	var n int
+
+	switch {
+	case z.tail != nil && off >= z.tailOff:
+		n = copy(p, z.tail[off-z.tailOff:])
+	case z.block != nil && off >= z.blockOff && end <= z.blockOff+int64(len(z.block)):
+		n = copy(p, z.block[off-z.blockOff:])
+	default:
+		length := min(max(int64(len(p)), zipReadAheadSize), z.size-off)
+
+		block, err := z.fetch(z.ctx, off, length)
+		if err != nil {
+			return 0, err
+		}
+
+		z.block, z.blockOff = block, off
+		n = copy(p, block)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Close releases the cached data, reads after Close return fs.ErrClosed.
+func (z *zipReaderAt) Close() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.tail, z.block, z.closed = nil, nil, true
+
+	return nil
+}
+
+// prefetchDirectory caches the end of the archive, extending it to the start of the central
+// directory when the directory is larger than the tail.
+func (z *zipReaderAt) prefetchDirectory(ctx context.Context) error {
+	tailLen := min(z.size, zipTailSize)
+	if tailLen == 0 {
+		return nil
+	}
+
+	tail, err := z.fetch(ctx, z.size-tailLen, tailLen)
+	if err != nil {
+		return err
+	}
+
+	z.tail, z.tailOff = tail, z.size-tailLen
+
+	// a zip64 record before the tail needs a second fetch to find the directory
+	for {
+		start, ok := directoryStart(z.tail, z.tailOff)
+		if !ok || start >= z.tailOff || start < 0 {
+			// malformed archives are reported by archive/zip
+			return nil
+		}
+
+		head, err := z.fetch(ctx, start, z.tailOff-start)
+		if err != nil {
+			return err
+		}
+
+		z.tail, z.tailOff = append(head, z.tail...), start
+	}
+}
+
+func (z *zipReaderAt) fetch(ctx context.Context, offset, length int64) ([]byte, error) {
+	res, err := z.s3client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(z.bucket),
+		Key:     aws.String(z.key),
+		Range:   buildRange(offset, length),
+		IfMatch: aws.String(z.etag),
+	})
+	if err != nil {
+		return nil, pathError(opRead, z.key, err)
+	}
+	defer res.Body.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(res.Body, data); err != nil {
+		return nil, pathError(opRead, z.key, err)
+	}
+
+	return data, nil
+}
+
+// directoryStart locates the end of central directory record in the tail of the archive and returns
+// the offset of the central directory, or of the zip64 end of central directory record if it
+// comes first.
+func directoryStart(tail []byte, tailOff int64) (int64, bool) {
+	pos := -1
+	for i := len(tail) - eocdLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == eocdSignature {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return 0, false
+	}
+
+	start := int64(binary.LittleEndian.Uint32(tail[pos+16:]))
+
+	// zip64 archives store the directory offset in a record located by the zip64 locator
+	loc := pos - zip64LocatorLen
+	if loc < 0 || binary.LittleEndian.Uint32(tail[loc:]) != zip64LocatorSig {
+		return start, true
+	}
+
+	recordOff := int64(binary.LittleEndian.Uint64(tail[loc+8:]))
+
+	rel := recordOff - tailOff
+	if rel < 0 || rel+zip64EOCDFixedLength > int64(len(tail)) {
+		// the record is before the tail, so fetch from it and let archive/zip parse it
+		return recordOff, true
+	}
+
+	if binary.LittleEndian.Uint32(tail[rel:]) != zip64EOCDSignature {
+		return 0, false
+	}
+
+	return min(int64(binary.LittleEndian.Uint64(tail[rel+48:])), recordOff), true
+}
@@ -0,0 +1,128 @@
+package s3iofs
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wolfeidau/s3iofs/internal/fakes3"
+)
+
+// buildZip returns an archive with many small members, and a large member which is stored
+// without compression so its size is predictable.
+func buildZip(t *testing.T, members int, large []byte) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for i := 0; i < members; i++ {
+		w, err := zw.Create(fmt.Sprintf("data/%04d/member.txt", i))
+		require.NoError(t, err)
+		_, err = fmt.Fprintf(w, "member %d", i)
+		require.NoError(t, err)
+	}
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "large.bin", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = w.Write(large)
+	require.NoError(t, err)
+
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func TestS3FS_OpenZipFS(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 3*1024*1024/16)
+
+	backend := fakes3.New("fooBucket")
+	backend.Put("fooBucket", "dataset.zip", buildZip(t, 3000, large))
+	backend.Put("fooBucket", "small.zip", buildZip(t, 10, []byte("large")))
+	backend.Put("fooBucket", "not-a-zip.txt", []byte("plain text"))
+
+	s3fs := NewWithClient("fooBucket", backend)
+
+	t.Run("directory is read with few requests", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		zfs, closer, err := s3fs.OpenZipFS("dataset.zip")
+		assert.NoError(err)
+		defer closer.Close()
+
+		// the tail, then the rest of the central directory which is larger than the tail
+		assert.Equal(1, backend.Calls("HeadObject"))
+		assert.Equal(2, backend.Calls("GetObject"))
+
+		entries, err := fs.ReadDir(zfs, "data")
+		assert.NoError(err)
+		assert.Len(entries, 3000)
+		assert.Equal(2, backend.Calls("GetObject"))
+
+		// a small member is read with a single request
+		data, err := fs.ReadFile(zfs, "data/1500/member.txt")
+		assert.NoError(err)
+		assert.Equal("member 1500", string(data))
+		assert.Equal(3, backend.Calls("GetObject"))
+
+		// neighbouring members are served from the same block
+		data, err = fs.ReadFile(zfs, "data/1501/member.txt")
+		assert.NoError(err)
+		assert.Equal("member 1501", string(data))
+		assert.Equal(3, backend.Calls("GetObject"))
+
+		backend.ResetCalls()
+
+		data, err = fs.ReadFile(zfs, "large.bin")
+		assert.NoError(err)
+		assert.Equal(large, data)
+		assert.LessOrEqual(backend.Calls("GetObject"), 4)
+	})
+
+	t.Run("small archive is read with one request", func(t *testing.T) {
+		assert := require.New(t)
+
+		backend.ResetCalls()
+
+		zfs, closer, err := s3fs.OpenZipFS("small.zip")
+		assert.NoError(err)
+
+		err = fstest.TestFS(zfs, "data/0000/member.txt", "large.bin")
+		assert.NoError(err)
+		assert.Equal(1, backend.Calls("GetObject"))
+
+		assert.NoError(closer.Close())
+
+		_, err = fs.ReadFile(zfs, "data/0001/member.txt")
+		assert.ErrorIs(err, fs.ErrClosed)
+	})
+
+	t.Run("archive replaced after open", func(t *testing.T) {
+		assert := require.New(t)
+
+		zfs, closer, err := s3fs.OpenZipFS("dataset.zip")
+		assert.NoError(err)
+		defer closer.Close()
+
+		backend.Put("fooBucket", "dataset.zip", buildZip(t, 3000, []byte("changed")))
+
+		_, err = fs.ReadFile(zfs, "data/0000/member.txt")
+		assert.ErrorContains(err, "PreconditionFailed")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, _, err := s3fs.OpenZipFS("missing.zip")
+		assert.ErrorIs(err, fs.ErrNotExist)
+
+		_, _, err = s3fs.OpenZipFS("not-a-zip.txt")
+		assert.ErrorIs(err, zip.ErrFormat)
+	})
+}